@@ -0,0 +1,6 @@
+package blocklist
+
+import "errors"
+
+// ErrInvalidDomain is returned when a blocklist entry is not a blockable domain name
+var ErrInvalidDomain = errors.New("invalid domain")
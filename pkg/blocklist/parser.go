@@ -0,0 +1,231 @@
+package blocklist
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strings"
+)
+
+// Format represents the syntax of a blocklist source
+type Format string
+
+const (
+	FormatAuto    Format = "auto"    // 行ごとに形式を自動判定
+	FormatHosts   Format = "hosts"   // hostsファイル形式 (例: "0.0.0.0 example.com")
+	FormatDomains Format = "domains" // 1行1ドメインのプレーンテキスト
+	FormatAdblock Format = "adblock" // AdBlock Plus形式 (例: "||example.com^")
+)
+
+// maxLineSize is the maximum length of a single line in a blocklist source
+const maxLineSize = 1024 * 1024
+
+// reservedHostnames are entries commonly found in hosts files that must never be blocked
+var reservedHostnames = map[string]bool{
+	"localhost":             true,
+	"localhost.localdomain": true,
+	"local":                 true,
+	"broadcasthost":         true,
+	"ip6-localhost":         true,
+	"ip6-loopback":          true,
+	"ip6-localnet":          true,
+	"ip6-mcastprefix":       true,
+	"ip6-allnodes":          true,
+	"ip6-allrouters":        true,
+	"ip6-allhosts":          true,
+	"0.0.0.0":               true,
+}
+
+// Result holds the outcome of parsing a blocklist source
+type Result struct {
+	Domains []string // 正規化・重複排除・ソート済みのドメイン一覧
+	Lines   int      // コメント・空行を除いた有効行数
+	Skipped int      // ドメインを取り出せなかった行数
+}
+
+// ParseFormat converts a string into a Format
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimSpace(s))); f {
+	case "":
+		return FormatAuto, nil
+	case FormatAuto, FormatHosts, FormatDomains, FormatAdblock:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown blocklist format: %q (must be auto, hosts, domains, or adblock)", s)
+	}
+}
+
+// Parse reads a blocklist source and returns the normalized, deduplicated domains it contains
+func Parse(r io.Reader, format Format) (*Result, error) {
+	if _, err := ParseFormat(string(format)); err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+
+	seen := make(map[string]bool)
+	result := &Result{}
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if isComment(line) {
+			continue
+		}
+		result.Lines++
+
+		lineFormat := format
+		if lineFormat == FormatAuto {
+			lineFormat = detectFormat(line)
+		}
+
+		var candidates []string
+		switch lineFormat {
+		case FormatHosts:
+			candidates = parseHostsLine(line)
+		case FormatAdblock:
+			candidates = parseAdblockLine(line)
+		default:
+			candidates = parseDomainsLine(line)
+		}
+
+		found := false
+		for _, candidate := range candidates {
+			domain, err := NormalizeDomain(candidate)
+			if err != nil {
+				continue
+			}
+			found = true
+			if !seen[domain] {
+				seen[domain] = true
+				result.Domains = append(result.Domains, domain)
+			}
+		}
+		if !found {
+			result.Skipped++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read blocklist: %w", err)
+	}
+
+	slices.Sort(result.Domains)
+	return result, nil
+}
+
+// NormalizeDomain lowercases and validates a domain name.
+// A leading wildcard label ("*.") and a trailing dot are removed.
+func NormalizeDomain(s string) (string, error) {
+	domain := strings.ToLower(strings.TrimSpace(s))
+	domain = strings.TrimPrefix(domain, "*.")
+	domain = strings.TrimSuffix(domain, ".")
+
+	if domain == "" {
+		return "", fmt.Errorf("empty domain: %w", ErrInvalidDomain)
+	}
+	if len(domain) > 253 {
+		return "", fmt.Errorf("domain too long: %q: %w", domain, ErrInvalidDomain)
+	}
+	if reservedHostnames[domain] {
+		return "", fmt.Errorf("reserved hostname: %q: %w", domain, ErrInvalidDomain)
+	}
+	if net.ParseIP(domain) != nil {
+		return "", fmt.Errorf("IP address is not a domain: %q: %w", domain, ErrInvalidDomain)
+	}
+
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return "", fmt.Errorf("domain must have at least two labels: %q: %w", domain, ErrInvalidDomain)
+	}
+	for _, label := range labels {
+		if !isValidLabel(label) {
+			return "", fmt.Errorf("invalid label %q in domain %q: %w", label, domain, ErrInvalidDomain)
+		}
+	}
+
+	return domain, nil
+}
+
+// isValidLabel reports whether a single DNS label is acceptable.
+// Underscores are allowed because they appear in real-world blocklists (e.g. tracking subdomains).
+func isValidLabel(label string) bool {
+	if label == "" || len(label) > 63 {
+		return false
+	}
+	if label[0] == '-' || label[len(label)-1] == '-' {
+		return false
+	}
+	for _, c := range label {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// isComment reports whether a line carries no entries (blank, comment or AdBlock header)
+func isComment(line string) bool {
+	return line == "" ||
+		strings.HasPrefix(line, "#") ||
+		strings.HasPrefix(line, "!") ||
+		strings.HasPrefix(line, "[")
+}
+
+// detectFormat guesses the format of a single line
+func detectFormat(line string) Format {
+	if strings.HasPrefix(line, "||") || strings.HasPrefix(line, "@@") {
+		return FormatAdblock
+	}
+	fields := strings.Fields(line)
+	if len(fields) > 1 && net.ParseIP(fields[0]) != nil {
+		return FormatHosts
+	}
+	return FormatDomains
+}
+
+// stripInlineComment removes a trailing "# ..." comment from a line
+func stripInlineComment(line string) string {
+	if i := strings.Index(line, "#"); i >= 0 {
+		return line[:i]
+	}
+	return line
+}
+
+// parseHostsLine extracts hostnames from a hosts file line ("<ip> <host> [<host>...]")
+func parseHostsLine(line string) []string {
+	fields := strings.Fields(stripInlineComment(line))
+	if len(fields) < 2 || net.ParseIP(fields[0]) == nil {
+		return nil
+	}
+	return fields[1:]
+}
+
+// parseDomainsLine extracts the domain from a plain domain list line
+func parseDomainsLine(line string) []string {
+	fields := strings.Fields(stripInlineComment(line))
+	if len(fields) != 1 {
+		return nil
+	}
+	return fields
+}
+
+// parseAdblockLine extracts the domain from an AdBlock Plus "||domain^" rule.
+// Exception rules (@@), rules with options, paths or wildcards are skipped
+// because they cannot be expressed as a whole-domain block.
+func parseAdblockLine(line string) []string {
+	if !strings.HasPrefix(line, "||") {
+		return nil
+	}
+	rule := strings.TrimPrefix(line, "||")
+	domain, rest, found := strings.Cut(rule, "^")
+	if !found || rest != "" {
+		return nil
+	}
+	if strings.ContainsAny(domain, "/*") {
+		return nil
+	}
+	return []string{domain}
+}
@@ -0,0 +1,141 @@
+package blocklist
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		format      Format
+		wantDomains []string
+		wantLines   int
+		wantSkipped int
+		wantErr     bool
+	}{
+		{
+			name: "hosts file",
+			input: `# comment
+127.0.0.1 localhost
+0.0.0.0 ads.example.com tracker.example.com # inline comment
+0.0.0.0 ADS.example.com
+`,
+			format:      FormatHosts,
+			wantDomains: []string{"ads.example.com", "tracker.example.com"},
+			wantLines:   3,
+			wantSkipped: 1,
+		},
+		{
+			name: "plain domains",
+			input: `example.com
+*.wildcard.example.org
+trailing.example.net.
+
+not a domain
+`,
+			format:      FormatDomains,
+			wantDomains: []string{"example.com", "trailing.example.net", "wildcard.example.org"},
+			wantLines:   4,
+			wantSkipped: 1,
+		},
+		{
+			name: "adblock plus",
+			input: `[Adblock Plus 2.0]
+! Title: test list
+||ads.example.com^
+||tracker.example.com^$third-party
+@@||allowed.example.com^
+||example.com/path^
+||*.example.org^
+`,
+			format:      FormatAdblock,
+			wantDomains: []string{"ads.example.com"},
+			wantLines:   5,
+			wantSkipped: 4,
+		},
+		{
+			name: "auto detects each line",
+			input: `0.0.0.0 hosts.example.com
+||adblock.example.com^
+plain.example.com
+plain.example.com
+`,
+			format:      FormatAuto,
+			wantDomains: []string{"adblock.example.com", "hosts.example.com", "plain.example.com"},
+			wantLines:   4,
+			wantSkipped: 0,
+		},
+		{
+			name:    "unknown format",
+			input:   "example.com",
+			format:  Format("csv"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Parse(strings.NewReader(tt.input), tt.format)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantDomains, result.Domains)
+			assert.Equal(t, tt.wantLines, result.Lines)
+			assert.Equal(t, tt.wantSkipped, result.Skipped)
+		})
+	}
+}
+
+func TestNormalizeDomain(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "lowercases", input: "WWW.Example.COM", want: "www.example.com"},
+		{name: "strips wildcard and trailing dot", input: "*.example.com.", want: "example.com"},
+		{name: "allows underscore", input: "_dmarc.example.com", want: "_dmarc.example.com"},
+		{name: "rejects single label", input: "intranet", wantErr: true},
+		{name: "rejects localhost", input: "localhost", wantErr: true},
+		{name: "rejects IP address", input: "192.168.1.1", wantErr: true},
+		{name: "rejects leading hyphen", input: "-bad.example.com", wantErr: true},
+		{name: "rejects empty label", input: "bad..example.com", wantErr: true},
+		{name: "rejects invalid character", input: "bad!.example.com", wantErr: true},
+		{name: "rejects too long label", input: strings.Repeat("a", 64) + ".com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeDomain(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.True(t, errors.Is(err, ErrInvalidDomain))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	f, err := ParseFormat("")
+	require.NoError(t, err)
+	assert.Equal(t, FormatAuto, f)
+
+	f, err = ParseFormat("Hosts")
+	require.NoError(t, err)
+	assert.Equal(t, FormatHosts, f)
+
+	_, err = ParseFormat("csv")
+	assert.Error(t, err)
+}
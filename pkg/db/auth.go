@@ -0,0 +1,237 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+)
+
+// User, API token and session repository operations.
+// Passwords and tokens are hashed by the caller; only their hashes are passed in.
+
+const userColumns = `id, username, password_hash, role, created_at, updated_at`
+
+// CreateUser inserts a new user
+func (db *DB) CreateUser(ctx context.Context, username, passwordHash string, role UserRole) (*User, error) {
+	query := `INSERT INTO users (username, password_hash, role) VALUES ($1, $2, $3) RETURNING ` + userColumns
+	rows, err := db.pool.Query(ctx, query, username, passwordHash, role)
+	if err != nil {
+		db.log.Error("Failed to create user", zap.String("username", username), zap.Error(err))
+		return nil, fmt.Errorf("failed to create user %s: %w", username, err)
+	}
+	user, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[User])
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, fmt.Errorf("failed to create user %s: %w", username, ErrUserAlreadyExists)
+		}
+		db.log.Error("Failed to create user", zap.String("username", username), zap.Error(err))
+		return nil, fmt.Errorf("failed to create user %s: %w", username, err)
+	}
+
+	db.log.Info("User created successfully", zap.String("username", username), zap.String("role", string(role)))
+	return &user, nil
+}
+
+// GetUsers retrieves all users ordered by username
+func (db *DB) GetUsers(ctx context.Context) ([]User, error) {
+	query := `SELECT ` + userColumns + ` FROM users ORDER BY username`
+	rows, err := db.pool.Query(ctx, query)
+	if err != nil {
+		db.log.Error("Failed to get users", zap.Error(err))
+		return nil, fmt.Errorf("failed to get users: %w", err)
+	}
+	users, err := pgx.CollectRows(rows, pgx.RowToStructByName[User])
+	if err != nil {
+		db.log.Error("Failed to scan user rows", zap.Error(err))
+		return nil, fmt.Errorf("failed to scan user rows: %w", err)
+	}
+	return users, nil
+}
+
+// GetUserByUsername retrieves a user by name
+func (db *DB) GetUserByUsername(ctx context.Context, username string) (*User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE username = $1`
+	return db.getUser(ctx, "username", username, query, username)
+}
+
+// SetUserPassword replaces the password hash of a user
+func (db *DB) SetUserPassword(ctx context.Context, username, passwordHash string) error {
+	query := `UPDATE users SET password_hash = $2 WHERE username = $1`
+	tag, err := db.pool.Exec(ctx, query, username, passwordHash)
+	if err != nil {
+		db.log.Error("Failed to set user password", zap.String("username", username), zap.Error(err))
+		return fmt.Errorf("failed to set password of user %s: %w", username, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to set password of user %s: %w", username, ErrUserNotFound)
+	}
+	return nil
+}
+
+// DeleteUser deletes a user along with its API tokens and sessions.
+// The last admin cannot be deleted so that the service always stays manageable.
+func (db *DB) DeleteUser(ctx context.Context, username string) error {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		db.log.Error("Failed to begin transaction", zap.Error(err))
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		// Commit済みの場合Rollbackは何もしない
+		_ = tx.Rollback(ctx)
+	}()
+
+	// 同時に複数のadminを削除して0人になることを防ぐため、adminの行をロックする
+	rows, err := tx.Query(ctx, `SELECT username FROM users WHERE role = $1 FOR UPDATE`, UserRoleAdmin)
+	if err != nil {
+		db.log.Error("Failed to lock admin users", zap.Error(err))
+		return fmt.Errorf("failed to lock admin users: %w", err)
+	}
+	admins, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return fmt.Errorf("failed to lock admin users: %w", err)
+	}
+	if len(admins) == 1 && admins[0] == username {
+		return fmt.Errorf("failed to delete user %s: %w", username, ErrLastAdmin)
+	}
+
+	tag, err := tx.Exec(ctx, `DELETE FROM users WHERE username = $1`, username)
+	if err != nil {
+		db.log.Error("Failed to delete user", zap.String("username", username), zap.Error(err))
+		return fmt.Errorf("failed to delete user %s: %w", username, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to delete user %s: %w", username, ErrUserNotFound)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		db.log.Error("Failed to commit user deletion", zap.String("username", username), zap.Error(err))
+		return fmt.Errorf("failed to commit user deletion: %w", err)
+	}
+
+	db.log.Info("User deleted successfully", zap.String("username", username))
+	return nil
+}
+
+// CreateAPIToken stores the hash of a new API token of a user
+func (db *DB) CreateAPIToken(ctx context.Context, userID int64, name, tokenHash string) (*APIToken, error) {
+	query := `INSERT INTO api_tokens (user_id, name, token_hash) VALUES ($1, $2, $3)
+	          RETURNING id, user_id, name, created_at, last_used_at`
+	rows, err := db.pool.Query(ctx, query, userID, name, tokenHash)
+	if err != nil {
+		db.log.Error("Failed to create API token", zap.Int64("user_id", userID), zap.Error(err))
+		return nil, fmt.Errorf("failed to create API token: %w", err)
+	}
+	token, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[APIToken])
+	if err != nil {
+		db.log.Error("Failed to create API token", zap.Int64("user_id", userID), zap.Error(err))
+		return nil, fmt.Errorf("failed to create API token: %w", err)
+	}
+	return &token, nil
+}
+
+// GetAPITokens retrieves the API tokens of a user, newest first
+func (db *DB) GetAPITokens(ctx context.Context, userID int64) ([]APIToken, error) {
+	query := `SELECT id, user_id, name, created_at, last_used_at FROM api_tokens
+	          WHERE user_id = $1 ORDER BY id DESC`
+	rows, err := db.pool.Query(ctx, query, userID)
+	if err != nil {
+		db.log.Error("Failed to get API tokens", zap.Int64("user_id", userID), zap.Error(err))
+		return nil, fmt.Errorf("failed to get API tokens: %w", err)
+	}
+	tokens, err := pgx.CollectRows(rows, pgx.RowToStructByName[APIToken])
+	if err != nil {
+		db.log.Error("Failed to scan API token rows", zap.Error(err))
+		return nil, fmt.Errorf("failed to scan API token rows: %w", err)
+	}
+	return tokens, nil
+}
+
+// DeleteAPIToken revokes an API token of a user
+func (db *DB) DeleteAPIToken(ctx context.Context, userID, tokenID int64) error {
+	tag, err := db.pool.Exec(ctx, `DELETE FROM api_tokens WHERE id = $1 AND user_id = $2`, tokenID, userID)
+	if err != nil {
+		db.log.Error("Failed to delete API token", zap.Int64("id", tokenID), zap.Error(err))
+		return fmt.Errorf("failed to delete API token %d: %w", tokenID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to delete API token %d: %w", tokenID, ErrAPITokenNotFound)
+	}
+	return nil
+}
+
+// GetUserByAPIToken returns the owner of an API token and records that the token was used
+func (db *DB) GetUserByAPIToken(ctx context.Context, tokenHash string) (*User, error) {
+	query := `WITH token AS (
+	            UPDATE api_tokens SET last_used_at = CURRENT_TIMESTAMP WHERE token_hash = $1 RETURNING user_id
+	          )
+	          SELECT u.id, u.username, u.password_hash, u.role, u.created_at, u.updated_at
+	          FROM users u JOIN token ON token.user_id = u.id`
+	return db.getUser(ctx, "API token", "", query, tokenHash)
+}
+
+// CreateSession stores the hash of a new login session that expires after ttl
+func (db *DB) CreateSession(ctx context.Context, userID int64, tokenHash string, ttl time.Duration) error {
+	// DBのTIMESTAMPはタイムゾーンを持たないため、有効期限はDB側の時刻で計算する
+	query := `INSERT INTO sessions (token_hash, user_id, expires_at)
+	          VALUES ($1, $2, CURRENT_TIMESTAMP + make_interval(secs => $3))`
+	if _, err := db.pool.Exec(ctx, query, tokenHash, userID, ttl.Seconds()); err != nil {
+		db.log.Error("Failed to create session", zap.Int64("user_id", userID), zap.Error(err))
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return nil
+}
+
+// GetUserBySession returns the user of a session that has not expired
+func (db *DB) GetUserBySession(ctx context.Context, tokenHash string) (*User, error) {
+	query := `SELECT u.id, u.username, u.password_hash, u.role, u.created_at, u.updated_at
+	          FROM users u JOIN sessions s ON s.user_id = u.id
+	          WHERE s.token_hash = $1 AND s.expires_at > CURRENT_TIMESTAMP`
+	return db.getUser(ctx, "session", "", query, tokenHash)
+}
+
+// DeleteSession ends a login session. Deleting a session that does not exist is not an error.
+func (db *DB) DeleteSession(ctx context.Context, tokenHash string) error {
+	if _, err := db.pool.Exec(ctx, `DELETE FROM sessions WHERE token_hash = $1`, tokenHash); err != nil {
+		db.log.Error("Failed to delete session", zap.Error(err))
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpiredSessions deletes expired sessions and returns the number of deleted rows
+func (db *DB) DeleteExpiredSessions(ctx context.Context) (int64, error) {
+	tag, err := db.pool.Exec(ctx, `DELETE FROM sessions WHERE expires_at <= CURRENT_TIMESTAMP`)
+	if err != nil {
+		db.log.Error("Failed to delete expired sessions", zap.Error(err))
+		return 0, fmt.Errorf("failed to delete expired sessions: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// getUser runs a query returning a single user. lookup and name describe the lookup for error messages.
+func (db *DB) getUser(ctx context.Context, lookup, name, query string, args ...any) (*User, error) {
+	rows, err := db.pool.Query(ctx, query, args...)
+	if err != nil {
+		db.log.Error("Failed to get user", zap.String("by", lookup), zap.Error(err))
+		return nil, fmt.Errorf("failed to get user by %s: %w", lookup, err)
+	}
+	user, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[User])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			if name != "" {
+				return nil, fmt.Errorf("user %s: %w", name, ErrUserNotFound)
+			}
+			return nil, fmt.Errorf("user by %s: %w", lookup, ErrUserNotFound)
+		}
+		db.log.Error("Failed to scan user row", zap.String("by", lookup), zap.Error(err))
+		return nil, fmt.Errorf("failed to scan user row: %w", err)
+	}
+	return &user, nil
+}
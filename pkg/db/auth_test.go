@@ -0,0 +1,113 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Users(t *testing.T) {
+	testDB := SetupTestDB(t)
+	defer testDB.Cleanup(t)
+	ctx := context.Background()
+
+	admin, err := testDB.DB.CreateUser(ctx, "alice", "hash-a", UserRoleAdmin)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", admin.Username)
+	assert.Equal(t, UserRoleAdmin, admin.Role)
+
+	_, err = testDB.DB.CreateUser(ctx, "alice", "hash-x", UserRoleViewer)
+	assert.True(t, errors.Is(err, ErrUserAlreadyExists))
+
+	_, err = testDB.DB.CreateUser(ctx, "bob", "hash-b", UserRoleViewer)
+	require.NoError(t, err)
+
+	users, err := testDB.DB.GetUsers(ctx)
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+	assert.Equal(t, "alice", users[0].Username)
+	assert.Equal(t, "bob", users[1].Username)
+
+	require.NoError(t, testDB.DB.SetUserPassword(ctx, "bob", "hash-b2"))
+	bob, err := testDB.DB.GetUserByUsername(ctx, "bob")
+	require.NoError(t, err)
+	assert.Equal(t, "hash-b2", bob.PasswordHash)
+
+	_, err = testDB.DB.GetUserByUsername(ctx, "carol")
+	assert.True(t, errors.Is(err, ErrUserNotFound))
+	assert.True(t, errors.Is(testDB.DB.SetUserPassword(ctx, "carol", "x"), ErrUserNotFound))
+
+	// The only admin cannot be deleted
+	assert.True(t, errors.Is(testDB.DB.DeleteUser(ctx, "alice"), ErrLastAdmin))
+	require.NoError(t, testDB.DB.DeleteUser(ctx, "bob"))
+	assert.True(t, errors.Is(testDB.DB.DeleteUser(ctx, "bob"), ErrUserNotFound))
+}
+
+func Test_APITokens(t *testing.T) {
+	testDB := SetupTestDB(t)
+	defer testDB.Cleanup(t)
+	ctx := context.Background()
+
+	user, err := testDB.DB.CreateUser(ctx, "alice", "hash", UserRoleAdmin)
+	require.NoError(t, err)
+
+	token, err := testDB.DB.CreateAPIToken(ctx, user.ID, "backup script", "token-hash")
+	require.NoError(t, err)
+	assert.Equal(t, "backup script", token.Name)
+	assert.Nil(t, token.LastUsedAt)
+
+	owner, err := testDB.DB.GetUserByAPIToken(ctx, "token-hash")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, owner.ID)
+
+	tokens, err := testDB.DB.GetAPITokens(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	assert.NotNil(t, tokens[0].LastUsedAt)
+
+	_, err = testDB.DB.GetUserByAPIToken(ctx, "unknown")
+	assert.True(t, errors.Is(err, ErrUserNotFound))
+
+	// Tokens of other users cannot be deleted
+	assert.True(t, errors.Is(testDB.DB.DeleteAPIToken(ctx, user.ID+1, token.ID), ErrAPITokenNotFound))
+	require.NoError(t, testDB.DB.DeleteAPIToken(ctx, user.ID, token.ID))
+	_, err = testDB.DB.GetUserByAPIToken(ctx, "token-hash")
+	assert.True(t, errors.Is(err, ErrUserNotFound))
+}
+
+func Test_Sessions(t *testing.T) {
+	testDB := SetupTestDB(t)
+	defer testDB.Cleanup(t)
+	ctx := context.Background()
+
+	user, err := testDB.DB.CreateUser(ctx, "alice", "hash", UserRoleViewer)
+	require.NoError(t, err)
+
+	require.NoError(t, testDB.DB.CreateSession(ctx, user.ID, "active", time.Hour))
+	require.NoError(t, testDB.DB.CreateSession(ctx, user.ID, "expired", -time.Hour))
+
+	got, err := testDB.DB.GetUserBySession(ctx, "active")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, got.ID)
+
+	_, err = testDB.DB.GetUserBySession(ctx, "expired")
+	assert.True(t, errors.Is(err, ErrUserNotFound))
+
+	deleted, err := testDB.DB.DeleteExpiredSessions(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	require.NoError(t, testDB.DB.DeleteSession(ctx, "active"))
+	_, err = testDB.DB.GetUserBySession(ctx, "active")
+	assert.True(t, errors.Is(err, ErrUserNotFound))
+
+	// Sessions are deleted with their user
+	require.NoError(t, testDB.DB.CreateSession(ctx, user.ID, "again", time.Hour))
+	require.NoError(t, testDB.DB.DeleteUser(ctx, "alice"))
+	_, err = testDB.DB.GetUserBySession(ctx, "again")
+	assert.True(t, errors.Is(err, ErrUserNotFound))
+}
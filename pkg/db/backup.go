@@ -0,0 +1,289 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// BackupVersion is the version of the configuration backup document written by ExportBackup.
+// Increment it whenever the document layout changes and keep RestoreBackup able to read older versions.
+const BackupVersion = 1
+
+// Backup is a versioned, serializable snapshot of the user-managed configuration.
+// Resolved IPs are not included; they are rebuilt by the batch after a restore.
+// Domains provided by feeds are not included either; they are re-fetched from the feeds.
+type Backup struct {
+	Version    int            `json:"version" yaml:"version"`
+	ExportedAt time.Time      `json:"exported_at" yaml:"exported_at"`
+	Domains    []BackupDomain `json:"domains" yaml:"domains"`
+	Feeds      []BackupFeed   `json:"feeds" yaml:"feeds"`
+}
+
+// BackupDomain is a manually registered domain in a Backup
+type BackupDomain struct {
+	Name   string      `json:"name" yaml:"name"`
+	Action BlockAction `json:"action,omitempty" yaml:"action,omitempty"` // 省略時はdrop
+}
+
+// BackupFeed is a blocklist feed subscription in a Backup
+type BackupFeed struct {
+	URL                    string `json:"url" yaml:"url"`
+	Format                 string `json:"format" yaml:"format"`
+	RefreshIntervalSeconds int    `json:"refresh_interval_seconds" yaml:"refresh_interval_seconds"`
+}
+
+// BackupFormat is the serialization format of a Backup document
+type BackupFormat string
+
+const (
+	BackupFormatJSON BackupFormat = "json"
+	BackupFormatYAML BackupFormat = "yaml"
+)
+
+// RestoreMode determines how RestoreBackup treats data already in the database
+type RestoreMode string
+
+const (
+	// RestoreModeMerge adds entries from the backup and leaves other existing entries untouched
+	RestoreModeMerge RestoreMode = "merge"
+	// RestoreModeReplace makes the database match the backup, deleting entries not contained in it
+	RestoreModeReplace RestoreMode = "replace"
+)
+
+// RestoreResult represents the changes made by RestoreBackup
+type RestoreResult struct {
+	DomainsAdded   int        `json:"domains_added"`
+	DomainsRemoved int        `json:"domains_removed"`
+	FeedsAdded     int        `json:"feeds_added"`
+	FeedsUpdated   int        `json:"feeds_updated"`
+	FeedsRemoved   int        `json:"feeds_removed"`
+	RemovedIPs     []DomainIP `json:"-"` // 削除されたドメインに紐づいていたIP(firewall ruleの削除が必要)
+}
+
+// ParseBackupFormat converts a string into a BackupFormat
+func ParseBackupFormat(s string) (BackupFormat, error) {
+	switch f := BackupFormat(s); f {
+	case BackupFormatJSON, BackupFormatYAML:
+		return f, nil
+	case "yml":
+		return BackupFormatYAML, nil
+	default:
+		return "", fmt.Errorf("unknown backup format: %q (must be json or yaml)", s)
+	}
+}
+
+// ParseRestoreMode converts a string into a RestoreMode
+func ParseRestoreMode(s string) (RestoreMode, error) {
+	switch m := RestoreMode(s); m {
+	case RestoreModeMerge, RestoreModeReplace:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown restore mode: %q (must be merge or replace)", s)
+	}
+}
+
+// EncodeBackup writes a Backup document in the given format
+func EncodeBackup(w io.Writer, backup *Backup, format BackupFormat) error {
+	switch format {
+	case BackupFormatYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(backup); err != nil {
+			return fmt.Errorf("failed to encode backup as YAML: %w", err)
+		}
+		return enc.Close()
+	default:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(backup); err != nil {
+			return fmt.Errorf("failed to encode backup as JSON: %w", err)
+		}
+		return nil
+	}
+}
+
+// DecodeBackup reads a Backup document in the given format and checks its version
+func DecodeBackup(r io.Reader, format BackupFormat) (*Backup, error) {
+	var backup Backup
+	var err error
+	switch format {
+	case BackupFormatYAML:
+		err = yaml.NewDecoder(r).Decode(&backup)
+	default:
+		err = json.NewDecoder(r).Decode(&backup)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode backup: %w", err)
+	}
+
+	if backup.Version < 1 || backup.Version > BackupVersion {
+		return nil, fmt.Errorf("backup version %d (supported: 1-%d): %w", backup.Version, BackupVersion, ErrUnsupportedBackupVersion)
+	}
+	return &backup, nil
+}
+
+// ExportBackup dumps manually registered domains and feed subscriptions
+func (db *DB) ExportBackup(ctx context.Context) (*Backup, error) {
+	backup := &Backup{
+		Version:    BackupVersion,
+		ExportedAt: time.Now().UTC(),
+		Domains:    []BackupDomain{},
+		Feeds:      []BackupFeed{},
+	}
+
+	rows, err := db.pool.Query(ctx, `SELECT domain_name, action FROM domains WHERE manual ORDER BY domain_name`)
+	if err != nil {
+		db.log.Error("Failed to export domains", zap.Error(err))
+		return nil, fmt.Errorf("failed to export domains: %w", err)
+	}
+	domains, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (BackupDomain, error) {
+		var d BackupDomain
+		err := row.Scan(&d.Name, &d.Action)
+		return d, err
+	})
+	if err != nil {
+		db.log.Error("Failed to export domains", zap.Error(err))
+		return nil, fmt.Errorf("failed to export domains: %w", err)
+	}
+	backup.Domains = append(backup.Domains, domains...)
+
+	feeds, err := db.GetAllFeeds(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export feeds: %w", err)
+	}
+	for _, feed := range feeds {
+		backup.Feeds = append(backup.Feeds, BackupFeed{
+			URL:                    feed.URL,
+			Format:                 feed.Format,
+			RefreshIntervalSeconds: feed.RefreshIntervalSeconds,
+		})
+	}
+
+	db.log.Info("Configuration exported",
+		zap.Int("domains", len(backup.Domains)),
+		zap.Int("feeds", len(backup.Feeds)))
+	return backup, nil
+}
+
+// RestoreBackup loads a Backup into the database in a single transaction
+func (db *DB) RestoreBackup(ctx context.Context, backup *Backup, mode RestoreMode) (*RestoreResult, error) {
+	domainNames := make([]string, 0, len(backup.Domains))
+	domainActions := make([]string, 0, len(backup.Domains))
+	for _, d := range backup.Domains {
+		action := d.Action
+		if action == "" {
+			action = BlockActionDrop
+		}
+		if _, err := ParseBlockAction(string(action)); err != nil {
+			return nil, fmt.Errorf("invalid backup domain %s: %w", d.Name, err)
+		}
+		domainNames = append(domainNames, d.Name)
+		domainActions = append(domainActions, string(action))
+	}
+	feedURLs := make([]string, 0, len(backup.Feeds))
+	for _, f := range backup.Feeds {
+		feedURLs = append(feedURLs, f.URL)
+	}
+
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		db.log.Error("Failed to begin restore transaction", zap.Error(err))
+		return nil, fmt.Errorf("failed to begin restore transaction: %w", err)
+	}
+	defer func() {
+		// Commit済みの場合Rollbackは何もしない
+		_ = tx.Rollback(ctx)
+	}()
+
+	result := &RestoreResult{}
+
+	if mode == RestoreModeReplace {
+		tag, err := tx.Exec(ctx, `DELETE FROM feeds WHERE url <> ALL($1::text[])`, feedURLs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete feeds not in backup: %w", err)
+		}
+		result.FeedsRemoved = int(tag.RowsAffected())
+
+		// 手動登録ドメイン、およびどのfeedにも含まれなくなったfeed管理ドメインのうちbackupにないものを削除
+		staleQuery := `SELECT d.domain_name FROM domains d
+		               WHERE d.domain_name <> ALL($1::varchar[])
+		                 AND (d.manual OR NOT EXISTS (SELECT 1 FROM feed_domains fd WHERE fd.domain_name = d.domain_name))`
+		stale, err := collectStrings(tx.Query(ctx, staleQuery, domainNames))
+		if err != nil {
+			return nil, fmt.Errorf("failed to find domains not in backup: %w", err)
+		}
+		result.RemovedIPs, err = deleteDomainsTx(ctx, tx, stale)
+		if err != nil {
+			return nil, err
+		}
+		result.DomainsRemoved = len(stale)
+	}
+
+	// backupに含まれるドメインは手動登録扱いとする
+	tag, err := tx.Exec(ctx, `INSERT INTO domains (domain_name, manual, action)
+	                          SELECT DISTINCT ON (name) name, TRUE, action
+	                          FROM unnest($1::varchar[], $2::varchar[]) AS b(name, action)
+	                          ON CONFLICT (domain_name) DO UPDATE SET manual = TRUE WHERE NOT domains.manual`,
+		domainNames, domainActions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore domains: %w", err)
+	}
+	result.DomainsAdded = int(tag.RowsAffected())
+
+	if mode == RestoreModeReplace {
+		// 登録済みドメインのactionもbackupに合わせる
+		_, err := tx.Exec(ctx, `UPDATE domains d SET action = b.action
+		                        FROM unnest($1::varchar[], $2::varchar[]) AS b(name, action)
+		                        WHERE d.domain_name = b.name AND d.action <> b.action`,
+			domainNames, domainActions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to restore domain actions: %w", err)
+		}
+	}
+
+	for _, feed := range backup.Feeds {
+		var inserted bool
+		query := `INSERT INTO feeds (url, format, refresh_interval_seconds) VALUES ($1, $2, $3)
+		          ON CONFLICT (url) DO NOTHING
+		          RETURNING TRUE`
+		if mode == RestoreModeReplace {
+			query = `INSERT INTO feeds (url, format, refresh_interval_seconds) VALUES ($1, $2, $3)
+			         ON CONFLICT (url) DO UPDATE
+			           SET format = EXCLUDED.format, refresh_interval_seconds = EXCLUDED.refresh_interval_seconds
+			         RETURNING (xmax = 0)`
+		}
+		err := tx.QueryRow(ctx, query, feed.URL, feed.Format, feed.RefreshIntervalSeconds).Scan(&inserted)
+		switch {
+		case err == nil && inserted:
+			result.FeedsAdded++
+		case err == nil:
+			result.FeedsUpdated++
+		case errors.Is(err, pgx.ErrNoRows):
+			// merge modeで登録済みのfeed
+		default:
+			return nil, fmt.Errorf("failed to restore feed %s: %w", feed.URL, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		db.log.Error("Failed to commit restore", zap.Error(err))
+		return nil, fmt.Errorf("failed to commit restore: %w", err)
+	}
+
+	db.log.Info("Configuration restored",
+		zap.String("mode", string(mode)),
+		zap.Int("domains_added", result.DomainsAdded),
+		zap.Int("domains_removed", result.DomainsRemoved),
+		zap.Int("feeds_added", result.FeedsAdded),
+		zap.Int("feeds_updated", result.FeedsUpdated),
+		zap.Int("feeds_removed", result.FeedsRemoved))
+	return result, nil
+}
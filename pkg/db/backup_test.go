@@ -0,0 +1,97 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_EncodeDecodeBackup(t *testing.T) {
+	backup := &Backup{
+		Version:    BackupVersion,
+		ExportedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Domains:    []BackupDomain{{Name: "example.com"}},
+		Feeds:      []BackupFeed{{URL: "https://example.com/hosts", Format: "hosts", RefreshIntervalSeconds: 3600}},
+	}
+
+	for _, format := range []BackupFormat{BackupFormatJSON, BackupFormatYAML} {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, EncodeBackup(&buf, backup, format))
+
+			decoded, err := DecodeBackup(&buf, format)
+			require.NoError(t, err)
+			assert.Equal(t, backup, decoded)
+		})
+	}
+
+	_, err := DecodeBackup(strings.NewReader(`{"version": 99}`), BackupFormatJSON)
+	assert.True(t, errors.Is(err, ErrUnsupportedBackupVersion))
+
+	_, err = DecodeBackup(strings.NewReader(`{"domains": []}`), BackupFormatJSON)
+	assert.True(t, errors.Is(err, ErrUnsupportedBackupVersion))
+}
+
+func Test_ExportRestoreBackup(t *testing.T) {
+	testDB := SetupTestDB(t)
+	defer testDB.Cleanup(t)
+	ctx := context.Background()
+
+	require.NoError(t, testDB.DB.CreateDomain(ctx, "a.com"))
+	require.NoError(t, testDB.DB.CreateDomain(ctx, "b.com"))
+	require.NoError(t, testDB.DB.SetDomainAction(ctx, "b.com", BlockActionReject))
+	feed, err := testDB.DB.CreateFeed(ctx, "https://example.com/hosts", "hosts", time.Hour)
+	require.NoError(t, err)
+	_, err = testDB.DB.SyncFeedDomains(ctx, feed.ID, []string{"feed.com"})
+	require.NoError(t, err)
+
+	backup, err := testDB.DB.ExportBackup(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []BackupDomain{
+		{Name: "a.com", Action: BlockActionDrop},
+		{Name: "b.com", Action: BlockActionReject},
+	}, backup.Domains)
+	require.Len(t, backup.Feeds, 1)
+	assert.Equal(t, 3600, backup.Feeds[0].RefreshIntervalSeconds)
+
+	// Merge keeps entries that are not in the backup
+	require.NoError(t, testDB.DB.CreateDomain(ctx, "extra.com"))
+	result, err := testDB.DB.RestoreBackup(ctx, &Backup{
+		Version: BackupVersion,
+		Domains: []BackupDomain{{Name: "a.com"}, {Name: "c.com"}},
+	}, RestoreModeMerge)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.DomainsAdded)
+	assert.Equal(t, 0, result.DomainsRemoved)
+
+	// Replace makes the database match the backup, including domain actions
+	require.NoError(t, testDB.DB.CreateDomainIP(ctx, "extra.com", "192.0.2.1"))
+	require.NoError(t, testDB.DB.SetDomainAction(ctx, "b.com", BlockActionLog))
+	result, err = testDB.DB.RestoreBackup(ctx, backup, RestoreModeReplace)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.DomainsRemoved) // extra.com, c.com
+	assert.Equal(t, 1, result.FeedsUpdated)
+	require.Len(t, result.RemovedIPs, 1)
+	assert.Equal(t, "192.0.2.1", result.RemovedIPs[0].IPAddress)
+
+	domains, err := testDB.DB.GetAllDomains(ctx)
+	require.NoError(t, err)
+	names := make([]string, 0, len(domains))
+	for _, d := range domains {
+		names = append(names, d.DomainName)
+	}
+	assert.Equal(t, []string{"a.com", "b.com", "feed.com"}, names)
+	assert.Equal(t, BlockActionReject, domains[1].Action)
+
+	_, err = testDB.DB.RestoreBackup(ctx, &Backup{
+		Version: BackupVersion,
+		Domains: []BackupDomain{{Name: "a.com", Action: "allow"}},
+	}, RestoreModeMerge)
+	assert.Error(t, err)
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// Block hit log repository operations
+
+// InsertBlockHits records logged packets, mapping each destination IP to the domain that currently owns it.
+// When several domains share the IP, the first one in name order is recorded.
+func (db *DB) InsertBlockHits(ctx context.Context, hits []BlockHit) (int64, error) {
+	if len(hits) == 0 {
+		return 0, nil
+	}
+
+	clientIPs := make([]string, 0, len(hits))
+	destIPs := make([]string, 0, len(hits))
+	hitAts := make([]time.Time, 0, len(hits))
+	for _, hit := range hits {
+		clientIPs = append(clientIPs, hit.ClientIP)
+		destIPs = append(destIPs, hit.DestIP)
+		hitAts = append(hitAts, hit.HitAt)
+	}
+
+	query := `INSERT INTO block_hits (client_ip, dest_ip, domain_name, hit_at)
+	          SELECT h.client_ip, h.dest_ip,
+	                 (SELECT MIN(di.domain_name) FROM domain_ips di WHERE di.ip_address = h.dest_ip),
+	                 h.hit_at
+	          FROM unnest($1::varchar[], $2::varchar[], $3::timestamp[]) AS h(client_ip, dest_ip, hit_at)`
+
+	tag, err := db.pool.Exec(ctx, query, clientIPs, destIPs, hitAts)
+	if err != nil {
+		db.log.Error("Failed to insert block hits", zap.Int("count", len(hits)), zap.Error(err))
+		return 0, fmt.Errorf("failed to insert block hits: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// GetBlockHitSummaries aggregates the block hits since the given time per client and domain, most recent first.
+// An empty clientIP returns every client.
+func (db *DB) GetBlockHitSummaries(ctx context.Context, since time.Time, clientIP string) ([]BlockHitSummary, error) {
+	query := `SELECT client_ip, domain_name, array_agg(DISTINCT dest_ip ORDER BY dest_ip),
+	                 COUNT(*), MIN(hit_at), MAX(hit_at)
+	          FROM block_hits
+	          WHERE hit_at >= $1 AND ($2 = '' OR client_ip = $2)
+	          GROUP BY client_ip, domain_name
+	          ORDER BY MAX(hit_at) DESC, client_ip, domain_name`
+
+	rows, err := db.pool.Query(ctx, query, since, clientIP)
+	if err != nil {
+		db.log.Error("Failed to get block hit summaries", zap.Error(err))
+		return nil, fmt.Errorf("failed to get block hit summaries: %w", err)
+	}
+	summaries, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (BlockHitSummary, error) {
+		var s BlockHitSummary
+		err := row.Scan(&s.ClientIP, &s.DomainName, &s.DestIPs, &s.Hits, &s.FirstHitAt, &s.LastHitAt)
+		return s, err
+	})
+	if err != nil {
+		db.log.Error("Failed to scan block hit summaries", zap.Error(err))
+		return nil, fmt.Errorf("failed to scan block hit summaries: %w", err)
+	}
+	return summaries, nil
+}
+
+// DeleteBlockHitsBefore deletes block hits logged before cutoff and returns the number deleted
+func (db *DB) DeleteBlockHitsBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	tag, err := db.pool.Exec(ctx, `DELETE FROM block_hits WHERE hit_at < $1`, cutoff)
+	if err != nil {
+		db.log.Error("Failed to delete old block hits", zap.Error(err))
+		return 0, fmt.Errorf("failed to delete old block hits: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_BlockHits(t *testing.T) {
+	testDB := SetupTestDB(t)
+	defer testDB.Cleanup(t)
+	ctx := context.Background()
+
+	require.NoError(t, testDB.DB.CreateDomain(ctx, "game.example.com"))
+	require.NoError(t, testDB.DB.CreateDomainIP(ctx, "game.example.com", "192.0.2.1"))
+	require.NoError(t, testDB.DB.CreateDomainIP(ctx, "game.example.com", "192.0.2.2"))
+
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	inserted, err := testDB.DB.InsertBlockHits(ctx, []BlockHit{
+		{ClientIP: "192.168.1.10", DestIP: "192.0.2.1", HitAt: base},
+		{ClientIP: "192.168.1.10", DestIP: "192.0.2.2", HitAt: base.Add(time.Minute)},
+		{ClientIP: "192.168.1.20", DestIP: "192.0.2.1", HitAt: base.Add(2 * time.Minute)},
+		// 記録時点でどのドメインにも属さないIP
+		{ClientIP: "192.168.1.20", DestIP: "198.51.100.1", HitAt: base.Add(-time.Hour)},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), inserted)
+
+	inserted, err = testDB.DB.InsertBlockHits(ctx, nil)
+	require.NoError(t, err)
+	assert.Zero(t, inserted)
+
+	summaries, err := testDB.DB.GetBlockHitSummaries(ctx, base.Add(-time.Minute), "")
+	require.NoError(t, err)
+	require.Len(t, summaries, 2)
+	assert.Equal(t, "192.168.1.20", summaries[0].ClientIP)
+	assert.Equal(t, int64(1), summaries[0].Hits)
+	assert.Equal(t, "192.168.1.10", summaries[1].ClientIP)
+	require.NotNil(t, summaries[1].DomainName)
+	assert.Equal(t, "game.example.com", *summaries[1].DomainName)
+	assert.Equal(t, []string{"192.0.2.1", "192.0.2.2"}, summaries[1].DestIPs)
+	assert.Equal(t, int64(2), summaries[1].Hits)
+	assert.True(t, summaries[1].FirstHitAt.Equal(base))
+	assert.True(t, summaries[1].LastHitAt.Equal(base.Add(time.Minute)))
+
+	summaries, err = testDB.DB.GetBlockHitSummaries(ctx, base.Add(-2*time.Hour), "192.168.1.20")
+	require.NoError(t, err)
+	require.Len(t, summaries, 2)
+	assert.Nil(t, summaries[1].DomainName)
+
+	deleted, err := testDB.DB.DeleteBlockHitsBefore(ctx, base)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+}
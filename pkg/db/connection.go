@@ -22,6 +22,7 @@ const (
 type DB struct {
 	pool *pgxpool.Pool
 	log  *zap.Logger
+	node string
 }
 
 // Config holds database connection configuration
@@ -32,6 +33,9 @@ type Config struct {
 	Password string
 	DBName   string
 	SSLMode  string
+	// Node is the name of the router whose firewall this process manages, when several routers share the database.
+	// Firewall operations and the run lock are per node. Empty for services that do not manage a firewall.
+	Node string
 
 	// Connection pool settings
 	MaxOpenConns int32         // Maximum number of open connections
@@ -103,7 +107,15 @@ func NewDB(config Config, log *zap.Logger) (*DB, error) {
 		zap.Duration("maxLifetime", config.MaxLifetime),
 		zap.Duration("maxIdleTime", config.MaxIdleTime))
 
-	return &DB{pool: pool, log: log}, nil
+	return &DB{pool: pool, log: log, node: config.Node}, nil
+}
+
+// Ping checks that the database is reachable
+func (db *DB) Ping(ctx context.Context) error {
+	if err := db.pool.Ping(ctx); err != nil {
+		return fmt.Errorf("failed to ping database: %w", err)
+	}
+	return nil
 }
 
 // Close closes the database connection pool
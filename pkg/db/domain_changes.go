@@ -0,0 +1,55 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// Domain change notification operations.
+// Triggers on domains and domain_overrides publish a DomainChange on DomainChangeChannel when a transaction commits.
+
+// DomainChangeChannel is the LISTEN/NOTIFY channel of domain changes
+const DomainChangeChannel = "domain_changes"
+
+// ListenDomainChanges calls handle for each domain change until ctx is cancelled.
+// It holds one connection, taken out of the pool, for as long as it listens.
+// An error is returned when the connection fails; changes committed while nobody listens are not delivered.
+func (db *DB) ListenDomainChanges(ctx context.Context, handle func(DomainChange)) error {
+	pooled, err := db.pool.Acquire(ctx)
+	if err != nil {
+		db.log.Error("Failed to acquire connection for domain change notifications", zap.Error(err))
+		return fmt.Errorf("failed to acquire connection for domain change notifications: %w", err)
+	}
+	// LISTEN状態の接続をpoolに戻さないよう、poolから切り離して終了時に閉じる
+	conn := pooled.Hijack()
+	defer func() {
+		_ = conn.Close(context.WithoutCancel(ctx))
+	}()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+DomainChangeChannel); err != nil {
+		db.log.Error("Failed to listen for domain changes", zap.Error(err))
+		return fmt.Errorf("failed to listen for domain changes: %w", err)
+	}
+	db.log.Info("Listening for domain changes", zap.String("channel", DomainChangeChannel))
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			db.log.Error("Failed to wait for domain change notification", zap.Error(err))
+			return fmt.Errorf("failed to wait for domain change notification: %w", err)
+		}
+		var change DomainChange
+		if err := json.Unmarshal([]byte(notification.Payload), &change); err != nil {
+			db.log.Warn("Ignored invalid domain change notification",
+				zap.String("payload", notification.Payload), zap.Error(err))
+			continue
+		}
+		handle(change)
+	}
+}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ListenDomainChanges(t *testing.T) {
+	testDB := SetupTestDB(t)
+	defer testDB.Cleanup(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan DomainChange, 16)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, testDB.DB.ListenDomainChanges(ctx, func(c DomainChange) { changes <- c }))
+	}()
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	receive := func(t *testing.T) DomainChange {
+		t.Helper()
+		select {
+		case c := <-changes:
+			return c
+		case <-time.After(5 * time.Second):
+			t.Fatal("no domain change notification received")
+			return DomainChange{}
+		}
+	}
+	exec := func(t *testing.T, sql string) {
+		t.Helper()
+		_, err := testDB.DB.pool.Exec(context.Background(), sql)
+		require.NoError(t, err)
+	}
+
+	// LISTENの開始を待ち、待機中に届いた通知を読み捨てる
+	attempt := 0
+	require.Eventually(t, func() bool {
+		attempt++
+		exec(t, fmt.Sprintf(`INSERT INTO domains (domain_name) VALUES ('ready%d.example.com')`, attempt))
+		select {
+		case <-changes:
+			return true
+		case <-time.After(100 * time.Millisecond):
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(200 * time.Millisecond)
+	for len(changes) > 0 {
+		<-changes
+	}
+
+	t.Run("inserted domains are named in chunks", func(t *testing.T) {
+		exec(t, `INSERT INTO domains (domain_name) SELECT 'd' || i || '.example.com' FROM generate_series(1, 25) i`)
+
+		first, second := receive(t), receive(t)
+		assert.Equal(t, "domains", first.Table)
+		assert.Equal(t, "INSERT", first.Op)
+		assert.Len(t, append(first.Domains, second.Domains...), 25)
+		assert.ElementsMatch(t, []int{20, 5}, []int{len(first.Domains), len(second.Domains)})
+	})
+
+	t.Run("conflicting insert is not published", func(t *testing.T) {
+		exec(t, `INSERT INTO domains (domain_name) VALUES ('d1.example.com') ON CONFLICT DO NOTHING`)
+		exec(t, `UPDATE domains SET action = 'drop' WHERE domain_name = 'd1.example.com'`) // 変更なし
+		exec(t, `UPDATE domains SET action = 'reject' WHERE domain_name LIKE 'd%.example.com'`)
+
+		change := receive(t)
+		assert.Equal(t, DomainChange{Table: "domains", Op: "UPDATE"}, change)
+	})
+
+	t.Run("deletes and overrides are published without names", func(t *testing.T) {
+		exec(t, `DELETE FROM domains WHERE domain_name LIKE 'd%.example.com'`)
+		assert.Equal(t, DomainChange{Table: "domains", Op: "DELETE"}, receive(t))
+
+		_, err := testDB.DB.SetDomainOverride(context.Background(), "ready1.example.com", OverrideKindExempt, time.Hour)
+		require.NoError(t, err)
+		assert.Equal(t, DomainChange{Table: "domain_overrides", Op: "INSERT"}, receive(t))
+	})
+
+	select {
+	case c := <-changes:
+		t.Errorf("unexpected domain change: %+v", c)
+	default:
+	}
+}
@@ -7,6 +7,67 @@ var (
 	// ErrDomainAlreadyExists is returned when attempting to create a domain that already exists
 	ErrDomainAlreadyExists = errors.New("domain already exists")
 
+	// ErrDomainNotFound is returned when the requested domain does not exist
+	ErrDomainNotFound = errors.New("domain not found")
+
 	// ErrDomainIPAlreadyExists is returned when attempting to create a domain IP that already exists
 	ErrDomainIPAlreadyExists = errors.New("domain IP already exists")
+
+	// ErrDomainIPNotFound is returned when the requested IP is not associated with the domain
+	ErrDomainIPNotFound = errors.New("domain IP not found")
+)
+
+// Domain override-related errors
+var (
+	// ErrDomainOverrideNotFound is returned when the domain has no active override
+	ErrDomainOverrideNotFound = errors.New("domain override not found")
+
+	// ErrDomainOverrideConflict is returned when setting an override of another kind than the domain's active one
+	ErrDomainOverrideConflict = errors.New("domain has an active override of another kind")
+
+	// ErrInvalidOverrideDuration is returned when an override would not expire in the future or lasts too long
+	ErrInvalidOverrideDuration = errors.New("invalid override duration")
+)
+
+// Feed-related errors
+var (
+	// ErrFeedAlreadyExists is returned when attempting to subscribe to a feed URL that is already registered
+	ErrFeedAlreadyExists = errors.New("feed already exists")
+
+	// ErrFeedNotFound is returned when the requested feed does not exist
+	ErrFeedNotFound = errors.New("feed not found")
+)
+
+// Backup-related errors
+var (
+	// ErrUnsupportedBackupVersion is returned when a backup document was written by an incompatible version
+	ErrUnsupportedBackupVersion = errors.New("unsupported backup version")
+)
+
+// Batch run-related errors
+var (
+	// ErrBatchRunNotFound is returned when the requested batch run does not exist
+	ErrBatchRunNotFound = errors.New("batch run not found")
+
+	// ErrRunRequestNotFound is returned when the requested run request does not exist
+	ErrRunRequestNotFound = errors.New("run request not found")
+
+	// ErrRunLockHeld is returned when another batch run holds the run lock
+	ErrRunLockHeld = errors.New("run lock is held by another batch run")
+)
+
+// Auth-related errors
+var (
+	// ErrUserAlreadyExists is returned when attempting to create a user whose name is already taken
+	ErrUserAlreadyExists = errors.New("user already exists")
+
+	// ErrUserNotFound is returned when the requested user does not exist,
+	// or when no user is associated with the given API token or session
+	ErrUserNotFound = errors.New("user not found")
+
+	// ErrLastAdmin is returned when deleting the only remaining admin user
+	ErrLastAdmin = errors.New("cannot delete the last admin user")
+
+	// ErrAPITokenNotFound is returned when the requested API token does not exist
+	ErrAPITokenNotFound = errors.New("API token not found")
 )
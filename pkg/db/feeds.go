@@ -0,0 +1,302 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+)
+
+// Feed repository operations
+
+const feedColumns = `id, url, format, refresh_interval_seconds, etag, last_modified,
+	last_fetched_at, last_status, last_error, last_domain_count, created_at, updated_at`
+
+// CreateFeed registers a new blocklist feed subscription
+func (db *DB) CreateFeed(ctx context.Context, url, format string, refreshInterval time.Duration) (*Feed, error) {
+	query := `INSERT INTO feeds (url, format, refresh_interval_seconds) VALUES ($1, $2, $3)
+	          RETURNING ` + feedColumns
+
+	feed, err := scanFeed(db.pool.QueryRow(ctx, query, url, format, int(refreshInterval.Seconds())))
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			db.log.Warn("Feed already exists", zap.String("url", url))
+			return nil, fmt.Errorf("failed to create feed %s: %w", url, ErrFeedAlreadyExists)
+		}
+
+		db.log.Error("Failed to create feed", zap.String("url", url), zap.Error(err))
+		return nil, fmt.Errorf("failed to create feed %s: %w", url, err)
+	}
+
+	db.log.Info("Feed created successfully", zap.Int64("id", feed.ID), zap.String("url", url))
+	return feed, nil
+}
+
+// GetAllFeeds retrieves all feed subscriptions
+func (db *DB) GetAllFeeds(ctx context.Context) ([]Feed, error) {
+	query := `SELECT ` + feedColumns + ` FROM feeds ORDER BY id`
+	return db.queryFeeds(ctx, query)
+}
+
+// GetDueFeeds retrieves feeds that have never been fetched or whose refresh interval has elapsed at now
+func (db *DB) GetDueFeeds(ctx context.Context, now time.Time) ([]Feed, error) {
+	query := `SELECT ` + feedColumns + ` FROM feeds
+	          WHERE last_fetched_at IS NULL
+	             OR last_fetched_at + make_interval(secs => refresh_interval_seconds) <= $1
+	          ORDER BY id`
+	return db.queryFeeds(ctx, query, now)
+}
+
+// queryFeeds executes a query returning feed rows
+func (db *DB) queryFeeds(ctx context.Context, query string, args ...any) ([]Feed, error) {
+	rows, err := db.pool.Query(ctx, query, args...)
+	if err != nil {
+		db.log.Error("Failed to get feeds", zap.Error(err))
+		return nil, fmt.Errorf("failed to get feeds: %w", err)
+	}
+	defer rows.Close()
+
+	var feeds []Feed
+	for rows.Next() {
+		feed, err := scanFeed(rows)
+		if err != nil {
+			db.log.Error("Failed to scan feed row", zap.Error(err))
+			return nil, fmt.Errorf("failed to scan feed row: %w", err)
+		}
+		feeds = append(feeds, *feed)
+	}
+
+	if err := rows.Err(); err != nil {
+		db.log.Error("Failed to iterate feed rows", zap.Error(err))
+		return nil, fmt.Errorf("failed to iterate feed rows: %w", err)
+	}
+
+	return feeds, nil
+}
+
+// scanFeed scans a single feed row selected with feedColumns
+func scanFeed(row pgx.Row) (*Feed, error) {
+	var feed Feed
+	err := row.Scan(
+		&feed.ID,
+		&feed.URL,
+		&feed.Format,
+		&feed.RefreshIntervalSeconds,
+		&feed.ETag,
+		&feed.LastModified,
+		&feed.LastFetchedAt,
+		&feed.LastStatus,
+		&feed.LastError,
+		&feed.LastDomainCount,
+		&feed.CreatedAt,
+		&feed.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &feed, nil
+}
+
+// UpdateFeedFetchResult records the outcome of a feed fetch
+func (db *DB) UpdateFeedFetchResult(ctx context.Context, feedID int64, result FeedFetchResult) error {
+	query := `UPDATE feeds SET
+	            etag = $2,
+	            last_modified = $3,
+	            last_fetched_at = NOW(),
+	            last_status = $4,
+	            last_error = $5,
+	            last_domain_count = $6
+	          WHERE id = $1`
+	tag, err := db.pool.Exec(ctx, query,
+		feedID, result.ETag, result.LastModified, result.Status, result.Error, result.DomainCount)
+	if err != nil {
+		db.log.Error("Failed to update feed fetch result", zap.Int64("id", feedID), zap.Error(err))
+		return fmt.Errorf("failed to update feed fetch result for feed %d: %w", feedID, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to update feed fetch result for feed %d: %w", feedID, ErrFeedNotFound)
+	}
+
+	return nil
+}
+
+// SyncFeedDomains replaces the set of domains provided by a feed in a single transaction.
+// Domains not yet registered are created as feed-owned (manual = false).
+// Domains dropped from the feed lose their membership, and feed-owned domains
+// no longer provided by any feed are deleted together with their IPs.
+func (db *DB) SyncFeedDomains(ctx context.Context, feedID int64, domainNames []string) (*FeedSyncResult, error) {
+	if domainNames == nil {
+		domainNames = []string{}
+	}
+
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		db.log.Error("Failed to begin feed sync transaction", zap.Error(err))
+		return nil, fmt.Errorf("failed to begin feed sync transaction: %w", err)
+	}
+	defer func() {
+		// Commit済みの場合Rollbackは何もしない
+		_ = tx.Rollback(ctx)
+	}()
+
+	result := &FeedSyncResult{}
+
+	insertDomains := `INSERT INTO domains (domain_name, manual)
+	                  SELECT DISTINCT unnest($1::varchar[]), FALSE
+	                  ON CONFLICT (domain_name) DO NOTHING`
+	tag, err := tx.Exec(ctx, insertDomains, domainNames)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert feed domains for feed %d: %w", feedID, err)
+	}
+	result.AddedDomains = int(tag.RowsAffected())
+
+	insertMembers := `INSERT INTO feed_domains (feed_id, domain_name)
+	                  SELECT $1, d FROM (SELECT DISTINCT unnest($2::varchar[]) AS d) AS s
+	                  ON CONFLICT (feed_id, domain_name) DO NOTHING`
+	if _, err := tx.Exec(ctx, insertMembers, feedID, domainNames); err != nil {
+		return nil, fmt.Errorf("failed to insert feed memberships for feed %d: %w", feedID, err)
+	}
+
+	deleteMembers := `DELETE FROM feed_domains
+	                  WHERE feed_id = $1 AND domain_name <> ALL($2::varchar[])
+	                  RETURNING domain_name`
+	result.DroppedDomains, err = collectStrings(tx.Query(ctx, deleteMembers, feedID, domainNames))
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete dropped feed memberships for feed %d: %w", feedID, err)
+	}
+
+	result.RemovedDomains, result.RemovedIPs, err = deleteOrphanedFeedDomains(ctx, tx, result.DroppedDomains)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		db.log.Error("Failed to commit feed sync", zap.Int64("id", feedID), zap.Error(err))
+		return nil, fmt.Errorf("failed to commit feed sync for feed %d: %w", feedID, err)
+	}
+
+	db.log.Info("Feed domains synchronized",
+		zap.Int64("id", feedID),
+		zap.Int("domains", len(domainNames)),
+		zap.Int("added", result.AddedDomains),
+		zap.Int("dropped", len(result.DroppedDomains)),
+		zap.Int("removed", len(result.RemovedDomains)))
+	return result, nil
+}
+
+// DeleteFeed removes a feed subscription. Feed-owned domains no longer provided by any
+// other feed are deleted, and the IPs that belonged to them are returned.
+func (db *DB) DeleteFeed(ctx context.Context, feedID int64) ([]DomainIP, error) {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		db.log.Error("Failed to begin feed delete transaction", zap.Error(err))
+		return nil, fmt.Errorf("failed to begin feed delete transaction: %w", err)
+	}
+	defer func() {
+		// Commit済みの場合Rollbackは何もしない
+		_ = tx.Rollback(ctx)
+	}()
+
+	members, err := collectStrings(tx.Query(ctx,
+		`SELECT domain_name FROM feed_domains WHERE feed_id = $1`, feedID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get memberships for feed %d: %w", feedID, err)
+	}
+
+	tag, err := tx.Exec(ctx, `DELETE FROM feeds WHERE id = $1`, feedID)
+	if err != nil {
+		db.log.Error("Failed to delete feed", zap.Int64("id", feedID), zap.Error(err))
+		return nil, fmt.Errorf("failed to delete feed %d: %w", feedID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, fmt.Errorf("failed to delete feed %d: %w", feedID, ErrFeedNotFound)
+	}
+
+	_, removedIPs, err := deleteOrphanedFeedDomains(ctx, tx, members)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		db.log.Error("Failed to commit feed delete", zap.Int64("id", feedID), zap.Error(err))
+		return nil, fmt.Errorf("failed to commit feed delete for feed %d: %w", feedID, err)
+	}
+
+	db.log.Info("Feed deleted successfully", zap.Int64("id", feedID))
+	return removedIPs, nil
+}
+
+// deleteOrphanedFeedDomains deletes those candidate domains that are feed-owned and
+// no longer provided by any feed. Returns the deleted domains and their IPs.
+func deleteOrphanedFeedDomains(ctx context.Context, tx pgx.Tx, candidates []string) ([]string, []DomainIP, error) {
+	if len(candidates) == 0 {
+		return nil, nil, nil
+	}
+
+	orphanQuery := `SELECT d.domain_name FROM domains d
+	                WHERE d.domain_name = ANY($1::varchar[])
+	                  AND NOT d.manual
+	                  AND NOT EXISTS (SELECT 1 FROM feed_domains fd WHERE fd.domain_name = d.domain_name)`
+	orphans, err := collectStrings(tx.Query(ctx, orphanQuery, candidates))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find orphaned feed domains: %w", err)
+	}
+	if len(orphans) == 0 {
+		return nil, nil, nil
+	}
+
+	removedIPs, err := deleteDomainsTx(ctx, tx, orphans)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return orphans, removedIPs, nil
+}
+
+// deleteDomainsTx deletes the given domains and returns the IPs that belonged to them
+func deleteDomainsTx(ctx context.Context, tx pgx.Tx, domainNames []string) ([]DomainIP, error) {
+	if len(domainNames) == 0 {
+		return nil, nil
+	}
+
+	deleteIPs := `DELETE FROM domain_ips WHERE domain_name = ANY($1::varchar[])
+	              RETURNING id, domain_name, ip_address, created_at, updated_at`
+	rows, err := tx.Query(ctx, deleteIPs, domainNames)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete domain IPs: %w", err)
+	}
+	removedIPs, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (DomainIP, error) {
+		var domainIP DomainIP
+		err := row.Scan(
+			&domainIP.ID,
+			&domainIP.DomainName,
+			&domainIP.IPAddress,
+			&domainIP.CreatedAt,
+			&domainIP.UpdatedAt,
+		)
+		return domainIP, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan deleted domain IPs: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM domains WHERE domain_name = ANY($1::varchar[])`, domainNames); err != nil {
+		return nil, fmt.Errorf("failed to delete domains: %w", err)
+	}
+
+	return removedIPs, nil
+}
+
+// collectStrings collects a single text column from query rows
+func collectStrings(rows pgx.Rows, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
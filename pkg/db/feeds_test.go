@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_CreateFeed(t *testing.T) {
+	testDB := SetupTestDB(t)
+	defer testDB.Cleanup(t)
+
+	feed, err := testDB.DB.CreateFeed(context.Background(), "file:///tmp/hosts", "hosts", 6*time.Hour)
+	require.NoError(t, err)
+	assert.NotZero(t, feed.ID)
+	assert.Equal(t, 6*time.Hour, feed.RefreshInterval())
+	assert.Nil(t, feed.LastFetchedAt)
+
+	_, err = testDB.DB.CreateFeed(context.Background(), "file:///tmp/hosts", "hosts", time.Hour)
+	assert.True(t, errors.Is(err, ErrFeedAlreadyExists))
+
+	// Never-fetched feeds are due
+	due, err := testDB.DB.GetDueFeeds(context.Background(), time.Now())
+	require.NoError(t, err)
+	assert.Len(t, due, 1)
+
+	err = testDB.DB.UpdateFeedFetchResult(context.Background(), feed.ID, FeedFetchResult{
+		Status:      FeedStatusUpdated,
+		ETag:        `"abc"`,
+		DomainCount: 3,
+	})
+	require.NoError(t, err)
+
+	due, err = testDB.DB.GetDueFeeds(context.Background(), time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, due)
+
+	feeds, err := testDB.DB.GetAllFeeds(context.Background())
+	require.NoError(t, err)
+	require.Len(t, feeds, 1)
+	assert.Equal(t, `"abc"`, feeds[0].ETag)
+	assert.Equal(t, FeedStatusUpdated, feeds[0].LastStatus)
+	assert.NotNil(t, feeds[0].LastFetchedAt)
+}
+
+func Test_SyncFeedDomains(t *testing.T) {
+	testDB := SetupTestDB(t)
+	defer testDB.Cleanup(t)
+	ctx := context.Background()
+
+	// manual.com is registered by hand and must survive being dropped from the feed
+	require.NoError(t, testDB.DB.CreateDomain(ctx, "manual.com"))
+
+	feed, err := testDB.DB.CreateFeed(ctx, "https://example.com/list.txt", "auto", 24*time.Hour)
+	require.NoError(t, err)
+	other, err := testDB.DB.CreateFeed(ctx, "https://example.org/list.txt", "auto", 24*time.Hour)
+	require.NoError(t, err)
+
+	result, err := testDB.DB.SyncFeedDomains(ctx, feed.ID, []string{"manual.com", "a.com", "b.com", "shared.com"})
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.AddedDomains)
+	assert.Empty(t, result.DroppedDomains)
+
+	_, err = testDB.DB.SyncFeedDomains(ctx, other.ID, []string{"shared.com"})
+	require.NoError(t, err)
+	require.NoError(t, testDB.DB.CreateDomainIP(ctx, "a.com", "192.0.2.1"))
+
+	// Drop everything except b.com from the first feed
+	result, err = testDB.DB.SyncFeedDomains(ctx, feed.ID, []string{"b.com"})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"manual.com", "a.com", "shared.com"}, result.DroppedDomains)
+	assert.Equal(t, []string{"a.com"}, result.RemovedDomains)
+	require.Len(t, result.RemovedIPs, 1)
+	assert.Equal(t, "192.0.2.1", result.RemovedIPs[0].IPAddress)
+
+	domains, err := testDB.DB.GetAllDomains(ctx)
+	require.NoError(t, err)
+	names := make([]string, 0, len(domains))
+	for _, d := range domains {
+		names = append(names, d.DomainName)
+	}
+	assert.Equal(t, []string{"b.com", "manual.com", "shared.com"}, names)
+
+	// Deleting the feed removes its remaining feed-owned domains
+	_, err = testDB.DB.DeleteFeed(ctx, feed.ID)
+	require.NoError(t, err)
+	domains, err = testDB.DB.GetAllDomains(ctx)
+	require.NoError(t, err)
+	assert.Len(t, domains, 2)
+
+	_, err = testDB.DB.DeleteFeed(ctx, feed.ID)
+	assert.True(t, errors.Is(err, ErrFeedNotFound))
+}
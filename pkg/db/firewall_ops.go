@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// Firewall operation outbox.
+// Triggers on domain_ips, domains and domain_overrides queue a FirewallOp in the same transaction as the change,
+// so the firewall converges to the database even when the process stops between the two updates.
+
+// MaxFirewallOpAttempts is how many times an operation may fail before it is dropped.
+// Dropped operations are left to the reconciliation of the next batch run.
+const MaxFirewallOpAttempts = 5
+
+// pendingFirewallOpsQuery selects the operations of this node ($2) and those queued for any node, oldest first.
+// 複数ドメインが同じIPを持つ場合、一時除外中でないドメインのうちreconcileFirewallと同じ順で最初のactionを使う
+const pendingFirewallOpsQuery = `SELECT o.id, o.ip_address, o.op, o.domain_name, o.attempts, o.last_error, o.created_at, o.node_name,
+	       (SELECT d.action FROM domain_ips di JOIN domains d ON d.domain_name = di.domain_name
+	        WHERE di.ip_address = o.ip_address
+	          AND NOT EXISTS (SELECT 1 FROM domain_overrides ov
+	                          WHERE ov.domain_name = di.domain_name AND ov.kind = $1
+	                            AND ov.expires_at > CURRENT_TIMESTAMP)
+	        ORDER BY di.domain_name, di.created_at DESC LIMIT 1) AS action
+	FROM firewall_ops o WHERE o.node_name IS NULL OR o.node_name = $2
+	ORDER BY o.id`
+
+// GetPendingFirewallOps retrieves the operations ApplyFirewallOps would claim, without claiming them
+func (db *DB) GetPendingFirewallOps(ctx context.Context) ([]FirewallOp, error) {
+	rows, err := db.pool.Query(ctx, pendingFirewallOpsQuery, OverrideKindExempt, db.node)
+	if err != nil {
+		db.log.Error("Failed to get pending firewall operations", zap.Error(err))
+		return nil, fmt.Errorf("failed to get pending firewall operations: %w", err)
+	}
+	ops, err := pgx.CollectRows(rows, pgx.RowToStructByName[FirewallOp])
+	if err != nil {
+		db.log.Error("Failed to scan firewall operation rows", zap.Error(err))
+		return nil, fmt.Errorf("failed to scan firewall operation rows: %w", err)
+	}
+	return ops, nil
+}
+
+// ApplyFirewallOps claims up to limit pending firewall operations in the order they were queued and calls apply
+// with them inside one transaction. apply returns the errors of the operations it failed to apply by ID;
+// the other operations are deleted, the failed ones are kept for a retry until MaxFirewallOpAttempts.
+// Only the operations of this node (Config.Node) and those queued for any node are claimed, and operations claimed
+// by another process are skipped. Returns the number of claimed operations.
+func (db *DB) ApplyFirewallOps(ctx context.Context, limit int, apply func(ctx context.Context, ops []FirewallOp) map[int64]error) (int, error) {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		db.log.Error("Failed to begin firewall operation transaction", zap.Error(err))
+		return 0, fmt.Errorf("failed to begin firewall operation transaction: %w", err)
+	}
+	defer func() {
+		// Commit済みの場合Rollbackは何もしない
+		_ = tx.Rollback(ctx)
+	}()
+
+	rows, err := tx.Query(ctx, pendingFirewallOpsQuery+` LIMIT $3 FOR UPDATE OF o SKIP LOCKED`, OverrideKindExempt, db.node, limit)
+	if err != nil {
+		db.log.Error("Failed to claim firewall operations", zap.Error(err))
+		return 0, fmt.Errorf("failed to claim firewall operations: %w", err)
+	}
+	ops, err := pgx.CollectRows(rows, pgx.RowToStructByName[FirewallOp])
+	if err != nil {
+		db.log.Error("Failed to scan firewall operation rows", zap.Error(err))
+		return 0, fmt.Errorf("failed to scan firewall operation rows: %w", err)
+	}
+	if len(ops) == 0 {
+		return 0, nil
+	}
+
+	failed := apply(ctx, ops)
+
+	done := make([]int64, 0, len(ops))
+	for _, op := range ops {
+		if _, ok := failed[op.ID]; !ok {
+			done = append(done, op.ID)
+		}
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM firewall_ops WHERE id = ANY($1)`, done); err != nil {
+		db.log.Error("Failed to delete applied firewall operations", zap.Error(err))
+		return 0, fmt.Errorf("failed to delete applied firewall operations: %w", err)
+	}
+	for id, applyErr := range failed {
+		if _, err := tx.Exec(ctx,
+			`UPDATE firewall_ops SET attempts = attempts + 1, last_error = $2 WHERE id = $1`,
+			id, applyErr.Error()); err != nil {
+			db.log.Error("Failed to record firewall operation failure", zap.Int64("id", id), zap.Error(err))
+			return 0, fmt.Errorf("failed to record failure of firewall operation %d: %w", id, err)
+		}
+	}
+
+	rows, err = tx.Query(ctx,
+		`DELETE FROM firewall_ops WHERE id = ANY($1) AND attempts >= $2 RETURNING ip_address, last_error`,
+		slices.Collect(maps.Keys(failed)), MaxFirewallOpAttempts)
+	if err != nil {
+		db.log.Error("Failed to drop firewall operations", zap.Error(err))
+		return 0, fmt.Errorf("failed to drop firewall operations: %w", err)
+	}
+	for rows.Next() {
+		var ip, lastError string
+		if err := rows.Scan(&ip, &lastError); err != nil {
+			rows.Close()
+			db.log.Error("Failed to scan dropped firewall operation row", zap.Error(err))
+			return 0, fmt.Errorf("failed to scan dropped firewall operation row: %w", err)
+		}
+		db.log.Warn("Dropped firewall operation after repeated failures; left to reconciliation",
+			zap.String("ip", ip),
+			zap.Int("attempts", MaxFirewallOpAttempts),
+			zap.String("last_error", lastError))
+	}
+	if err := rows.Err(); err != nil {
+		db.log.Error("Failed to iterate dropped firewall operation rows", zap.Error(err))
+		return 0, fmt.Errorf("failed to iterate dropped firewall operation rows: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		db.log.Error("Failed to commit firewall operation transaction", zap.Error(err))
+		return 0, fmt.Errorf("failed to commit firewall operation transaction: %w", err)
+	}
+	return len(ops), nil
+}
@@ -0,0 +1,124 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// claimFirewallOps claims the pending operations and applies them with the given errors
+func claimFirewallOps(t *testing.T, tdb *TestDBContainer, failed map[string]error) []FirewallOp {
+	t.Helper()
+	var claimed []FirewallOp
+	_, err := tdb.DB.ApplyFirewallOps(context.Background(), 100, func(_ context.Context, ops []FirewallOp) map[int64]error {
+		claimed = ops
+		errs := make(map[int64]error)
+		for _, op := range ops {
+			if err, ok := failed[op.IPAddress]; ok {
+				errs[op.ID] = err
+			}
+		}
+		return errs
+	})
+	require.NoError(t, err)
+	return claimed
+}
+
+func Test_ApplyFirewallOps(t *testing.T) {
+	testDB := SetupTestDB(t)
+	defer testDB.Cleanup(t)
+	ctx := context.Background()
+
+	require.NoError(t, testDB.DB.CreateDomain(ctx, "example.com"))
+	require.NoError(t, testDB.DB.CreateDomain(ctx, "example.org"))
+	require.NoError(t, testDB.DB.CreateDomainIP(ctx, "example.com", "192.0.2.1"))
+	require.NoError(t, testDB.DB.CreateDomainIP(ctx, "example.org", "192.0.2.1"))
+	require.NoError(t, testDB.DB.CreateDomainIP(ctx, "example.org", "192.0.2.2"))
+
+	// 未適用の操作は取得しても削除されない
+	pending, err := testDB.DB.GetPendingFirewallOps(ctx)
+	require.NoError(t, err)
+	assert.Len(t, pending, 3)
+
+	// IPの追加はdomain_ipsと同じトランザクションで登録され、適用時のあるべきactionを持つ
+	ops := claimFirewallOps(t, testDB, nil)
+	assert.Equal(t, pending, ops)
+	require.Len(t, ops, 3)
+	for _, op := range ops {
+		assert.Equal(t, "add", op.Op)
+		require.NotNil(t, op.Action)
+		assert.Equal(t, BlockActionDrop, *op.Action)
+	}
+	assert.Empty(t, claimFirewallOps(t, testDB, nil), "applied operations are deleted")
+
+	// actionの変更は所属するIPごとに登録される
+	require.NoError(t, testDB.DB.SetDomainAction(ctx, "example.org", BlockActionReject))
+	ops = claimFirewallOps(t, testDB, nil)
+	require.Len(t, ops, 2)
+	for _, op := range ops {
+		assert.Equal(t, "update", op.Op)
+		assert.Equal(t, "example.org", op.DomainName)
+	}
+
+	// 一時除外されたドメインのIPは、他のドメインが持つ場合のみブロックする
+	_, err = testDB.DB.SetDomainOverride(ctx, "example.org", OverrideKindExempt, time.Hour)
+	require.NoError(t, err)
+	actions := make(map[string]*BlockAction)
+	for _, op := range claimFirewallOps(t, testDB, nil) {
+		actions[op.IPAddress] = op.Action
+	}
+	require.Len(t, actions, 2)
+	require.NotNil(t, actions["192.0.2.1"])
+	assert.Equal(t, BlockActionDrop, *actions["192.0.2.1"])
+	assert.Nil(t, actions["192.0.2.2"])
+
+	// ドメインの削除でIPごとにremoveが登録される
+	_, err = testDB.DB.DeleteDomain(ctx, "example.com")
+	require.NoError(t, err)
+	var removed []string
+	for _, op := range claimFirewallOps(t, testDB, nil) {
+		if op.Op == "remove" {
+			removed = append(removed, op.IPAddress)
+			assert.Nil(t, op.Action)
+		}
+	}
+	assert.Equal(t, []string{"192.0.2.1"}, removed)
+}
+
+func Test_ApplyFirewallOps_failures(t *testing.T) {
+	testDB := SetupTestDB(t)
+	defer testDB.Cleanup(t)
+	ctx := context.Background()
+
+	require.NoError(t, testDB.DB.CreateDomain(ctx, "example.com"))
+	require.NoError(t, testDB.DB.CreateDomainIP(ctx, "example.com", "192.0.2.1"))
+	require.NoError(t, testDB.DB.CreateDomainIP(ctx, "example.com", "192.0.2.2"))
+
+	// 失敗した操作は残り、上限回数に達すると破棄される
+	failed := map[string]error{"192.0.2.1": errors.New("nft: busy")}
+	for attempt := 1; attempt <= MaxFirewallOpAttempts; attempt++ {
+		ops := claimFirewallOps(t, testDB, failed)
+		require.NotEmpty(t, ops, "attempt %d", attempt)
+		assert.Equal(t, "192.0.2.1", ops[0].IPAddress)
+		assert.Equal(t, attempt-1, ops[0].Attempts)
+		if attempt > 1 {
+			assert.Equal(t, "nft: busy", ops[0].LastError)
+		}
+	}
+	assert.Empty(t, claimFirewallOps(t, testDB, nil))
+
+	// applyが呼ばれる前に失敗した場合は何も削除しない
+	require.NoError(t, testDB.DB.CreateDomainIP(ctx, "example.com", "192.0.2.3"))
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err := testDB.DB.ApplyFirewallOps(cancelled, 100, func(context.Context, []FirewallOp) map[int64]error {
+		t.Fatal("apply must not be called")
+		return nil
+	})
+	assert.Error(t, err)
+	assert.Len(t, claimFirewallOps(t, testDB, nil), 1)
+}
@@ -0,0 +1,165 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// Block hit repository operations
+
+// RecordBlockCounters stores the counter values read from the firewall and adds the traffic
+// since the previous call to the current hourly bucket of every domain owning each IP.
+// A counter lower than its previous value means the rule was recreated (reboot, action change)
+// and is counted from zero. Returns the number of domains that received hits.
+// The counters are compared with the values this node (Config.Node) stored, since every node reads its own firewall.
+func (db *DB) RecordBlockCounters(ctx context.Context, counters []BlockCounter) (int, error) {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		db.log.Error("Failed to begin block counter transaction", zap.Error(err))
+		return 0, fmt.Errorf("failed to begin block counter transaction: %w", err)
+	}
+	defer func() {
+		// Commit済みの場合Rollbackは何もしない
+		_ = tx.Rollback(ctx)
+	}()
+
+	rows, err := tx.Query(ctx, `SELECT ip_address, packets, bytes FROM block_counters WHERE node_name = $1 FOR UPDATE`, db.node)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get previous block counters: %w", err)
+	}
+	previous, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (BlockCounter, error) {
+		var c BlockCounter
+		err := row.Scan(&c.IPAddress, &c.Packets, &c.Bytes)
+		return c, err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get previous block counters: %w", err)
+	}
+	last := make(map[string]BlockCounter, len(previous))
+	for _, c := range previous {
+		last[c.IPAddress] = c
+	}
+
+	ips := make([]string, 0, len(counters))
+	packets := make([]int64, 0, len(counters))
+	bytes := make([]int64, 0, len(counters))
+	var deltaIPs []string
+	var deltaPackets, deltaBytes []int64
+	for _, c := range counters {
+		ips = append(ips, c.IPAddress)
+		packets = append(packets, c.Packets)
+		bytes = append(bytes, c.Bytes)
+
+		delta := c
+		if prev, ok := last[c.IPAddress]; ok && c.Packets >= prev.Packets && c.Bytes >= prev.Bytes {
+			delta.Packets -= prev.Packets
+			delta.Bytes -= prev.Bytes
+		}
+		if delta.Packets > 0 {
+			deltaIPs = append(deltaIPs, delta.IPAddress)
+			deltaPackets = append(deltaPackets, delta.Packets)
+			deltaBytes = append(deltaBytes, delta.Bytes)
+		}
+	}
+
+	// ルールが削除されたIPの前回値は不要(再作成時は0から数え直す)
+	if _, err := tx.Exec(ctx, `DELETE FROM block_counters WHERE node_name = $1 AND ip_address <> ALL($2::varchar[])`, db.node, ips); err != nil {
+		return 0, fmt.Errorf("failed to delete stale block counters: %w", err)
+	}
+	_, err = tx.Exec(ctx, `INSERT INTO block_counters (node_name, ip_address, packets, bytes)
+	                       SELECT $1::varchar, * FROM unnest($2::varchar[], $3::bigint[], $4::bigint[])
+	                       ON CONFLICT (node_name, ip_address) DO UPDATE
+	                         SET packets = EXCLUDED.packets, bytes = EXCLUDED.bytes, updated_at = CURRENT_TIMESTAMP`,
+		db.node, ips, packets, bytes)
+	if err != nil {
+		return 0, fmt.Errorf("failed to store block counters: %w", err)
+	}
+
+	// 複数ドメインが同じIPを持つ場合は各ドメインに加算する
+	tag, err := tx.Exec(ctx, `INSERT INTO domain_hits (domain_name, bucket, packets, bytes)
+	                          SELECT di.domain_name, date_trunc('hour', CURRENT_TIMESTAMP), SUM(c.packets), SUM(c.bytes)
+	                          FROM unnest($1::varchar[], $2::bigint[], $3::bigint[]) AS c(ip_address, packets, bytes)
+	                          JOIN domain_ips di ON di.ip_address = c.ip_address
+	                          GROUP BY di.domain_name
+	                          ON CONFLICT (domain_name, bucket) DO UPDATE
+	                            SET packets = domain_hits.packets + EXCLUDED.packets,
+	                                bytes = domain_hits.bytes + EXCLUDED.bytes`,
+		deltaIPs, deltaPackets, deltaBytes)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record domain hits: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		db.log.Error("Failed to commit block counters", zap.Error(err))
+		return 0, fmt.Errorf("failed to commit block counters: %w", err)
+	}
+
+	domains := int(tag.RowsAffected())
+	db.log.Info("Block counters recorded",
+		zap.Int("ips", len(counters)),
+		zap.Int("ips_with_hits", len(deltaIPs)),
+		zap.Int("domains", domains))
+	return domains, nil
+}
+
+// GetDomainHits returns the blocked traffic of every domain within the last window, at hourly resolution
+func (db *DB) GetDomainHits(ctx context.Context, window time.Duration) ([]DomainHits, error) {
+	query := `SELECT d.domain_name, d.action, COALESCE(SUM(h.packets), 0), COALESCE(SUM(h.bytes), 0)
+	          FROM domains d
+	          LEFT JOIN domain_hits h ON h.domain_name = d.domain_name
+	            AND h.bucket >= date_trunc('hour', CURRENT_TIMESTAMP - $1 * interval '1 second')
+	          GROUP BY d.domain_name, d.action
+	          ORDER BY d.domain_name`
+
+	rows, err := db.pool.Query(ctx, query, int64(window.Seconds()))
+	if err != nil {
+		db.log.Error("Failed to get domain hits", zap.Error(err))
+		return nil, fmt.Errorf("failed to get domain hits: %w", err)
+	}
+	hits, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (DomainHits, error) {
+		var h DomainHits
+		err := row.Scan(&h.DomainName, &h.Action, &h.Packets, &h.Bytes)
+		return h, err
+	})
+	if err != nil {
+		db.log.Error("Failed to scan domain hits", zap.Error(err))
+		return nil, fmt.Errorf("failed to scan domain hits: %w", err)
+	}
+	return hits, nil
+}
+
+// GetDomainHitHistory returns the hourly blocked traffic of a domain within the last window, oldest first.
+// Hours without hits are omitted.
+func (db *DB) GetDomainHitHistory(ctx context.Context, domainName string, window time.Duration) ([]DomainHitBucket, error) {
+	query := `SELECT bucket, packets, bytes FROM domain_hits
+	          WHERE domain_name = $1 AND bucket >= date_trunc('hour', CURRENT_TIMESTAMP - $2 * interval '1 second')
+	          ORDER BY bucket`
+
+	rows, err := db.pool.Query(ctx, query, domainName, int64(window.Seconds()))
+	if err != nil {
+		db.log.Error("Failed to get domain hit history", zap.String("domain", domainName), zap.Error(err))
+		return nil, fmt.Errorf("failed to get domain hit history: %w", err)
+	}
+	buckets, err := pgx.CollectRows(rows, pgx.RowToStructByName[DomainHitBucket])
+	if err != nil {
+		db.log.Error("Failed to scan domain hit history", zap.String("domain", domainName), zap.Error(err))
+		return nil, fmt.Errorf("failed to scan domain hit history: %w", err)
+	}
+	return buckets, nil
+}
+
+// DeleteDomainHitsOlderThan deletes hourly hit buckets older than retention and returns the number deleted
+func (db *DB) DeleteDomainHitsOlderThan(ctx context.Context, retention time.Duration) (int64, error) {
+	tag, err := db.pool.Exec(ctx,
+		`DELETE FROM domain_hits WHERE bucket < CURRENT_TIMESTAMP - $1 * interval '1 second'`,
+		int64(retention.Seconds()))
+	if err != nil {
+		db.log.Error("Failed to delete old domain hits", zap.Error(err))
+		return 0, fmt.Errorf("failed to delete old domain hits: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,147 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_RecordBlockCounters(t *testing.T) {
+	testDB := SetupTestDB(t)
+	defer testDB.Cleanup(t)
+	ctx := context.Background()
+
+	require.NoError(t, testDB.DB.CreateDomain(ctx, "a.example.com"))
+	require.NoError(t, testDB.DB.CreateDomain(ctx, "b.example.com"))
+	require.NoError(t, testDB.DB.CreateDomain(ctx, "idle.example.com"))
+	require.NoError(t, testDB.DB.CreateDomainIP(ctx, "a.example.com", "192.0.2.1"))
+	require.NoError(t, testDB.DB.CreateDomainIP(ctx, "a.example.com", "192.0.2.2"))
+	// 192.0.2.2 is shared by both domains
+	require.NoError(t, testDB.DB.CreateDomainIP(ctx, "b.example.com", "192.0.2.2"))
+
+	// The first snapshot counts everything since the rules were created
+	domains, err := testDB.DB.RecordBlockCounters(ctx, []BlockCounter{
+		{IPAddress: "192.0.2.1", Packets: 10, Bytes: 600},
+		{IPAddress: "192.0.2.2", Packets: 5, Bytes: 300},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, domains)
+
+	// Only the increase is added; a lower counter means the rule was recreated
+	_, err = testDB.DB.RecordBlockCounters(ctx, []BlockCounter{
+		{IPAddress: "192.0.2.1", Packets: 14, Bytes: 840},
+		{IPAddress: "192.0.2.2", Packets: 1, Bytes: 60},
+	})
+	require.NoError(t, err)
+
+	// No change adds nothing
+	domains, err = testDB.DB.RecordBlockCounters(ctx, []BlockCounter{
+		{IPAddress: "192.0.2.1", Packets: 14, Bytes: 840},
+		{IPAddress: "192.0.2.2", Packets: 1, Bytes: 60},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 0, domains)
+
+	hits, err := testDB.DB.GetDomainHits(ctx, 24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, []DomainHits{
+		{DomainName: "a.example.com", Action: BlockActionDrop, Packets: 20, Bytes: 1200},
+		{DomainName: "b.example.com", Action: BlockActionDrop, Packets: 6, Bytes: 360},
+		{DomainName: "idle.example.com", Action: BlockActionDrop},
+	}, hits)
+
+	// A removed rule is counted from zero when it is created again
+	_, err = testDB.DB.RecordBlockCounters(ctx, []BlockCounter{{IPAddress: "192.0.2.1", Packets: 14, Bytes: 840}})
+	require.NoError(t, err)
+	_, err = testDB.DB.RecordBlockCounters(ctx, []BlockCounter{
+		{IPAddress: "192.0.2.1", Packets: 14, Bytes: 840},
+		{IPAddress: "192.0.2.2", Packets: 2, Bytes: 120},
+	})
+	require.NoError(t, err)
+
+	hits, err = testDB.DB.GetDomainHits(ctx, 24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(22), hits[0].Packets)
+	assert.Equal(t, int64(8), hits[1].Packets)
+}
+
+func Test_RecordBlockCounters_nodes(t *testing.T) {
+	testDB := SetupTestDB(t)
+	defer testDB.Cleanup(t)
+	ctx := context.Background()
+
+	require.NoError(t, testDB.DB.CreateDomain(ctx, "a.example.com"))
+	require.NoError(t, testDB.DB.CreateDomainIP(ctx, "a.example.com", "192.0.2.1"))
+
+	// 各nodeは自身のfirewallのcounterを読むため、同じIPでも前回値はnodeごとに比較する
+	nodeA := &DB{pool: testDB.DB.pool, log: testDB.DB.log, node: "main"}
+	nodeB := &DB{pool: testDB.DB.pool, log: testDB.DB.log, node: "guest"}
+
+	_, err := nodeA.RecordBlockCounters(ctx, []BlockCounter{{IPAddress: "192.0.2.1", Packets: 10, Bytes: 600}})
+	require.NoError(t, err)
+	_, err = nodeB.RecordBlockCounters(ctx, []BlockCounter{{IPAddress: "192.0.2.1", Packets: 3, Bytes: 180}})
+	require.NoError(t, err)
+	_, err = nodeA.RecordBlockCounters(ctx, []BlockCounter{{IPAddress: "192.0.2.1", Packets: 12, Bytes: 720}})
+	require.NoError(t, err)
+	_, err = nodeB.RecordBlockCounters(ctx, []BlockCounter{{IPAddress: "192.0.2.1", Packets: 4, Bytes: 240}})
+	require.NoError(t, err)
+
+	hits, err := testDB.DB.GetDomainHits(ctx, 24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, []DomainHits{
+		{DomainName: "a.example.com", Action: BlockActionDrop, Packets: 16, Bytes: 960},
+	}, hits)
+
+	// A node without the rule does not delete the counters of the other node
+	_, err = nodeB.RecordBlockCounters(ctx, nil)
+	require.NoError(t, err)
+	_, err = nodeA.RecordBlockCounters(ctx, []BlockCounter{{IPAddress: "192.0.2.1", Packets: 12, Bytes: 720}})
+	require.NoError(t, err)
+
+	hits, err = testDB.DB.GetDomainHits(ctx, 24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(16), hits[0].Packets)
+}
+
+func Test_DeleteDomainHitsOlderThan(t *testing.T) {
+	testDB := SetupTestDB(t)
+	defer testDB.Cleanup(t)
+	ctx := context.Background()
+
+	require.NoError(t, testDB.DB.CreateDomain(ctx, "a.example.com"))
+	_, err := testDB.DB.pool.Exec(ctx, `INSERT INTO domain_hits (domain_name, bucket, packets, bytes) VALUES
+		('a.example.com', date_trunc('hour', CURRENT_TIMESTAMP), 1, 60),
+		('a.example.com', date_trunc('hour', CURRENT_TIMESTAMP - interval '2 days'), 2, 120),
+		('a.example.com', date_trunc('hour', CURRENT_TIMESTAMP - interval '40 days'), 4, 240)`)
+	require.NoError(t, err)
+
+	hits, err := testDB.DB.GetDomainHits(ctx, 24*time.Hour)
+	require.NoError(t, err)
+	require.Len(t, hits, 1)
+	assert.Equal(t, int64(1), hits[0].Packets)
+
+	deleted, err := testDB.DB.DeleteDomainHitsOlderThan(ctx, 30*24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	hits, err = testDB.DB.GetDomainHits(ctx, 365*24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), hits[0].Packets)
+
+	history, err := testDB.DB.GetDomainHitHistory(ctx, "a.example.com", 7*24*time.Hour)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, int64(2), history[0].Packets)
+	assert.Equal(t, int64(1), history[1].Packets)
+	assert.True(t, history[0].Bucket.Before(history[1].Bucket))
+
+	// Hits are deleted with their domain
+	_, err = testDB.DB.DeleteDomain(ctx, "a.example.com")
+	require.NoError(t, err)
+	var remaining int
+	require.NoError(t, testDB.DB.pool.QueryRow(ctx, "SELECT COUNT(*) FROM domain_hits").Scan(&remaining))
+	assert.Zero(t, remaining)
+}
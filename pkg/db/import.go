@@ -0,0 +1,91 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// Domain import operations
+
+// PreviewDomainImport compares the given domains against the domains table without modifying it
+func (db *DB) PreviewDomainImport(ctx context.Context, domainNames []string) (*DomainImportDiff, error) {
+	query := `SELECT domain_name FROM domains WHERE domain_name = ANY($1)`
+
+	rows, err := db.pool.Query(ctx, query, domainNames)
+	if err != nil {
+		db.log.Error("Failed to query existing domains for import", zap.Error(err))
+		return nil, fmt.Errorf("failed to query existing domains for import: %w", err)
+	}
+	defer rows.Close()
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var domainName string
+		if err := rows.Scan(&domainName); err != nil {
+			db.log.Error("Failed to scan existing domain row", zap.Error(err))
+			return nil, fmt.Errorf("failed to scan existing domain row: %w", err)
+		}
+		existing[domainName] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		db.log.Error("Failed to iterate existing domain rows", zap.Error(err))
+		return nil, fmt.Errorf("failed to iterate existing domain rows: %w", err)
+	}
+
+	diff := &DomainImportDiff{}
+	seen := make(map[string]bool, len(domainNames))
+	for _, domainName := range domainNames {
+		if seen[domainName] {
+			continue
+		}
+		seen[domainName] = true
+		if existing[domainName] {
+			diff.Existing = append(diff.Existing, domainName)
+		} else {
+			diff.ToAdd = append(diff.ToAdd, domainName)
+		}
+	}
+
+	return diff, nil
+}
+
+// ImportDomains inserts all given domains in a single transaction using one bulk INSERT.
+// Domains that already exist are left untouched. Returns the number of newly inserted domains.
+func (db *DB) ImportDomains(ctx context.Context, domainNames []string) (int, error) {
+	if len(domainNames) == 0 {
+		return 0, nil
+	}
+
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		db.log.Error("Failed to begin domain import transaction", zap.Error(err))
+		return 0, fmt.Errorf("failed to begin domain import transaction: %w", err)
+	}
+	defer func() {
+		// Commit済みの場合Rollbackは何もしない
+		_ = tx.Rollback(ctx)
+	}()
+
+	query := `INSERT INTO domains (domain_name)
+	          SELECT DISTINCT unnest($1::varchar[])
+	          ON CONFLICT (domain_name) DO NOTHING`
+	result, err := tx.Exec(ctx, query, domainNames)
+	if err != nil {
+		db.log.Error("Failed to import domains", zap.Int("count", len(domainNames)), zap.Error(err))
+		return 0, fmt.Errorf("failed to import domains: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		db.log.Error("Failed to commit domain import", zap.Error(err))
+		return 0, fmt.Errorf("failed to commit domain import: %w", err)
+	}
+
+	inserted := int(result.RowsAffected())
+	db.log.Info("Domains imported successfully",
+		zap.Int("requested", len(domainNames)),
+		zap.Int("inserted", inserted))
+	return inserted, nil
+}
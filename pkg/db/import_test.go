@@ -0,0 +1,50 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_PreviewDomainImport(t *testing.T) {
+	testDB := SetupTestDB(t)
+	defer testDB.Cleanup(t)
+
+	err := testDB.DB.CreateDomain(context.Background(), "existing.com")
+	require.NoError(t, err)
+
+	diff, err := testDB.DB.PreviewDomainImport(context.Background(),
+		[]string{"existing.com", "new.com", "new.com"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"new.com"}, diff.ToAdd)
+	assert.Equal(t, []string{"existing.com"}, diff.Existing)
+
+	// Preview must not modify the domains table
+	domains, err := testDB.DB.GetAllDomains(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, domains, 1)
+}
+
+func Test_ImportDomains(t *testing.T) {
+	testDB := SetupTestDB(t)
+	defer testDB.Cleanup(t)
+
+	err := testDB.DB.CreateDomain(context.Background(), "existing.com")
+	require.NoError(t, err)
+
+	inserted, err := testDB.DB.ImportDomains(context.Background(),
+		[]string{"existing.com", "a.com", "b.com", "a.com"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, inserted)
+
+	domains, err := testDB.DB.GetAllDomains(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, domains, 3)
+
+	// Empty input is a no-op
+	inserted, err = testDB.DB.ImportDomains(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, inserted)
+}
@@ -0,0 +1,204 @@
+package db
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// Schema migration operations.
+// migrations/<version>_<name>.sql are applied in version order, once each, and recorded in schema_migrations.
+// Applied migrations must not be edited; change the schema by adding a migration with the next version.
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationFilePattern matches migration file names such as 0001_initial.sql
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.sql$`)
+
+// migrationLockKey is the advisory lock that serializes services migrating the same database at startup
+const migrationLockKey int64 = 0x726d6d67
+
+// Migration is a versioned schema change embedded in the binary
+type Migration struct {
+	Version int64
+	Name    string
+	sql     string
+}
+
+// MigrationStatus is a migration and when it was applied to the database
+type MigrationStatus struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at"` // 未適用の場合nil
+	// Unknown is true for a migration applied by a newer binary that this binary does not include
+	Unknown bool `json:"unknown,omitempty"`
+}
+
+// Migrations returns the embedded migrations in version order
+func Migrations() ([]Migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	migrations := make([]Migration, 0, len(entries))
+	for _, entry := range entries {
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name: %s (must be <version>_<name>.sql)", entry.Name())
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version: %s", entry.Name())
+		}
+		sql, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+		migrations = append(migrations, Migration{Version: version, Name: match[2], sql: string(sql)})
+	}
+
+	slices.SortFunc(migrations, func(a, b Migration) int { return int(a.Version - b.Version) })
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version %d: %s and %s",
+				migrations[i].Version, migrations[i-1].Name, migrations[i].Name)
+		}
+	}
+	return migrations, nil
+}
+
+// Migrate applies the migrations that have not been applied yet and returns them.
+// All pending migrations are applied in one transaction, so a failure leaves the schema unchanged.
+// Services starting at the same time wait for each other instead of applying a migration twice.
+func (db *DB) Migrate(ctx context.Context) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		db.log.Error("Failed to begin migration transaction", zap.Error(err))
+		return nil, fmt.Errorf("failed to begin migration transaction: %w", err)
+	}
+	defer func() {
+		// Commit済みの場合Rollbackは何もしない
+		_ = tx.Rollback(ctx)
+	}()
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLockKey); err != nil {
+		db.log.Error("Failed to lock schema migrations", zap.Error(err))
+		return nil, fmt.Errorf("failed to lock schema migrations: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+	    version BIGINT PRIMARY KEY,
+	    name VARCHAR(255) NOT NULL,
+	    applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`); err != nil {
+		db.log.Error("Failed to create schema_migrations table", zap.Error(err))
+		return nil, fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		db.log.Error("Failed to get applied migrations", zap.Error(err))
+		return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+	appliedVersions, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		db.log.Error("Failed to scan applied migration rows", zap.Error(err))
+		return nil, fmt.Errorf("failed to scan applied migration rows: %w", err)
+	}
+
+	var applied []Migration
+	for _, m := range migrations {
+		if slices.Contains(appliedVersions, m.Version) {
+			continue
+		}
+		// 引数なしのExecはsimple protocolで実行されるため、複数のSQL文を含められる
+		if _, err := tx.Exec(ctx, m.sql); err != nil {
+			db.log.Error("Failed to apply migration",
+				zap.Int64("version", m.Version), zap.String("name", m.Name), zap.Error(err))
+			return nil, fmt.Errorf("failed to apply migration %d_%s: %w", m.Version, m.Name, err)
+		}
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name); err != nil {
+			db.log.Error("Failed to record migration", zap.Int64("version", m.Version), zap.Error(err))
+			return nil, fmt.Errorf("failed to record migration %d_%s: %w", m.Version, m.Name, err)
+		}
+		applied = append(applied, m)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		db.log.Error("Failed to commit migrations", zap.Error(err))
+		return nil, fmt.Errorf("failed to commit migrations: %w", err)
+	}
+
+	for _, m := range applied {
+		db.log.Info("Applied migration", zap.Int64("version", m.Version), zap.String("name", m.Name))
+	}
+	if latest := migrations[len(migrations)-1].Version; len(appliedVersions) > 0 && slices.Max(appliedVersions) > latest {
+		db.log.Warn("Database schema is newer than this binary",
+			zap.Int64("database_version", slices.Max(appliedVersions)),
+			zap.Int64("binary_version", latest))
+	}
+	return applied, nil
+}
+
+// GetMigrationStatus returns every embedded migration and every migration recorded in the database, in version order
+func (db *DB) GetMigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var recorded []MigrationStatus
+	var exists bool
+	if err := db.pool.QueryRow(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		db.log.Error("Failed to check schema_migrations table", zap.Error(err))
+		return nil, fmt.Errorf("failed to check schema_migrations table: %w", err)
+	}
+	if exists {
+		rows, err := db.pool.Query(ctx, `SELECT version, name, applied_at FROM schema_migrations`)
+		if err != nil {
+			db.log.Error("Failed to get applied migrations", zap.Error(err))
+			return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+		}
+		recorded, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (MigrationStatus, error) {
+			var status MigrationStatus
+			err := row.Scan(&status.Version, &status.Name, &status.AppliedAt)
+			return status, err
+		})
+		if err != nil {
+			db.log.Error("Failed to scan applied migration rows", zap.Error(err))
+			return nil, fmt.Errorf("failed to scan applied migration rows: %w", err)
+		}
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version, Name: m.Name}
+		if i := slices.IndexFunc(recorded, func(r MigrationStatus) bool { return r.Version == m.Version }); i >= 0 {
+			status.AppliedAt = recorded[i].AppliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	for _, r := range recorded {
+		if !slices.ContainsFunc(migrations, func(m Migration) bool { return m.Version == r.Version }) {
+			r.Unknown = true
+			statuses = append(statuses, r)
+		}
+	}
+	slices.SortFunc(statuses, func(a, b MigrationStatus) int { return int(a.Version - b.Version) })
+	return statuses, nil
+}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	// versionは1からの連番
+	for i, m := range migrations {
+		assert.Equal(t, int64(i+1), m.Version, m.Name)
+		assert.NotEmpty(t, m.sql, m.Name)
+	}
+	assert.Equal(t, "initial", migrations[0].Name)
+}
+
+func Test_Migrate(t *testing.T) {
+	testDB := SetupTestDB(t)
+	defer testDB.Cleanup(t)
+
+	ctx := context.Background()
+	migrations, err := Migrations()
+	require.NoError(t, err)
+
+	t.Run("SetupTestDB applies every migration", func(t *testing.T) {
+		statuses, err := testDB.DB.GetMigrationStatus(ctx)
+		require.NoError(t, err)
+		require.Len(t, statuses, len(migrations))
+		for _, s := range statuses {
+			assert.NotNil(t, s.AppliedAt, s.Name)
+			assert.False(t, s.Unknown, s.Name)
+		}
+	})
+
+	t.Run("applied migrations are not applied again", func(t *testing.T) {
+		applied, err := testDB.DB.Migrate(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, applied)
+	})
+
+	t.Run("database created without schema_migrations is adopted", func(t *testing.T) {
+		// schema_migrations導入前にinit.sqlで作成されたDBを再現する
+		_, err := testDB.DB.pool.Exec(ctx, `DROP TABLE schema_migrations`)
+		require.NoError(t, err)
+		_, err = testDB.DB.pool.Exec(ctx, `INSERT INTO domains (domain_name) VALUES ('example.com')`)
+		require.NoError(t, err)
+
+		statuses, err := testDB.DB.GetMigrationStatus(ctx)
+		require.NoError(t, err)
+		for _, s := range statuses {
+			assert.Nil(t, s.AppliedAt, s.Name)
+		}
+
+		applied, err := testDB.DB.Migrate(ctx)
+		require.NoError(t, err)
+		assert.Len(t, applied, len(migrations))
+
+		domain, err := testDB.DB.GetDomain(ctx, "example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "example.com", domain.DomainName)
+	})
+
+	t.Run("migrations recorded by a newer binary are reported", func(t *testing.T) {
+		_, err := testDB.DB.pool.Exec(ctx, `INSERT INTO schema_migrations (version, name) VALUES (9999, 'future')`)
+		require.NoError(t, err)
+
+		applied, err := testDB.DB.Migrate(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, applied)
+
+		statuses, err := testDB.DB.GetMigrationStatus(ctx)
+		require.NoError(t, err)
+		last := statuses[len(statuses)-1]
+		assert.Equal(t, int64(9999), last.Version)
+		assert.True(t, last.Unknown)
+	})
+}
@@ -1,4 +1,6 @@
 -- Initialize router_manager database schema
+-- 0001〜0009はschema_migrations導入前にdb/schema/init.sqlで作成されたDBにも適用できるよう、冪等に記述する
+
 -- Create domains table to store blocked domain names
 CREATE TABLE IF NOT EXISTS domains (
     domain_name VARCHAR(255) PRIMARY KEY,
@@ -32,8 +34,8 @@ END;
 $$ language 'plpgsql';
 
 -- Apply triggers to automatically update updated_at columns
-CREATE TRIGGER update_domains_updated_at BEFORE UPDATE ON domains
+CREATE OR REPLACE TRIGGER update_domains_updated_at BEFORE UPDATE ON domains
     FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
 
-CREATE TRIGGER update_domain_ips_updated_at BEFORE UPDATE ON domain_ips
+CREATE OR REPLACE TRIGGER update_domain_ips_updated_at BEFORE UPDATE ON domain_ips
     FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
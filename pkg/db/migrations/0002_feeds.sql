@@ -0,0 +1,34 @@
+-- FALSE: blocklist feedによって追加されたドメイン。どのfeedにも含まれなくなった時点で削除される
+ALTER TABLE domains ADD COLUMN IF NOT EXISTS manual BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- Create feeds table to store subscribed blocklist sources
+CREATE TABLE IF NOT EXISTS feeds (
+    id BIGSERIAL PRIMARY KEY,
+    url TEXT NOT NULL,
+    format VARCHAR(16) NOT NULL DEFAULT 'auto',
+    refresh_interval_seconds INTEGER NOT NULL DEFAULT 86400,
+    etag TEXT NOT NULL DEFAULT '',
+    last_modified TEXT NOT NULL DEFAULT '',
+    last_fetched_at TIMESTAMP,
+    last_status VARCHAR(16) NOT NULL DEFAULT '',
+    last_error TEXT NOT NULL DEFAULT '',
+    last_domain_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT uk_feeds_url UNIQUE (url)
+);
+
+-- Create feed_domains table to store which domains each feed currently provides
+CREATE TABLE IF NOT EXISTS feed_domains (
+    feed_id BIGINT NOT NULL,
+    domain_name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (feed_id, domain_name),
+    CONSTRAINT fk_feed_domains_feed_id FOREIGN KEY (feed_id) REFERENCES feeds(id) ON DELETE CASCADE,
+    CONSTRAINT fk_feed_domains_domain_name FOREIGN KEY (domain_name) REFERENCES domains(domain_name) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_feed_domains_domain_name ON feed_domains(domain_name);
+
+CREATE OR REPLACE TRIGGER update_feeds_updated_at BEFORE UPDATE ON feeds
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
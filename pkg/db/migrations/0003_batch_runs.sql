@@ -0,0 +1,13 @@
+-- Create batch_runs table to record the outcome of each batch execution
+CREATE TABLE IF NOT EXISTS batch_runs (
+    id BIGSERIAL PRIMARY KEY,
+    started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP,
+    -- running, succeeded, partial(一部ドメインの処理に失敗), failed
+    status VARCHAR(16) NOT NULL DEFAULT 'running',
+    domains_total INTEGER NOT NULL DEFAULT 0,
+    domains_failed INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_batch_runs_started_at ON batch_runs(started_at);
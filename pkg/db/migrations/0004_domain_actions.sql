@@ -0,0 +1,5 @@
+-- firewallでの扱い: drop(破棄), reject(TCP RST/ICMP admin-prohibitedで拒否), log(ログ出力後に破棄)
+ALTER TABLE domains ADD COLUMN IF NOT EXISTS action VARCHAR(16) NOT NULL DEFAULT 'drop';
+
+ALTER TABLE domains DROP CONSTRAINT IF EXISTS ck_domains_action;
+ALTER TABLE domains ADD CONSTRAINT ck_domains_action CHECK (action IN ('drop', 'reject', 'log'));
@@ -0,0 +1,20 @@
+-- Create block_counters table to store the last counter values read from the firewall per IP.
+-- firewallのcounterは累積値のため、前回値との差分をdomain_hitsに加算する
+CREATE TABLE IF NOT EXISTS block_counters (
+    ip_address VARCHAR(45) PRIMARY KEY,
+    packets BIGINT NOT NULL DEFAULT 0,
+    bytes BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create domain_hits table to store blocked packets per domain in hourly buckets
+CREATE TABLE IF NOT EXISTS domain_hits (
+    domain_name VARCHAR(255) NOT NULL,
+    bucket TIMESTAMP NOT NULL, -- 1時間単位に切り捨てた時刻
+    packets BIGINT NOT NULL DEFAULT 0,
+    bytes BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (domain_name, bucket),
+    CONSTRAINT fk_domain_hits_domain_name FOREIGN KEY (domain_name) REFERENCES domains(domain_name) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_domain_hits_bucket ON domain_hits(bucket);
@@ -0,0 +1,10 @@
+-- Create block_hits table to store LAN clients whose packets to blocked IPs were logged via NFLOG
+CREATE TABLE IF NOT EXISTS block_hits (
+    id BIGSERIAL PRIMARY KEY,
+    client_ip VARCHAR(45) NOT NULL,
+    dest_ip VARCHAR(45) NOT NULL,
+    domain_name VARCHAR(255), -- 記録時点でdest_ipを持つドメイン。不明な場合NULL
+    hit_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_block_hits_hit_at ON block_hits(hit_at);
@@ -0,0 +1,12 @@
+-- Create run_requests table to store batch runs requested from the API and executed by the batch daemon
+CREATE TABLE IF NOT EXISTS run_requests (
+    id BIGSERIAL PRIMARY KEY,
+    requested_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP, -- daemonが処理を開始した時刻。未処理の場合NULL
+    finished_at TIMESTAMP,
+    batch_run_id BIGINT,
+    CONSTRAINT fk_run_requests_batch_run_id FOREIGN KEY (batch_run_id) REFERENCES batch_runs(id) ON DELETE SET NULL
+);
+
+-- 未処理のリクエストは1件のみ(連続したリクエストは1回の実行にまとめる)
+CREATE UNIQUE INDEX IF NOT EXISTS uk_run_requests_pending ON run_requests((started_at IS NULL)) WHERE started_at IS NULL;
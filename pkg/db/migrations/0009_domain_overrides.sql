@@ -0,0 +1,12 @@
+-- Create domain_overrides table to store time-bounded overrides of domains (1ドメインにつき1件)
+-- block: 期限まで一時的にブロックし、期限到来時にドメインを削除する
+-- exempt: 期限までブロックを解除し、期限到来時にルールを戻す
+CREATE TABLE IF NOT EXISTS domain_overrides (
+    domain_name VARCHAR(255) PRIMARY KEY,
+    kind VARCHAR(16) NOT NULL CHECK (kind IN ('block', 'exempt')),
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_domain_overrides_domain_name FOREIGN KEY (domain_name) REFERENCES domains(domain_name) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_domain_overrides_expires_at ON domain_overrides(expires_at);
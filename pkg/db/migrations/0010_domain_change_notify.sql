@@ -0,0 +1,43 @@
+-- Publish changes of domains and domain overrides on the domain_changes channel so that the batch daemon
+-- can process them immediately. payloadはJSON: {"table": ..., "op": ..., "domains": [...]}
+-- 追加されたドメインのみ名前を含める。それ以外の変更はfirewallの照合で反映されるため、種類のみ通知する
+
+-- Notify the names of inserted domains, 20 per notification to stay below the 8000 byte payload limit
+CREATE OR REPLACE FUNCTION notify_domain_inserts()
+RETURNS TRIGGER AS $$
+DECLARE
+    names TEXT[];
+BEGIN
+    FOR names IN
+        SELECT array_agg(domain_name)
+        FROM (SELECT domain_name, row_number() OVER () - 1 AS n FROM new_rows) numbered
+        GROUP BY n / 20
+    LOOP
+        PERFORM pg_notify('domain_changes',
+            json_build_object('table', TG_TABLE_NAME, 'op', TG_OP, 'domains', names)::text);
+    END LOOP;
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+-- Notify other changes without names. 同一トランザクション内の同じpayloadの通知は1件にまとめられる
+CREATE OR REPLACE FUNCTION notify_domain_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify('domain_changes', json_build_object('table', TG_TABLE_NAME, 'op', TG_OP)::text);
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+CREATE OR REPLACE TRIGGER notify_domains_insert AFTER INSERT ON domains
+    REFERENCING NEW TABLE AS new_rows
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_domain_inserts();
+
+CREATE OR REPLACE TRIGGER notify_domains_action_update AFTER UPDATE OF action ON domains
+    FOR EACH ROW WHEN (OLD.action IS DISTINCT FROM NEW.action) EXECUTE FUNCTION notify_domain_change();
+
+CREATE OR REPLACE TRIGGER notify_domains_delete AFTER DELETE ON domains
+    FOR EACH ROW EXECUTE FUNCTION notify_domain_change();
+
+CREATE OR REPLACE TRIGGER notify_domain_overrides_change AFTER INSERT OR UPDATE OR DELETE ON domain_overrides
+    FOR EACH ROW EXECUTE FUNCTION notify_domain_change();
@@ -0,0 +1,3 @@
+-- Record the number of managed firewall rules present when a batch run finishes, for health checks.
+-- NULLの場合は数えていない(記録前の実行、またはfirewallの一覧取得に失敗した実行)
+ALTER TABLE batch_runs ADD COLUMN IF NOT EXISTS firewall_rules INTEGER;
@@ -0,0 +1,61 @@
+-- Create firewall_ops table as an outbox of firewall changes. Triggers queue an operation for every IP whose rule
+-- has to change, in the same transaction as the change of domain_ips, domains.action or an exempt override,
+-- so that a crash between the database and the firewall update leaves the operation pending instead of losing it.
+-- add: IPが追加された, remove: IPが削除された, update: actionまたは一時除外が変更された
+-- 適用時はopの種類ではなくその時点のDBの状態からIPのあるべきルールを求めるため、何度適用しても同じ結果になる
+CREATE TABLE IF NOT EXISTS firewall_ops (
+    id BIGSERIAL PRIMARY KEY,
+    ip_address VARCHAR(45) NOT NULL,
+    op VARCHAR(8) NOT NULL CHECK (op IN ('add', 'remove', 'update')),
+    domain_name VARCHAR(255) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Queue the IPs of a domain_ips row
+CREATE OR REPLACE FUNCTION queue_domain_ip_firewall_op()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO firewall_ops (ip_address, op, domain_name) VALUES (NEW.ip_address, 'add', NEW.domain_name);
+    ELSE
+        INSERT INTO firewall_ops (ip_address, op, domain_name) VALUES (OLD.ip_address, 'remove', OLD.domain_name);
+    END IF;
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+-- Queue every IP of the domain whose action or exempt override changed
+CREATE OR REPLACE FUNCTION queue_domain_firewall_ops()
+RETURNS TRIGGER AS $$
+DECLARE
+    name VARCHAR(255);
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        name := OLD.domain_name;
+    ELSE
+        name := NEW.domain_name;
+    END IF;
+    INSERT INTO firewall_ops (ip_address, op, domain_name)
+    SELECT ip_address, 'update', domain_name FROM domain_ips WHERE domain_name = name;
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+-- ドメイン削除時のIPはdomain_ipsのCASCADE削除でremoveとして登録される
+CREATE OR REPLACE TRIGGER queue_domain_ips_firewall_op AFTER INSERT OR DELETE ON domain_ips
+    FOR EACH ROW EXECUTE FUNCTION queue_domain_ip_firewall_op();
+
+CREATE OR REPLACE TRIGGER queue_domains_action_firewall_ops AFTER UPDATE OF action ON domains
+    FOR EACH ROW WHEN (OLD.action IS DISTINCT FROM NEW.action) EXECUTE FUNCTION queue_domain_firewall_ops();
+
+-- 一時ブロックはIPの追加・削除として登録されるため、一時除外のみ対象にする
+CREATE OR REPLACE TRIGGER queue_domain_overrides_insert_firewall_ops AFTER INSERT ON domain_overrides
+    FOR EACH ROW WHEN (NEW.kind = 'exempt') EXECUTE FUNCTION queue_domain_firewall_ops();
+
+CREATE OR REPLACE TRIGGER queue_domain_overrides_update_firewall_ops AFTER UPDATE ON domain_overrides
+    FOR EACH ROW WHEN (OLD.kind = 'exempt' OR NEW.kind = 'exempt') EXECUTE FUNCTION queue_domain_firewall_ops();
+
+CREATE OR REPLACE TRIGGER queue_domain_overrides_delete_firewall_ops AFTER DELETE ON domain_overrides
+    FOR EACH ROW WHEN (OLD.kind = 'exempt') EXECUTE FUNCTION queue_domain_firewall_ops();
@@ -0,0 +1,65 @@
+-- Create nodes table for several routers sharing one database. Each router (node) records its own firewall state,
+-- and firewall_ops are queued once per node so that every node applies them to its own firewall.
+CREATE TABLE IF NOT EXISTS nodes (
+    name VARCHAR(255) PRIMARY KEY,
+    booted_at TIMESTAMP,             -- 再起動後に既存のIPのルールを再適用した時刻
+    applied_at TIMESTAMP,            -- 最後にfirewallをDBと照合した時刻
+    firewall_rules INTEGER,          -- 照合後の管理対象ルール数
+    last_seen_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- NULLはnode導入前に登録された操作、またはnodeが登録されていない場合の操作で、いずれかのnodeが適用する
+ALTER TABLE firewall_ops ADD COLUMN IF NOT EXISTS node_name VARCHAR(255);
+CREATE INDEX IF NOT EXISTS idx_firewall_ops_node_name ON firewall_ops(node_name, id);
+
+ALTER TABLE batch_runs ADD COLUMN IF NOT EXISTS node_name VARCHAR(255) NOT NULL DEFAULT '';
+
+-- The node resolving the domains. The other nodes only apply the IPs it records.
+-- 期限内に更新されなかった場合、次に実行したnodeが引き継ぐ
+CREATE TABLE IF NOT EXISTS resolver_lease (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    node_name VARCHAR(255) NOT NULL,
+    acquired_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL
+);
+
+-- Queue an operation for every node seen in the last 7 days (NodeStaleAfter), or for any node if none is registered.
+-- 7日以上実行していないnodeは、次回の実行時の照合で差分を解消する
+CREATE OR REPLACE FUNCTION queue_firewall_op(ip VARCHAR, op_name VARCHAR, domain VARCHAR)
+RETURNS VOID AS $$
+BEGIN
+    INSERT INTO firewall_ops (ip_address, op, domain_name, node_name)
+    SELECT ip, op_name, domain, name FROM nodes WHERE last_seen_at > CURRENT_TIMESTAMP - INTERVAL '7 days';
+    IF NOT FOUND THEN
+        INSERT INTO firewall_ops (ip_address, op, domain_name) VALUES (ip, op_name, domain);
+    END IF;
+END;
+$$ language 'plpgsql';
+
+CREATE OR REPLACE FUNCTION queue_domain_ip_firewall_op()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        PERFORM queue_firewall_op(NEW.ip_address, 'add', NEW.domain_name);
+    ELSE
+        PERFORM queue_firewall_op(OLD.ip_address, 'remove', OLD.domain_name);
+    END IF;
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+CREATE OR REPLACE FUNCTION queue_domain_firewall_ops()
+RETURNS TRIGGER AS $$
+DECLARE
+    name VARCHAR(255);
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        name := OLD.domain_name;
+    ELSE
+        name := NEW.domain_name;
+    END IF;
+    PERFORM queue_firewall_op(ip_address, 'update', domain_name) FROM domain_ips WHERE domain_name = name;
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
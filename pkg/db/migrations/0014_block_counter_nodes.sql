@@ -0,0 +1,6 @@
+-- Keep the last counter values per node. Each router reads the counters of its own firewall,
+-- so the increase must be computed against the values the same node read before.
+-- 既存の値はnode未設定('')の実行のものとして残す
+ALTER TABLE block_counters ADD COLUMN IF NOT EXISTS node_name VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE block_counters DROP CONSTRAINT IF EXISTS block_counters_pkey;
+ALTER TABLE block_counters ADD PRIMARY KEY (node_name, ip_address);
@@ -1,19 +1,275 @@
 package db
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
+
+// BlockAction is the firewall action applied to the IPs of a blocked domain
+type BlockAction string
+
+const (
+	BlockActionDrop   BlockAction = "drop"   // 応答せずに破棄(クライアントはタイムアウトまで待つ)
+	BlockActionReject BlockAction = "reject" // TCPはRST、それ以外はICMP admin-prohibitedを返して即座に失敗させる
+	BlockActionLog    BlockAction = "log"    // ログ出力後に破棄
+)
+
+// ParseBlockAction converts a string into a BlockAction
+func ParseBlockAction(s string) (BlockAction, error) {
+	switch a := BlockAction(s); a {
+	case BlockActionDrop, BlockActionReject, BlockActionLog:
+		return a, nil
+	default:
+		return "", fmt.Errorf("unknown block action: %q (must be drop, reject or log)", s)
+	}
+}
+
+// UserRole is the permission level of an api service user
+type UserRole string
+
+const (
+	UserRoleAdmin  UserRole = "admin"  // 全ての操作が可能
+	UserRoleViewer UserRole = "viewer" // 参照のみ
+)
+
+// ParseUserRole converts a string into a UserRole
+func ParseUserRole(s string) (UserRole, error) {
+	switch r := UserRole(s); r {
+	case UserRoleAdmin, UserRoleViewer:
+		return r, nil
+	default:
+		return "", fmt.Errorf("unknown user role: %q (must be admin or viewer)", s)
+	}
+}
+
+// OverrideKind is the kind of a time-bounded domain override
+type OverrideKind string
+
+const (
+	OverrideKindBlock  OverrideKind = "block"  // 期限まで一時的にブロック。期限到来時にドメインを削除
+	OverrideKindExempt OverrideKind = "exempt" // 期限までブロックを解除
+)
+
+// MaxOverrideDuration is the longest period an override can last
+const MaxOverrideDuration = 366 * 24 * time.Hour
+
+// ParseOverrideKind converts a string into an OverrideKind
+func ParseOverrideKind(s string) (OverrideKind, error) {
+	switch k := OverrideKind(s); k {
+	case OverrideKindBlock, OverrideKindExempt:
+		return k, nil
+	default:
+		return "", fmt.Errorf("unknown override kind: %q (must be block or exempt)", s)
+	}
+}
 
 // Domain represents a blocked domain entry
 type Domain struct {
-	DomainName string    `db:"domain_name"`
-	CreatedAt  time.Time `db:"created_at"`
-	UpdatedAt  time.Time `db:"updated_at"`
+	DomainName string      `db:"domain_name"`
+	Manual     bool        `db:"manual"` // falseの場合blocklist feedが管理するドメイン
+	Action     BlockAction `db:"action"`
+	CreatedAt  time.Time   `db:"created_at"`
+	UpdatedAt  time.Time   `db:"updated_at"`
 }
 
 // DomainIP represents an IP address associated with a blocked domain
 type DomainIP struct {
+	ID         int64       `db:"id"`
+	DomainName string      `db:"domain_name"`
+	IPAddress  string      `db:"ip_address"`
+	Action     BlockAction `db:"action"` // 所属ドメインのaction。GetDomainIPs/GetAllDomainIPsでのみ設定される
+	CreatedAt  time.Time   `db:"created_at"`
+	UpdatedAt  time.Time   `db:"updated_at"`
+}
+
+// DomainImportDiff represents the difference between an import source and the domains table
+type DomainImportDiff struct {
+	ToAdd    []string // 未登録のため追加されるドメイン
+	Existing []string // 登録済みのため変更されないドメイン
+}
+
+// Feed represents a subscribed blocklist source that is refreshed periodically
+type Feed struct {
+	ID                     int64      `db:"id"`
+	URL                    string     `db:"url"` // http(s):// または file://
+	Format                 string     `db:"format"`
+	RefreshIntervalSeconds int        `db:"refresh_interval_seconds"`
+	ETag                   string     `db:"etag"`
+	LastModified           string     `db:"last_modified"`
+	LastFetchedAt          *time.Time `db:"last_fetched_at"`
+	LastStatus             string     `db:"last_status"` // FeedStatus*
+	LastError              string     `db:"last_error"`
+	LastDomainCount        int        `db:"last_domain_count"`
+	CreatedAt              time.Time  `db:"created_at"`
+	UpdatedAt              time.Time  `db:"updated_at"`
+}
+
+// RefreshInterval returns the feed refresh interval as a time.Duration
+func (f Feed) RefreshInterval() time.Duration {
+	return time.Duration(f.RefreshIntervalSeconds) * time.Second
+}
+
+// Feed fetch statuses stored in feeds.last_status
+const (
+	FeedStatusUpdated     = "updated"
+	FeedStatusNotModified = "not_modified"
+	FeedStatusError       = "error"
+)
+
+// FeedFetchResult holds the outcome of a feed fetch to be recorded on the feed
+type FeedFetchResult struct {
+	Status       string
+	ETag         string
+	LastModified string
+	Error        string
+	DomainCount  int
+}
+
+// FeedSyncResult represents the changes made when replacing the domains provided by a feed
+type FeedSyncResult struct {
+	AddedDomains   int        // feedによって新規作成されたドメイン数
+	DroppedDomains []string   // feedに含まれなくなったドメイン
+	RemovedDomains []string   // どのfeedにも含まれなくなり削除されたドメイン
+	RemovedIPs     []DomainIP // 削除されたドメインに紐づいていたIP(firewall ruleの削除が必要)
+}
+
+// Batch run statuses stored in batch_runs.status
+const (
+	BatchRunStatusRunning   = "running"
+	BatchRunStatusSucceeded = "succeeded"
+	BatchRunStatusPartial   = "partial" // 一部ドメインの処理に失敗
+	BatchRunStatusFailed    = "failed"
+)
+
+// BatchRun represents a single execution of the batch
+type BatchRun struct {
+	ID            int64      `db:"id" json:"id"`
+	StartedAt     time.Time  `db:"started_at" json:"started_at"`
+	FinishedAt    *time.Time `db:"finished_at" json:"finished_at"` // 実行中の場合nil
+	Status        string     `db:"status" json:"status"`           // BatchRunStatus*
+	DomainsTotal  int        `db:"domains_total" json:"domains_total"`
+	DomainsFailed int        `db:"domains_failed" json:"domains_failed"`
+	Error         string     `db:"error" json:"error"`
+	FirewallRules *int       `db:"firewall_rules" json:"firewall_rules"` // 数えていない場合nil
+	NodeName      string     `db:"node_name" json:"node_name"`           // 実行したnode(node導入前の実行は空)
+}
+
+// RunRequest represents a batch run requested through the API, executed by the batch daemon
+type RunRequest struct {
+	ID          int64      `db:"id" json:"id"`
+	RequestedAt time.Time  `db:"requested_at" json:"requested_at"`
+	StartedAt   *time.Time `db:"started_at" json:"started_at"`     // 未処理の場合nil
+	FinishedAt  *time.Time `db:"finished_at" json:"finished_at"`   // 実行中の場合nil
+	BatchRunID  *int64     `db:"batch_run_id" json:"batch_run_id"` // 実行結果を記録できなかった場合nil
+}
+
+// BatchRunResult holds the outcome of a batch run to be recorded when it finishes
+type BatchRunResult struct {
+	Status        string
+	DomainsTotal  int
+	DomainsFailed int
+	Error         string
+	FirewallRules *int // 実行終了時に存在した管理対象のルール数。数えられなかった場合nil
+}
+
+// DomainHitBucket holds the traffic blocked for a domain within one hour
+type DomainHitBucket struct {
+	Bucket  time.Time `db:"bucket" json:"bucket"`
+	Packets int64     `db:"packets" json:"packets"`
+	Bytes   int64     `db:"bytes" json:"bytes"`
+}
+
+// BlockCounter holds the cumulative counter values read from the firewall rules of an IP
+type BlockCounter struct {
+	IPAddress string
+	Packets   int64
+	Bytes     int64
+}
+
+// DomainHits represents the blocked traffic of a domain within a time window
+type DomainHits struct {
+	DomainName string      `db:"domain_name" json:"domain"`
+	Action     BlockAction `db:"action" json:"action"`
+	Packets    int64       `db:"packets" json:"packets"`
+	Bytes      int64       `db:"bytes" json:"bytes"`
+}
+
+// BlockHit is a packet from a LAN client to a blocked IP, logged by the firewall
+type BlockHit struct {
+	ClientIP string
+	DestIP   string
+	HitAt    time.Time
+}
+
+// BlockHitSummary aggregates the logged packets of a client to a domain
+type BlockHitSummary struct {
+	ClientIP   string    `db:"client_ip" json:"client_ip"`
+	DomainName *string   `db:"domain_name" json:"domain"` // dest_ipがドメインに紐付かない場合nil
+	DestIPs    []string  `db:"dest_ips" json:"dest_ips"`
+	Hits       int64     `db:"hits" json:"hits"`
+	FirstHitAt time.Time `db:"first_hit_at" json:"first_hit_at"`
+	LastHitAt  time.Time `db:"last_hit_at" json:"last_hit_at"`
+}
+
+// User represents an account of the api service
+type User struct {
+	ID           int64     `db:"id" json:"id"`
+	Username     string    `db:"username" json:"username"`
+	PasswordHash string    `db:"password_hash" json:"-"` // bcrypt
+	Role         UserRole  `db:"role" json:"role"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt    time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// APIToken represents a token used by scripts to call the api service as its user.
+// The token itself is only shown once when created; only its hash is stored.
+type APIToken struct {
+	ID         int64      `db:"id" json:"id"`
+	UserID     int64      `db:"user_id" json:"user_id"`
+	Name       string     `db:"name" json:"name"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+	LastUsedAt *time.Time `db:"last_used_at" json:"last_used_at"` // 未使用の場合nil
+}
+
+// DomainOverride represents a time-bounded override of a domain
+type DomainOverride struct {
+	DomainName string       `db:"domain_name" json:"domain"`
+	Kind       OverrideKind `db:"kind" json:"kind"`
+	ExpiresAt  time.Time    `db:"expires_at" json:"expires_at"`
+	CreatedAt  time.Time    `db:"created_at" json:"created_at"`
+}
+
+// DomainChange is a change of domains or domain overrides published on DomainChangeChannel
+type DomainChange struct {
+	Table string `json:"table"` // domains, domain_overrides
+	Op    string `json:"op"`    // INSERT, UPDATE, DELETE
+	// Domains are the names of inserted domains. Other changes do not name the domains.
+	Domains []string `json:"domains"`
+}
+
+// FirewallOp is a pending firewall change queued by the database together with the change of a domain IP,
+// a domain's action or an exempt override
+type FirewallOp struct {
 	ID         int64     `db:"id"`
-	DomainName string    `db:"domain_name"`
 	IPAddress  string    `db:"ip_address"`
+	Op         string    `db:"op"` // add, remove, update
+	DomainName string    `db:"domain_name"`
+	Attempts   int       `db:"attempts"` // これまでに適用に失敗した回数
+	LastError  string    `db:"last_error"`
 	CreatedAt  time.Time `db:"created_at"`
-	UpdatedAt  time.Time `db:"updated_at"`
+	NodeName   *string   `db:"node_name"` // 適用するnode(nil: いずれかのnode)
+	// Action is the action the rule of the IP should have when the operation is claimed,
+	// or nil when the IP should not be blocked (no domain has it or all of them are exempt)
+	Action *BlockAction `db:"action"`
+}
+
+// Node represents a router applying the blocklist of the shared database to its own firewall
+type Node struct {
+	Name          string     `db:"name" json:"name"`
+	BootedAt      *time.Time `db:"booted_at" json:"booted_at"`           // 再起動後にルールを再適用していない場合nil
+	AppliedAt     *time.Time `db:"applied_at" json:"applied_at"`         // firewallをDBと照合していない場合nil
+	FirewallRules *int       `db:"firewall_rules" json:"firewall_rules"` // 照合していない場合nil
+	LastSeenAt    time.Time  `db:"last_seen_at" json:"last_seen_at"`
+	CreatedAt     time.Time  `db:"created_at" json:"created_at"`
+	Resolver      bool       `db:"resolver" json:"resolver"` // ドメインの名前解決を担当しているか
 }
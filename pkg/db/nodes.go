@@ -0,0 +1,150 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// NodeStaleAfter is how long a node may go without running before firewall operations are no longer queued for it.
+// A node coming back after that converges at the reconciliation of its next batch run.
+// 0013_nodes.sqlのqueue_firewall_opと同じ期間
+const NodeStaleAfter = 7 * 24 * time.Hour
+
+// nodeColumns lists the columns of Node, Resolver is computed from resolver_lease
+const nodeColumns = `n.name, n.booted_at, n.applied_at, n.firewall_rules, n.last_seen_at, n.created_at,
+                     COALESCE(r.node_name = n.name AND r.expires_at > CURRENT_TIMESTAMP, false) AS resolver`
+
+// RegisterNode records that this node (Config.Node) is running, so that firewall operations are queued for it.
+// Operations left for nodes that have not run for NodeStaleAfter are dropped.
+func (db *DB) RegisterNode(ctx context.Context) error {
+	query := `INSERT INTO nodes (name) VALUES ($1)
+	          ON CONFLICT (name) DO UPDATE SET last_seen_at = CURRENT_TIMESTAMP`
+	if _, err := db.pool.Exec(ctx, query, db.node); err != nil {
+		db.log.Error("Failed to register node", zap.String("node", db.node), zap.Error(err))
+		return fmt.Errorf("failed to register node %s: %w", db.node, err)
+	}
+
+	query = `DELETE FROM firewall_ops WHERE node_name IN (
+	             SELECT name FROM nodes WHERE last_seen_at <= CURRENT_TIMESTAMP - make_interval(secs => $1))`
+	tag, err := db.pool.Exec(ctx, query, NodeStaleAfter.Seconds())
+	if err != nil {
+		db.log.Error("Failed to drop firewall operations of stale nodes", zap.Error(err))
+		return fmt.Errorf("failed to drop firewall operations of stale nodes: %w", err)
+	}
+	if tag.RowsAffected() > 0 {
+		db.log.Info("Dropped firewall operations of stale nodes", zap.Int64("operations", tag.RowsAffected()))
+	}
+	return nil
+}
+
+// RecordNodeBoot records that this node re-applied the rules of the existing IPs after a reboot
+func (db *DB) RecordNodeBoot(ctx context.Context) error {
+	query := `UPDATE nodes SET booted_at = CURRENT_TIMESTAMP, last_seen_at = CURRENT_TIMESTAMP WHERE name = $1`
+	if _, err := db.pool.Exec(ctx, query, db.node); err != nil {
+		db.log.Error("Failed to record node boot", zap.String("node", db.node), zap.Error(err))
+		return fmt.Errorf("failed to record boot of node %s: %w", db.node, err)
+	}
+	return nil
+}
+
+// RecordNodeApplied records that this node reconciled its firewall with the database, leaving rules managed rules
+func (db *DB) RecordNodeApplied(ctx context.Context, rules int) error {
+	query := `UPDATE nodes SET applied_at = CURRENT_TIMESTAMP, firewall_rules = $2, last_seen_at = CURRENT_TIMESTAMP
+	          WHERE name = $1`
+	if _, err := db.pool.Exec(ctx, query, db.node, rules); err != nil {
+		db.log.Error("Failed to record node firewall state", zap.String("node", db.node), zap.Error(err))
+		return fmt.Errorf("failed to record firewall state of node %s: %w", db.node, err)
+	}
+	return nil
+}
+
+// GetActiveNodeAges returns how long ago each node last ran, by node name. Nodes that have not run for NodeStaleAfter
+// are treated as removed and left out. The ages are computed by the database as in GetLastFinishedBatchRun.
+func (db *DB) GetActiveNodeAges(ctx context.Context) (map[string]time.Duration, error) {
+	query := `SELECT name, EXTRACT(EPOCH FROM CURRENT_TIMESTAMP - last_seen_at)::float8 FROM nodes
+	          WHERE last_seen_at > CURRENT_TIMESTAMP - make_interval(secs => $1)`
+	rows, err := db.pool.Query(ctx, query, NodeStaleAfter.Seconds())
+	if err != nil {
+		db.log.Error("Failed to get node ages", zap.Error(err))
+		return nil, fmt.Errorf("failed to get node ages: %w", err)
+	}
+	defer rows.Close()
+
+	ages := make(map[string]time.Duration)
+	for rows.Next() {
+		var name string
+		var ageSeconds float64
+		if err := rows.Scan(&name, &ageSeconds); err != nil {
+			db.log.Error("Failed to scan node age row", zap.Error(err))
+			return nil, fmt.Errorf("failed to scan node age row: %w", err)
+		}
+		ages[name] = time.Duration(ageSeconds * float64(time.Second))
+	}
+	if err := rows.Err(); err != nil {
+		db.log.Error("Failed to get node ages", zap.Error(err))
+		return nil, fmt.Errorf("failed to get node ages: %w", err)
+	}
+	return ages, nil
+}
+
+// GetAllNodes retrieves the registered nodes ordered by name
+func (db *DB) GetAllNodes(ctx context.Context) ([]Node, error) {
+	query := `SELECT ` + nodeColumns + ` FROM nodes n LEFT JOIN resolver_lease r ON true ORDER BY n.name`
+	rows, err := db.pool.Query(ctx, query)
+	if err != nil {
+		db.log.Error("Failed to get nodes", zap.Error(err))
+		return nil, fmt.Errorf("failed to get nodes: %w", err)
+	}
+	nodes, err := pgx.CollectRows(rows, pgx.RowToStructByName[Node])
+	if err != nil {
+		db.log.Error("Failed to scan node rows", zap.Error(err))
+		return nil, fmt.Errorf("failed to scan node rows: %w", err)
+	}
+	return nodes, nil
+}
+
+// ClaimResolver takes or renews the resolver lease for this node until ttl from now, unless another node holds
+// an unexpired lease. Reports whether this node holds the lease and returns the node holding it.
+func (db *DB) ClaimResolver(ctx context.Context, ttl time.Duration) (bool, string, error) {
+	query := `INSERT INTO resolver_lease (node_name, expires_at)
+	          VALUES ($1, CURRENT_TIMESTAMP + make_interval(secs => $2))
+	          ON CONFLICT (id) DO UPDATE SET
+	              node_name = EXCLUDED.node_name,
+	              expires_at = EXCLUDED.expires_at,
+	              acquired_at = CASE WHEN resolver_lease.node_name = EXCLUDED.node_name
+	                                 THEN resolver_lease.acquired_at ELSE CURRENT_TIMESTAMP END
+	          WHERE resolver_lease.node_name = EXCLUDED.node_name OR resolver_lease.expires_at <= CURRENT_TIMESTAMP
+	          RETURNING node_name`
+	var holder string
+	err := db.pool.QueryRow(ctx, query, db.node, ttl.Seconds()).Scan(&holder)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// 他のnodeが期限内のleaseを保持している
+		err = db.pool.QueryRow(ctx, `SELECT node_name FROM resolver_lease`).Scan(&holder)
+	}
+	if err != nil {
+		db.log.Error("Failed to claim resolver lease", zap.String("node", db.node), zap.Error(err))
+		return false, "", fmt.Errorf("failed to claim resolver lease: %w", err)
+	}
+	return holder == db.node, holder, nil
+}
+
+// CheckResolver reports whether ClaimResolver would let this node resolve the domains, without taking the lease,
+// and returns the node holding an unexpired lease ("": none)
+func (db *DB) CheckResolver(ctx context.Context) (bool, string, error) {
+	var holder string
+	err := db.pool.QueryRow(ctx,
+		`SELECT node_name FROM resolver_lease WHERE expires_at > CURRENT_TIMESTAMP`).Scan(&holder)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return true, "", nil
+	}
+	if err != nil {
+		db.log.Error("Failed to check resolver lease", zap.String("node", db.node), zap.Error(err))
+		return false, "", fmt.Errorf("failed to check resolver lease: %w", err)
+	}
+	return holder == db.node, holder, nil
+}
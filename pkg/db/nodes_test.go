@@ -0,0 +1,158 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Nodes(t *testing.T) {
+	testDB := SetupTestDB(t)
+	defer testDB.Cleanup(t)
+
+	ctx := context.Background()
+	nodeA := &DB{pool: testDB.DB.pool, log: testDB.DB.log, node: "main"}
+	nodeB := &DB{pool: testDB.DB.pool, log: testDB.DB.log, node: "guest"}
+
+	t.Run("firewall operations are queued for each node", func(t *testing.T) {
+		testDB.ClearTables(t)
+		require.NoError(t, nodeA.RegisterNode(ctx))
+		require.NoError(t, nodeB.RegisterNode(ctx))
+		require.NoError(t, testDB.DB.CreateDomain(ctx, "example.com"))
+		_, err := testDB.DB.UpsertDomainIPs(ctx, "example.com", []string{"192.0.2.1"})
+		require.NoError(t, err)
+
+		for _, node := range []*DB{nodeA, nodeB} {
+			var applied []FirewallOp
+			claimed, err := node.ApplyFirewallOps(ctx, 10, func(_ context.Context, ops []FirewallOp) map[int64]error {
+				applied = ops
+				return nil
+			})
+			require.NoError(t, err)
+			assert.Equal(t, 1, claimed, node.node)
+			if assert.Len(t, applied, 1) {
+				assert.Equal(t, node.node, *applied[0].NodeName)
+				assert.Equal(t, "192.0.2.1", applied[0].IPAddress)
+			}
+		}
+	})
+
+	t.Run("operations of stale nodes are dropped", func(t *testing.T) {
+		testDB.ClearTables(t)
+		require.NoError(t, nodeA.RegisterNode(ctx))
+		require.NoError(t, nodeB.RegisterNode(ctx))
+		require.NoError(t, testDB.DB.CreateDomain(ctx, "example.com"))
+		_, err := testDB.DB.UpsertDomainIPs(ctx, "example.com", []string{"192.0.2.1"})
+		require.NoError(t, err)
+
+		_, err = testDB.DB.pool.Exec(ctx, `UPDATE nodes SET last_seen_at = CURRENT_TIMESTAMP - INTERVAL '8 days' WHERE name = 'guest'`)
+		require.NoError(t, err)
+		require.NoError(t, nodeA.RegisterNode(ctx))
+		var pending int
+		require.NoError(t, testDB.DB.pool.QueryRow(ctx, `SELECT COUNT(*) FROM firewall_ops WHERE node_name = 'guest'`).Scan(&pending))
+		assert.Zero(t, pending)
+
+		// 新しい操作も登録されない
+		_, err = testDB.DB.UpsertDomainIPs(ctx, "example.com", []string{"192.0.2.2"})
+		require.NoError(t, err)
+		require.NoError(t, testDB.DB.pool.QueryRow(ctx, `SELECT COUNT(*) FROM firewall_ops WHERE node_name = 'guest'`).Scan(&pending))
+		assert.Zero(t, pending)
+	})
+
+	t.Run("resolver lease is kept by its node until it expires", func(t *testing.T) {
+		testDB.ClearTables(t)
+		require.NoError(t, nodeA.RegisterNode(ctx))
+		require.NoError(t, nodeB.RegisterNode(ctx))
+
+		// leaseがない場合はどのnodeも名前解決できる
+		resolver, holder, err := nodeB.CheckResolver(ctx)
+		require.NoError(t, err)
+		assert.True(t, resolver)
+		assert.Empty(t, holder)
+
+		claimed, holder, err := nodeA.ClaimResolver(ctx, time.Hour)
+		require.NoError(t, err)
+		assert.True(t, claimed)
+		assert.Equal(t, "main", holder)
+		claimed, holder, err = nodeB.ClaimResolver(ctx, time.Hour)
+		require.NoError(t, err)
+		assert.False(t, claimed)
+		assert.Equal(t, "main", holder)
+		resolver, holder, err = nodeB.CheckResolver(ctx)
+		require.NoError(t, err)
+		assert.False(t, resolver)
+		assert.Equal(t, "main", holder)
+
+		_, err = testDB.DB.pool.Exec(ctx, `UPDATE resolver_lease SET expires_at = CURRENT_TIMESTAMP - INTERVAL '1 second'`)
+		require.NoError(t, err)
+		// 期限切れのleaseは確認しても取得しない
+		resolver, holder, err = nodeB.CheckResolver(ctx)
+		require.NoError(t, err)
+		assert.True(t, resolver)
+		assert.Empty(t, holder)
+		claimed, holder, err = nodeB.ClaimResolver(ctx, time.Hour)
+		require.NoError(t, err)
+		assert.True(t, claimed)
+		assert.Equal(t, "guest", holder)
+
+		nodes, err := testDB.DB.GetAllNodes(ctx)
+		require.NoError(t, err)
+		require.Len(t, nodes, 2)
+		assert.Equal(t, "guest", nodes[0].Name)
+		assert.True(t, nodes[0].Resolver)
+		assert.False(t, nodes[1].Resolver)
+	})
+
+	t.Run("node state is recorded", func(t *testing.T) {
+		testDB.ClearTables(t)
+		require.NoError(t, nodeA.RegisterNode(ctx))
+		require.NoError(t, nodeA.RecordNodeBoot(ctx))
+		require.NoError(t, nodeA.RecordNodeApplied(ctx, 12))
+
+		nodes, err := testDB.DB.GetAllNodes(ctx)
+		require.NoError(t, err)
+		require.Len(t, nodes, 1)
+		assert.NotNil(t, nodes[0].BootedAt)
+		assert.NotNil(t, nodes[0].AppliedAt)
+		if assert.NotNil(t, nodes[0].FirewallRules) {
+			assert.Equal(t, 12, *nodes[0].FirewallRules)
+		}
+	})
+
+	t.Run("ages of removed nodes are left out", func(t *testing.T) {
+		testDB.ClearTables(t)
+		require.NoError(t, nodeA.RegisterNode(ctx))
+		require.NoError(t, nodeB.RegisterNode(ctx))
+		_, err := testDB.DB.pool.Exec(ctx, `UPDATE nodes SET last_seen_at = CURRENT_TIMESTAMP - INTERVAL '3 hours' WHERE name = 'main'`)
+		require.NoError(t, err)
+
+		ages, err := testDB.DB.GetActiveNodeAges(ctx)
+		require.NoError(t, err)
+		require.Len(t, ages, 2)
+		assert.InDelta(t, (3 * time.Hour).Seconds(), ages["main"].Seconds(), 60)
+		assert.Less(t, ages["guest"], time.Minute)
+
+		_, err = testDB.DB.pool.Exec(ctx, `UPDATE nodes SET last_seen_at = CURRENT_TIMESTAMP - INTERVAL '8 days' WHERE name = 'main'`)
+		require.NoError(t, err)
+		ages, err = testDB.DB.GetActiveNodeAges(ctx)
+		require.NoError(t, err)
+		assert.NotContains(t, ages, "main")
+	})
+
+	t.Run("run locks of different nodes are independent", func(t *testing.T) {
+		releaseA, err := nodeA.AcquireRunLock(ctx, "main pid=1", false)
+		require.NoError(t, err)
+		defer releaseA(ctx) //nolint:errcheck
+
+		releaseB, err := nodeB.AcquireRunLock(ctx, "guest pid=1", false)
+		require.NoError(t, err)
+		require.NoError(t, releaseB(ctx))
+
+		holder, err := nodeA.RunLockHolder(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "main pid=1", holder)
+	})
+}
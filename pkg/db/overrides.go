@@ -0,0 +1,231 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+)
+
+// Domain override repository operations.
+// DBのTIMESTAMPはタイムゾーンを持たないため、期限は常にDB側の時刻を基準に計算・比較する。
+
+const overrideColumns = `domain_name, kind, expires_at, created_at`
+
+// SetDomainOverride sets a time-bounded override of a domain that expires after duration.
+// A block override creates the domain as a manual domain; an exempt override requires the domain to exist.
+// Setting an override of the same kind again replaces its expiry.
+func (db *DB) SetDomainOverride(ctx context.Context, domainName string, kind OverrideKind, duration time.Duration) (*DomainOverride, error) {
+	if duration <= 0 || duration > MaxOverrideDuration {
+		return nil, fmt.Errorf("failed to set override of domain %s: %w: %s (must be between 1s and %s)",
+			domainName, ErrInvalidOverrideDuration, duration, MaxOverrideDuration)
+	}
+
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		db.log.Error("Failed to begin domain override transaction", zap.Error(err))
+		return nil, fmt.Errorf("failed to begin domain override transaction: %w", err)
+	}
+	defer func() {
+		// Commit済みの場合Rollbackは何もしない
+		_ = tx.Rollback(ctx)
+	}()
+
+	if kind == OverrideKindBlock {
+		tag, err := tx.Exec(ctx,
+			`INSERT INTO domains (domain_name) VALUES ($1) ON CONFLICT (domain_name) DO NOTHING`, domainName)
+		if err != nil {
+			db.log.Error("Failed to create temporarily blocked domain", zap.String("domain", domainName), zap.Error(err))
+			return nil, fmt.Errorf("failed to create domain %s: %w", domainName, err)
+		}
+		if tag.RowsAffected() == 0 {
+			// 既存ドメインの期限延長のみ許可する。恒久的なドメインを期限付きにはしない
+			var hasBlock bool
+			err := tx.QueryRow(ctx,
+				`SELECT EXISTS (SELECT 1 FROM domain_overrides WHERE domain_name = $1 AND kind = $2)`,
+				domainName, OverrideKindBlock).Scan(&hasBlock)
+			if err != nil {
+				db.log.Error("Failed to check domain override", zap.String("domain", domainName), zap.Error(err))
+				return nil, fmt.Errorf("failed to check override of domain %s: %w", domainName, err)
+			}
+			if !hasBlock {
+				return nil, fmt.Errorf("failed to set override of domain %s: %w", domainName, ErrDomainAlreadyExists)
+			}
+		}
+	}
+
+	// 別の種類のオーバーライドが有効な場合は上書きせずエラーにする
+	query := `INSERT INTO domain_overrides (domain_name, kind, expires_at)
+	          VALUES ($1, $2, CURRENT_TIMESTAMP + make_interval(secs => $3))
+	          ON CONFLICT (domain_name) DO UPDATE SET kind = EXCLUDED.kind, expires_at = EXCLUDED.expires_at
+	          WHERE domain_overrides.kind = EXCLUDED.kind
+	          RETURNING ` + overrideColumns
+	rows, err := tx.Query(ctx, query, domainName, kind, duration.Seconds())
+	if err != nil {
+		db.log.Error("Failed to set domain override", zap.String("domain", domainName), zap.Error(err))
+		return nil, fmt.Errorf("failed to set override of domain %s: %w", domainName, err)
+	}
+	override, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[DomainOverride])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("failed to set override of domain %s: %w", domainName, ErrDomainOverrideConflict)
+		}
+		// 外部キー制約(error code 23503)に抵触した場合、除外対象のドメインが存在しない
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return nil, fmt.Errorf("failed to set override of domain %s: %w", domainName, ErrDomainNotFound)
+		}
+		db.log.Error("Failed to set domain override", zap.String("domain", domainName), zap.Error(err))
+		return nil, fmt.Errorf("failed to set override of domain %s: %w", domainName, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		db.log.Error("Failed to commit domain override", zap.String("domain", domainName), zap.Error(err))
+		return nil, fmt.Errorf("failed to commit override of domain %s: %w", domainName, err)
+	}
+
+	db.log.Info("Domain override set",
+		zap.String("domain", domainName),
+		zap.String("kind", string(kind)),
+		zap.Duration("duration", duration))
+	return &override, nil
+}
+
+// GetActiveDomainOverrides retrieves the overrides that have not expired yet, soonest expiry first
+func (db *DB) GetActiveDomainOverrides(ctx context.Context) ([]DomainOverride, error) {
+	query := `SELECT ` + overrideColumns + ` FROM domain_overrides
+	          WHERE expires_at > CURRENT_TIMESTAMP ORDER BY expires_at, domain_name`
+	rows, err := db.pool.Query(ctx, query)
+	if err != nil {
+		db.log.Error("Failed to get domain overrides", zap.Error(err))
+		return nil, fmt.Errorf("failed to get domain overrides: %w", err)
+	}
+	overrides, err := pgx.CollectRows(rows, pgx.RowToStructByName[DomainOverride])
+	if err != nil {
+		db.log.Error("Failed to scan domain override rows", zap.Error(err))
+		return nil, fmt.Errorf("failed to scan domain override rows: %w", err)
+	}
+	return overrides, nil
+}
+
+// EndDomainOverride makes the active override of a domain expire now.
+// The expiry itself is carried out by ExpireDomainOverrides.
+func (db *DB) EndDomainOverride(ctx context.Context, domainName string) error {
+	query := `UPDATE domain_overrides SET expires_at = CURRENT_TIMESTAMP
+	          WHERE domain_name = $1 AND expires_at > CURRENT_TIMESTAMP`
+	tag, err := db.pool.Exec(ctx, query, domainName)
+	if err != nil {
+		db.log.Error("Failed to end domain override", zap.String("domain", domainName), zap.Error(err))
+		return fmt.Errorf("failed to end override of domain %s: %w", domainName, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to end override of domain %s: %w", domainName, ErrDomainOverrideNotFound)
+	}
+
+	db.log.Info("Domain override ended", zap.String("domain", domainName))
+	return nil
+}
+
+// PreviewExpiredDomainOverrides returns the expired overrides that ExpireDomainOverrides would delete, and the domains
+// of expired block overrides it would delete with them, without modifying anything
+func (db *DB) PreviewExpiredDomainOverrides(ctx context.Context) ([]DomainOverride, []string, error) {
+	query := `SELECT ` + overrideColumns + ` FROM domain_overrides
+	          WHERE expires_at <= CURRENT_TIMESTAMP ORDER BY expires_at, domain_name`
+	rows, err := db.pool.Query(ctx, query)
+	if err != nil {
+		db.log.Error("Failed to get expired domain overrides", zap.Error(err))
+		return nil, nil, fmt.Errorf("failed to get expired domain overrides: %w", err)
+	}
+	expired, err := pgx.CollectRows(rows, pgx.RowToStructByName[DomainOverride])
+	if err != nil {
+		db.log.Error("Failed to scan expired domain override rows", zap.Error(err))
+		return nil, nil, fmt.Errorf("failed to scan expired domain override rows: %w", err)
+	}
+
+	// feedが提供するドメインはfeedに引き継がれ削除されない
+	deleted, err := collectStrings(db.pool.Query(ctx,
+		`SELECT d.domain_name FROM domain_overrides o JOIN domains d ON d.domain_name = o.domain_name
+		 WHERE o.expires_at <= CURRENT_TIMESTAMP AND o.kind = $1 AND d.manual
+		   AND NOT EXISTS (SELECT 1 FROM feed_domains fd WHERE fd.domain_name = d.domain_name)
+		 ORDER BY d.domain_name`,
+		OverrideKindBlock))
+	if err != nil {
+		db.log.Error("Failed to get temporarily blocked domains to delete", zap.Error(err))
+		return nil, nil, fmt.Errorf("failed to get temporarily blocked domains to delete: %w", err)
+	}
+	return expired, deleted, nil
+}
+
+// ExpireDomainOverrides deletes the expired overrides and returns them.
+// Domains of expired block overrides are deleted too, and their IPs are returned so that the caller can remove the rules.
+// A temporarily blocked domain that a feed provides in the meantime is handed over to the feed instead of being deleted.
+func (db *DB) ExpireDomainOverrides(ctx context.Context) ([]DomainOverride, []DomainIP, error) {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		db.log.Error("Failed to begin override expiry transaction", zap.Error(err))
+		return nil, nil, fmt.Errorf("failed to begin override expiry transaction: %w", err)
+	}
+	defer func() {
+		// Commit済みの場合Rollbackは何もしない
+		_ = tx.Rollback(ctx)
+	}()
+
+	rows, err := tx.Query(ctx,
+		`DELETE FROM domain_overrides WHERE expires_at <= CURRENT_TIMESTAMP RETURNING `+overrideColumns)
+	if err != nil {
+		db.log.Error("Failed to delete expired domain overrides", zap.Error(err))
+		return nil, nil, fmt.Errorf("failed to delete expired domain overrides: %w", err)
+	}
+	expired, err := pgx.CollectRows(rows, pgx.RowToStructByName[DomainOverride])
+	if err != nil {
+		db.log.Error("Failed to scan expired domain override rows", zap.Error(err))
+		return nil, nil, fmt.Errorf("failed to scan expired domain override rows: %w", err)
+	}
+
+	var blocked []string
+	for _, o := range expired {
+		if o.Kind == OverrideKindBlock {
+			blocked = append(blocked, o.DomainName)
+		}
+	}
+
+	var removedIPs []DomainIP
+	if len(blocked) > 0 {
+		if _, err := tx.Exec(ctx,
+			`UPDATE domains SET manual = FALSE
+			 WHERE domain_name = ANY($1::varchar[])
+			   AND EXISTS (SELECT 1 FROM feed_domains fd WHERE fd.domain_name = domains.domain_name)`,
+			blocked); err != nil {
+			db.log.Error("Failed to hand temporarily blocked domains over to feeds", zap.Error(err))
+			return nil, nil, fmt.Errorf("failed to hand temporarily blocked domains over to feeds: %w", err)
+		}
+		names, err := collectStrings(tx.Query(ctx,
+			`SELECT domain_name FROM domains WHERE domain_name = ANY($1::varchar[]) AND manual FOR UPDATE`,
+			blocked))
+		if err != nil {
+			db.log.Error("Failed to lock temporarily blocked domains", zap.Error(err))
+			return nil, nil, fmt.Errorf("failed to lock temporarily blocked domains: %w", err)
+		}
+		removedIPs, err = deleteDomainsTx(ctx, tx, names)
+		if err != nil {
+			db.log.Error("Failed to delete temporarily blocked domains", zap.Error(err))
+			return nil, nil, fmt.Errorf("failed to delete temporarily blocked domains: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		db.log.Error("Failed to commit override expiry", zap.Error(err))
+		return nil, nil, fmt.Errorf("failed to commit override expiry: %w", err)
+	}
+
+	if len(expired) > 0 {
+		db.log.Info("Expired domain overrides",
+			zap.Int("overrides", len(expired)),
+			zap.Int("removed_ips", len(removedIPs)))
+	}
+	return expired, removedIPs, nil
+}
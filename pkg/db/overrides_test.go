@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_DomainOverrides(t *testing.T) {
+	testDB := SetupTestDB(t)
+	defer testDB.Cleanup(t)
+	ctx := context.Background()
+
+	require.NoError(t, testDB.DB.CreateDomain(ctx, "example.com"))
+
+	// 除外はドメインが存在する場合のみ
+	_, err := testDB.DB.SetDomainOverride(ctx, "missing.example", OverrideKindExempt, time.Hour)
+	assert.True(t, errors.Is(err, ErrDomainNotFound))
+
+	exempt, err := testDB.DB.SetDomainOverride(ctx, "example.com", OverrideKindExempt, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, OverrideKindExempt, exempt.Kind)
+	assert.True(t, exempt.ExpiresAt.After(exempt.CreatedAt))
+
+	// 恒久的なドメインは一時ブロックにできず、別種類のオーバーライドでも上書きできない
+	_, err = testDB.DB.SetDomainOverride(ctx, "example.com", OverrideKindBlock, time.Hour)
+	assert.True(t, errors.Is(err, ErrDomainAlreadyExists))
+
+	// 一時ブロックはドメインを作成し、再設定で期限を延長する
+	_, err = testDB.DB.SetDomainOverride(ctx, "temp.example", OverrideKindBlock, time.Hour)
+	require.NoError(t, err)
+	extended, err := testDB.DB.SetDomainOverride(ctx, "temp.example", OverrideKindBlock, 2*time.Hour)
+	require.NoError(t, err)
+	_, err = testDB.DB.GetDomain(ctx, "temp.example")
+	require.NoError(t, err)
+	_, err = testDB.DB.SetDomainOverride(ctx, "temp.example", OverrideKindExempt, time.Hour)
+	assert.True(t, errors.Is(err, ErrDomainOverrideConflict))
+
+	_, err = testDB.DB.SetDomainOverride(ctx, "example.com", OverrideKindExempt, 0)
+	assert.True(t, errors.Is(err, ErrInvalidOverrideDuration))
+
+	active, err := testDB.DB.GetActiveDomainOverrides(ctx)
+	require.NoError(t, err)
+	require.Len(t, active, 2)
+	assert.Equal(t, "example.com", active[0].DomainName)
+	assert.Equal(t, "temp.example", active[1].DomainName)
+	assert.Equal(t, extended.ExpiresAt, active[1].ExpiresAt)
+
+	// 期限前は何も失効しない
+	expired, removed, err := testDB.DB.ExpireDomainOverrides(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, expired)
+	assert.Empty(t, removed)
+
+	require.NoError(t, testDB.DB.CreateDomainIP(ctx, "temp.example", "192.0.2.1"))
+	require.NoError(t, testDB.DB.EndDomainOverride(ctx, "temp.example"))
+	require.NoError(t, testDB.DB.EndDomainOverride(ctx, "example.com"))
+	assert.True(t, errors.Is(testDB.DB.EndDomainOverride(ctx, "example.com"), ErrDomainOverrideNotFound))
+
+	active, err = testDB.DB.GetActiveDomainOverrides(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, active)
+
+	// プレビューは失効するオーバーライドと削除されるドメインを返し、何も変更しない
+	preview, deleted, err := testDB.DB.PreviewExpiredDomainOverrides(ctx)
+	require.NoError(t, err)
+	assert.Len(t, preview, 2)
+	assert.Equal(t, []string{"temp.example"}, deleted)
+	_, err = testDB.DB.GetDomain(ctx, "temp.example")
+	require.NoError(t, err)
+
+	// 一時ブロックのドメインはIPごと削除され、除外されていたドメインは残る
+	expired, removed, err = testDB.DB.ExpireDomainOverrides(ctx)
+	require.NoError(t, err)
+	assert.Len(t, expired, 2)
+	require.Len(t, removed, 1)
+	assert.Equal(t, "192.0.2.1", removed[0].IPAddress)
+
+	_, err = testDB.DB.GetDomain(ctx, "temp.example")
+	assert.True(t, errors.Is(err, ErrDomainNotFound))
+	_, err = testDB.DB.GetDomain(ctx, "example.com")
+	require.NoError(t, err)
+}
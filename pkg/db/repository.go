@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"go.uber.org/zap"
 )
@@ -34,7 +35,7 @@ func (db *DB) CreateDomain(ctx context.Context, domainName string) error {
 
 // GetAllDomains retrieves all domains
 func (db *DB) GetAllDomains(ctx context.Context) ([]Domain, error) {
-	query := `SELECT domain_name, created_at, updated_at FROM domains ORDER BY domain_name`
+	query := `SELECT domain_name, manual, action, created_at, updated_at FROM domains ORDER BY domain_name`
 
 	rows, err := db.pool.Query(ctx, query)
 	if err != nil {
@@ -48,6 +49,8 @@ func (db *DB) GetAllDomains(ctx context.Context) ([]Domain, error) {
 		var domain Domain
 		err := rows.Scan(
 			&domain.DomainName,
+			&domain.Manual,
+			&domain.Action,
 			&domain.CreatedAt,
 			&domain.UpdatedAt,
 		)
@@ -66,6 +69,89 @@ func (db *DB) GetAllDomains(ctx context.Context) ([]Domain, error) {
 	return domains, nil
 }
 
+// GetDomain retrieves a single domain
+func (db *DB) GetDomain(ctx context.Context, domainName string) (*Domain, error) {
+	query := `SELECT domain_name, manual, action, created_at, updated_at FROM domains WHERE domain_name = $1`
+
+	var domain Domain
+	err := db.pool.QueryRow(ctx, query, domainName).Scan(
+		&domain.DomainName,
+		&domain.Manual,
+		&domain.Action,
+		&domain.CreatedAt,
+		&domain.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("failed to get domain %s: %w", domainName, ErrDomainNotFound)
+		}
+		db.log.Error("Failed to get domain", zap.String("domain", domainName), zap.Error(err))
+		return nil, fmt.Errorf("failed to get domain %s: %w", domainName, err)
+	}
+
+	return &domain, nil
+}
+
+// DeleteDomain removes a domain together with its IPs and returns the IPs that belonged to it
+func (db *DB) DeleteDomain(ctx context.Context, domainName string) ([]DomainIP, error) {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		db.log.Error("Failed to begin domain delete transaction", zap.Error(err))
+		return nil, fmt.Errorf("failed to begin domain delete transaction: %w", err)
+	}
+	defer func() {
+		// Commit済みの場合Rollbackは何もしない
+		_ = tx.Rollback(ctx)
+	}()
+
+	var locked string
+	err = tx.QueryRow(ctx,
+		`SELECT domain_name FROM domains WHERE domain_name = $1 FOR UPDATE`, domainName).Scan(&locked)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("failed to delete domain %s: %w", domainName, ErrDomainNotFound)
+		}
+		db.log.Error("Failed to lock domain", zap.String("domain", domainName), zap.Error(err))
+		return nil, fmt.Errorf("failed to delete domain %s: %w", domainName, err)
+	}
+
+	removedIPs, err := deleteDomainsTx(ctx, tx, []string{domainName})
+	if err != nil {
+		db.log.Error("Failed to delete domain", zap.String("domain", domainName), zap.Error(err))
+		return nil, fmt.Errorf("failed to delete domain %s: %w", domainName, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		db.log.Error("Failed to commit domain delete", zap.String("domain", domainName), zap.Error(err))
+		return nil, fmt.Errorf("failed to commit domain delete for %s: %w", domainName, err)
+	}
+
+	db.log.Info("Domain deleted successfully",
+		zap.String("domain", domainName),
+		zap.Int("ips", len(removedIPs)))
+	return removedIPs, nil
+}
+
+// SetDomainAction changes the block action applied to the IPs of a domain
+func (db *DB) SetDomainAction(ctx context.Context, domainName string, action BlockAction) error {
+	tag, err := db.pool.Exec(ctx, `UPDATE domains SET action = $2 WHERE domain_name = $1`, domainName, action)
+	if err != nil {
+		db.log.Error("Failed to set domain action",
+			zap.String("domain", domainName),
+			zap.String("action", string(action)),
+			zap.Error(err))
+		return fmt.Errorf("failed to set action of domain %s: %w", domainName, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to set action of domain %s: %w", domainName, ErrDomainNotFound)
+	}
+
+	db.log.Info("Domain action updated",
+		zap.String("domain", domainName),
+		zap.String("action", string(action)))
+	return nil
+}
+
 // Domain IP repository operations
 
 // CreateDomainIP inserts a new IP address for a domain
@@ -98,8 +184,9 @@ func (db *DB) CreateDomainIP(ctx context.Context, domainName, ipAddress string)
 
 // GetDomainIPs retrieves all IP addresses for a domain
 func (db *DB) GetDomainIPs(ctx context.Context, domainName string) ([]DomainIP, error) {
-	query := `SELECT id, domain_name, ip_address, created_at, updated_at 
-			  FROM domain_ips WHERE domain_name = $1 ORDER BY domain_name`
+	query := `SELECT di.id, di.domain_name, di.ip_address, d.action, di.created_at, di.updated_at
+			  FROM domain_ips di JOIN domains d ON d.domain_name = di.domain_name
+			  WHERE di.domain_name = $1 ORDER BY di.domain_name`
 
 	rows, err := db.pool.Query(ctx, query, domainName)
 	if err != nil {
@@ -115,6 +202,7 @@ func (db *DB) GetDomainIPs(ctx context.Context, domainName string) ([]DomainIP,
 			&domainIP.ID,
 			&domainIP.DomainName,
 			&domainIP.IPAddress,
+			&domainIP.Action,
 			&domainIP.CreatedAt,
 			&domainIP.UpdatedAt,
 		)
@@ -147,7 +235,7 @@ func (db *DB) DeleteDomainIP(ctx context.Context, domainName, ipAddress string)
 
 	rowsAffected := result.RowsAffected()
 	if rowsAffected == 0 {
-		return fmt.Errorf("domain IP %s for %s not found", ipAddress, domainName)
+		return fmt.Errorf("failed to delete domain IP %s for %s: %w", ipAddress, domainName, ErrDomainIPNotFound)
 	}
 
 	db.log.Info("Domain IP deleted successfully",
@@ -158,8 +246,9 @@ func (db *DB) DeleteDomainIP(ctx context.Context, domainName, ipAddress string)
 
 // GetAllDomainIPs retrieves all domain IP entries
 func (db *DB) GetAllDomainIPs(ctx context.Context) ([]DomainIP, error) {
-	query := `SELECT id, domain_name, ip_address, created_at, updated_at 
-			  FROM domain_ips ORDER BY domain_name, created_at DESC`
+	query := `SELECT di.id, di.domain_name, di.ip_address, d.action, di.created_at, di.updated_at
+			  FROM domain_ips di JOIN domains d ON d.domain_name = di.domain_name
+			  ORDER BY di.domain_name, di.created_at DESC`
 
 	rows, err := db.pool.Query(ctx, query)
 	if err != nil {
@@ -175,6 +264,7 @@ func (db *DB) GetAllDomainIPs(ctx context.Context) ([]DomainIP, error) {
 			&domainIP.ID,
 			&domainIP.DomainName,
 			&domainIP.IPAddress,
+			&domainIP.Action,
 			&domainIP.CreatedAt,
 			&domainIP.UpdatedAt,
 		)
@@ -193,6 +283,16 @@ func (db *DB) GetAllDomainIPs(ctx context.Context) ([]DomainIP, error) {
 	return domainIPs, nil
 }
 
+// CountBlockedIPs returns the number of distinct IPs recorded for the domains
+func (db *DB) CountBlockedIPs(ctx context.Context) (int, error) {
+	var count int
+	if err := db.pool.QueryRow(ctx, `SELECT count(DISTINCT ip_address) FROM domain_ips`).Scan(&count); err != nil {
+		db.log.Error("Failed to count blocked IPs", zap.Error(err))
+		return 0, fmt.Errorf("failed to count blocked IPs: %w", err)
+	}
+	return count, nil
+}
+
 // UpdateDomainIPUpdatedAt updates the updated_at timestamp for a domain IP record
 func (db *DB) UpdateDomainIPUpdatedAt(ctx context.Context, domainName, ipAddress string) error {
 	query := `UPDATE domain_ips SET updated_at = NOW() WHERE domain_name = $1 AND ip_address = $2`
@@ -206,7 +306,7 @@ func (db *DB) UpdateDomainIPUpdatedAt(ctx context.Context, domainName, ipAddress
 	}
 
 	if result.RowsAffected() == 0 {
-		return fmt.Errorf("domain IP %s for %s not found", ipAddress, domainName)
+		return fmt.Errorf("failed to refresh updated_at of domain IP %s for %s: %w", ipAddress, domainName, ErrDomainIPNotFound)
 	}
 
 	db.log.Debug("Domain IP updated_at refreshed",
@@ -215,6 +315,101 @@ func (db *DB) UpdateDomainIPUpdatedAt(ctx context.Context, domainName, ipAddress
 	return nil
 }
 
+// UpsertDomainIPs records the IPs resolved for a domain in one statement: IPs not yet recorded are inserted
+// and the updated_at of recorded IPs is refreshed. Returns the IPs that were inserted.
+func (db *DB) UpsertDomainIPs(ctx context.Context, domainName string, ipAddresses []string) ([]string, error) {
+	if len(ipAddresses) == 0 {
+		return nil, nil
+	}
+
+	// 同じIPを2回更新するとON CONFLICTがエラーになるため重複を除く。xmax = 0の行は新規に挿入された行
+	query := `INSERT INTO domain_ips (domain_name, ip_address)
+	          SELECT $1, ip FROM (SELECT DISTINCT unnest($2::varchar[]) AS ip) AS s
+	          ON CONFLICT (domain_name, ip_address) DO UPDATE SET updated_at = CURRENT_TIMESTAMP
+	          RETURNING ip_address, xmax = 0 AS inserted`
+	rows, err := db.pool.Query(ctx, query, domainName, ipAddresses)
+	if err != nil {
+		db.log.Error("Failed to upsert domain IPs", zap.String("domain", domainName), zap.Error(err))
+		return nil, fmt.Errorf("failed to upsert domain IPs for %s: %w", domainName, err)
+	}
+	defer rows.Close()
+
+	var inserted []string
+	for rows.Next() {
+		var ip string
+		var isNew bool
+		if err := rows.Scan(&ip, &isNew); err != nil {
+			db.log.Error("Failed to scan upserted domain IP row", zap.Error(err))
+			return nil, fmt.Errorf("failed to scan upserted domain IP row: %w", err)
+		}
+		if isNew {
+			inserted = append(inserted, ip)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		// 外部キー制約(error code 23503)に抵触した場合、ドメインが削除されている
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return nil, fmt.Errorf("failed to upsert domain IPs for %s: %w", domainName, ErrDomainNotFound)
+		}
+		db.log.Error("Failed to upsert domain IPs", zap.String("domain", domainName), zap.Error(err))
+		return nil, fmt.Errorf("failed to upsert domain IPs for %s: %w", domainName, err)
+	}
+
+	db.log.Debug("Domain IPs upserted",
+		zap.String("domain", domainName),
+		zap.Int("inserted", len(inserted)),
+		zap.Int("refreshed", len(ipAddresses)-len(inserted)))
+	return inserted, nil
+}
+
+// TouchDomainIPs refreshes the updated_at of the given IPs of a domain in one statement.
+// Returns the number of refreshed IPs; IPs not recorded for the domain are ignored.
+func (db *DB) TouchDomainIPs(ctx context.Context, domainName string, ipAddresses []string) (int64, error) {
+	if len(ipAddresses) == 0 {
+		return 0, nil
+	}
+
+	query := `UPDATE domain_ips SET updated_at = NOW() WHERE domain_name = $1 AND ip_address = ANY($2::varchar[])`
+	result, err := db.pool.Exec(ctx, query, domainName, ipAddresses)
+	if err != nil {
+		db.log.Error("Failed to touch domain IPs", zap.String("domain", domainName), zap.Error(err))
+		return 0, fmt.Errorf("failed to update domain IP updated_at for %s: %w", domainName, err)
+	}
+
+	db.log.Debug("Domain IPs updated_at refreshed",
+		zap.String("domain", domainName),
+		zap.Int64("count", result.RowsAffected()))
+	return result.RowsAffected(), nil
+}
+
+// DeleteDomainIPs deletes the given IPs of a domain in one statement and returns the deleted records.
+// IPs not recorded for the domain are ignored.
+func (db *DB) DeleteDomainIPs(ctx context.Context, domainName string, ipAddresses []string) ([]DomainIP, error) {
+	if len(ipAddresses) == 0 {
+		return nil, nil
+	}
+
+	query := `DELETE FROM domain_ips WHERE domain_name = $1 AND ip_address = ANY($2::varchar[])
+	          RETURNING id, domain_name, ip_address, created_at, updated_at`
+	rows, err := db.pool.Query(ctx, query, domainName, ipAddresses)
+	if err != nil {
+		db.log.Error("Failed to delete domain IPs", zap.String("domain", domainName), zap.Error(err))
+		return nil, fmt.Errorf("failed to delete domain IPs for %s: %w", domainName, err)
+	}
+	deleted, err := pgx.CollectRows(rows, pgx.RowToStructByNameLax[DomainIP])
+	if err != nil {
+		db.log.Error("Failed to scan deleted domain IP rows", zap.Error(err))
+		return nil, fmt.Errorf("failed to scan deleted domain IP rows: %w", err)
+	}
+
+	db.log.Info("Domain IPs deleted",
+		zap.String("domain", domainName),
+		zap.Int("count", len(deleted)))
+	return deleted, nil
+}
+
 // DeleteExpiredDomainIPs deletes domain IP entries older than cutoff and returns the deleted records
 func (db *DB) DeleteExpiredDomainIPs(ctx context.Context, cutoff time.Time) ([]DomainIP, error) {
 	query := `DELETE FROM domain_ips WHERE updated_at < $1
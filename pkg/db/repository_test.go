@@ -222,6 +222,116 @@ func Test_DeleteDomainIP(t *testing.T) {
 	err = testDB.DB.DeleteDomainIP(context.Background(), domainName, "192.168.1.2")
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "not found")
+	assert.True(t, errors.Is(err, ErrDomainIPNotFound))
+}
+
+func Test_BulkDomainIPs(t *testing.T) {
+	testDB := SetupTestDB(t)
+	defer testDB.Cleanup(t)
+	ctx := context.Background()
+
+	require.NoError(t, testDB.DB.CreateDomain(ctx, "example.com"))
+	require.NoError(t, testDB.DB.CreateDomainIP(ctx, "example.com", "192.168.1.1"))
+
+	// 新規のIPのみ返し、重複は1件として扱う
+	inserted, err := testDB.DB.UpsertDomainIPs(ctx, "example.com", []string{"192.168.1.1", "192.168.1.2", "192.168.1.2"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"192.168.1.2"}, inserted)
+	domainIPs, err := testDB.DB.GetDomainIPs(ctx, "example.com")
+	require.NoError(t, err)
+	assert.Len(t, domainIPs, 2)
+
+	inserted, err = testDB.DB.UpsertDomainIPs(ctx, "example.com", []string{"192.168.1.1"})
+	require.NoError(t, err)
+	assert.Empty(t, inserted)
+
+	_, err = testDB.DB.UpsertDomainIPs(ctx, "missing.example.com", []string{"192.168.1.1"})
+	assert.True(t, errors.Is(err, ErrDomainNotFound))
+
+	touched, err := testDB.DB.TouchDomainIPs(ctx, "example.com", []string{"192.168.1.1", "192.168.1.9"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), touched)
+
+	deleted, err := testDB.DB.DeleteDomainIPs(ctx, "example.com", []string{"192.168.1.1", "192.168.1.2", "192.168.1.9"})
+	require.NoError(t, err)
+	assert.Len(t, deleted, 2)
+	domainIPs, err = testDB.DB.GetDomainIPs(ctx, "example.com")
+	require.NoError(t, err)
+	assert.Empty(t, domainIPs)
+
+	// 空の場合はDBに問い合わせない
+	inserted, err = testDB.DB.UpsertDomainIPs(ctx, "example.com", nil)
+	require.NoError(t, err)
+	assert.Empty(t, inserted)
+}
+
+func Test_CountBlockedIPs(t *testing.T) {
+	testDB := SetupTestDB(t)
+	defer testDB.Cleanup(t)
+	ctx := context.Background()
+
+	count, err := testDB.DB.CountBlockedIPs(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	// 複数のドメインが同じIPを持つ場合は1件として数える
+	require.NoError(t, testDB.DB.CreateDomain(ctx, "example.com"))
+	require.NoError(t, testDB.DB.CreateDomain(ctx, "example.org"))
+	require.NoError(t, testDB.DB.CreateDomainIP(ctx, "example.com", "192.168.1.1"))
+	require.NoError(t, testDB.DB.CreateDomainIP(ctx, "example.com", "192.168.1.2"))
+	require.NoError(t, testDB.DB.CreateDomainIP(ctx, "example.org", "192.168.1.1"))
+
+	count, err = testDB.DB.CountBlockedIPs(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func Test_GetAndDeleteDomain(t *testing.T) {
+	testDB := SetupTestDB(t)
+	defer testDB.Cleanup(t)
+	ctx := context.Background()
+
+	require.NoError(t, testDB.DB.CreateDomain(ctx, "example.com"))
+	require.NoError(t, testDB.DB.CreateDomainIP(ctx, "example.com", "192.168.1.1"))
+
+	domain, err := testDB.DB.GetDomain(ctx, "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "example.com", domain.DomainName)
+	assert.True(t, domain.Manual)
+
+	removedIPs, err := testDB.DB.DeleteDomain(ctx, "example.com")
+	require.NoError(t, err)
+	require.Len(t, removedIPs, 1)
+	assert.Equal(t, "192.168.1.1", removedIPs[0].IPAddress)
+
+	_, err = testDB.DB.GetDomain(ctx, "example.com")
+	assert.True(t, errors.Is(err, ErrDomainNotFound))
+
+	_, err = testDB.DB.DeleteDomain(ctx, "example.com")
+	assert.True(t, errors.Is(err, ErrDomainNotFound))
+}
+
+func Test_SetDomainAction(t *testing.T) {
+	testDB := SetupTestDB(t)
+	defer testDB.Cleanup(t)
+	ctx := context.Background()
+
+	require.NoError(t, testDB.DB.CreateDomain(ctx, "example.com"))
+	require.NoError(t, testDB.DB.CreateDomainIP(ctx, "example.com", "192.168.1.1"))
+
+	domain, err := testDB.DB.GetDomain(ctx, "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, BlockActionDrop, domain.Action)
+
+	require.NoError(t, testDB.DB.SetDomainAction(ctx, "example.com", BlockActionReject))
+
+	domainIPs, err := testDB.DB.GetAllDomainIPs(ctx)
+	require.NoError(t, err)
+	require.Len(t, domainIPs, 1)
+	assert.Equal(t, BlockActionReject, domainIPs[0].Action)
+
+	err = testDB.DB.SetDomainAction(ctx, "missing.example.com", BlockActionLog)
+	assert.True(t, errors.Is(err, ErrDomainNotFound))
 }
 
 func Test_IntegrationWorkflow(t *testing.T) {
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// runLockClass is the advisory lock held during a batch run, so that runs of several processes do not overlap.
+// The second key is the hash of the node name, so that the routers sharing the database run independently.
+const runLockClass int32 = 0x726d6272
+
+// AcquireRunLock takes the run lock of this node (Config.Node) on a dedicated connection, whose application_name is set to holder so that
+// RunLockHolder can report it, and returns the function releasing the lock.
+// If wait is false and another session holds the lock, ErrRunLockHeld is returned;
+// otherwise it waits until the lock is released or ctx is done.
+func (db *DB) AcquireRunLock(ctx context.Context, holder string, wait bool) (func(context.Context) error, error) {
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		db.log.Error("Failed to acquire connection for run lock", zap.Error(err))
+		return nil, fmt.Errorf("failed to acquire connection for run lock: %w", err)
+	}
+	// 失敗した場合はapplication_nameを変更した接続をプールに戻さない
+	discard := func() {
+		_ = conn.Conn().Close(context.WithoutCancel(ctx))
+		conn.Release()
+	}
+
+	if _, err := conn.Exec(ctx, `SELECT set_config('application_name', $1, false)`, holder); err != nil {
+		discard()
+		db.log.Error("Failed to set run lock holder", zap.Error(err))
+		return nil, fmt.Errorf("failed to set run lock holder: %w", err)
+	}
+
+	if wait {
+		if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1, hashtext($2))`, runLockClass, db.node); err != nil {
+			discard()
+			db.log.Error("Failed to wait for run lock", zap.Error(err))
+			return nil, fmt.Errorf("failed to wait for run lock: %w", err)
+		}
+	} else {
+		var locked bool
+		if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1, hashtext($2))`, runLockClass, db.node).Scan(&locked); err != nil {
+			discard()
+			db.log.Error("Failed to take run lock", zap.Error(err))
+			return nil, fmt.Errorf("failed to take run lock: %w", err)
+		}
+		if !locked {
+			discard()
+			return nil, ErrRunLockHeld
+		}
+	}
+
+	release := func(ctx context.Context) error {
+		// セッションのadvisory lockは接続を閉じても解放される
+		if _, err := conn.Exec(ctx, `SELECT pg_advisory_unlock($1, hashtext($2))`, runLockClass, db.node); err != nil {
+			discard()
+			db.log.Error("Failed to release run lock", zap.Error(err))
+			return fmt.Errorf("failed to release run lock: %w", err)
+		}
+		if _, err := conn.Exec(ctx, `RESET application_name`); err != nil {
+			discard()
+			return nil
+		}
+		conn.Release()
+		return nil
+	}
+	return release, nil
+}
+
+// RunLockHolder returns the holder given to AcquireRunLock by the session holding the run lock of this node,
+// or "" if the lock is free
+func (db *DB) RunLockHolder(ctx context.Context) (string, error) {
+	// 2つのint4のadvisory lockはclassidとobjidにそれぞれのkeyが符号なしで入る
+	query := `SELECT a.pid, a.application_name FROM pg_locks l JOIN pg_stat_activity a ON a.pid = l.pid
+	          WHERE l.locktype = 'advisory' AND l.granted AND l.objsubid = 2
+	            AND l.classid::bigint = $1::bigint & 4294967295 AND l.objid::bigint = hashtext($2)::bigint & 4294967295
+	          LIMIT 1`
+	var pid int
+	var holder string
+	err := db.pool.QueryRow(ctx, query, runLockClass, db.node).Scan(&pid, &holder)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		db.log.Error("Failed to get run lock holder", zap.Error(err))
+		return "", fmt.Errorf("failed to get run lock holder: %w", err)
+	}
+	if holder == "" {
+		return "backend pid " + strconv.Itoa(pid), nil
+	}
+	return holder, nil
+}
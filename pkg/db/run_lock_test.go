@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_RunLock(t *testing.T) {
+	testDB := SetupTestDB(t)
+	defer testDB.Cleanup(t)
+
+	ctx := context.Background()
+
+	holder, err := testDB.DB.RunLockHolder(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, holder)
+
+	release, err := testDB.DB.AcquireRunLock(ctx, "pi pid=100", false)
+	require.NoError(t, err)
+
+	t.Run("second holder is rejected and told the holder", func(t *testing.T) {
+		_, err := testDB.DB.AcquireRunLock(ctx, "pi pid=200", false)
+		assert.ErrorIs(t, err, ErrRunLockHeld)
+
+		holder, err := testDB.DB.RunLockHolder(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "pi pid=100", holder)
+	})
+
+	t.Run("waiting holder gives up when ctx is done", func(t *testing.T) {
+		waitCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+		defer cancel()
+		_, err := testDB.DB.AcquireRunLock(waitCtx, "pi pid=200", true)
+		assert.Error(t, err)
+	})
+
+	t.Run("waiting holder takes the lock once released", func(t *testing.T) {
+		acquired := make(chan error, 1)
+		go func() {
+			release, err := testDB.DB.AcquireRunLock(ctx, "pi pid=300", true)
+			if err == nil {
+				err = release(ctx)
+			}
+			acquired <- err
+		}()
+
+		time.Sleep(100 * time.Millisecond)
+		require.NoError(t, release(ctx))
+		select {
+		case err := <-acquired:
+			assert.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("waiting holder did not take the lock")
+		}
+	})
+
+	holder, err = testDB.DB.RunLockHolder(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, holder)
+}
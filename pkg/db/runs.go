@@ -0,0 +1,212 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// Batch run repository operations
+
+const batchRunColumns = `id, started_at, finished_at, status, domains_total, domains_failed, error, firewall_rules, node_name`
+
+// StartBatchRun records the start of a batch run and returns its ID
+func (db *DB) StartBatchRun(ctx context.Context) (int64, error) {
+	var id int64
+	query := `INSERT INTO batch_runs (status, node_name) VALUES ($1, $2) RETURNING id`
+	if err := db.pool.QueryRow(ctx, query, BatchRunStatusRunning, db.node).Scan(&id); err != nil {
+		db.log.Error("Failed to start batch run", zap.Error(err))
+		return 0, fmt.Errorf("failed to start batch run: %w", err)
+	}
+	return id, nil
+}
+
+// FinishBatchRun records the outcome of a batch run
+func (db *DB) FinishBatchRun(ctx context.Context, runID int64, result BatchRunResult) error {
+	query := `UPDATE batch_runs SET
+	            finished_at = NOW(),
+	            status = $2,
+	            domains_total = $3,
+	            domains_failed = $4,
+	            error = $5,
+	            firewall_rules = $6
+	          WHERE id = $1`
+	tag, err := db.pool.Exec(ctx, query,
+		runID, result.Status, result.DomainsTotal, result.DomainsFailed, result.Error, result.FirewallRules)
+	if err != nil {
+		db.log.Error("Failed to finish batch run", zap.Int64("id", runID), zap.Error(err))
+		return fmt.Errorf("failed to finish batch run %d: %w", runID, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to finish batch run %d: %w", runID, ErrBatchRunNotFound)
+	}
+
+	return nil
+}
+
+// GetRecentBatchRuns retrieves the latest batch runs, newest first
+func (db *DB) GetRecentBatchRuns(ctx context.Context, limit int) ([]BatchRun, error) {
+	query := `SELECT ` + batchRunColumns + `
+	          FROM batch_runs ORDER BY started_at DESC, id DESC LIMIT $1`
+
+	rows, err := db.pool.Query(ctx, query, limit)
+	if err != nil {
+		db.log.Error("Failed to get batch runs", zap.Error(err))
+		return nil, fmt.Errorf("failed to get batch runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []BatchRun
+	for rows.Next() {
+		var run BatchRun
+		if err := rows.Scan(
+			&run.ID,
+			&run.StartedAt,
+			&run.FinishedAt,
+			&run.Status,
+			&run.DomainsTotal,
+			&run.DomainsFailed,
+			&run.Error,
+			&run.FirewallRules,
+			&run.NodeName,
+		); err != nil {
+			db.log.Error("Failed to scan batch run row", zap.Error(err))
+			return nil, fmt.Errorf("failed to scan batch run row: %w", err)
+		}
+		runs = append(runs, run)
+	}
+
+	if err := rows.Err(); err != nil {
+		db.log.Error("Failed to iterate batch run rows", zap.Error(err))
+		return nil, fmt.Errorf("failed to iterate batch run rows: %w", err)
+	}
+
+	return runs, nil
+}
+
+// GetLastFinishedBatchRun retrieves the batch run that finished last and how long ago it finished,
+// measured by the database clock. Returns ErrBatchRunNotFound if no run has finished yet.
+func (db *DB) GetLastFinishedBatchRun(ctx context.Context) (*BatchRun, time.Duration, error) {
+	query := `SELECT ` + batchRunColumns + `, EXTRACT(EPOCH FROM CURRENT_TIMESTAMP - finished_at)::float8
+	          FROM batch_runs WHERE finished_at IS NOT NULL ORDER BY finished_at DESC, id DESC LIMIT 1`
+	var run BatchRun
+	var ageSeconds float64
+	err := db.pool.QueryRow(ctx, query).Scan(
+		&run.ID,
+		&run.StartedAt,
+		&run.FinishedAt,
+		&run.Status,
+		&run.DomainsTotal,
+		&run.DomainsFailed,
+		&run.Error,
+		&run.FirewallRules,
+		&run.NodeName,
+		&ageSeconds,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, 0, fmt.Errorf("failed to get last finished batch run: %w", ErrBatchRunNotFound)
+		}
+		db.log.Error("Failed to get last finished batch run", zap.Error(err))
+		return nil, 0, fmt.Errorf("failed to get last finished batch run: %w", err)
+	}
+	return &run, time.Duration(ageSeconds * float64(time.Second)), nil
+}
+
+// CreateRunRequest requests a batch run from the daemon.
+// If a request is already waiting, it is returned instead so that repeated requests result in a single run.
+func (db *DB) CreateRunRequest(ctx context.Context) (*RunRequest, error) {
+	insert := `INSERT INTO run_requests DEFAULT VALUES
+	           ON CONFLICT ((started_at IS NULL)) WHERE started_at IS NULL DO NOTHING
+	           RETURNING id, requested_at, started_at, finished_at, batch_run_id`
+	rows, err := db.pool.Query(ctx, insert)
+	if err != nil {
+		db.log.Error("Failed to create run request", zap.Error(err))
+		return nil, fmt.Errorf("failed to create run request: %w", err)
+	}
+	request, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[RunRequest])
+	if err == nil {
+		return &request, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to create run request: %w", err)
+	}
+
+	pending, err := db.GetPendingRunRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if pending == nil {
+		// 既存のリクエストが直前に処理開始された
+		return db.CreateRunRequest(ctx)
+	}
+	return pending, nil
+}
+
+// GetPendingRunRequest returns the latest run request that has not finished yet, or nil if there is none
+func (db *DB) GetPendingRunRequest(ctx context.Context) (*RunRequest, error) {
+	query := `SELECT id, requested_at, started_at, finished_at, batch_run_id FROM run_requests
+	          WHERE finished_at IS NULL ORDER BY id DESC LIMIT 1`
+	rows, err := db.pool.Query(ctx, query)
+	if err != nil {
+		db.log.Error("Failed to get pending run request", zap.Error(err))
+		return nil, fmt.Errorf("failed to get pending run request: %w", err)
+	}
+	request, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[RunRequest])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get pending run request: %w", err)
+	}
+	return &request, nil
+}
+
+// ClaimRunRequest marks the waiting run request as started and returns its ID, or 0 if there is none
+func (db *DB) ClaimRunRequest(ctx context.Context) (int64, error) {
+	var id int64
+	query := `UPDATE run_requests SET started_at = CURRENT_TIMESTAMP WHERE started_at IS NULL RETURNING id`
+	if err := db.pool.QueryRow(ctx, query).Scan(&id); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil
+		}
+		db.log.Error("Failed to claim run request", zap.Error(err))
+		return 0, fmt.Errorf("failed to claim run request: %w", err)
+	}
+	return id, nil
+}
+
+// FinishRunRequest records that a run request has been executed as the given batch run (0 if it was not recorded)
+func (db *DB) FinishRunRequest(ctx context.Context, requestID, batchRunID int64) error {
+	var runID *int64
+	if batchRunID != 0 {
+		runID = &batchRunID
+	}
+	query := `UPDATE run_requests SET finished_at = CURRENT_TIMESTAMP, batch_run_id = $2 WHERE id = $1`
+	tag, err := db.pool.Exec(ctx, query, requestID, runID)
+	if err != nil {
+		db.log.Error("Failed to finish run request", zap.Int64("request_id", requestID), zap.Error(err))
+		return fmt.Errorf("failed to finish run request: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to finish run request %d: %w", requestID, ErrRunRequestNotFound)
+	}
+	return nil
+}
+
+// AbandonRunRequests marks run requests that were started but never finished (the daemon stopped while running them)
+// as finished, and returns the number of requests updated
+func (db *DB) AbandonRunRequests(ctx context.Context) (int64, error) {
+	query := `UPDATE run_requests SET finished_at = CURRENT_TIMESTAMP WHERE started_at IS NOT NULL AND finished_at IS NULL`
+	tag, err := db.pool.Exec(ctx, query)
+	if err != nil {
+		db.log.Error("Failed to abandon run requests", zap.Error(err))
+		return 0, fmt.Errorf("failed to abandon run requests: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
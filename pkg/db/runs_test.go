@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_BatchRuns(t *testing.T) {
+	testDB := SetupTestDB(t)
+	defer testDB.Cleanup(t)
+	ctx := context.Background()
+
+	first, err := testDB.DB.StartBatchRun(ctx)
+	require.NoError(t, err)
+	require.NoError(t, testDB.DB.FinishBatchRun(ctx, first, BatchRunResult{
+		Status:        BatchRunStatusPartial,
+		DomainsTotal:  3,
+		DomainsFailed: 1,
+	}))
+
+	second, err := testDB.DB.StartBatchRun(ctx)
+	require.NoError(t, err)
+
+	runs, err := testDB.DB.GetRecentBatchRuns(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, runs, 2)
+
+	// Newest first; the second run is still running
+	assert.Equal(t, second, runs[0].ID)
+	assert.Equal(t, BatchRunStatusRunning, runs[0].Status)
+	assert.Nil(t, runs[0].FinishedAt)
+
+	assert.Equal(t, first, runs[1].ID)
+	assert.Equal(t, BatchRunStatusPartial, runs[1].Status)
+	assert.Equal(t, 3, runs[1].DomainsTotal)
+	assert.Equal(t, 1, runs[1].DomainsFailed)
+	assert.NotNil(t, runs[1].FinishedAt)
+
+	runs, err = testDB.DB.GetRecentBatchRuns(ctx, 1)
+	require.NoError(t, err)
+	assert.Len(t, runs, 1)
+
+	// The running second run has not finished, so the first one is the last finished
+	last, age, err := testDB.DB.GetLastFinishedBatchRun(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, first, last.ID)
+	assert.Nil(t, last.FirewallRules)
+	assert.Less(t, age, time.Minute)
+
+	rules := 12
+	require.NoError(t, testDB.DB.FinishBatchRun(ctx, second, BatchRunResult{
+		Status:        BatchRunStatusSucceeded,
+		FirewallRules: &rules,
+	}))
+	last, _, err = testDB.DB.GetLastFinishedBatchRun(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, second, last.ID)
+	require.NotNil(t, last.FirewallRules)
+	assert.Equal(t, 12, *last.FirewallRules)
+
+	err = testDB.DB.FinishBatchRun(ctx, 9999, BatchRunResult{Status: BatchRunStatusFailed})
+	assert.True(t, errors.Is(err, ErrBatchRunNotFound))
+}
+
+func Test_GetLastFinishedBatchRun_none(t *testing.T) {
+	testDB := SetupTestDB(t)
+	defer testDB.Cleanup(t)
+
+	_, _, err := testDB.DB.GetLastFinishedBatchRun(context.Background())
+	assert.True(t, errors.Is(err, ErrBatchRunNotFound))
+}
+
+func Test_RunRequests(t *testing.T) {
+	testDB := SetupTestDB(t)
+	defer testDB.Cleanup(t)
+	ctx := context.Background()
+
+	pending, err := testDB.DB.GetPendingRunRequest(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, pending)
+
+	id, err := testDB.DB.ClaimRunRequest(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, id)
+
+	first, err := testDB.DB.CreateRunRequest(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, first.StartedAt)
+
+	// Requests made before the daemon picks up the first one are merged into it
+	second, err := testDB.DB.CreateRunRequest(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, second.ID)
+
+	id, err = testDB.DB.ClaimRunRequest(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, id)
+
+	// A request made while a run is in progress waits for the next run
+	third, err := testDB.DB.CreateRunRequest(ctx)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.ID, third.ID)
+
+	runID, err := testDB.DB.StartBatchRun(ctx)
+	require.NoError(t, err)
+	require.NoError(t, testDB.DB.FinishRunRequest(ctx, first.ID, runID))
+
+	pending, err = testDB.DB.GetPendingRunRequest(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, pending)
+	assert.Equal(t, third.ID, pending.ID)
+
+	// A request left running by a stopped daemon is finished when the daemon restarts
+	_, err = testDB.DB.ClaimRunRequest(ctx)
+	require.NoError(t, err)
+	abandoned, err := testDB.DB.AbandonRunRequests(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), abandoned)
+
+	pending, err = testDB.DB.GetPendingRunRequest(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, pending)
+
+	err = testDB.DB.FinishRunRequest(ctx, 9999, 0)
+	assert.True(t, errors.Is(err, ErrRunRequestNotFound))
+}
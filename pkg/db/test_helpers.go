@@ -2,10 +2,6 @@ package db
 
 import (
 	"context"
-	"fmt"
-	"io"
-	"os"
-	"path/filepath"
 	"testing"
 
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -64,9 +60,9 @@ func SetupTestDB(t *testing.T) *TestDBContainer {
 	// Create DB wrapper
 	db := &DB{pool: pool, log: logger}
 
-	// Initialize schema
-	if err := initializeSchema(db.pool); err != nil {
-		t.Fatalf("Failed to initialize schema: %v", err)
+	// Initialize schema with the same migrations as the services
+	if _, err := db.Migrate(ctx); err != nil {
+		t.Fatalf("Failed to migrate schema: %v", err)
 	}
 
 	return &TestDBContainer{
@@ -91,36 +87,6 @@ func (tdb *TestDBContainer) Cleanup(t *testing.T) {
 	}
 }
 
-// initializeSchema reads and executes the schema SQL file
-func initializeSchema(pool *pgxpool.Pool) error {
-	// Get the path to the schema file
-	schemaPath := filepath.Join("..", "..", "db", "schema", "init.sql")
-
-	// Read the schema file
-	schemaFile, err := os.Open(schemaPath)
-	if err != nil {
-		return fmt.Errorf("failed to open schema file %s: %w", schemaPath, err)
-	}
-	defer func() {
-		if closeErr := schemaFile.Close(); closeErr != nil {
-			// In a real implementation, you might want to log this error
-			_ = closeErr
-		}
-	}()
-
-	schemaSQL, err := io.ReadAll(schemaFile)
-	if err != nil {
-		return fmt.Errorf("failed to read schema file: %w", err)
-	}
-
-	// Execute the schema
-	if _, err := pool.Exec(context.Background(), string(schemaSQL)); err != nil {
-		return fmt.Errorf("failed to execute schema: %w", err)
-	}
-
-	return nil
-}
-
 // ClearTables clears all data from test tables
 func (tdb *TestDBContainer) ClearTables(t *testing.T) {
 	t.Helper()
@@ -130,8 +96,35 @@ func (tdb *TestDBContainer) ClearTables(t *testing.T) {
 		t.Fatalf("Failed to clear domain_ips table: %v", err)
 	}
 
+	// domain_ipsの削除で登録された操作も含めて削除する
+	if _, err := tdb.DB.pool.Exec(context.Background(), "DELETE FROM firewall_ops"); err != nil {
+		t.Fatalf("Failed to clear firewall_ops table: %v", err)
+	}
+
 	// Clear domains
 	if _, err := tdb.DB.pool.Exec(context.Background(), "DELETE FROM domains"); err != nil {
 		t.Fatalf("Failed to clear domains table: %v", err)
 	}
+
+	// domain_hitsはdomains削除時にCASCADEで削除される
+	if _, err := tdb.DB.pool.Exec(context.Background(), "DELETE FROM block_counters"); err != nil {
+		t.Fatalf("Failed to clear block_counters table: %v", err)
+	}
+
+	if _, err := tdb.DB.pool.Exec(context.Background(), "DELETE FROM block_hits"); err != nil {
+		t.Fatalf("Failed to clear block_hits table: %v", err)
+	}
+
+	if _, err := tdb.DB.pool.Exec(context.Background(), "DELETE FROM nodes"); err != nil {
+		t.Fatalf("Failed to clear nodes table: %v", err)
+	}
+
+	if _, err := tdb.DB.pool.Exec(context.Background(), "DELETE FROM resolver_lease"); err != nil {
+		t.Fatalf("Failed to clear resolver_lease table: %v", err)
+	}
+
+	// api_tokensとsessionsはusers削除時にCASCADEで削除される
+	if _, err := tdb.DB.pool.Exec(context.Background(), "DELETE FROM users"); err != nil {
+		t.Fatalf("Failed to clear users table: %v", err)
+	}
 }
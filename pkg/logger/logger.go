@@ -18,6 +18,13 @@ type LoggerConfig struct {
 }
 
 func NewLogger(cfg LoggerConfig) *zap.Logger {
+	logger, _ := NewLoggerWithLevel(cfg)
+	return logger
+}
+
+// NewLoggerWithLevel creates a logger like NewLogger and also returns its level,
+// which can be changed while the logger is in use (e.g. on configuration reload)
+func NewLoggerWithLevel(cfg LoggerConfig) (*zap.Logger, zap.AtomicLevel) {
 	var zapCfg zap.Config
 	switch cfg.Format {
 	case "local":
@@ -62,5 +69,5 @@ func NewLogger(cfg LoggerConfig) *zap.Logger {
 		)
 	}
 
-	return logger
+	return logger, zapCfg.Level
 }
@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
-	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
-	"github.com/gin-gonic/gin"
+	"github.com/tokane888/router-manager-go/pkg/db"
 	pkglogger "github.com/tokane888/router-manager-go/pkg/logger"
 	"github.com/tokane888/router-manager-go/services/api/internal/config"
+	"github.com/tokane888/router-manager-go/services/api/internal/router"
 	"go.uber.org/zap"
 )
 
@@ -23,12 +27,44 @@ func main() {
 	//nolint: errcheck
 	defer logger.Sync()
 
-	r := gin.Default()
-	r.GET("/ping", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"message": "pong",
-		})
-	})
+	database, err := db.NewDB(cfg.Database, logger)
+	if err != nil {
+		logger.Error("failed to initialize database connection", zap.Error(err))
+		return
+	}
+	defer database.Close()
+
+	// migrateコマンド以外は起動時に未適用のmigrationを適用し、スキーマをバイナリに合わせる
+	if cfg.MigrateOnStart && (len(os.Args) < 2 || os.Args[1] != "migrate") {
+		if _, err := database.Migrate(context.Background()); err != nil {
+			logger.Error("failed to migrate database", zap.Error(err))
+			return
+		}
+	}
+
+	if len(os.Args) > 1 {
+		switch command := os.Args[1]; command {
+		case "user":
+			ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+			defer stop()
+			if err := runUser(ctx, database, os.Args[2:], os.Stdin, os.Stdout); err != nil {
+				logger.Error("user command failed", zap.Error(err))
+			}
+			return
+		case "migrate":
+			ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+			defer stop()
+			if err := runMigrate(ctx, database, os.Args[2:], os.Stdout); err != nil {
+				logger.Error("migrate command failed", zap.Error(err))
+			}
+			return
+		default:
+			logger.Error("unknown command", zap.String("command", command))
+			return
+		}
+	}
+
+	r := router.NewRouter(cfg.RouterConfig, database, logger)
 	err = r.Run(fmt.Sprintf(":%d", cfg.RouterConfig.Port))
 	if err != nil {
 		logger.Error("failed to start API server", zap.Error(err))
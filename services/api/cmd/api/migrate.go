@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tokane888/router-manager-go/pkg/db"
+)
+
+// runMigrate implements the "migrate" subcommand, which applies the pending database migrations.
+// With -status it lists the migrations and when they were applied instead.
+//
+//	router-manager-api migrate [-status]
+func runMigrate(ctx context.Context, database *db.DB, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	status := fs.Bool("status", false, "list migrations and when they were applied")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("usage: migrate [-status]")
+	}
+
+	if *status {
+		statuses, err := database.GetMigrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			if s.Unknown {
+				applied += " (unknown to this binary)"
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return w.Flush()
+	}
+
+	applied, err := database.Migrate(ctx)
+	if err != nil {
+		return err
+	}
+	if len(applied) == 0 {
+		fmt.Fprintln(stdout, "database schema is up to date")
+	}
+	for _, m := range applied {
+		fmt.Fprintf(stdout, "applied migration %04d_%s\n", m.Version, m.Name)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/api/internal/auth"
+	"golang.org/x/term"
+)
+
+const userUsage = `usage:
+  user add [-role admin|viewer] <username>
+  user passwd <username>
+  user list
+
+passwords are read from stdin`
+
+// runUser implements the "user" subcommand for managing accounts without the API,
+// e.g. creating the first admin or resetting a forgotten password
+func runUser(ctx context.Context, database *db.DB, args []string, stdin *os.File, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(userUsage)
+	}
+
+	switch args[0] {
+	case "add":
+		fs := flag.NewFlagSet("user add", flag.ContinueOnError)
+		roleFlag := fs.String("role", string(db.UserRoleAdmin), "user role (admin, viewer)")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			return errors.New(userUsage)
+		}
+		username := fs.Arg(0)
+		if err := auth.ValidateUsername(username); err != nil {
+			return err
+		}
+		role, err := db.ParseUserRole(*roleFlag)
+		if err != nil {
+			return err
+		}
+		hash, err := readPasswordHash(stdin, stdout)
+		if err != nil {
+			return err
+		}
+		user, err := database.CreateUser(ctx, username, hash, role)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "added user %s (%s)\n", user.Username, user.Role)
+
+	case "passwd":
+		if len(args) != 2 {
+			return errors.New(userUsage)
+		}
+		hash, err := readPasswordHash(stdin, stdout)
+		if err != nil {
+			return err
+		}
+		if err := database.SetUserPassword(ctx, args[1], hash); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "changed password of %s\n", args[1])
+
+	case "list":
+		users, err := database.GetUsers(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "USERNAME\tROLE\tCREATED")
+		for _, user := range users {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", user.Username, user.Role, user.CreatedAt.Format(time.RFC3339))
+		}
+		return w.Flush()
+
+	default:
+		return errors.New(userUsage)
+	}
+	return nil
+}
+
+// readPasswordHash reads a password from stdin and returns its hash.
+// On a terminal the password is read twice without echo; otherwise the first line is used.
+func readPasswordHash(stdin *os.File, stdout io.Writer) (string, error) {
+	var password string
+	if fd := int(stdin.Fd()); term.IsTerminal(fd) {
+		fmt.Fprint(stdout, "Password: ")
+		first, err := term.ReadPassword(fd)
+		fmt.Fprintln(stdout)
+		if err != nil {
+			return "", fmt.Errorf("failed to read password: %w", err)
+		}
+		fmt.Fprint(stdout, "Retype password: ")
+		second, err := term.ReadPassword(fd)
+		fmt.Fprintln(stdout)
+		if err != nil {
+			return "", fmt.Errorf("failed to read password: %w", err)
+		}
+		if string(first) != string(second) {
+			return "", errors.New("passwords do not match")
+		}
+		password = string(first)
+	} else {
+		line, err := bufio.NewReader(stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("failed to read password: %w", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	return auth.HashPassword(password)
+}
@@ -0,0 +1,132 @@
+// Package auth authenticates api service requests with API tokens or login sessions
+// and authorizes them by user role.
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/api/internal/problem"
+	"go.uber.org/zap"
+)
+
+// SessionCookieName is the cookie holding the session token of the admin UI
+const SessionCookieName = "router_manager_session"
+
+// userContextKey is the gin context key of the authenticated user
+const userContextKey = "auth.user"
+
+// Config holds the settings of login sessions
+type Config struct {
+	SessionTTL   time.Duration
+	SecureCookie bool // trueの場合cookieをHTTPSでのみ送信する
+}
+
+// Repository defines the database operations required to authenticate requests
+type Repository interface {
+	GetUserByAPIToken(ctx context.Context, tokenHash string) (*db.User, error)
+	GetUserBySession(ctx context.Context, tokenHash string) (*db.User, error)
+}
+
+// Authenticator resolves the user of a request
+type Authenticator struct {
+	repo   Repository
+	cfg    Config
+	logger *zap.Logger
+}
+
+// errNoCredentials is returned when a request carries neither an API token nor a session cookie
+var errNoCredentials = errors.New("no credentials")
+
+// NewAuthenticator creates a new Authenticator
+func NewAuthenticator(repo Repository, cfg Config, logger *zap.Logger) *Authenticator {
+	return &Authenticator{
+		repo:   repo,
+		cfg:    cfg,
+		logger: logger,
+	}
+}
+
+// Authenticate rejects requests without a valid API token (Authorization: Bearer) or session cookie
+func (a *Authenticator) Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := a.userFromRequest(c)
+		if err != nil {
+			if errors.Is(err, errNoCredentials) || errors.Is(err, db.ErrUserNotFound) {
+				c.Header("WWW-Authenticate", `Bearer realm="router-manager"`)
+				problem.Write(c, http.StatusUnauthorized, "authentication required")
+				return
+			}
+			problem.Error(c, a.logger, err, "failed to authenticate request")
+			return
+		}
+		c.Set(userContextKey, user)
+		c.Next()
+	}
+}
+
+// RequireAdmin rejects requests of users other than admins. It must be used after Authenticate.
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if user := CurrentUser(c); user == nil || user.Role != db.UserRoleAdmin {
+			problem.Write(c, http.StatusForbidden, "admin role required")
+			return
+		}
+		c.Next()
+	}
+}
+
+// CurrentUser returns the user authenticated by Authenticate, or nil
+func CurrentUser(c *gin.Context) *db.User {
+	user, _ := c.Get(userContextKey)
+	u, _ := user.(*db.User)
+	return u
+}
+
+// SetSessionCookie sends the session token to the browser
+func (a *Authenticator) SetSessionCookie(c *gin.Context, token string) {
+	// SameSite=Strictで他サイトからのリクエストにcookieを付与させず、CSRFを防ぐ
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(SessionCookieName, token, int(a.cfg.SessionTTL.Seconds()), "/", "", a.cfg.SecureCookie, true)
+}
+
+// ClearSessionCookie removes the session cookie from the browser
+func (a *Authenticator) ClearSessionCookie(c *gin.Context) {
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(SessionCookieName, "", -1, "/", "", a.cfg.SecureCookie, true)
+}
+
+// SessionTTL returns how long a login session lasts
+func (a *Authenticator) SessionTTL() time.Duration {
+	return a.cfg.SessionTTL
+}
+
+// SessionToken returns the session token sent by the browser, or "" if there is none
+func SessionToken(c *gin.Context) string {
+	token, err := c.Cookie(SessionCookieName)
+	if err != nil {
+		return ""
+	}
+	return token
+}
+
+// userFromRequest looks up the user of the API token, or of the session cookie if no token is given
+func (a *Authenticator) userFromRequest(c *gin.Context) (*db.User, error) {
+	ctx := c.Request.Context()
+	if header := c.GetHeader("Authorization"); header != "" {
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || token == "" {
+			return nil, errNoCredentials
+		}
+		return a.repo.GetUserByAPIToken(ctx, HashToken(token))
+	}
+	if token := SessionToken(c); token != "" {
+		return a.repo.GetUserBySession(ctx, HashToken(token))
+	}
+	return nil, errNoCredentials
+}
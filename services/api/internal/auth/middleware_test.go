@@ -0,0 +1,198 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"go.uber.org/zap"
+)
+
+// fakeRepo keeps API tokens and sessions by token hash as the database does.
+// Sessions past their expiry are not found, like GetUserBySession.
+type fakeRepo struct {
+	tokens   map[string]*db.User
+	sessions map[string]fakeSession
+	now      time.Time
+	err      error
+}
+
+type fakeSession struct {
+	user      *db.User
+	expiresAt time.Time
+}
+
+func (f *fakeRepo) GetUserByAPIToken(_ context.Context, tokenHash string) (*db.User, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if user, ok := f.tokens[tokenHash]; ok {
+		return user, nil
+	}
+	return nil, fmt.Errorf("user by API token: %w", db.ErrUserNotFound)
+}
+
+func (f *fakeRepo) GetUserBySession(_ context.Context, tokenHash string) (*db.User, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if s, ok := f.sessions[tokenHash]; ok && s.expiresAt.After(f.now) {
+		return s.user, nil
+	}
+	return nil, fmt.Errorf("user by session: %w", db.ErrUserNotFound)
+}
+
+var (
+	testAdmin  = &db.User{ID: 1, Username: "admin", Role: db.UserRoleAdmin}
+	testViewer = &db.User{ID: 2, Username: "viewer", Role: db.UserRoleViewer}
+)
+
+// newTestRouter registers a read route for every authenticated user and a mutating route for admins, as the router does
+func newTestRouter(repo Repository) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	authn := NewAuthenticator(repo, Config{SessionTTL: time.Hour}, zap.NewNop())
+	viewer := r.Group("", authn.Authenticate())
+	viewer.GET("/domains", func(c *gin.Context) { c.String(http.StatusOK, CurrentUser(c).Username) })
+	admin := viewer.Group("", RequireAdmin())
+	admin.POST("/domains", func(c *gin.Context) { c.Status(http.StatusCreated) })
+	return r
+}
+
+func TestAuthenticator(t *testing.T) {
+	now := time.Now()
+	repo := &fakeRepo{
+		tokens: map[string]*db.User{
+			HashToken("rmt_admin"):  testAdmin,
+			HashToken("rmt_viewer"): testViewer,
+		},
+		sessions: map[string]fakeSession{
+			HashToken("rms_admin"):   {user: testAdmin, expiresAt: now.Add(time.Hour)},
+			HashToken("rms_expired"): {user: testAdmin, expiresAt: now.Add(-time.Minute)},
+		},
+		now: now,
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		header     string // Authorization
+		cookie     string // session token
+		wantStatus int
+	}{
+		{name: "anonymous read", method: http.MethodGet, wantStatus: http.StatusUnauthorized},
+		{name: "anonymous change", method: http.MethodPost, wantStatus: http.StatusUnauthorized},
+		{name: "malformed authorization header", method: http.MethodGet, header: "Basic YWRtaW46cGFzcw==", wantStatus: http.StatusUnauthorized},
+		{name: "viewer reads", method: http.MethodGet, header: "Bearer rmt_viewer", wantStatus: http.StatusOK},
+		{name: "viewer cannot change", method: http.MethodPost, header: "Bearer rmt_viewer", wantStatus: http.StatusForbidden},
+		{name: "admin token changes", method: http.MethodPost, header: "Bearer rmt_admin", wantStatus: http.StatusCreated},
+		{name: "admin session changes", method: http.MethodPost, cookie: "rms_admin", wantStatus: http.StatusCreated},
+		{name: "revoked token", method: http.MethodGet, header: "Bearer rmt_revoked", wantStatus: http.StatusUnauthorized},
+		{name: "expired session", method: http.MethodGet, cookie: "rms_expired", wantStatus: http.StatusUnauthorized},
+		// トークンが指定された場合はcookieを参照しない
+		{name: "revoked token with valid session", method: http.MethodPost, header: "Bearer rmt_revoked", cookie: "rms_admin", wantStatus: http.StatusUnauthorized},
+	}
+
+	r := newTestRouter(repo)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/domains", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: tt.cookie})
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus == http.StatusUnauthorized {
+				assert.Equal(t, `Bearer realm="router-manager"`, w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestAuthenticator_revokedTokenIsRejected(t *testing.T) {
+	repo := &fakeRepo{tokens: map[string]*db.User{HashToken("rmt_admin"): testAdmin}}
+	r := newTestRouter(repo)
+	request := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/domains", nil)
+		req.Header.Set("Authorization", "Bearer rmt_admin")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, request())
+	delete(repo.tokens, HashToken("rmt_admin"))
+	assert.Equal(t, http.StatusUnauthorized, request())
+}
+
+func TestAuthenticator_repositoryError(t *testing.T) {
+	r := newTestRouter(&fakeRepo{err: errors.New("connection refused")})
+
+	req := httptest.NewRequest(http.MethodGet, "/domains", nil)
+	req.Header.Set("Authorization", "Bearer rmt_admin")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	// DBのエラーは認証失敗として扱わない
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestAuthenticator_SetSessionCookie(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name   string
+		secure bool
+	}{
+		{name: "http", secure: false},
+		{name: "https only", secure: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authn := NewAuthenticator(&fakeRepo{}, Config{SessionTTL: 2 * time.Hour, SecureCookie: tt.secure}, zap.NewNop())
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			authn.SetSessionCookie(c, "rms_token")
+
+			cookies := w.Result().Cookies()
+			if assert.Len(t, cookies, 1) {
+				cookie := cookies[0]
+				assert.Equal(t, SessionCookieName, cookie.Name)
+				assert.Equal(t, "rms_token", cookie.Value)
+				assert.Equal(t, http.SameSiteStrictMode, cookie.SameSite)
+				assert.True(t, cookie.HttpOnly)
+				assert.Equal(t, tt.secure, cookie.Secure)
+				assert.Equal(t, "/", cookie.Path)
+				assert.Equal(t, 7200, cookie.MaxAge)
+			}
+		})
+	}
+}
+
+func TestAuthenticator_ClearSessionCookie(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	authn := NewAuthenticator(&fakeRepo{}, Config{SessionTTL: time.Hour}, zap.NewNop())
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	authn.ClearSessionCookie(c)
+
+	cookies := w.Result().Cookies()
+	if assert.Len(t, cookies, 1) {
+		assert.Equal(t, "", cookies[0].Value)
+		assert.Equal(t, http.SameSiteStrictMode, cookies[0].SameSite)
+		assert.Negative(t, cookies[0].MaxAge)
+	}
+}
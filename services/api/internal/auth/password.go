@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MinPasswordLength is the minimum number of characters of a password
+const MinPasswordLength = 8
+
+// maxPasswordBytes is the longest password bcrypt accepts
+const maxPasswordBytes = 72
+
+// dummyHash is compared against when the user does not exist so that
+// a login attempt takes the same time whether the username is valid or not
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("router-manager-dummy-password"), bcrypt.DefaultCost)
+
+// HashPassword validates a password and returns its bcrypt hash
+func HashPassword(password string) (string, error) {
+	if utf8.RuneCountInString(password) < MinPasswordLength {
+		return "", fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	}
+	if len(password) > maxPasswordBytes {
+		return "", fmt.Errorf("password must be at most %d bytes", maxPasswordBytes)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether password matches the bcrypt hash.
+// An empty hash means the user does not exist; the dummy hash is checked to keep the timing constant.
+func CheckPassword(hash, password string) bool {
+	if hash == "" {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
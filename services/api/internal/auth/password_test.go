@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$2a$"), "bcrypt hash expected, got %s", hash)
+	assert.True(t, CheckPassword(hash, "correct horse"))
+	assert.False(t, CheckPassword(hash, "correct horsE"))
+
+	_, err = HashPassword("short")
+	assert.ErrorContains(t, err, "at least 8 characters")
+	_, err = HashPassword(strings.Repeat("a", 73))
+	assert.ErrorContains(t, err, "at most 72 bytes")
+	// 文字数は8文字以上だがbyte数で上限を超える
+	_, err = HashPassword(strings.Repeat("あ", 25))
+	assert.Error(t, err)
+}
+
+func TestCheckPassword_unknownUser(t *testing.T) {
+	// 存在しないユーザー(空のhash)は常に失敗する
+	assert.False(t, CheckPassword("", ""))
+	assert.False(t, CheckPassword("", "router-manager-dummy-password"))
+	assert.False(t, CheckPassword("not a bcrypt hash", "password"))
+}
@@ -0,0 +1,28 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewToken(t *testing.T) {
+	token, hash, err := NewToken(APITokenPrefix)
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(token, APITokenPrefix))
+	// 32 bytesをbase64url(パディングなし)で符号化
+	assert.Len(t, strings.TrimPrefix(token, APITokenPrefix), 43)
+	assert.Equal(t, HashToken(token), hash)
+
+	other, _, err := NewToken(APITokenPrefix)
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other)
+}
+
+func TestHashToken(t *testing.T) {
+	// echo -n rmt_example | sha256sum
+	assert.Equal(t, "02324abae9e836b00e6f94d38b347f725517677c302442694998ac8efe1d2cf8", HashToken("rmt_example"))
+}
@@ -0,0 +1,17 @@
+package auth
+
+import (
+	"errors"
+	"regexp"
+)
+
+// usernamePattern restricts usernames to characters that are safe in URLs and logs
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,64}$`)
+
+// ValidateUsername reports whether a username can be registered
+func ValidateUsername(username string) error {
+	if !usernamePattern.MatchString(username) {
+		return errors.New("invalid username: use up to 64 letters, digits, '.', '_' or '-'")
+	}
+	return nil
+}
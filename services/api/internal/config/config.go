@@ -4,9 +4,13 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/tokane888/router-manager-go/pkg/db"
 	"github.com/tokane888/router-manager-go/pkg/logger"
+	"github.com/tokane888/router-manager-go/services/api/internal/auth"
+	"github.com/tokane888/router-manager-go/services/api/internal/handler"
 	"github.com/tokane888/router-manager-go/services/api/internal/router"
 )
 
@@ -15,7 +19,10 @@ type Config struct {
 	Env          string
 	RouterConfig router.RouterConfig
 	Logger       logger.LoggerConfig
-	// 必要に応じてDatabaseConfig等各structへ注入する設定追加
+	Database     db.Config
+	// MigrateOnStart applies pending database migrations when the server starts
+	MigrateOnStart bool
+	// 必要に応じて各structへ注入する設定追加
 }
 
 // NewConfig loads environment variables into Config
@@ -31,11 +38,41 @@ func NewConfig(version string) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	sessionTTL, err := getDurationEnv("SESSION_TTL", 7*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	if sessionTTL <= 0 {
+		return nil, fmt.Errorf("invalid SESSION_TTL: %s (must be positive)", sessionTTL)
+	}
+	secureCookie, err := getBoolEnv("SESSION_COOKIE_SECURE", false)
+	if err != nil {
+		return nil, err
+	}
+	maxRunAge, err := getDurationEnv("HEALTH_MAX_RUN_AGE", 2*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	if maxRunAge <= 0 {
+		return nil, fmt.Errorf("invalid HEALTH_MAX_RUN_AGE: %s (must be positive)", maxRunAge)
+	}
+	migrateOnStart, err := getBoolEnv("DB_MIGRATE_ON_START", true)
+	if err != nil {
+		return nil, err
+	}
 
 	cfg := &Config{
 		Env: env,
 		RouterConfig: router.RouterConfig{
 			Port: port,
+			Auth: auth.Config{
+				SessionTTL:   sessionTTL,
+				SecureCookie: secureCookie,
+			},
+			Health: handler.HealthConfig{
+				MaxRunAge:        maxRunAge,
+				DnsmasqConfigDir: getEnv("DNSMASQ_CONFIG_DIR", ""),
+			},
 		},
 		Logger: logger.LoggerConfig{
 			AppName:    getEnv("APP_NAME", ""),
@@ -43,6 +80,15 @@ func NewConfig(version string) (*Config, error) {
 			Level:      getEnv("LOG_LEVEL", "info"),
 			Format:     getEnv("LOG_FORMAT", "local"),
 		},
+		Database: db.Config{
+			Host:     getEnv("DB_HOST", "localhost"),
+			Port:     getEnv("DB_PORT", "5432"),
+			DBName:   getEnv("DB_NAME", "router_manager"),
+			User:     getEnv("DB_USER", "postgres"),
+			Password: getEnv("DB_PASSWORD", ""),
+			SSLMode:  getEnv("DB_SSL_MODE", "disable"),
+		},
+		MigrateOnStart: migrateOnStart,
 	}
 	return cfg, nil
 }
@@ -64,3 +110,25 @@ func getIntEnv(key string, fallback int) (int, error) {
 	}
 	return fallback, nil
 }
+
+func getDurationEnv(key string, fallback time.Duration) (time.Duration, error) {
+	if s, exists := os.LookupEnv(key); exists {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid value for environment variable %s: %q (expected duration): %w", key, s, err)
+		}
+		return d, nil
+	}
+	return fallback, nil
+}
+
+func getBoolEnv(key string, fallback bool) (bool, error) {
+	if s, exists := os.LookupEnv(key); exists {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return false, fmt.Errorf("invalid value for environment variable %s: %q (expected boolean): %w", key, s, err)
+		}
+		return b, nil
+	}
+	return fallback, nil
+}
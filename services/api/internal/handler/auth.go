@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/api/internal/auth"
+	"github.com/tokane888/router-manager-go/services/api/internal/problem"
+	"go.uber.org/zap"
+)
+
+// sessionTokenPrefix marks session tokens; unlike API tokens they never leave the browser cookie
+const sessionTokenPrefix = "rms_"
+
+// AuthRepository defines the database operations required for login sessions and password changes
+type AuthRepository interface {
+	GetUserByUsername(ctx context.Context, username string) (*db.User, error)
+	SetUserPassword(ctx context.Context, username, passwordHash string) error
+	CreateSession(ctx context.Context, userID int64, tokenHash string, ttl time.Duration) error
+	DeleteSession(ctx context.Context, tokenHash string) error
+	DeleteExpiredSessions(ctx context.Context) (int64, error)
+}
+
+// AuthHandler handles login, logout and password changes
+type AuthHandler struct {
+	repo   AuthRepository
+	authn  *auth.Authenticator
+	logger *zap.Logger
+}
+
+// loginRequest is the JSON body accepted by the login endpoint
+type loginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// changePasswordRequest is the JSON body accepted by the password endpoint
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// NewAuthHandler creates a new AuthHandler
+func NewAuthHandler(repo AuthRepository, authn *auth.Authenticator, logger *zap.Logger) *AuthHandler {
+	return &AuthHandler{
+		repo:   repo,
+		authn:  authn,
+		logger: logger,
+	}
+}
+
+// Login checks a username and password and starts a session stored in a cookie.
+//
+//	POST /api/v1/auth/login {"username": "admin", "password": "..."}
+func (h *AuthHandler) Login(c *gin.Context) {
+	var req loginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Validation(c, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	user, err := h.repo.GetUserByUsername(ctx, req.Username)
+	if err != nil && !errors.Is(err, db.ErrUserNotFound) {
+		problem.Error(c, h.logger, err, "failed to log in", zap.String("username", req.Username))
+		return
+	}
+	hash := ""
+	if user != nil {
+		hash = user.PasswordHash
+	}
+	// ユーザーの有無を区別できないよう、存在しない場合も同じエラーを返す
+	if !auth.CheckPassword(hash, req.Password) {
+		h.logger.Warn("Login failed", zap.String("username", req.Username), zap.String("client_ip", c.ClientIP()))
+		problem.Write(c, http.StatusUnauthorized, "invalid username or password")
+		return
+	}
+
+	token, tokenHash, err := auth.NewToken(sessionTokenPrefix)
+	if err != nil {
+		problem.Error(c, h.logger, err, "failed to log in")
+		return
+	}
+	if err := h.repo.CreateSession(ctx, user.ID, tokenHash, h.authn.SessionTTL()); err != nil {
+		problem.Error(c, h.logger, err, "failed to log in", zap.String("username", user.Username))
+		return
+	}
+	// 期限切れのsessionはログインのたびに削除する。失敗してもログインは成功させる
+	if _, err := h.repo.DeleteExpiredSessions(ctx); err != nil {
+		h.logger.Warn("Failed to delete expired sessions", zap.Error(err))
+	}
+
+	h.authn.SetSessionCookie(c, token)
+	h.logger.Info("User logged in", zap.String("username", user.Username))
+	c.JSON(http.StatusOK, user)
+}
+
+// Logout ends the session of the request.
+//
+//	POST /api/v1/auth/logout
+func (h *AuthHandler) Logout(c *gin.Context) {
+	if token := auth.SessionToken(c); token != "" {
+		if err := h.repo.DeleteSession(c.Request.Context(), auth.HashToken(token)); err != nil {
+			problem.Error(c, h.logger, err, "failed to log out")
+			return
+		}
+	}
+	h.authn.ClearSessionCookie(c)
+	c.Status(http.StatusNoContent)
+}
+
+// Me returns the authenticated user.
+//
+//	GET /api/v1/auth/me
+func (h *AuthHandler) Me(c *gin.Context) {
+	c.JSON(http.StatusOK, auth.CurrentUser(c))
+}
+
+// ChangePassword changes the password of the authenticated user.
+//
+//	PUT /api/v1/auth/password {"current_password": "...", "new_password": "..."}
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	var req changePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Validation(c, err)
+		return
+	}
+	user := auth.CurrentUser(c)
+	if !auth.CheckPassword(user.PasswordHash, req.CurrentPassword) {
+		problem.Write(c, http.StatusForbidden, "current password is incorrect")
+		return
+	}
+	hash, err := auth.HashPassword(req.NewPassword)
+	if err != nil {
+		problem.Validation(c, err)
+		return
+	}
+	if err := h.repo.SetUserPassword(c.Request.Context(), user.Username, hash); err != nil {
+		problem.Error(c, h.logger, err, "failed to change password", zap.String("username", user.Username))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/api/internal/auth"
+	"go.uber.org/zap"
+)
+
+// mockAuthRepo keeps users and sessions in memory, sessions by token hash as the database does
+type mockAuthRepo struct {
+	users    map[string]*db.User
+	sessions map[string]int64 // token hash -> user ID
+}
+
+func (m *mockAuthRepo) GetUserByUsername(_ context.Context, username string) (*db.User, error) {
+	if user, ok := m.users[username]; ok {
+		return user, nil
+	}
+	return nil, fmt.Errorf("user %s: %w", username, db.ErrUserNotFound)
+}
+
+func (m *mockAuthRepo) SetUserPassword(_ context.Context, username, passwordHash string) error {
+	m.users[username].PasswordHash = passwordHash
+	return nil
+}
+
+func (m *mockAuthRepo) CreateSession(_ context.Context, userID int64, tokenHash string, _ time.Duration) error {
+	m.sessions[tokenHash] = userID
+	return nil
+}
+
+func (m *mockAuthRepo) DeleteSession(_ context.Context, tokenHash string) error {
+	delete(m.sessions, tokenHash)
+	return nil
+}
+
+func (m *mockAuthRepo) DeleteExpiredSessions(_ context.Context) (int64, error) { return 0, nil }
+
+func TestAuthHandler_Login(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hash, err := auth.HashPassword("correct horse")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		body        string
+		wantStatus  int
+		wantSession bool
+	}{
+		{name: "valid password", body: `{"username": "admin", "password": "correct horse"}`, wantStatus: http.StatusOK, wantSession: true},
+		{name: "wrong password", body: `{"username": "admin", "password": "wrong horse"}`, wantStatus: http.StatusUnauthorized},
+		{name: "unknown user", body: `{"username": "nobody", "password": "correct horse"}`, wantStatus: http.StatusUnauthorized},
+		{name: "missing password", body: `{"username": "admin"}`, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockAuthRepo{
+				users:    map[string]*db.User{"admin": {ID: 1, Username: "admin", PasswordHash: hash, Role: db.UserRoleAdmin}},
+				sessions: map[string]int64{},
+			}
+			authn := auth.NewAuthenticator(nil, auth.Config{SessionTTL: time.Hour, SecureCookie: true}, zap.NewNop())
+			h := NewAuthHandler(repo, authn, zap.NewNop())
+			r := gin.New()
+			r.POST("/login", h.Login)
+
+			req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			cookies := w.Result().Cookies()
+			if !tt.wantSession {
+				assert.Empty(t, cookies)
+				assert.Empty(t, repo.sessions)
+				return
+			}
+			require.Len(t, cookies, 1)
+			cookie := cookies[0]
+			assert.Equal(t, auth.SessionCookieName, cookie.Name)
+			assert.Equal(t, http.SameSiteStrictMode, cookie.SameSite)
+			assert.True(t, cookie.HttpOnly)
+			assert.True(t, cookie.Secure)
+			// DBにはtokenそのものではなくhashのみを保存する
+			assert.Equal(t, map[string]int64{auth.HashToken(cookie.Value): 1}, repo.sessions)
+			assert.NotContains(t, w.Body.String(), hash)
+		})
+	}
+}
+
+func TestAuthHandler_Logout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := &mockAuthRepo{sessions: map[string]int64{auth.HashToken("rms_token"): 1}}
+	authn := auth.NewAuthenticator(nil, auth.Config{SessionTTL: time.Hour}, zap.NewNop())
+	h := NewAuthHandler(repo, authn, zap.NewNop())
+	r := gin.New()
+	r.POST("/logout", h.Logout)
+
+	req := httptest.NewRequest(http.MethodPost, "/logout", nil)
+	req.AddCookie(&http.Cookie{Name: auth.SessionCookieName, Value: "rms_token"})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, repo.sessions)
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Negative(t, cookies[0].MaxAge)
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/api/internal/problem"
+	"go.uber.org/zap"
+)
+
+// maxBackupBodySize is the maximum accepted size of an uploaded configuration backup
+const maxBackupBodySize = 32 << 20
+
+// BackupRepository defines the database operations required for configuration export and restore
+type BackupRepository interface {
+	ExportBackup(ctx context.Context) (*db.Backup, error)
+	RestoreBackup(ctx context.Context, backup *db.Backup, mode db.RestoreMode) (*db.RestoreResult, error)
+}
+
+// BackupHandler handles configuration export and restore requests
+type BackupHandler struct {
+	repo   BackupRepository
+	logger *zap.Logger
+}
+
+// NewBackupHandler creates a new BackupHandler
+func NewBackupHandler(repo BackupRepository, logger *zap.Logger) *BackupHandler {
+	return &BackupHandler{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// Export returns the current configuration as a versioned document.
+//
+//	GET /api/v1/config/export?format=json
+func (h *BackupHandler) Export(c *gin.Context) {
+	format, err := queryBackupFormat(c)
+	if err != nil {
+		problem.Validation(c, err)
+		return
+	}
+
+	backup, err := h.repo.ExportBackup(c.Request.Context())
+	if err != nil {
+		problem.Error(c, h.logger, err, "failed to export configuration")
+		return
+	}
+
+	contentType := "application/json"
+	if format == db.BackupFormatYAML {
+		contentType = "application/yaml"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="router-manager-backup-%s.%s"`, backup.ExportedAt.Format("20060102"), format))
+	c.Status(http.StatusOK)
+	if err := db.EncodeBackup(c.Writer, backup, format); err != nil {
+		h.logger.Error("Failed to write configuration export", zap.Error(err))
+	}
+}
+
+// Restore loads the request body as a configuration backup.
+// Firewall rules of domains deleted in replace mode are not removed here since the API
+// has no access to the firewall; the next batch run removes them when it reconciles the rules.
+//
+//	POST /api/v1/config/restore?mode=merge&format=json
+func (h *BackupHandler) Restore(c *gin.Context) {
+	format, err := queryBackupFormat(c)
+	if err != nil {
+		problem.Validation(c, err)
+		return
+	}
+
+	mode, err := db.ParseRestoreMode(c.DefaultQuery("mode", string(db.RestoreModeMerge)))
+	if err != nil {
+		problem.Validation(c, err)
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxBackupBodySize)
+	backup, err := db.DecodeBackup(body, format)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			problem.Write(c, http.StatusRequestEntityTooLarge, "backup too large")
+			return
+		}
+		problem.Validation(c, err)
+		return
+	}
+
+	result, err := h.repo.RestoreBackup(c.Request.Context(), backup, mode)
+	if err != nil {
+		problem.Error(c, h.logger, err, "failed to restore configuration")
+		return
+	}
+	if len(result.RemovedIPs) > 0 {
+		h.logger.Warn("Restore removed domains whose firewall rules remain until the next batch run",
+			zap.Int("ips", len(result.RemovedIPs)))
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// queryBackupFormat reads the format query parameter (default json)
+func queryBackupFormat(c *gin.Context) (db.BackupFormat, error) {
+	return db.ParseBackupFormat(c.DefaultQuery("format", string(db.BackupFormatJSON)))
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/api/internal/problem"
+	"go.uber.org/zap"
+)
+
+// DomainActionRepository defines the database operations required to change a domain's block action
+type DomainActionRepository interface {
+	SetDomainAction(ctx context.Context, domainName string, action db.BlockAction) error
+}
+
+// DomainActionHandler handles block action changes of domains
+type DomainActionHandler struct {
+	repo   DomainActionRepository
+	logger *zap.Logger
+}
+
+// setActionRequest is the JSON body accepted by the action endpoint
+type setActionRequest struct {
+	Action string `json:"action" binding:"required"`
+}
+
+// NewDomainActionHandler creates a new DomainActionHandler
+func NewDomainActionHandler(repo DomainActionRepository, logger *zap.Logger) *DomainActionHandler {
+	return &DomainActionHandler{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// SetAction changes how a domain's IPs are blocked (drop, reject or log).
+// The API has no access to the firewall; existing rules are replaced when the next batch run reconciles them.
+//
+//	PUT /api/v1/domains/:name/action {"action": "reject"}
+func (h *DomainActionHandler) SetAction(c *gin.Context) {
+	var req setActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Validation(c, err)
+		return
+	}
+	action, err := db.ParseBlockAction(req.Action)
+	if err != nil {
+		problem.Validation(c, err)
+		return
+	}
+
+	name := strings.ToLower(c.Param("name"))
+	if err := h.repo.SetDomainAction(c.Request.Context(), name, action); err != nil {
+		problem.Error(c, h.logger, err, "failed to set domain action", zap.String("domain", name))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"domain": name, "action": action})
+}
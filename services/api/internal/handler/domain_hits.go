@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/api/internal/problem"
+	"go.uber.org/zap"
+)
+
+// defaultHitWindow is the time window summed when the window query parameter is omitted
+const defaultHitWindow = 24 * time.Hour
+
+// DomainHitsRepository defines the database operations required to read block hit counts
+type DomainHitsRepository interface {
+	GetDomainHits(ctx context.Context, window time.Duration) ([]db.DomainHits, error)
+}
+
+// DomainHitsHandler handles block hit count requests
+type DomainHitsHandler struct {
+	repo   DomainHitsRepository
+	logger *zap.Logger
+}
+
+// NewDomainHitsHandler creates a new DomainHitsHandler
+func NewDomainHitsHandler(repo DomainHitsRepository, logger *zap.Logger) *DomainHitsHandler {
+	return &DomainHitsHandler{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// Hits returns the packets and bytes blocked per domain within the window (default 24h).
+// Counts are aggregated hourly by the batch, so the window is rounded to whole hours.
+//
+//	GET /api/v1/domains/hits?window=24h
+func (h *DomainHitsHandler) Hits(c *gin.Context) {
+	window := defaultHitWindow
+	if value := c.Query("window"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			problem.Write(c, http.StatusBadRequest, "invalid window: must be a positive duration such as 24h")
+			return
+		}
+		window = parsed
+	}
+
+	hits, err := h.repo.GetDomainHits(c.Request.Context(), window)
+	if err != nil {
+		problem.Error(c, h.logger, err, "failed to get domain hits")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"window": window.String(), "domains": hits})
+}
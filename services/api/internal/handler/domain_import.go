@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tokane888/router-manager-go/pkg/blocklist"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/api/internal/problem"
+	"go.uber.org/zap"
+)
+
+// maxImportBodySize is the maximum accepted size of an uploaded blocklist
+const maxImportBodySize = 32 << 20
+
+// DomainImportRepository defines the database operations required for bulk domain import
+type DomainImportRepository interface {
+	PreviewDomainImport(ctx context.Context, domainNames []string) (*db.DomainImportDiff, error)
+	ImportDomains(ctx context.Context, domainNames []string) (int, error)
+}
+
+// DomainImportHandler handles bulk domain import requests
+type DomainImportHandler struct {
+	repo   DomainImportRepository
+	logger *zap.Logger
+}
+
+// importResponse is the JSON body returned by the import endpoint
+type importResponse struct {
+	Format   blocklist.Format `json:"format"`
+	Parsed   int              `json:"parsed"`
+	Skipped  int              `json:"skipped"`
+	ToAdd    []string         `json:"to_add"`
+	Existing int              `json:"existing"`
+	Added    int              `json:"added"`
+	DryRun   bool             `json:"dry_run"`
+}
+
+// NewDomainImportHandler creates a new DomainImportHandler
+func NewDomainImportHandler(repo DomainImportRepository, logger *zap.Logger) *DomainImportHandler {
+	return &DomainImportHandler{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// Import parses the request body as a blocklist and imports its domains.
+//
+//	POST /api/v1/domains/import?format=auto&dry_run=true
+func (h *DomainImportHandler) Import(c *gin.Context) {
+	format, err := blocklist.ParseFormat(c.Query("format"))
+	if err != nil {
+		problem.Validation(c, err)
+		return
+	}
+
+	dryRun := false
+	if s := c.Query("dry_run"); s != "" {
+		dryRun, err = strconv.ParseBool(s)
+		if err != nil {
+			problem.Write(c, http.StatusBadRequest, "dry_run must be a boolean")
+			return
+		}
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBodySize)
+	parsed, err := blocklist.Parse(body, format)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			problem.Write(c, http.StatusRequestEntityTooLarge, "blocklist too large")
+			return
+		}
+		problem.Validation(c, err)
+		return
+	}
+
+	resp := importResponse{
+		Format:  format,
+		Parsed:  len(parsed.Domains),
+		Skipped: parsed.Skipped,
+		ToAdd:   []string{},
+		DryRun:  dryRun,
+	}
+	if len(parsed.Domains) == 0 {
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	ctx := c.Request.Context()
+	diff, err := h.repo.PreviewDomainImport(ctx, parsed.Domains)
+	if err != nil {
+		problem.Error(c, h.logger, err, "failed to preview domain import")
+		return
+	}
+	if diff.ToAdd != nil {
+		resp.ToAdd = diff.ToAdd
+	}
+	resp.Existing = len(diff.Existing)
+
+	if !dryRun && len(diff.ToAdd) > 0 {
+		resp.Added, err = h.repo.ImportDomains(ctx, diff.ToAdd)
+		if err != nil {
+			problem.Error(c, h.logger, err, "failed to import domains")
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,260 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tokane888/router-manager-go/pkg/blocklist"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/api/internal/problem"
+	"go.uber.org/zap"
+)
+
+// domainHistoryWindow is the period of hourly hit counts returned with a domain
+const domainHistoryWindow = 7 * 24 * time.Hour
+
+// DomainRepository defines the database operations required to manage domains
+type DomainRepository interface {
+	GetAllDomains(ctx context.Context) ([]db.Domain, error)
+	GetDomain(ctx context.Context, domainName string) (*db.Domain, error)
+	CreateDomain(ctx context.Context, domainName string) error
+	SetDomainAction(ctx context.Context, domainName string, action db.BlockAction) error
+	DeleteDomain(ctx context.Context, domainName string) ([]db.DomainIP, error)
+	DeleteDomainIP(ctx context.Context, domainName, ipAddress string) error
+	GetAllDomainIPs(ctx context.Context) ([]db.DomainIP, error)
+	GetDomainIPs(ctx context.Context, domainName string) ([]db.DomainIP, error)
+	GetDomainHitHistory(ctx context.Context, domainName string, window time.Duration) ([]db.DomainHitBucket, error)
+	GetActiveDomainOverrides(ctx context.Context) ([]db.DomainOverride, error)
+}
+
+// DomainHandler handles domain management requests
+type DomainHandler struct {
+	repo   DomainRepository
+	logger *zap.Logger
+}
+
+// domainResponse is the JSON representation of a domain
+type domainResponse struct {
+	Name       string         `json:"name"`
+	Manual     bool           `json:"manual"` // falseの場合blocklist feedが管理するドメイン
+	Action     db.BlockAction `json:"action"`
+	IPCount    int            `json:"ip_count"`
+	LastSeenAt *time.Time     `json:"last_seen_at"` // 最も新しいIPのupdated_at。IP未解決の場合nil
+	CreatedAt  time.Time      `json:"created_at"`
+	// 有効な一時ブロック・一時除外。ない場合nil
+	Override *db.DomainOverride `json:"override"`
+}
+
+// domainIPResponse is the JSON representation of a resolved IP of a domain
+type domainIPResponse struct {
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// domainDetailResponse is the JSON body returned for a single domain
+type domainDetailResponse struct {
+	domainResponse
+	IPs     []domainIPResponse   `json:"ips"`
+	History []db.DomainHitBucket `json:"history"`
+}
+
+// createDomainRequest is the JSON body accepted when registering a domain
+type createDomainRequest struct {
+	Name   string `json:"name" binding:"required"`
+	Action string `json:"action"`
+}
+
+// NewDomainHandler creates a new DomainHandler
+func NewDomainHandler(repo DomainRepository, logger *zap.Logger) *DomainHandler {
+	return &DomainHandler{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// List returns all domains with the number of resolved IPs.
+//
+//	GET /api/v1/domains
+func (h *DomainHandler) List(c *gin.Context) {
+	ctx := c.Request.Context()
+	domains, err := h.repo.GetAllDomains(ctx)
+	if err != nil {
+		problem.Error(c, h.logger, err, "failed to get domains")
+		return
+	}
+	ips, err := h.repo.GetAllDomainIPs(ctx)
+	if err != nil {
+		problem.Error(c, h.logger, err, "failed to get domain IPs")
+		return
+	}
+	overrides, err := h.overridesByDomain(ctx)
+	if err != nil {
+		problem.Error(c, h.logger, err, "failed to get domain overrides")
+		return
+	}
+
+	ipsByDomain := make(map[string][]db.DomainIP, len(domains))
+	for _, ip := range ips {
+		ipsByDomain[ip.DomainName] = append(ipsByDomain[ip.DomainName], ip)
+	}
+	response := make([]domainResponse, 0, len(domains))
+	for _, domain := range domains {
+		response = append(response, newDomainResponse(domain, ipsByDomain[domain.DomainName], overrides[domain.DomainName]))
+	}
+	c.JSON(http.StatusOK, gin.H{"domains": response})
+}
+
+// Get returns a domain with its resolved IPs and its hourly hit counts of the last 7 days.
+//
+//	GET /api/v1/domains/:name
+func (h *DomainHandler) Get(c *gin.Context) {
+	ctx := c.Request.Context()
+	name := strings.ToLower(c.Param("name"))
+
+	domain, err := h.repo.GetDomain(ctx, name)
+	if err != nil {
+		problem.Error(c, h.logger, err, "failed to get domain", zap.String("domain", name))
+		return
+	}
+	ips, err := h.repo.GetDomainIPs(ctx, name)
+	if err != nil {
+		problem.Error(c, h.logger, err, "failed to get domain IPs", zap.String("domain", name))
+		return
+	}
+	history, err := h.repo.GetDomainHitHistory(ctx, name, domainHistoryWindow)
+	if err != nil {
+		problem.Error(c, h.logger, err, "failed to get domain hit history", zap.String("domain", name))
+		return
+	}
+	overrides, err := h.overridesByDomain(ctx)
+	if err != nil {
+		problem.Error(c, h.logger, err, "failed to get domain overrides", zap.String("domain", name))
+		return
+	}
+
+	response := domainDetailResponse{
+		domainResponse: newDomainResponse(*domain, ips, overrides[name]),
+		IPs:            make([]domainIPResponse, 0, len(ips)),
+		History:        history,
+	}
+	for _, ip := range ips {
+		response.IPs = append(response.IPs, domainIPResponse{IP: ip.IPAddress, CreatedAt: ip.CreatedAt, UpdatedAt: ip.UpdatedAt})
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// Create registers a domain. The action defaults to drop.
+// Its IPs are resolved and blocked by the next batch run.
+//
+//	POST /api/v1/domains {"name": "example.com", "action": "reject"}
+func (h *DomainHandler) Create(c *gin.Context) {
+	var req createDomainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Validation(c, err)
+		return
+	}
+	name, err := blocklist.NormalizeDomain(req.Name)
+	if err != nil {
+		problem.Validation(c, err)
+		return
+	}
+	action := db.BlockActionDrop
+	if req.Action != "" {
+		if action, err = db.ParseBlockAction(req.Action); err != nil {
+			problem.Validation(c, err)
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	if err := h.repo.CreateDomain(ctx, name); err != nil {
+		problem.Error(c, h.logger, err, "failed to create domain", zap.String("domain", name))
+		return
+	}
+	// 新規ドメインはdropで作成されるため、それ以外の場合のみ更新する
+	if action != db.BlockActionDrop {
+		if err := h.repo.SetDomainAction(ctx, name, action); err != nil {
+			problem.Error(c, h.logger, err, "failed to set domain action", zap.String("domain", name))
+			return
+		}
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"domain": name, "action": action})
+}
+
+// Delete removes a manually registered domain.
+// Its firewall rules are removed when the next batch run reconciles them.
+//
+//	DELETE /api/v1/domains/:name
+func (h *DomainHandler) Delete(c *gin.Context) {
+	ctx := c.Request.Context()
+	name := strings.ToLower(c.Param("name"))
+
+	domain, err := h.repo.GetDomain(ctx, name)
+	if err != nil {
+		problem.Error(c, h.logger, err, "failed to get domain", zap.String("domain", name))
+		return
+	}
+	if !domain.Manual {
+		// feedのドメインは次回のfeed更新で再登録されるため削除できない
+		problem.Write(c, http.StatusConflict, "domain is provided by a blocklist feed; remove the feed instead")
+		return
+	}
+
+	removed, err := h.repo.DeleteDomain(ctx, name)
+	if err != nil {
+		problem.Error(c, h.logger, err, "failed to delete domain", zap.String("domain", name))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"domain": name, "removed_ips": len(removed)})
+}
+
+// DeleteIP removes a resolved IP from a domain, e.g. one shared with a site that must stay reachable.
+// The IP is added again if the domain still resolves to it; its firewall rule is removed by the next batch run.
+//
+//	DELETE /api/v1/domains/:name/ips/:ip
+func (h *DomainHandler) DeleteIP(c *gin.Context) {
+	name := strings.ToLower(c.Param("name"))
+	ip := c.Param("ip")
+	if err := h.repo.DeleteDomainIP(c.Request.Context(), name, ip); err != nil {
+		problem.Error(c, h.logger, err, "failed to delete domain IP", zap.String("domain", name), zap.String("ip", ip))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// overridesByDomain returns the active overrides keyed by domain name
+func (h *DomainHandler) overridesByDomain(ctx context.Context) (map[string]*db.DomainOverride, error) {
+	overrides, err := h.repo.GetActiveDomainOverrides(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byDomain := make(map[string]*db.DomainOverride, len(overrides))
+	for i := range overrides {
+		byDomain[overrides[i].DomainName] = &overrides[i]
+	}
+	return byDomain, nil
+}
+
+// newDomainResponse builds the JSON representation of a domain, its IPs and its active override
+func newDomainResponse(domain db.Domain, ips []db.DomainIP, override *db.DomainOverride) domainResponse {
+	response := domainResponse{
+		Name:      domain.DomainName,
+		Manual:    domain.Manual,
+		Action:    domain.Action,
+		IPCount:   len(ips),
+		CreatedAt: domain.CreatedAt,
+		Override:  override,
+	}
+	for _, ip := range ips {
+		if response.LastSeenAt == nil || ip.UpdatedAt.After(*response.LastSeenAt) {
+			updatedAt := ip.UpdatedAt
+			response.LastSeenAt = &updatedAt
+		}
+	}
+	return response
+}
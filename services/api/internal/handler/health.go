@@ -0,0 +1,267 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"go.uber.org/zap"
+)
+
+// healthCheckTimeout bounds each check so that a hung database does not hang the monitoring request
+const healthCheckTimeout = 3 * time.Second
+
+// Health check statuses. The report status is the worst status of its checks.
+const (
+	HealthStatusOK   = "ok"
+	HealthStatusWarn = "warn" // 動作しているが確認が必要
+	HealthStatusFail = "fail"
+	HealthStatusSkip = "skip" // 前提となるcheckの失敗や未設定のため確認していない
+)
+
+// HealthConfig holds the thresholds of the health checks
+type HealthConfig struct {
+	MaxRunAge        time.Duration // 最後に終了したバッチ実行からの経過時間の上限
+	DnsmasqConfigDir string        // 空の場合dnsmasqの確認を行わない
+}
+
+// HealthRepository defines the database operations required to check the system health
+type HealthRepository interface {
+	Ping(ctx context.Context) error
+	GetLastFinishedBatchRun(ctx context.Context) (*db.BatchRun, time.Duration, error)
+	CountBlockedIPs(ctx context.Context) (int, error)
+	GetActiveNodeAges(ctx context.Context) (map[string]time.Duration, error)
+}
+
+// HealthCheck is the result of checking one part of the system
+type HealthCheck struct {
+	Status  string         `json:"status"` // HealthStatus*
+	Message string         `json:"message,omitempty"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// HealthReport is the response of /healthz and /readyz
+type HealthReport struct {
+	Status string                 `json:"status"` // HealthStatus*
+	Checks map[string]HealthCheck `json:"checks"`
+}
+
+// HealthHandler reports the state of the database, the batch runs, the nodes, the firewall rules and dnsmasq
+type HealthHandler struct {
+	repo   HealthRepository
+	config HealthConfig
+	logger *zap.Logger
+}
+
+// NewHealthHandler creates a new HealthHandler
+func NewHealthHandler(repo HealthRepository, config HealthConfig, logger *zap.Logger) *HealthHandler {
+	return &HealthHandler{
+		repo:   repo,
+		config: config,
+		logger: logger,
+	}
+}
+
+// Healthz reports every check but fails (503) only when the database is unreachable,
+// since the API cannot serve any request without it.
+//
+//	GET /healthz
+func (h *HealthHandler) Healthz(c *gin.Context) {
+	report := h.check(c.Request.Context())
+	status := http.StatusOK
+	if report.Checks["database"].Status == HealthStatusFail {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
+
+// Readyz reports every check and fails (503) when any of them fails:
+// the database is unreachable, the last batch run failed or is too old, a router sharing the database (node)
+// has not run for too long, the managed firewall rules are missing or the dnsmasq configuration cannot be read.
+// The batch run and firewall checks cover the run that finished last on any node.
+//
+//	GET /readyz
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	report := h.check(c.Request.Context())
+	status := http.StatusOK
+	if report.Status == HealthStatusFail {
+		status = http.StatusServiceUnavailable
+		h.logger.Warn("Readiness check failed", zap.Any("checks", report.Checks))
+	}
+	c.JSON(status, report)
+}
+
+// check runs all health checks
+func (h *HealthHandler) check(ctx context.Context) HealthReport {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	checks := make(map[string]HealthCheck, 5)
+	checks["database"] = h.checkDatabase(ctx)
+
+	var run *db.BatchRun
+	if checks["database"].Status == HealthStatusFail {
+		skip := HealthCheck{Status: HealthStatusSkip, Message: "database is unreachable"}
+		checks["batch_run"] = skip
+		checks["nodes"] = skip
+		checks["firewall"] = skip
+	} else {
+		checks["batch_run"], run = h.checkBatchRun(ctx)
+		checks["nodes"] = h.checkNodes(ctx)
+		checks["firewall"] = h.checkFirewall(ctx, run)
+	}
+	checks["dnsmasq"] = h.checkDnsmasq()
+
+	status := HealthStatusOK
+	for _, check := range checks {
+		switch check.Status {
+		case HealthStatusFail:
+			status = HealthStatusFail
+		case HealthStatusWarn:
+			if status == HealthStatusOK {
+				status = HealthStatusWarn
+			}
+		}
+	}
+	return HealthReport{Status: status, Checks: checks}
+}
+
+// checkDatabase checks that the database is reachable
+func (h *HealthHandler) checkDatabase(ctx context.Context) HealthCheck {
+	start := time.Now()
+	if err := h.repo.Ping(ctx); err != nil {
+		return HealthCheck{Status: HealthStatusFail, Message: err.Error()}
+	}
+	return HealthCheck{
+		Status:  HealthStatusOK,
+		Details: map[string]any{"latency_ms": time.Since(start).Milliseconds()},
+	}
+}
+
+// checkBatchRun checks the age and outcome of the batch run that finished last and returns the run if any
+func (h *HealthHandler) checkBatchRun(ctx context.Context) (HealthCheck, *db.BatchRun) {
+	run, age, err := h.repo.GetLastFinishedBatchRun(ctx)
+	if errors.Is(err, db.ErrBatchRunNotFound) {
+		return HealthCheck{Status: HealthStatusFail, Message: "no batch run has finished yet"}, nil
+	}
+	if err != nil {
+		return HealthCheck{Status: HealthStatusFail, Message: err.Error()}, nil
+	}
+
+	check := HealthCheck{
+		Status: HealthStatusOK,
+		Details: map[string]any{
+			"id":             run.ID,
+			"status":         run.Status,
+			"finished_at":    run.FinishedAt,
+			"age":            age.Round(time.Second).String(),
+			"domains_total":  run.DomainsTotal,
+			"domains_failed": run.DomainsFailed,
+		},
+	}
+	switch {
+	case age > h.config.MaxRunAge:
+		check.Status = HealthStatusFail
+		check.Message = fmt.Sprintf("last batch run finished more than %s ago", h.config.MaxRunAge)
+	case run.Status == db.BatchRunStatusFailed:
+		check.Status = HealthStatusFail
+		check.Message = "last batch run failed: " + run.Error
+	case run.Status == db.BatchRunStatusPartial:
+		check.Status = HealthStatusWarn
+		check.Message = fmt.Sprintf("last batch run failed to process %d domains", run.DomainsFailed)
+	}
+	return check, run
+}
+
+// checkNodes checks that every node has run within the maximum run age, so that one node running does not hide
+// another that stopped. Nodes that have not run for db.NodeStaleAfter are treated as removed.
+func (h *HealthHandler) checkNodes(ctx context.Context) HealthCheck {
+	ages, err := h.repo.GetActiveNodeAges(ctx)
+	if err != nil {
+		return HealthCheck{Status: HealthStatusFail, Message: err.Error()}
+	}
+	if len(ages) == 0 {
+		return HealthCheck{Status: HealthStatusSkip, Message: "no node has registered yet"}
+	}
+
+	var stale []string
+	for name, age := range ages {
+		if age > h.config.MaxRunAge {
+			stale = append(stale, name)
+		}
+	}
+	slices.Sort(stale)
+	check := HealthCheck{
+		Status:  HealthStatusOK,
+		Details: map[string]any{"nodes": len(ages)},
+	}
+	if len(stale) > 0 {
+		check.Status = HealthStatusFail
+		check.Message = fmt.Sprintf("nodes have not run for more than %s: %s", h.config.MaxRunAge, strings.Join(stale, ", "))
+		check.Details["stale"] = stale
+	}
+	return check
+}
+
+// checkFirewall checks that the managed firewall rules were present at the end of the last batch run.
+// The API has no access to the firewall, so it relies on the count recorded by the batch.
+func (h *HealthHandler) checkFirewall(ctx context.Context, run *db.BatchRun) HealthCheck {
+	if run == nil {
+		return HealthCheck{Status: HealthStatusSkip, Message: "no batch run has finished yet"}
+	}
+	if run.FirewallRules == nil {
+		return HealthCheck{Status: HealthStatusWarn, Message: "last batch run did not record the firewall rules"}
+	}
+
+	blockedIPs, err := h.repo.CountBlockedIPs(ctx)
+	if err != nil {
+		return HealthCheck{Status: HealthStatusFail, Message: err.Error()}
+	}
+	check := HealthCheck{
+		Status:  HealthStatusOK,
+		Details: map[string]any{"rules": *run.FirewallRules, "blocked_ips": blockedIPs},
+	}
+	if *run.FirewallRules == 0 && blockedIPs > 0 {
+		check.Status = HealthStatusFail
+		check.Message = "no managed firewall rules were present although domains have IPs"
+	}
+	return check
+}
+
+// checkDnsmasq checks that the dnsmasq configuration directory can be read
+func (h *HealthHandler) checkDnsmasq() HealthCheck {
+	dir := h.config.DnsmasqConfigDir
+	if dir == "" {
+		return HealthCheck{Status: HealthStatusSkip, Message: "DNSMASQ_CONFIG_DIR is not set"}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return HealthCheck{Status: HealthStatusFail, Message: err.Error()}
+	}
+	var files []string
+	for _, entry := range entries {
+		// Debianのdnsmasqは conf-dir=/etc/dnsmasq.d/,*.conf で.confのみ読み込む
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".conf" {
+			files = append(files, entry.Name())
+		}
+	}
+
+	check := HealthCheck{
+		Status:  HealthStatusOK,
+		Details: map[string]any{"config_dir": dir, "files": len(files)},
+	}
+	if len(files) == 0 {
+		check.Status = HealthStatusWarn
+		check.Message = "no .conf files in " + dir
+	}
+	return check
+}
@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"go.uber.org/zap"
+)
+
+type mockHealthRepo struct {
+	pingErr    error
+	run        *db.BatchRun
+	runAge     time.Duration
+	blockedIPs int
+	nodeAges   map[string]time.Duration
+}
+
+func (m *mockHealthRepo) Ping(_ context.Context) error { return m.pingErr }
+
+func (m *mockHealthRepo) GetLastFinishedBatchRun(_ context.Context) (*db.BatchRun, time.Duration, error) {
+	if m.run == nil {
+		return nil, 0, db.ErrBatchRunNotFound
+	}
+	return m.run, m.runAge, nil
+}
+
+func (m *mockHealthRepo) CountBlockedIPs(_ context.Context) (int, error) { return m.blockedIPs, nil }
+
+func (m *mockHealthRepo) GetActiveNodeAges(_ context.Context) (map[string]time.Duration, error) {
+	return m.nodeAges, nil
+}
+
+func intPtr(i int) *int { return &i }
+
+func TestHealthHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dnsmasqDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dnsmasqDir, "block.conf"), nil, 0o600))
+
+	tests := []struct {
+		name        string
+		repo        *mockHealthRepo
+		dnsmasqDir  string
+		wantStatus  string
+		wantChecks  map[string]string
+		wantHealthz int
+		wantReadyz  int
+	}{
+		{
+			name: "healthy",
+			repo: &mockHealthRepo{
+				run: &db.BatchRun{Status: db.BatchRunStatusSucceeded, FirewallRules: intPtr(3)}, runAge: time.Hour, blockedIPs: 3,
+				nodeAges: map[string]time.Duration{"main": time.Hour, "guest": 90 * time.Minute},
+			},
+			dnsmasqDir: dnsmasqDir,
+			wantStatus: HealthStatusOK,
+			wantChecks: map[string]string{
+				"database": HealthStatusOK, "batch_run": HealthStatusOK, "nodes": HealthStatusOK, "firewall": HealthStatusOK, "dnsmasq": HealthStatusOK,
+			},
+			wantHealthz: http.StatusOK,
+			wantReadyz:  http.StatusOK,
+		},
+		{
+			// 1台のルーターが実行していても、停止した他のルーターは検出する
+			name: "another node stopped running",
+			repo: &mockHealthRepo{
+				run: &db.BatchRun{Status: db.BatchRunStatusSucceeded, FirewallRules: intPtr(3)}, runAge: time.Hour, blockedIPs: 3,
+				nodeAges: map[string]time.Duration{"main": time.Hour, "guest": 5 * time.Hour},
+			},
+			dnsmasqDir: dnsmasqDir,
+			wantStatus: HealthStatusFail,
+			wantChecks: map[string]string{
+				"database": HealthStatusOK, "batch_run": HealthStatusOK, "nodes": HealthStatusFail, "firewall": HealthStatusOK, "dnsmasq": HealthStatusOK,
+			},
+			wantHealthz: http.StatusOK,
+			wantReadyz:  http.StatusServiceUnavailable,
+		},
+		{
+			name:       "partial run and dnsmasq not configured",
+			repo:       &mockHealthRepo{run: &db.BatchRun{Status: db.BatchRunStatusPartial, FirewallRules: intPtr(3)}, blockedIPs: 3},
+			wantStatus: HealthStatusWarn,
+			wantChecks: map[string]string{
+				"database": HealthStatusOK, "batch_run": HealthStatusWarn, "nodes": HealthStatusSkip, "firewall": HealthStatusOK, "dnsmasq": HealthStatusSkip,
+			},
+			wantHealthz: http.StatusOK,
+			wantReadyz:  http.StatusOK,
+		},
+		{
+			name:       "stale run without firewall rules",
+			repo:       &mockHealthRepo{run: &db.BatchRun{Status: db.BatchRunStatusSucceeded, FirewallRules: intPtr(0)}, runAge: 3 * time.Hour, blockedIPs: 3},
+			dnsmasqDir: filepath.Join(dnsmasqDir, "missing"),
+			wantStatus: HealthStatusFail,
+			wantChecks: map[string]string{
+				"database": HealthStatusOK, "batch_run": HealthStatusFail, "nodes": HealthStatusSkip, "firewall": HealthStatusFail, "dnsmasq": HealthStatusFail,
+			},
+			wantHealthz: http.StatusOK,
+			wantReadyz:  http.StatusServiceUnavailable,
+		},
+		{
+			name:       "no finished run",
+			repo:       &mockHealthRepo{},
+			wantStatus: HealthStatusFail,
+			wantChecks: map[string]string{
+				"database": HealthStatusOK, "batch_run": HealthStatusFail, "nodes": HealthStatusSkip, "firewall": HealthStatusSkip, "dnsmasq": HealthStatusSkip,
+			},
+			wantHealthz: http.StatusOK,
+			wantReadyz:  http.StatusServiceUnavailable,
+		},
+		{
+			name:       "database unreachable",
+			repo:       &mockHealthRepo{pingErr: errors.New("connection refused")},
+			wantStatus: HealthStatusFail,
+			wantChecks: map[string]string{
+				"database": HealthStatusFail, "batch_run": HealthStatusSkip, "nodes": HealthStatusSkip, "firewall": HealthStatusSkip, "dnsmasq": HealthStatusSkip,
+			},
+			wantHealthz: http.StatusServiceUnavailable,
+			wantReadyz:  http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHealthHandler(tt.repo, HealthConfig{MaxRunAge: 2 * time.Hour, DnsmasqConfigDir: tt.dnsmasqDir}, zap.NewNop())
+			r := gin.New()
+			r.GET("/healthz", h.Healthz)
+			r.GET("/readyz", h.Readyz)
+
+			for path, wantCode := range map[string]int{"/healthz": tt.wantHealthz, "/readyz": tt.wantReadyz} {
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+				assert.Equal(t, wantCode, w.Code, path)
+
+				var report HealthReport
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+				assert.Equal(t, tt.wantStatus, report.Status, path)
+				checks := make(map[string]string, len(report.Checks))
+				for name, check := range report.Checks {
+					checks[name] = check.Status
+				}
+				assert.Equal(t, tt.wantChecks, checks, path)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tokane888/router-manager-go/pkg/blocklist"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/api/internal/problem"
+	"go.uber.org/zap"
+)
+
+// OverrideRepository defines the database operations required to manage temporary blocks and exemptions
+type OverrideRepository interface {
+	GetActiveDomainOverrides(ctx context.Context) ([]db.DomainOverride, error)
+	SetDomainOverride(ctx context.Context, domainName string, kind db.OverrideKind, duration time.Duration) (*db.DomainOverride, error)
+	EndDomainOverride(ctx context.Context, domainName string) error
+	CreateRunRequest(ctx context.Context) (*db.RunRequest, error)
+}
+
+// OverrideHandler handles time-bounded overrides of domains
+type OverrideHandler struct {
+	repo   OverrideRepository
+	logger *zap.Logger
+}
+
+// setOverrideRequest is the JSON body accepted by the override endpoint. Exactly one of Duration and Until is required.
+type setOverrideRequest struct {
+	Kind     string     `json:"kind" binding:"required"`
+	Duration string     `json:"duration"` // "30m", "2h"などGoのduration形式
+	Until    *time.Time `json:"until"`
+}
+
+// NewOverrideHandler creates a new OverrideHandler
+func NewOverrideHandler(repo OverrideRepository, logger *zap.Logger) *OverrideHandler {
+	return &OverrideHandler{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// List returns the active temporary blocks and exemptions, soonest expiry first.
+//
+//	GET /api/v1/overrides
+func (h *OverrideHandler) List(c *gin.Context) {
+	overrides, err := h.repo.GetActiveDomainOverrides(c.Request.Context())
+	if err != nil {
+		problem.Error(c, h.logger, err, "failed to get domain overrides")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"overrides": overrides})
+}
+
+// Set blocks a domain temporarily (kind block) or lifts its block temporarily (kind exempt) until the
+// given time. A temporary block registers the domain and is deleted with it when it expires; setting the
+// same kind again changes the expiry. The firewall is updated by the batch daemon within OVERRIDE_CHECK_INTERVAL.
+//
+//	PUT /api/v1/domains/:name/override {"kind": "exempt", "duration": "30m"}
+func (h *OverrideHandler) Set(c *gin.Context) {
+	var req setOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Validation(c, err)
+		return
+	}
+	kind, err := db.ParseOverrideKind(req.Kind)
+	if err != nil {
+		problem.Validation(c, err)
+		return
+	}
+	duration, err := overrideDuration(req, time.Now())
+	if err != nil {
+		problem.Validation(c, err)
+		return
+	}
+	name, err := blocklist.NormalizeDomain(c.Param("name"))
+	if err != nil {
+		problem.Validation(c, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	override, err := h.repo.SetDomainOverride(ctx, name, kind, duration)
+	if err != nil {
+		problem.Error(c, h.logger, err, "failed to set domain override", zap.String("domain", name))
+		return
+	}
+	// 一時ブロックのドメインはIPが未解決のため、daemonに即時実行を要求する
+	if kind == db.OverrideKindBlock {
+		if _, err := h.repo.CreateRunRequest(ctx); err != nil {
+			h.logger.Warn("Failed to request batch run for temporary block", zap.String("domain", name), zap.Error(err))
+		}
+	}
+
+	c.JSON(http.StatusOK, override)
+}
+
+// End ends the temporary block or exemption of a domain now.
+// A temporarily blocked domain is deleted; the block of an exempt domain is restored.
+//
+//	DELETE /api/v1/domains/:name/override
+func (h *OverrideHandler) End(c *gin.Context) {
+	name := strings.ToLower(c.Param("name"))
+	if err := h.repo.EndDomainOverride(c.Request.Context(), name); err != nil {
+		problem.Error(c, h.logger, err, "failed to end domain override", zap.String("domain", name))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// overrideDuration returns how long the requested override lasts
+func overrideDuration(req setOverrideRequest, now time.Time) (time.Duration, error) {
+	var duration time.Duration
+	switch {
+	case req.Duration != "" && req.Until != nil:
+		return 0, errors.New("duration and until cannot be used together")
+	case req.Duration != "":
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration: %w", err)
+		}
+		duration = d
+	case req.Until != nil:
+		duration = req.Until.Sub(now).Round(time.Second)
+	default:
+		return 0, errors.New("either duration or until is required")
+	}
+
+	if duration <= 0 || duration > db.MaxOverrideDuration {
+		return 0, fmt.Errorf("override must end in the future and last at most %s", db.MaxOverrideDuration)
+	}
+	return duration, nil
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/api/internal/problem"
+	"go.uber.org/zap"
+)
+
+// maxRunsLimit is the maximum number of batch runs returned at once
+const maxRunsLimit = 100
+
+// RunRepository defines the database operations required to show and request batch runs
+type RunRepository interface {
+	GetRecentBatchRuns(ctx context.Context, limit int) ([]db.BatchRun, error)
+	GetPendingRunRequest(ctx context.Context) (*db.RunRequest, error)
+	CreateRunRequest(ctx context.Context) (*db.RunRequest, error)
+}
+
+// RunHandler handles batch run history and run requests
+type RunHandler struct {
+	repo   RunRepository
+	logger *zap.Logger
+}
+
+// NewRunHandler creates a new RunHandler
+func NewRunHandler(repo RunRepository, logger *zap.Logger) *RunHandler {
+	return &RunHandler{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// List returns the latest batch runs, newest first, and the run request not finished yet if any.
+//
+//	GET /api/v1/runs?limit=20
+func (h *RunHandler) List(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 || limit > maxRunsLimit {
+		problem.Write(c, http.StatusBadRequest, "invalid limit: must be between 1 and 100")
+		return
+	}
+
+	ctx := c.Request.Context()
+	runs, err := h.repo.GetRecentBatchRuns(ctx, limit)
+	if err != nil {
+		problem.Error(c, h.logger, err, "failed to get batch runs")
+		return
+	}
+	pending, err := h.repo.GetPendingRunRequest(ctx)
+	if err != nil {
+		problem.Error(c, h.logger, err, "failed to get pending run request")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"runs": runs, "pending_request": pending})
+}
+
+// Request asks the batch daemon to run now. The API cannot run the batch itself since it has
+// no access to the firewall; the request is picked up by `router-manager-batch daemon`.
+// A request made while another one is waiting returns the waiting one.
+//
+//	POST /api/v1/runs
+func (h *RunHandler) Request(c *gin.Context) {
+	request, err := h.repo.CreateRunRequest(c.Request.Context())
+	if err != nil {
+		problem.Error(c, h.logger, err, "failed to request batch run")
+		return
+	}
+	c.JSON(http.StatusAccepted, request)
+}
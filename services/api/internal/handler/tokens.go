@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/api/internal/auth"
+	"github.com/tokane888/router-manager-go/services/api/internal/problem"
+	"go.uber.org/zap"
+)
+
+// APITokenRepository defines the database operations required to manage API tokens
+type APITokenRepository interface {
+	GetAPITokens(ctx context.Context, userID int64) ([]db.APIToken, error)
+	CreateAPIToken(ctx context.Context, userID int64, name, tokenHash string) (*db.APIToken, error)
+	DeleteAPIToken(ctx context.Context, userID, tokenID int64) error
+}
+
+// APITokenHandler handles the API tokens of the authenticated user.
+// A token has the same role as its user.
+type APITokenHandler struct {
+	repo   APITokenRepository
+	logger *zap.Logger
+}
+
+// createTokenRequest is the JSON body accepted when creating an API token
+type createTokenRequest struct {
+	Name string `json:"name" binding:"required,max=64"`
+}
+
+// NewAPITokenHandler creates a new APITokenHandler
+func NewAPITokenHandler(repo APITokenRepository, logger *zap.Logger) *APITokenHandler {
+	return &APITokenHandler{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// List returns the API tokens of the authenticated user. The tokens themselves are not returned.
+//
+//	GET /api/v1/tokens
+func (h *APITokenHandler) List(c *gin.Context) {
+	tokens, err := h.repo.GetAPITokens(c.Request.Context(), auth.CurrentUser(c).ID)
+	if err != nil {
+		problem.Error(c, h.logger, err, "failed to get API tokens")
+		return
+	}
+	if tokens == nil {
+		tokens = []db.APIToken{}
+	}
+	c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+// Create issues an API token. The token is only included in this response.
+//
+//	POST /api/v1/tokens {"name": "backup script"}
+func (h *APITokenHandler) Create(c *gin.Context) {
+	var req createTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Validation(c, err)
+		return
+	}
+
+	token, hash, err := auth.NewToken(auth.APITokenPrefix)
+	if err != nil {
+		problem.Error(c, h.logger, err, "failed to create API token")
+		return
+	}
+	user := auth.CurrentUser(c)
+	created, err := h.repo.CreateAPIToken(c.Request.Context(), user.ID, req.Name, hash)
+	if err != nil {
+		problem.Error(c, h.logger, err, "failed to create API token", zap.String("username", user.Username))
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"token": token, "api_token": created})
+}
+
+// Delete revokes an API token of the authenticated user.
+//
+//	DELETE /api/v1/tokens/:id
+func (h *APITokenHandler) Delete(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		problem.Write(c, http.StatusBadRequest, "invalid token id")
+		return
+	}
+	if err := h.repo.DeleteAPIToken(c.Request.Context(), auth.CurrentUser(c).ID, id); err != nil {
+		problem.Error(c, h.logger, err, "failed to delete API token", zap.Int64("id", id))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
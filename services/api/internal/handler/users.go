@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/api/internal/auth"
+	"github.com/tokane888/router-manager-go/services/api/internal/problem"
+	"go.uber.org/zap"
+)
+
+// UserRepository defines the database operations required to manage users
+type UserRepository interface {
+	GetUsers(ctx context.Context) ([]db.User, error)
+	CreateUser(ctx context.Context, username, passwordHash string, role db.UserRole) (*db.User, error)
+	DeleteUser(ctx context.Context, username string) error
+}
+
+// UserHandler handles user management by admins
+type UserHandler struct {
+	repo   UserRepository
+	logger *zap.Logger
+}
+
+// createUserRequest is the JSON body accepted when creating a user
+type createUserRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Role     string `json:"role"`
+}
+
+// NewUserHandler creates a new UserHandler
+func NewUserHandler(repo UserRepository, logger *zap.Logger) *UserHandler {
+	return &UserHandler{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// List returns all users.
+//
+//	GET /api/v1/users
+func (h *UserHandler) List(c *gin.Context) {
+	users, err := h.repo.GetUsers(c.Request.Context())
+	if err != nil {
+		problem.Error(c, h.logger, err, "failed to get users")
+		return
+	}
+	if users == nil {
+		users = []db.User{}
+	}
+	c.JSON(http.StatusOK, gin.H{"users": users})
+}
+
+// Create adds a user. The role defaults to viewer.
+//
+//	POST /api/v1/users {"username": "bob", "password": "...", "role": "viewer"}
+func (h *UserHandler) Create(c *gin.Context) {
+	var req createUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Validation(c, err)
+		return
+	}
+	if err := auth.ValidateUsername(req.Username); err != nil {
+		problem.Validation(c, err)
+		return
+	}
+	role := db.UserRoleViewer
+	if req.Role != "" {
+		var err error
+		if role, err = db.ParseUserRole(req.Role); err != nil {
+			problem.Validation(c, err)
+			return
+		}
+	}
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		problem.Validation(c, err)
+		return
+	}
+
+	user, err := h.repo.CreateUser(c.Request.Context(), req.Username, hash, role)
+	if err != nil {
+		problem.Error(c, h.logger, err, "failed to create user", zap.String("username", req.Username))
+		return
+	}
+	c.JSON(http.StatusCreated, user)
+}
+
+// Delete removes a user along with its API tokens and sessions. The last admin cannot be deleted.
+//
+//	DELETE /api/v1/users/:name
+func (h *UserHandler) Delete(c *gin.Context) {
+	name := c.Param("name")
+	if err := h.repo.DeleteUser(c.Request.Context(), name); err != nil {
+		problem.Error(c, h.logger, err, "failed to delete user", zap.String("username", name))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
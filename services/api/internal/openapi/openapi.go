@@ -0,0 +1,21 @@
+// Package openapi embeds the OpenAPI document describing every api service endpoint.
+// The router is checked against it by router_test.go, so routes and the document must be changed together.
+// Validator checks requests against the parameters and request bodies of the document before they reach the handlers.
+package openapi
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed openapi.yaml
+var Spec []byte
+
+// Serve returns the OpenAPI document.
+//
+//	GET /api/v1/openapi.yaml
+func Serve(c *gin.Context) {
+	c.Data(http.StatusOK, "application/yaml", Spec)
+}
@@ -0,0 +1,437 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tokane888/router-manager-go/services/api/internal/problem"
+	"gopkg.in/yaml.v3"
+)
+
+// maxValidatedBodySize is the largest request body checked against the document.
+// Larger bodies (big backups) are left to the handler, which enforces its own size limit.
+const maxValidatedBodySize = 4 << 20
+
+// Schema is the subset of the OpenAPI 3.0 schema object used by openapi.yaml
+type Schema struct {
+	Ref        string             `yaml:"$ref"`
+	Type       string             `yaml:"type"`
+	Format     string             `yaml:"format"`
+	Enum       []any              `yaml:"enum"`
+	Pattern    string             `yaml:"pattern"`
+	MinLength  *int               `yaml:"minLength"`
+	MaxLength  *int               `yaml:"maxLength"`
+	Minimum    *float64           `yaml:"minimum"`
+	Maximum    *float64           `yaml:"maximum"`
+	Required   []string           `yaml:"required"`
+	Properties map[string]*Schema `yaml:"properties"`
+	Items      *Schema            `yaml:"items"`
+	AllOf      []*Schema          `yaml:"allOf"`
+	Nullable   bool               `yaml:"nullable"`
+}
+
+type parameter struct {
+	Ref      string  `yaml:"$ref"`
+	Name     string  `yaml:"name"`
+	In       string  `yaml:"in"`
+	Required bool    `yaml:"required"`
+	Schema   *Schema `yaml:"schema"`
+}
+
+type requestBody struct {
+	Required bool `yaml:"required"`
+	Content  map[string]struct {
+		Schema *Schema `yaml:"schema"`
+	} `yaml:"content"`
+}
+
+type operation struct {
+	Parameters  []parameter  `yaml:"parameters"`
+	RequestBody *requestBody `yaml:"requestBody"`
+}
+
+type document struct {
+	Paths      map[string]map[string]yaml.Node `yaml:"paths"`
+	Components struct {
+		Schemas    map[string]*Schema   `yaml:"schemas"`
+		Parameters map[string]parameter `yaml:"parameters"`
+	} `yaml:"components"`
+}
+
+// Validator checks requests against the parameters and request bodies of the document
+type Validator struct {
+	doc        document
+	operations map[string]operation      // "METHOD /path" (path in OpenAPI form)
+	patterns   map[string]*regexp.Regexp // compiled by NewValidator, read-only afterwards
+}
+
+// NewValidator parses the embedded document
+func NewValidator() (*Validator, error) {
+	v := &Validator{operations: make(map[string]operation), patterns: make(map[string]*regexp.Regexp)}
+	if err := yaml.Unmarshal(Spec, &v.doc); err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI document: %w", err)
+	}
+	for path, item := range v.doc.Paths {
+		for method, node := range item {
+			var op operation
+			if err := node.Decode(&op); err != nil {
+				return nil, fmt.Errorf("failed to parse OpenAPI operation %s %s: %w", method, path, err)
+			}
+			v.operations[strings.ToUpper(method)+" "+path] = op
+		}
+	}
+
+	// リクエストごとに正規表現をコンパイルしないよう、文書内のpatternを先にコンパイルする
+	for _, s := range v.doc.Components.Schemas {
+		if err := v.compilePatterns(s); err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range v.doc.Components.Parameters {
+		if err := v.compilePatterns(p.Schema); err != nil {
+			return nil, err
+		}
+	}
+	for _, op := range v.operations {
+		for _, p := range op.Parameters {
+			if err := v.compilePatterns(p.Schema); err != nil {
+				return nil, err
+			}
+		}
+		if op.RequestBody != nil {
+			for _, media := range op.RequestBody.Content {
+				if err := v.compilePatterns(media.Schema); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return v, nil
+}
+
+// compilePatterns compiles the patterns of a schema and its subschemas
+func (v *Validator) compilePatterns(s *Schema) error {
+	if s == nil {
+		return nil
+	}
+	if s.Pattern != "" {
+		if _, ok := v.patterns[s.Pattern]; !ok {
+			re, err := regexp.Compile(s.Pattern)
+			if err != nil {
+				return fmt.Errorf("invalid pattern %q in OpenAPI document: %w", s.Pattern, err)
+			}
+			v.patterns[s.Pattern] = re
+		}
+	}
+	for _, prop := range s.Properties {
+		if err := v.compilePatterns(prop); err != nil {
+			return err
+		}
+	}
+	for _, sub := range s.AllOf {
+		if err := v.compilePatterns(sub); err != nil {
+			return err
+		}
+	}
+	return v.compilePatterns(s.Items)
+}
+
+var ginParam = regexp.MustCompile(`:(\w+)`)
+
+// Middleware rejects requests whose path or query parameters or JSON/YAML body do not match the document.
+// It must be used after authentication so that unauthenticated requests are reported as such.
+// Text bodies and routes missing from the document are left to the handler.
+func (v *Validator) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		op, ok := v.operations[c.Request.Method+" "+ginParam.ReplaceAllString(c.FullPath(), "{$1}")]
+		if !ok {
+			c.Next()
+			return
+		}
+		if err := v.validateParameters(c, op); err != nil {
+			problem.Validation(c, err)
+			return
+		}
+		if err := v.validateBody(c, op); err != nil {
+			problem.Validation(c, err)
+			return
+		}
+		c.Next()
+	}
+}
+
+// validateParameters checks the path and query parameters documented for the operation
+func (v *Validator) validateParameters(c *gin.Context, op operation) error {
+	for _, p := range op.Parameters {
+		if p.Ref != "" {
+			p = v.doc.Components.Parameters[strings.TrimPrefix(p.Ref, "#/components/parameters/")]
+		}
+		if p.Schema == nil {
+			continue
+		}
+		var raw string
+		switch p.In {
+		case "path":
+			// pathパラメータはルートに一致した時点で存在する
+			raw = c.Param(p.Name)
+		case "query":
+			var ok bool
+			if raw, ok = c.GetQuery(p.Name); !ok {
+				if p.Required {
+					return fmt.Errorf("query parameter %s is required", p.Name)
+				}
+				continue
+			}
+		default:
+			continue
+		}
+		value, err := parameterValue(raw, v.resolve(p.Schema).Type)
+		if err != nil {
+			return fmt.Errorf("%s parameter %s: %w", p.In, p.Name, err)
+		}
+		if err := v.validate(p.Schema, value, p.In+" parameter "+p.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parameterValue converts a path or query string value to the JSON type of its schema
+func parameterValue(raw, typ string) (any, error) {
+	switch typ {
+	case "integer", "number":
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, errors.New("must be a number")
+		}
+		return n, nil
+	case "boolean":
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, errors.New("must be a boolean")
+		}
+		return b, nil
+	default:
+		return raw, nil
+	}
+}
+
+// validateBody checks a JSON or YAML request body against the schema of the operation.
+// The body is put back for the handler.
+func (v *Validator) validateBody(c *gin.Context, op operation) error {
+	if op.RequestBody == nil {
+		return nil
+	}
+	jsonBody, hasJSON := op.RequestBody.Content["application/json"]
+	yamlBody, hasYAML := op.RequestBody.Content["application/yaml"]
+	if !hasJSON && !hasYAML {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxValidatedBodySize+1))
+	if err != nil {
+		return fmt.Errorf("failed to read request body: %w", err)
+	}
+	if len(body) > maxValidatedBodySize {
+		c.Request.Body = readCloser{io.MultiReader(bytes.NewReader(body), c.Request.Body), c.Request.Body}
+		return nil
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if len(bytes.TrimSpace(body)) == 0 {
+		if op.RequestBody.Required {
+			return errors.New("request body is required")
+		}
+		return nil
+	}
+
+	// handlerはContent-Typeではなく本文(restoreはformatパラメータ)で形式を判断するため、ここでも本文から判断する
+	if hasJSON {
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		var value any
+		if err := decoder.Decode(&value); err == nil {
+			return v.validate(jsonBody.Schema, normalize(value), "request body")
+		}
+	}
+	if hasYAML {
+		var value any
+		if err := yaml.Unmarshal(body, &value); err == nil {
+			return v.validate(yamlBody.Schema, normalize(value), "request body")
+		}
+	}
+	// 解析できない本文はhandlerがエラーを返す
+	return nil
+}
+
+// readCloser reads from a reader and closes the original body
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// normalize converts decoded JSON and YAML values to float64 numbers, strings and string-keyed maps
+func normalize(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case time.Time:
+		// YAMLの日時はtime.Timeになるため文字列に戻す
+		return v.Format(time.RFC3339Nano)
+	case map[string]any:
+		for key, item := range v {
+			v[key] = normalize(item)
+		}
+		return v
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = normalize(item)
+		}
+		return m
+	case []any:
+		for i, item := range v {
+			v[i] = normalize(item)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// resolve follows a $ref to a component schema
+func (v *Validator) resolve(s *Schema) *Schema {
+	for s != nil && s.Ref != "" {
+		s = v.doc.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+	}
+	if s == nil {
+		return &Schema{}
+	}
+	return s
+}
+
+// validate checks value against the schema. at names the value in error messages.
+func (v *Validator) validate(schema *Schema, value any, at string) error {
+	s := v.resolve(schema)
+	for _, sub := range s.AllOf {
+		if value == nil && s.Nullable {
+			break
+		}
+		if err := v.validate(sub, value, at); err != nil {
+			return err
+		}
+	}
+	if value == nil {
+		if s.Nullable || s.Type == "" {
+			return nil
+		}
+		return fmt.Errorf("%s must not be null", at)
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s must be an object", at)
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s: %s is required", at, name)
+			}
+		}
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			// 定義されていないプロパティは許可する(additionalPropertiesのデフォルト)
+			if prop, ok := s.Properties[name]; ok {
+				if err := v.validate(prop, obj[name], at+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s must be an array", at)
+		}
+		for i, item := range items {
+			if err := v.validate(s.Items, item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s must be a string", at)
+		}
+		if err := v.validateString(s, str, at); err != nil {
+			return err
+		}
+	case "integer", "number":
+		n, ok := value.(float64)
+		if !ok || (s.Type == "integer" && n != math.Trunc(n)) {
+			return fmt.Errorf("%s must be an %s", at, s.Type)
+		}
+		if s.Minimum != nil && n < *s.Minimum {
+			return fmt.Errorf("%s must be at least %v", at, *s.Minimum)
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			return fmt.Errorf("%s must be at most %v", at, *s.Maximum)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s must be a boolean", at)
+		}
+	}
+
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(e any) bool { return fmt.Sprint(e) == fmt.Sprint(value) }) {
+		allowed := make([]string, 0, len(s.Enum))
+		for _, e := range s.Enum {
+			allowed = append(allowed, fmt.Sprint(e))
+		}
+		return fmt.Errorf("%s must be one of %s", at, strings.Join(allowed, ", "))
+	}
+	return nil
+}
+
+// validateString checks the length, pattern and format of a string
+func (v *Validator) validateString(s *Schema, str, at string) error {
+	length := len([]rune(str))
+	if s.MinLength != nil && length < *s.MinLength {
+		return fmt.Errorf("%s must be at least %d characters", at, *s.MinLength)
+	}
+	if s.MaxLength != nil && length > *s.MaxLength {
+		return fmt.Errorf("%s must be at most %d characters", at, *s.MaxLength)
+	}
+	if s.Pattern != "" {
+		if re := v.patterns[s.Pattern]; re != nil && !re.MatchString(str) {
+			return fmt.Errorf("%s must match %s", at, s.Pattern)
+		}
+	}
+	if s.Format == "date-time" {
+		if _, err := time.Parse(time.RFC3339, str); err != nil {
+			return fmt.Errorf("%s must be an RFC 3339 date-time", at)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package openapi
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newValidatedRouter registers documented routes behind the middleware; the handler echoes the body it receives
+func newValidatedRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	v, err := NewValidator()
+	require.NoError(t, err)
+
+	echo := func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, string(body))
+	}
+	r := gin.New()
+	g := r.Group("/api/v1", v.Middleware())
+	g.POST("/auth/login", echo)
+	g.POST("/users", echo)
+	g.DELETE("/users/:name", echo)
+	g.DELETE("/tokens/:id", echo)
+	g.POST("/domains", echo)
+	g.POST("/domains/import", echo)
+	g.PUT("/domains/:name/override", echo)
+	g.GET("/runs", echo)
+	g.POST("/config/restore", echo)
+	g.GET("/undocumented", echo)
+	return r
+}
+
+func TestValidator_Middleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantDetail string
+	}{
+		{name: "valid login", method: http.MethodPost, target: "/api/v1/auth/login", body: `{"username":"admin","password":"secret"}`, wantStatus: http.StatusOK},
+		{name: "missing required property", method: http.MethodPost, target: "/api/v1/auth/login", body: `{"username":"admin"}`, wantStatus: http.StatusBadRequest, wantDetail: "request body: password is required"},
+		{name: "missing required body", method: http.MethodPost, target: "/api/v1/auth/login", wantStatus: http.StatusBadRequest, wantDetail: "request body is required"},
+		{name: "wrong type", method: http.MethodPost, target: "/api/v1/auth/login", body: `{"username":1,"password":"secret"}`, wantStatus: http.StatusBadRequest, wantDetail: "request body.username must be a string"},
+		{name: "pattern", method: http.MethodPost, target: "/api/v1/users", body: `{"username":"a b","password":"password1"}`, wantStatus: http.StatusBadRequest, wantDetail: "request body.username must match"},
+		{name: "minLength", method: http.MethodPost, target: "/api/v1/users", body: `{"username":"alice","password":"short"}`, wantStatus: http.StatusBadRequest, wantDetail: "request body.password must be at least 8 characters"},
+		{name: "enum through $ref", method: http.MethodPost, target: "/api/v1/domains", body: `{"name":"example.com","action":"allow"}`, wantStatus: http.StatusBadRequest, wantDetail: "request body.action must be one of drop, reject, log"},
+		{name: "valid domain", method: http.MethodPost, target: "/api/v1/domains", body: `{"name":"example.com","action":"reject"}`, wantStatus: http.StatusOK},
+		{name: "date-time", method: http.MethodPut, target: "/api/v1/domains/example.com/override", body: `{"kind":"exempt","until":"tomorrow"}`, wantStatus: http.StatusBadRequest, wantDetail: "request body.until must be an RFC 3339 date-time"},
+		{name: "valid override", method: http.MethodPut, target: "/api/v1/domains/example.com/override", body: `{"kind":"exempt","until":"2026-01-02T15:04:05+09:00"}`, wantStatus: http.StatusOK},
+		{name: "query maximum", method: http.MethodGet, target: "/api/v1/runs?limit=101", wantStatus: http.StatusBadRequest, wantDetail: "query parameter limit must be at most 100"},
+		{name: "query not an integer", method: http.MethodGet, target: "/api/v1/runs?limit=abc", wantStatus: http.StatusBadRequest, wantDetail: "query parameter limit: must be a number"},
+		{name: "valid query", method: http.MethodGet, target: "/api/v1/runs?limit=100", wantStatus: http.StatusOK},
+		{name: "path pattern through $ref", method: http.MethodDelete, target: "/api/v1/users/a%20b", wantStatus: http.StatusBadRequest, wantDetail: "path parameter name must match"},
+		{name: "valid path", method: http.MethodDelete, target: "/api/v1/users/alice", wantStatus: http.StatusOK},
+		{name: "path not an integer", method: http.MethodDelete, target: "/api/v1/tokens/abc", wantStatus: http.StatusBadRequest, wantDetail: "path parameter id: must be a number"},
+		{name: "query enum", method: http.MethodPost, target: "/api/v1/config/restore?mode=overwrite", body: `{"version":1,"domains":[],"feeds":[]}`, wantStatus: http.StatusBadRequest, wantDetail: "query parameter mode must be one of merge, replace"},
+		{name: "array items", method: http.MethodPost, target: "/api/v1/config/restore", body: `{"version":1,"domains":[{"action":"drop"}],"feeds":[]}`, wantStatus: http.StatusBadRequest, wantDetail: "request body.domains[0]: name is required"},
+		{name: "integer", method: http.MethodPost, target: "/api/v1/config/restore", body: `{"version":1.5,"domains":[],"feeds":[]}`, wantStatus: http.StatusBadRequest, wantDetail: "request body.version must be an integer"},
+		{name: "valid yaml", method: http.MethodPost, target: "/api/v1/config/restore?format=yaml", body: "version: 1\nexported_at: 2026-01-02T15:04:05Z\ndomains:\n  - name: example.com\nfeeds: []\n", wantStatus: http.StatusOK},
+		{name: "invalid yaml", method: http.MethodPost, target: "/api/v1/config/restore?format=yaml", body: "version: 1\ndomains:\n  - action: drop\nfeeds: []\n", wantStatus: http.StatusBadRequest, wantDetail: "request body.domains[0]: name is required"},
+		// 解析できない本文とtext/plainの本文はhandlerに任せる
+		{name: "malformed body", method: http.MethodPost, target: "/api/v1/auth/login", body: `{"username":`, wantStatus: http.StatusOK},
+		{name: "text body", method: http.MethodPost, target: "/api/v1/domains/import", body: "example.com\n", wantStatus: http.StatusOK},
+		{name: "undocumented route", method: http.MethodGet, target: "/api/v1/undocumented?limit=abc", wantStatus: http.StatusOK},
+	}
+	r := newValidatedRouter(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+
+			assert.Equal(t, tt.wantStatus, w.Code, w.Body.String())
+			if tt.wantStatus == http.StatusOK {
+				// 検証後もhandlerは同じ本文を読める
+				assert.Equal(t, tt.body, w.Body.String())
+				return
+			}
+			assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+			assert.Contains(t, w.Body.String(), `"type":"urn:router-manager:problem:validation"`)
+			assert.Contains(t, w.Body.String(), tt.wantDetail)
+		})
+	}
+}
+
+func TestValidator_Middleware_largeBody(t *testing.T) {
+	// 上限を超える本文は検証せずにそのままhandlerへ渡す
+	body := `{"version":"not an integer","domains":[],"feeds":[],"padding":"` + strings.Repeat("x", maxValidatedBodySize) + `"}`
+	w := httptest.NewRecorder()
+	newValidatedRouter(t).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/config/restore", strings.NewReader(body)))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, len(body), w.Body.Len())
+}
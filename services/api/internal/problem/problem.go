@@ -0,0 +1,106 @@
+// Package problem writes api errors as RFC 9457 problem details (application/problem+json)
+// and maps pkg/db errors to HTTP statuses so that every endpoint reports them the same way.
+package problem
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"go.uber.org/zap"
+)
+
+// ContentType is the media type of error responses
+const ContentType = "application/problem+json"
+
+// Problem types. Errors without a specific type use "about:blank", whose meaning is the HTTP status.
+const (
+	TypeBlank      = "about:blank"
+	TypeValidation = "urn:router-manager:problem:validation"
+	TypeNotFound   = "urn:router-manager:problem:not-found"
+	TypeConflict   = "urn:router-manager:problem:conflict"
+)
+
+// Problem is the body of every error response
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"` // リクエストのpath
+}
+
+// dbErrors maps pkg/db errors to the status and type of the response
+var dbErrors = []struct {
+	err     error
+	status  int
+	typeURI string
+}{
+	{db.ErrDomainNotFound, http.StatusNotFound, TypeNotFound},
+	{db.ErrDomainIPNotFound, http.StatusNotFound, TypeNotFound},
+	{db.ErrFeedNotFound, http.StatusNotFound, TypeNotFound},
+	{db.ErrBatchRunNotFound, http.StatusNotFound, TypeNotFound},
+	{db.ErrRunRequestNotFound, http.StatusNotFound, TypeNotFound},
+	{db.ErrUserNotFound, http.StatusNotFound, TypeNotFound},
+	{db.ErrAPITokenNotFound, http.StatusNotFound, TypeNotFound},
+	{db.ErrDomainOverrideNotFound, http.StatusNotFound, TypeNotFound},
+	{db.ErrDomainAlreadyExists, http.StatusConflict, TypeConflict},
+	{db.ErrDomainIPAlreadyExists, http.StatusConflict, TypeConflict},
+	{db.ErrFeedAlreadyExists, http.StatusConflict, TypeConflict},
+	{db.ErrUserAlreadyExists, http.StatusConflict, TypeConflict},
+	{db.ErrLastAdmin, http.StatusConflict, TypeConflict},
+	{db.ErrDomainOverrideConflict, http.StatusConflict, TypeConflict},
+	{db.ErrInvalidOverrideDuration, http.StatusBadRequest, TypeValidation},
+	{db.ErrUnsupportedBackupVersion, http.StatusBadRequest, TypeValidation},
+}
+
+// Write aborts the request with a problem of the given status
+func Write(c *gin.Context, status int, detail string) {
+	typeURI := TypeBlank
+	switch status {
+	case http.StatusBadRequest:
+		typeURI = TypeValidation
+	case http.StatusNotFound:
+		typeURI = TypeNotFound
+	case http.StatusConflict:
+		typeURI = TypeConflict
+	}
+	write(c, status, typeURI, detail)
+}
+
+// Validation aborts the request with a 400 problem describing invalid input
+func Validation(c *gin.Context, err error) {
+	write(c, http.StatusBadRequest, TypeValidation, err.Error())
+}
+
+// Error aborts the request with the problem of a pkg/db error.
+// Other errors are logged and reported as 500 with detail, which must not contain internal information.
+func Error(c *gin.Context, logger *zap.Logger, err error, detail string, fields ...zap.Field) {
+	for _, e := range dbErrors {
+		if errors.Is(err, e.err) {
+			write(c, e.status, e.typeURI, e.err.Error())
+			return
+		}
+	}
+	logger.Error(strings.ToUpper(detail[:1])+detail[1:], append(fields, zap.Error(err))...)
+	write(c, http.StatusInternalServerError, TypeBlank, detail)
+}
+
+// NotFound handles requests to undefined routes
+func NotFound(c *gin.Context) {
+	write(c, http.StatusNotFound, TypeNotFound, "no such endpoint")
+}
+
+func write(c *gin.Context, status int, typeURI, detail string) {
+	// Content-Typeを先に設定すると、gin.JSONはapplication/jsonで上書きしない
+	c.Header("Content-Type", ContentType)
+	c.AbortWithStatusJSON(status, Problem{
+		Type:     typeURI,
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: c.Request.URL.Path,
+	})
+}
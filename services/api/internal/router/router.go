@@ -1,5 +1,97 @@
 package router
 
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/api/internal/auth"
+	"github.com/tokane888/router-manager-go/services/api/internal/handler"
+	"github.com/tokane888/router-manager-go/services/api/internal/openapi"
+	"github.com/tokane888/router-manager-go/services/api/internal/problem"
+	"github.com/tokane888/router-manager-go/services/api/internal/web"
+	"go.uber.org/zap"
+)
+
 type RouterConfig struct {
-	Port int
+	Port   int
+	Auth   auth.Config
+	Health handler.HealthConfig
+}
+
+// NewRouter creates a gin engine with all API routes registered.
+// Every API route except login requires authentication; changes require the admin role.
+// Routes must match internal/openapi/openapi.yaml, which router_test.go checks.
+func NewRouter(cfg RouterConfig, database *db.DB, logger *zap.Logger) *gin.Engine {
+	r := gin.Default()
+	r.NoRoute(problem.NotFound)
+	r.GET("/ping", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "pong",
+		})
+	})
+	healthHandler := handler.NewHealthHandler(database, cfg.Health, logger)
+	r.GET("/healthz", healthHandler.Healthz)
+	r.GET("/readyz", healthHandler.Readyz)
+
+	authn := auth.NewAuthenticator(database, cfg.Auth, logger)
+	authHandler := handler.NewAuthHandler(database, authn, logger)
+	userHandler := handler.NewUserHandler(database, logger)
+	tokenHandler := handler.NewAPITokenHandler(database, logger)
+	importHandler := handler.NewDomainImportHandler(database, logger)
+	backupHandler := handler.NewBackupHandler(database, logger)
+	actionHandler := handler.NewDomainActionHandler(database, logger)
+	hitsHandler := handler.NewDomainHitsHandler(database, logger)
+	domainHandler := handler.NewDomainHandler(database, logger)
+	runHandler := handler.NewRunHandler(database, logger)
+	overrideHandler := handler.NewOverrideHandler(database, logger)
+
+	// 管理画面。静的ファイルのみで、データの取得・変更はAPI側で認証する
+	r.StaticFS("/ui", web.FS())
+	r.GET("/", func(c *gin.Context) {
+		c.Redirect(http.StatusFound, "/ui/")
+	})
+
+	// 埋め込みのOpenAPI文書でリクエストを検証する。401/403を先に返すため認証・認可の後に置く
+	validator, err := openapi.NewValidator()
+	if err != nil {
+		logger.Fatal("Failed to load OpenAPI document", zap.Error(err))
+	}
+	validate := validator.Middleware()
+
+	v1 := r.Group("/api/v1")
+	v1.GET("/openapi.yaml", openapi.Serve)
+	v1.POST("/auth/login", validate, authHandler.Login)
+	v1.POST("/auth/logout", authHandler.Logout)
+
+	// viewer以上
+	viewer := v1.Group("", authn.Authenticate(), validate)
+	viewer.GET("/auth/me", authHandler.Me)
+	viewer.PUT("/auth/password", authHandler.ChangePassword)
+	viewer.GET("/tokens", tokenHandler.List)
+	viewer.POST("/tokens", tokenHandler.Create)
+	viewer.DELETE("/tokens/:id", tokenHandler.Delete)
+	viewer.GET("/domains", domainHandler.List)
+	viewer.GET("/domains/hits", hitsHandler.Hits)
+	viewer.GET("/domains/:name", domainHandler.Get)
+	viewer.GET("/overrides", overrideHandler.List)
+	viewer.GET("/runs", runHandler.List)
+	viewer.GET("/config/export", backupHandler.Export)
+
+	// adminのみ
+	admin := v1.Group("", authn.Authenticate(), auth.RequireAdmin(), validate)
+	admin.GET("/users", userHandler.List)
+	admin.POST("/users", userHandler.Create)
+	admin.DELETE("/users/:name", userHandler.Delete)
+	admin.POST("/domains", domainHandler.Create)
+	admin.POST("/domains/import", importHandler.Import)
+	admin.DELETE("/domains/:name", domainHandler.Delete)
+	admin.DELETE("/domains/:name/ips/:ip", domainHandler.DeleteIP)
+	admin.PUT("/domains/:name/action", actionHandler.SetAction)
+	admin.PUT("/domains/:name/override", overrideHandler.Set)
+	admin.DELETE("/domains/:name/override", overrideHandler.End)
+	admin.POST("/runs", runHandler.Request)
+	admin.POST("/config/restore", backupHandler.Restore)
+
+	return r
 }
@@ -0,0 +1,118 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tokane888/router-manager-go/services/api/internal/openapi"
+	"github.com/tokane888/router-manager-go/services/api/internal/problem"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// openAPIOperation is the part of an OpenAPI operation checked against the router
+type openAPIOperation struct {
+	Security *[]map[string][]string `yaml:"security"` // nilの場合はdocument全体のsecurity(認証必須)
+}
+
+// specOperations returns the operations of the OpenAPI document keyed by "METHOD /path"
+func specOperations(t *testing.T) map[string]openAPIOperation {
+	t.Helper()
+	var spec struct {
+		Paths map[string]map[string]openAPIOperation `yaml:"paths"`
+	}
+	require.NoError(t, yaml.Unmarshal(openapi.Spec, &spec))
+
+	methods := []string{"get", "put", "post", "delete", "patch", "head", "options"}
+	operations := make(map[string]openAPIOperation)
+	for path, item := range spec.Paths {
+		for method, op := range item {
+			if slices.Contains(methods, method) {
+				operations[strings.ToUpper(method)+" "+path] = op
+			}
+		}
+	}
+	return operations
+}
+
+var ginParam = regexp.MustCompile(`:(\w+)`)
+
+func newTestRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	// DBに到達するリクエストは送らないためnil
+	return NewRouter(RouterConfig{}, nil, zap.NewNop())
+}
+
+func Test_RoutesMatchOpenAPI(t *testing.T) {
+	var routes []string
+	for _, route := range newTestRouter().Routes() {
+		// 管理画面の静的ファイルはAPIではない
+		if route.Path == "/" || strings.HasPrefix(route.Path, "/ui/") {
+			continue
+		}
+		routes = append(routes, route.Method+" "+ginParam.ReplaceAllString(route.Path, "{$1}"))
+	}
+	var documented []string
+	for op := range specOperations(t) {
+		documented = append(documented, op)
+	}
+	slices.Sort(routes)
+	slices.Sort(documented)
+
+	assert.Equal(t, documented, routes, "routes and internal/openapi/openapi.yaml must list the same operations")
+}
+
+func Test_AuthenticationMatchesOpenAPI(t *testing.T) {
+	r := newTestRouter()
+	for op, spec := range specOperations(t) {
+		method, path, _ := strings.Cut(op, " ")
+		path = regexp.MustCompile(`\{\w+\}`).ReplaceAllString(path, "x")
+		public := spec.Security != nil && len(*spec.Security) == 0
+		if public && (path == "/healthz" || path == "/readyz") {
+			// 認証なしで常にDBに到達するため送らない
+			continue
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+
+		if public {
+			assert.NotEqual(t, http.StatusUnauthorized, w.Code, "%s is documented as public", op)
+			continue
+		}
+		assert.Equal(t, http.StatusUnauthorized, w.Code, "%s must require authentication", op)
+		assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"), op)
+	}
+}
+
+func Test_RequestsAreValidatedAgainstOpenAPI(t *testing.T) {
+	r := newTestRouter()
+
+	// 本文の検証はDBより前に行われる
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", strings.NewReader(`{"username":"admin"}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"type":"urn:router-manager:problem:validation"`)
+
+	// 認証されていないリクエストは本文が不正でも401
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/domains", strings.NewReader(`{"action":"allow"}`)))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func Test_UnknownRouteReturnsProblem(t *testing.T) {
+	w := httptest.NewRecorder()
+	newTestRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/nothing", nil))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), `"type":"urn:router-manager:problem:not-found"`)
+	assert.Contains(t, w.Body.String(), `"instance":"/api/v1/nothing"`)
+}
@@ -0,0 +1,312 @@
+"use strict";
+
+// router-manager admin UI. Talks to /api/v1 only; firewall changes are applied by the next batch run.
+// The session cookie is set by /auth/login; a 401 response shows the login form.
+
+const api = "/api/v1";
+
+const $ = (id) => document.getElementById(id);
+
+async function request(method, path, body) {
+  const options = { method, headers: {} };
+  if (body !== undefined) {
+    options.headers["Content-Type"] = "application/json";
+    options.body = JSON.stringify(body);
+  }
+  const res = await fetch(api + path, options);
+  const data = await res.json().catch(() => ({}));
+  if (res.status === 401 && path !== "/auth/login") {
+    showLogin();
+  }
+  if (!res.ok) {
+    throw new Error(data.detail || data.title || res.statusText);
+  }
+  return data;
+}
+
+function showMessage(text) {
+  const el = $("message");
+  el.textContent = text;
+  el.hidden = !text;
+}
+
+function formatTime(value) {
+  return value ? new Date(value).toLocaleString() : "-";
+}
+
+// overrideText describes an active temporary block or exemption
+function overrideText(override) {
+  if (!override) {
+    return "";
+  }
+  const label = override.kind === "exempt" ? "一時解除中" : "一時ブロック";
+  return `${label} (${formatTime(override.expires_at)} まで)`;
+}
+
+function element(tag, props, ...children) {
+  const el = document.createElement(tag);
+  Object.assign(el, props);
+  el.append(...children);
+  return el;
+}
+
+// ログイン
+
+let currentUser = null;
+
+function showLogin() {
+  currentUser = null;
+  $("nav").hidden = true;
+  for (const view of ["domains-view", "domain-view", "runs-view"]) {
+    $(view).hidden = true;
+  }
+  $("login-view").hidden = false;
+}
+
+function setUser(user) {
+  currentUser = user;
+  $("current-user").textContent = user.username;
+  // viewerには変更操作を表示しない(API側でも拒否される)
+  document.body.classList.toggle("viewer", user.role !== "admin");
+  $("nav").hidden = false;
+  $("login-view").hidden = true;
+}
+
+$("login").addEventListener("submit", async (event) => {
+  event.preventDefault();
+  const fields = event.target.elements;
+  try {
+    setUser(await request("POST", "/auth/login", { username: fields.username.value, password: fields.password.value }));
+    event.target.reset();
+    showMessage("");
+    await route();
+  } catch (err) {
+    showMessage(err.message);
+  }
+});
+
+$("logout").addEventListener("click", async (event) => {
+  event.preventDefault();
+  try {
+    await request("POST", "/auth/logout");
+    showMessage("");
+  } catch (err) {
+    showMessage(err.message);
+  }
+  showLogin();
+});
+
+// ドメイン一覧
+
+let domains = [];
+
+function renderDomains() {
+  const filter = $("domain-filter").value.trim().toLowerCase();
+  const list = $("domain-list");
+  list.replaceChildren();
+  for (const d of domains) {
+    if (filter && !d.name.includes(filter)) {
+      continue;
+    }
+    const link = element("a", { href: "#domain/" + encodeURIComponent(d.name) }, d.name);
+    const meta = element(
+      "span",
+      { className: "meta" },
+      `${d.action} / IP ${d.ip_count} / ${d.manual ? "手動" : "feed"} / 最終解決 ${formatTime(d.last_seen_at)}`,
+    );
+    if (d.override) {
+      meta.append(element("span", { className: "override" }, overrideText(d.override)));
+    }
+    list.append(element("li", {}, link, meta));
+  }
+}
+
+async function loadDomains() {
+  const data = await request("GET", "/domains");
+  domains = data.domains;
+  renderDomains();
+}
+
+$("domain-filter").addEventListener("input", renderDomains);
+
+$("add-domain").addEventListener("submit", async (event) => {
+  event.preventDefault();
+  const form = event.target;
+  const fields = form.elements;
+  try {
+    if (fields.expires.value) {
+      // 期限付きの場合は一時ブロックとして登録する
+      const override = await request("PUT", "/domains/" + encodeURIComponent(fields.name.value) + "/override", {
+        kind: "block",
+        duration: fields.expires.value,
+      });
+      if (fields.action.value !== "drop") {
+        await request("PUT", "/domains/" + encodeURIComponent(override.domain) + "/action", { action: fields.action.value });
+      }
+    } else {
+      await request("POST", "/domains", { name: fields.name.value, action: fields.action.value });
+    }
+    form.reset();
+    showMessage("");
+    await loadDomains();
+  } catch (err) {
+    showMessage(err.message);
+  }
+});
+
+// ドメイン詳細
+
+let currentDomain = "";
+
+function renderHistory(history) {
+  const container = $("domain-history");
+  container.replaceChildren();
+  const max = Math.max(1, ...history.map((h) => h.packets));
+  for (const h of history) {
+    const bar = element("div", { title: `${formatTime(h.bucket)}: ${h.packets} packets` });
+    bar.style.height = `${(h.packets / max) * 100}%`;
+    container.append(bar);
+  }
+  if (history.length === 0) {
+    container.append(element("span", { className: "meta" }, "記録なし"));
+  }
+}
+
+async function loadDomain(name) {
+  const d = await request("GET", "/domains/" + encodeURIComponent(name));
+  currentDomain = d.name;
+  $("domain-name").textContent = d.name;
+  $("domain-action").value = d.action;
+  $("domain-source").textContent = d.manual ? "手動登録" : "blocklist feedから登録 (削除はfeed側で行ってください)";
+  $("delete-domain").disabled = !d.manual;
+  $("domain-action").disabled = currentUser.role !== "admin";
+  $("domain-override").textContent = overrideText(d.override) || "一時ブロック・一時解除なし";
+  $("exempt-controls").hidden = d.override !== null;
+  $("end-override").hidden = d.override === null;
+  renderHistory(d.history);
+  const list = $("domain-ips");
+  list.replaceChildren();
+  for (const ip of d.ips) {
+    list.append(element("li", {}, ip.ip, element("span", { className: "meta" }, "最終解決 " + formatTime(ip.updated_at))));
+  }
+}
+
+$("domain-action").addEventListener("change", async (event) => {
+  try {
+    await request("PUT", "/domains/" + encodeURIComponent(currentDomain) + "/action", { action: event.target.value });
+    showMessage("");
+  } catch (err) {
+    showMessage(err.message);
+  }
+});
+
+$("delete-domain").addEventListener("click", async () => {
+  if (!confirm(currentDomain + " を削除しますか?")) {
+    return;
+  }
+  try {
+    await request("DELETE", "/domains/" + encodeURIComponent(currentDomain));
+    location.hash = "#domains";
+  } catch (err) {
+    showMessage(err.message);
+  }
+});
+
+$("exempt-domain").addEventListener("click", async () => {
+  try {
+    await request("PUT", "/domains/" + encodeURIComponent(currentDomain) + "/override", {
+      kind: "exempt",
+      duration: $("exempt-duration").value,
+    });
+    showMessage("");
+    await loadDomain(currentDomain);
+  } catch (err) {
+    showMessage(err.message);
+  }
+});
+
+$("end-override").addEventListener("click", async () => {
+  try {
+    await request("DELETE", "/domains/" + encodeURIComponent(currentDomain) + "/override");
+    showMessage("");
+    await loadDomain(currentDomain);
+  } catch (err) {
+    showMessage(err.message);
+  }
+});
+
+// 実行履歴
+
+async function loadRuns() {
+  const data = await request("GET", "/runs");
+  const pending = data.pending_request;
+  $("pending-request").textContent = pending
+    ? `実行要求 ${formatTime(pending.requested_at)} (${pending.started_at ? "実行中" : "待機中"})`
+    : "";
+  $("request-run").disabled = pending !== null;
+  const list = $("run-list");
+  list.replaceChildren();
+  for (const run of data.runs) {
+    const status = element("span", { className: "status-" + run.status }, run.status);
+    const meta = element(
+      "span",
+      { className: "meta" },
+      `${formatTime(run.started_at)} / ${run.domains_total - run.domains_failed}/${run.domains_total} 件成功`,
+    );
+    const item = element("li", {}, status, meta);
+    if (run.error) {
+      item.append(element("span", { className: "meta" }, run.error));
+    }
+    list.append(item);
+  }
+}
+
+$("request-run").addEventListener("click", async () => {
+  try {
+    await request("POST", "/runs");
+    showMessage("");
+    await loadRuns();
+  } catch (err) {
+    showMessage(err.message);
+  }
+});
+
+// 画面切り替え
+
+async function route() {
+  if (!currentUser) {
+    return;
+  }
+  const hash = location.hash.slice(1) || "domains";
+  const [view, arg] = hash.split("/");
+  $("domains-view").hidden = view !== "domains";
+  $("domain-view").hidden = view !== "domain";
+  $("runs-view").hidden = view !== "runs";
+  try {
+    if (view === "domain") {
+      await loadDomain(decodeURIComponent(arg));
+    } else if (view === "runs") {
+      await loadRuns();
+    } else {
+      await loadDomains();
+    }
+  } catch (err) {
+    showMessage(err.message);
+  }
+}
+
+async function start() {
+  try {
+    setUser(await request("GET", "/auth/me"));
+  } catch (err) {
+    // 未ログインの場合はrequestがログイン画面を表示済み
+    if ($("login-view").hidden) {
+      showMessage(err.message);
+    }
+    return;
+  }
+  await route();
+}
+
+window.addEventListener("hashchange", route);
+start();
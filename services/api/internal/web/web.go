@@ -0,0 +1,22 @@
+// Package web serves the admin UI. The static files are embedded into the binary
+// so that the api service can be deployed as a single file on the router.
+package web
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var static embed.FS
+
+// FS returns the file system of the admin UI
+func FS() http.FileSystem {
+	sub, err := fs.Sub(static, "static")
+	if err != nil {
+		// "static"はgo:embedで必ず存在する
+		panic(err)
+	}
+	return http.FS(sub)
+}
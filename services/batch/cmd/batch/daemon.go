@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/tokane888/router-manager-go/services/batch/internal/usecase"
+	"go.uber.org/zap"
+)
+
+// daemonTasks holds the long-running tasks of the daemon subcommand
+type daemonTasks struct {
+	runRequests   *usecase.RunRequestUseCase
+	runner        *batchRunner
+	overrides     *usecase.OverrideUseCase
+	domainChanges *usecase.DomainChangeUseCase
+	clientHits    *usecase.ClientHitUseCase // NFLOG_GROUP未設定の場合nil
+	reloader      *configReloader
+}
+
+// runDaemon implements the "daemon" subcommand, which runs until the process is stopped.
+// It executes the batch runs requested through the API, applies temporary blocks and exemptions
+// when they are set, ended or expire, processes domains as soon as they are added or changed in the
+// database and, if NFLOG_GROUP is set, records the LAN clients whose packets hit blocked IPs. SIGHUP reloads the configuration without interrupting these tasks.
+//
+//	router-manager-batch daemon
+func runDaemon(ctx context.Context, tasks daemonTasks, args []string) error {
+	fs := flag.NewFlagSet("daemon", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("usage: daemon")
+	}
+
+	// いずれかのタスクが失敗した場合は他のタスクも停止する
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// SIGHUPの既定動作はプロセス終了のため、タスク開始前に受信を登録する
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	start := func(task func(ctx context.Context) error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := task(ctx); err != nil {
+				errs <- err
+				cancel()
+			}
+		}()
+	}
+
+	// バッチ実行、オーバーライドやドメイン変更の反映、設定の再読み込みが同時にfirewallを変更しないよう直列化する。
+	// runnerは再読み込みで差し替えられるため、firewallMuを保持している間のみ参照する。
+	// 他のプロセス(timerや手動実行)のバッチ実行とも重ならないよう、firewallを変更するタスクは実行ロックも取得する
+	var firewallMu sync.Mutex
+	runner := tasks.runner
+	start(func(ctx context.Context) error {
+		return tasks.runRequests.Serve(ctx, func(ctx context.Context) int64 {
+			firewallMu.Lock()
+			defer firewallMu.Unlock()
+			report, err := runner.runExclusive(ctx)
+			if err != nil {
+				runner.logger.Warn("Skipped requested batch run", zap.Error(err))
+				return 0
+			}
+			return report.RunID
+		})
+	})
+	start(func(ctx context.Context) error {
+		return tasks.overrides.Watch(ctx, func(ctx context.Context) error {
+			firewallMu.Lock()
+			defer firewallMu.Unlock()
+			// ロックを取得できない場合は反映済みとせず、次回のチェックで再試行する
+			return runner.lock.Do(ctx, runner.domainBlocker.ApplyOverrides)
+		})
+	})
+	start(func(ctx context.Context) error {
+		return tasks.domainChanges.Watch(ctx, func(ctx context.Context, added []string) error {
+			firewallMu.Lock()
+			defer firewallMu.Unlock()
+			// ロックを取得できない場合、変更はロックを保持するバッチ実行か次回の実行で反映される
+			return runner.lock.Do(ctx, func(ctx context.Context) error {
+				_, err := runner.domainBlocker.ProcessNewDomains(ctx, added)
+				return err
+			})
+		})
+	})
+	start(func(ctx context.Context) error {
+		return tasks.reloader.Serve(ctx, hup, func(ctx context.Context, next *batchRunner, moveRules bool) {
+			firewallMu.Lock()
+			defer firewallMu.Unlock()
+			prev := runner
+			runner = next
+			if moveRules {
+				// 他のプロセスのバッチ実行と同時にルールを変更しないよう、実行ロックを保持して移動する
+				err := runner.lock.Do(ctx, func(ctx context.Context) error {
+					moveBlockRules(ctx, prev, next, tasks.reloader.logger)
+					return nil
+				})
+				if err != nil {
+					tasks.reloader.logger.Error("Failed to move block rules to the reloaded firewall settings", zap.Error(err))
+				}
+			}
+		})
+	})
+	if tasks.clientHits != nil {
+		start(tasks.clientHits.Run)
+	}
+
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
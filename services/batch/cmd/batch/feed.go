@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tokane888/router-manager-go/pkg/blocklist"
+	"github.com/tokane888/router-manager-go/services/batch/internal/usecase"
+)
+
+const feedUsage = `usage:
+  feed add [-format auto|hosts|domains|adblock] [-interval 24h] <url>
+  feed list
+  feed remove <id>
+  feed refresh [-force]`
+
+// runFeed implements the "feed" subcommand for managing subscribed blocklist feeds
+func runFeed(ctx context.Context, uc *usecase.FeedUseCase, args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(feedUsage)
+	}
+
+	switch args[0] {
+	case "add":
+		fs := flag.NewFlagSet("feed add", flag.ContinueOnError)
+		formatFlag := fs.String("format", string(blocklist.FormatAuto), "blocklist format (auto, hosts, domains, adblock)")
+		interval := fs.Duration("interval", 24*time.Hour, "refresh interval")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			return errors.New(feedUsage)
+		}
+		format, err := blocklist.ParseFormat(*formatFlag)
+		if err != nil {
+			return err
+		}
+		feed, err := uc.AddFeed(ctx, fs.Arg(0), format, *interval)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "added feed %d: %s\n", feed.ID, feed.URL)
+
+	case "list":
+		feeds, err := uc.ListFeeds(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tURL\tFORMAT\tINTERVAL\tLAST FETCHED\tSTATUS\tDOMAINS\tERROR")
+		for _, feed := range feeds {
+			lastFetched := "-"
+			if feed.LastFetchedAt != nil {
+				lastFetched = feed.LastFetchedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+				feed.ID, feed.URL, feed.Format, feed.RefreshInterval(),
+				lastFetched, feed.LastStatus, feed.LastDomainCount, feed.LastError)
+		}
+		return w.Flush()
+
+	case "remove":
+		if len(args) != 2 {
+			return errors.New(feedUsage)
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid feed id %q: %w", args[1], err)
+		}
+		if err := uc.RemoveFeed(ctx, id); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "removed feed %d\n", id)
+
+	case "refresh":
+		fs := flag.NewFlagSet("feed refresh", flag.ContinueOnError)
+		force := fs.Bool("force", false, "refresh all feeds ignoring refresh interval and ETag/Last-Modified")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		return uc.RefreshFeeds(ctx, *force)
+
+	default:
+		return errors.New(feedUsage)
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/tokane888/router-manager-go/pkg/blocklist"
+	"github.com/tokane888/router-manager-go/services/batch/internal/usecase"
+)
+
+// runImport implements the "import" subcommand.
+//
+//	router-manager-batch import [-format auto|hosts|domains|adblock] [-dry-run] <file|->
+func runImport(ctx context.Context, uc *usecase.DomainImportUseCase, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	formatFlag := fs.String("format", string(blocklist.FormatAuto), "blocklist format (auto, hosts, domains, adblock)")
+	dryRun := fs.Bool("dry-run", false, "preview the diff without modifying the database")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: import [-format auto|hosts|domains|adblock] [-dry-run] <file|->")
+	}
+
+	format, err := blocklist.ParseFormat(*formatFlag)
+	if err != nil {
+		return err
+	}
+
+	var src io.Reader = os.Stdin
+	if path := fs.Arg(0); path != "-" {
+		f, err := os.Open(path) //nolint:gosec // G304: path is given by the operator on the command line
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		defer f.Close() //nolint:errcheck // read-only file
+		src = f
+	}
+
+	result, err := uc.Import(ctx, src, format, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	for _, domain := range result.ToAdd {
+		fmt.Fprintf(stdout, "+ %s\n", domain)
+	}
+	if result.DryRun {
+		fmt.Fprintf(stdout, "dry run: %d to add, %d already registered, %d lines skipped\n",
+			len(result.ToAdd), result.Existing, result.Skipped)
+	} else {
+		fmt.Fprintf(stdout, "imported: %d added, %d already registered, %d lines skipped\n",
+			result.Added, result.Existing, result.Skipped)
+	}
+	return nil
+}
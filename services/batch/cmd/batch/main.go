@@ -2,17 +2,18 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"log"
-	"net"
+	"os"
 	"os/signal"
 	"syscall"
 
 	"github.com/tokane888/router-manager-go/pkg/db"
 	pkglogger "github.com/tokane888/router-manager-go/pkg/logger"
 	"github.com/tokane888/router-manager-go/services/batch/internal/config"
-	"github.com/tokane888/router-manager-go/services/batch/internal/infrastructure/dns"
 	"github.com/tokane888/router-manager-go/services/batch/internal/infrastructure/firewall"
-	"github.com/tokane888/router-manager-go/services/batch/internal/infrastructure/system"
+	"github.com/tokane888/router-manager-go/services/batch/internal/infrastructure/snapshot"
 	"github.com/tokane888/router-manager-go/services/batch/internal/usecase"
 	"go.uber.org/zap"
 )
@@ -21,11 +22,25 @@ import (
 var version = "dev"
 
 func main() {
-	cfg, err := config.NewConfig(version)
+	// 共通フラグはサブコマンドより前に指定する。例: router-manager-batch -config batch.yaml -set log.level=debug daemon
+	var opts config.Options
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	opts.RegisterFlags(fs)
+	_ = fs.Parse(os.Args[1:]) // ExitOnError
+	args := fs.Args()
+
+	cfg, err := config.NewConfig(version, opts)
 	if err != nil {
 		log.Fatalf("failed to load config: %v", err)
 	}
-	logger := pkglogger.NewLogger(cfg.Logger)
+	// 有効な設定の表示はDBに接続せずに行う
+	if len(args) > 0 && args[0] == "config" {
+		if err := cfg.WriteEffective(os.Stdout); err != nil {
+			log.Fatalf("failed to write config: %v", err)
+		}
+		return
+	}
+	logger, logLevel := pkglogger.NewLoggerWithLevel(cfg.Logger)
 	//nolint: errcheck
 	defer logger.Sync()
 
@@ -33,6 +48,19 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	// 起動直後のルール復元はDBの起動を待たずに行う
+	if len(args) > 0 && args[0] == "restore-rules" {
+		firewallManager, err := firewall.NewManager(cfg.Firewall, cfg.NFTables, cfg.IPTables, logger)
+		if err != nil {
+			logger.Fatal("Failed to initialize firewall manager", zap.Error(err))
+		}
+		snapshotUseCase := usecase.NewRuleSnapshotUseCase(snapshot.NewFileStore(cfg.RulesSnapshotFile), firewallManager, logger)
+		if err := runRestoreRules(ctx, snapshotUseCase, args[1:], os.Stdout); err != nil {
+			logger.Fatal("Failed to restore firewall rules", zap.Error(err))
+		}
+		return
+	}
+
 	logger.Info("Domain IP Blocker batch service starting")
 
 	// Initialize database connection
@@ -43,36 +71,109 @@ func main() {
 	}
 	defer database.Close()
 
-	// Initialize DNS resolver
-	dnsResolver := dns.NewDNSResolver(cfg.DNS, net.DefaultResolver, logger)
-
-	// Initialize nftables manager
-	nftablesManager := firewall.NewNFTablesManager(cfg.NFTables, logger)
-
-	// Initialize reboot detector
-	rebootDetector := system.NewRebootDetector(logger)
+	// migrateサブコマンド以外は起動時に未適用のmigrationを適用し、スキーマをバイナリに合わせる。
+	// DBを変更しないサブコマンドはmigrationを適用せず、未適用のmigrationがある場合は終了する
+	switch {
+	case len(args) > 0 && args[0] == "migrate":
+	case len(args) > 0 && readOnlyCommands[args[0]]:
+		if err := checkMigrations(ctx, database); err != nil {
+			logger.Fatal("Database schema is not up to date", zap.Error(err))
+		}
+	case cfg.MigrateOnStart:
+		if _, err := database.Migrate(ctx); err != nil {
+			logger.Fatal("Failed to migrate database", zap.Error(err))
+		}
+	}
 
-	// Initialize use case
-	domainBlockerUseCase := usecase.NewDomainBlockerUseCase(
-		database,
-		dnsResolver,
-		nftablesManager,
-		rebootDetector,
-		logger,
-		cfg.Processing,
-	)
+	// Initialize DNS resolver, firewall manager and use cases
+	runner, err := newBatchRunner(cfg, database, logger)
+	if err != nil {
+		logger.Fatal("Failed to initialize batch runner", zap.Error(err))
+	}
 
-	logger.Info("Starting domain processing")
+	// Dispatch subcommands. Without a subcommand the batch processes all domains.
+	if len(args) > 0 {
+		switch command := args[0]; command {
+		case "import":
+			importUseCase := usecase.NewDomainImportUseCase(database, logger)
+			if err := runImport(ctx, importUseCase, args[1:], os.Stdout); err != nil {
+				logger.Fatal("Failed to import domains", zap.Error(err))
+			}
+		case "feed":
+			if err := runFeed(ctx, runner.feeds, args[1:], os.Stdout); err != nil {
+				logger.Fatal("Failed to execute feed command", zap.Error(err))
+			}
+		case "export":
+			if err := runExport(ctx, runner.backup, args[1:], os.Stdout); err != nil {
+				logger.Fatal("Failed to export configuration", zap.Error(err))
+			}
+		case "restore":
+			if err := runRestore(ctx, runner.backup, args[1:], os.Stdin, os.Stdout); err != nil {
+				logger.Fatal("Failed to restore configuration", zap.Error(err))
+			}
+		case "daemon":
+			tasks := daemonTasks{
+				runRequests:   usecase.NewRunRequestUseCase(database, logger, cfg.RunRequestPollInterval),
+				runner:        runner,
+				overrides:     usecase.NewOverrideUseCase(database, logger, cfg.OverrideCheckInterval),
+				domainChanges: usecase.NewDomainChangeUseCase(database, logger),
+				reloader: &configReloader{
+					cfg:  cfg,
+					load: func() (*config.Config, error) { return config.NewConfig(version, opts) },
+					newRunner: func(cfg *config.Config) (*batchRunner, error) {
+						return newBatchRunner(cfg, database, logger)
+					},
+					level:  logLevel,
+					logger: logger,
+				},
+			}
+			if cfg.NFLogGroup > 0 {
+				listener := firewall.NewNFLogListener(cfg.NFLogGroup, logger)
+				tasks.clientHits = usecase.NewClientHitUseCase(database, listener, logger, cfg.ClientHits)
+			}
+			if err := runDaemon(ctx, tasks, args[1:]); err != nil {
+				logger.Fatal("Daemon stopped", zap.Error(err))
+			}
+			logger.Info("Daemon stopped")
+		case "migrate":
+			if err := runMigrate(ctx, database, args[1:], os.Stdout); err != nil {
+				logger.Fatal("Failed to migrate database", zap.Error(err))
+			}
+		case "plan":
+			if err := runPlan(ctx, runner.domainBlocker, runner.firewall, args[1:], os.Stdout); err != nil {
+				logger.Fatal("Failed to plan domain processing", zap.Error(err))
+			}
+		default:
+			logger.Fatal("Unknown subcommand", zap.String("command", command))
+		}
+		return
+	}
 
-	// Execute domain processing
-	if err := domainBlockerUseCase.ProcessAllDomains(ctx); err != nil {
-		logger.Error("Failed to process domains", zap.Error(err))
+	report, err := runner.runExclusive(ctx)
+	if errors.Is(err, db.ErrRunLockHeld) {
+		logger.Warn("Skipped batch run because another run is in progress", zap.Error(err))
+		stop()
+		database.Close()
+		_ = logger.Sync()
+		os.Exit(exitSkipped)
+	}
+	if err != nil {
+		logger.Fatal("Failed to take run lock", zap.Error(err))
 	}
 
 	select {
 	case <-ctx.Done():
 		logger.Info("Service cancelled")
 	default:
-		logger.Info("Domain IP Blocker batch service completed")
+		logger.Info("Domain IP Blocker batch service completed", zap.String("status", report.Status))
+	}
+
+	// 失敗した実行をsystemdが検知できるよう終了コードに反映する
+	if code := report.exitCode(); code != exitSucceeded {
+		// os.Exitはdeferを実行しないため、先に後処理を行う
+		stop()
+		database.Close()
+		_ = logger.Sync()
+		os.Exit(code)
 	}
 }
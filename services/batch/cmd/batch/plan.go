@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
+	"github.com/tokane888/router-manager-go/services/batch/internal/usecase"
+)
+
+// planSymbols are the diff markers of each plan action in text output
+var planSymbols = map[usecase.PlanAction]string{
+	usecase.PlanActionReapply:     "^",
+	usecase.PlanActionApplyOp:     "&",
+	usecase.PlanActionEndOverride: "<",
+	usecase.PlanActionAdd:         "+",
+	usecase.PlanActionRefresh:     "~",
+	usecase.PlanActionExpire:      "-",
+	usecase.PlanActionRestore:     "!",
+	usecase.PlanActionRemove:      "x",
+	usecase.PlanActionUpdate:      "*",
+}
+
+// runPlan implements the "plan" subcommand which prints the changes a batch run would make
+// without modifying the database or the firewall.
+//
+//	router-manager-batch plan [-o text|json|script]
+func runPlan(ctx context.Context, uc *usecase.DomainBlockerUseCase, scripter repository.FirewallScripter, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("plan", flag.ContinueOnError)
+	output := fs.String("o", "text", "output format (text, json, script)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("usage: plan [-o text|json|script]")
+	}
+	if *output != "text" && *output != "json" && *output != "script" {
+		return fmt.Errorf("unknown output format: %q (must be text, json or script)", *output)
+	}
+
+	plan, err := uc.Plan(ctx)
+	if err != nil {
+		return err
+	}
+
+	switch *output {
+	case "json":
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(plan)
+	case "script":
+		return writePlanScript(ctx, stdout, plan, scripter)
+	default:
+		return writePlanText(stdout, plan)
+	}
+}
+
+// writePlanText writes the plan as a human readable diff
+func writePlanText(w io.Writer, plan *usecase.Plan) error {
+	if plan.Reboot {
+		fmt.Fprintln(w, "First run after reboot: existing rules will be re-applied")
+	}
+	if plan.Resolver != "" {
+		fmt.Fprintf(w, "Domains are resolved by node %s: only the IPs it recorded will be applied\n", plan.Resolver)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, c := range plan.Changes {
+		fmt.Fprintf(tw, "%s %s\t%s\t%s\t%s\n", planSymbols[c.Action], c.Action, c.Domain, c.IP, c.BlockAction)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, f := range plan.Failures {
+		fmt.Fprintf(w, "resolution failed for %s: %s\n", f.Domain, f.Error)
+	}
+	if plan.ReconcileError != "" {
+		fmt.Fprintf(w, "firewall rules could not be listed, reconciliation is not included: %s\n", plan.ReconcileError)
+	}
+
+	fmt.Fprintf(w, "\nPlan: %d to re-apply, %d queued operations, %d overrides to end, %d to add, %d to refresh, %d to expire, %d to restore, %d to update, %d to remove, %d failed\n",
+		plan.Count(usecase.PlanActionReapply), plan.Count(usecase.PlanActionApplyOp), plan.Count(usecase.PlanActionEndOverride), plan.Count(usecase.PlanActionAdd),
+		plan.Count(usecase.PlanActionRefresh), plan.Count(usecase.PlanActionExpire),
+		plan.Count(usecase.PlanActionRestore), plan.Count(usecase.PlanActionUpdate),
+		plan.Count(usecase.PlanActionRemove), len(plan.Failures))
+	return nil
+}
+
+// writePlanScript writes the firewall commands the plan would execute.
+// Refreshes and ended overrides only touch the database and are not included;
+// the rules of the domains deleted with an override are removed by the reconciliation.
+func writePlanScript(ctx context.Context, w io.Writer, plan *usecase.Plan, scripter repository.FirewallScripter) error {
+	for _, c := range plan.Changes {
+		var commands []string
+		switch c.Action {
+		case usecase.PlanActionReapply, usecase.PlanActionAdd, usecase.PlanActionRestore:
+			commands = scripter.AddBlockRuleCommands(c.IP, c.BlockAction)
+		case usecase.PlanActionExpire, usecase.PlanActionRemove, usecase.PlanActionUpdate, usecase.PlanActionApplyOp:
+			var err error
+			commands, err = scripter.RemoveBlockRuleCommands(ctx, c.IP)
+			if err != nil {
+				return fmt.Errorf("failed to render removal of %s: %w", c.IP, err)
+			}
+			if c.Action == usecase.PlanActionUpdate || (c.Action == usecase.PlanActionApplyOp && c.BlockAction != "") {
+				commands = append(commands, scripter.AddBlockRuleCommands(c.IP, c.BlockAction)...)
+			}
+		default:
+			continue
+		}
+		for _, command := range commands {
+			if _, err := fmt.Fprintf(w, "%s # %s %s\n", command, c.Action, c.Domain); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/tokane888/router-manager-go/services/batch/internal/config"
+	"github.com/tokane888/router-manager-go/services/batch/internal/infrastructure/firewall"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// restartSettings are the settings that a reload does not apply, by config file key or section prefix.
+// The database connection, the NFLOG listener and the daemon schedule keep their settings until a restart.
+// The firewall policy is kept as well since the rules of one policy mean the opposite in the other.
+var restartSettings = []string{"env", "app_name", "log.format", "firewall.policy", "database.", "nflog.", "daemon."}
+
+// configReloader re-reads the configuration when the daemon receives SIGHUP
+type configReloader struct {
+	cfg       *config.Config // 現在適用中の設定
+	load      func() (*config.Config, error)
+	newRunner func(cfg *config.Config) (*batchRunner, error)
+	level     zap.AtomicLevel
+	logger    *zap.Logger
+}
+
+// Serve reloads the configuration each time a signal arrives on hup until ctx is cancelled.
+// A configuration that fails validation is rejected and the current one stays in use.
+// swap replaces the runner used by the daemon; moveRules reports that the block rules belong somewhere else now.
+func (r *configReloader) Serve(ctx context.Context, hup <-chan os.Signal, swap func(ctx context.Context, next *batchRunner, moveRules bool)) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-hup:
+			r.reload(ctx, swap)
+		}
+	}
+}
+
+// reload loads the configuration and, if it is valid and changed, swaps in a runner built from it
+func (r *configReloader) reload(ctx context.Context, swap func(ctx context.Context, next *batchRunner, moveRules bool)) {
+	r.logger.Info("Reloading configuration")
+	cfg, err := r.load()
+	if err != nil {
+		r.logger.Error("Rejected configuration reload, keeping the current configuration", zap.Error(err))
+		return
+	}
+
+	changed := r.cfg.ChangedKeys(cfg)
+	if len(changed) == 0 {
+		r.logger.Info("Configuration unchanged")
+		return
+	}
+
+	// NFLOGの受信groupは再起動まで変わらないため、ルールが送るgroupも維持する
+	cfg.NFTables.LogGroup = r.cfg.NFTables.LogGroup
+	cfg.IPTables.LogGroup = r.cfg.IPTables.LogGroup
+	cfg.NFTables.Policy = r.cfg.NFTables.Policy
+
+	next, err := r.newRunner(cfg)
+	if err != nil {
+		r.logger.Error("Rejected configuration reload, keeping the current configuration", zap.Error(err))
+		return
+	}
+	swap(ctx, next, firewallLocation(r.cfg) != firewallLocation(cfg))
+
+	if level, err := zapcore.ParseLevel(cfg.Logger.Level); err == nil {
+		r.level.SetLevel(level)
+	}
+	if restart := restartRequired(changed); len(restart) > 0 {
+		r.logger.Warn("Some changed settings take effect after a restart", zap.Strings("settings", restart))
+	}
+	r.cfg = cfg
+	r.logger.Info("Configuration reloaded", zap.Strings("changed", changed))
+}
+
+// restartRequired returns the keys that a reload does not apply
+func restartRequired(keys []string) []string {
+	var restart []string
+	for _, key := range keys {
+		for _, setting := range restartSettings {
+			if key == setting || (strings.HasSuffix(setting, ".") && strings.HasPrefix(key, setting)) {
+				restart = append(restart, key)
+				break
+			}
+		}
+	}
+	return restart
+}
+
+// firewallLocation identifies where the selected firewall backend keeps the block rules
+func firewallLocation(cfg *config.Config) string {
+	if cfg.Firewall == firewall.BackendIPTables {
+		return strings.Join([]string{cfg.Firewall, cfg.IPTables.Command, cfg.IPTables.Chain, cfg.IPTables.SetName}, " ")
+	}
+	if cfg.NFTables.Policy == firewall.PolicyAllowlist {
+		return strings.Join([]string{cfg.Firewall, cfg.NFTables.Family, cfg.NFTables.Table, cfg.NFTables.Chain, cfg.NFTables.AllowSet}, " ")
+	}
+	return strings.Join([]string{cfg.Firewall, cfg.NFTables.Family, cfg.NFTables.Table, cfg.NFTables.Chain}, " ")
+}
+
+// moveBlockRules creates the block rules with the next runner's firewall, then removes them from the previous one.
+// Creating first keeps the IPs blocked throughout.
+func moveBlockRules(ctx context.Context, prev, next *batchRunner, logger *zap.Logger) {
+	if err := next.domainBlocker.ApplyOverrides(ctx); err != nil {
+		// 新しい場所にルールを作成できない場合、古いルールは残しておく
+		logger.Error("Failed to create block rules with the reloaded firewall settings", zap.Error(err))
+		return
+	}
+
+	rules, err := prev.firewall.ListBlockRules(ctx)
+	if err != nil {
+		logger.Error("Failed to list block rules of the previous firewall settings", zap.Error(err))
+		return
+	}
+	for _, rule := range rules {
+		if err := prev.firewall.RemoveBlockRule(ctx, rule.IP); err != nil {
+			logger.Error("Failed to remove block rule of the previous firewall settings",
+				zap.String("ip", rule.IP), zap.Error(err))
+		}
+	}
+	logger.Info("Moved block rules to the reloaded firewall settings", zap.Int("rules", len(rules)))
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/batch/internal/config"
+	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
+	"github.com/tokane888/router-manager-go/services/batch/internal/infrastructure/backup"
+	"github.com/tokane888/router-manager-go/services/batch/internal/infrastructure/dns"
+	"github.com/tokane888/router-manager-go/services/batch/internal/infrastructure/feed"
+	"github.com/tokane888/router-manager-go/services/batch/internal/infrastructure/firewall"
+	"github.com/tokane888/router-manager-go/services/batch/internal/infrastructure/runlock"
+	"github.com/tokane888/router-manager-go/services/batch/internal/infrastructure/snapshot"
+	"github.com/tokane888/router-manager-go/services/batch/internal/infrastructure/status"
+	"github.com/tokane888/router-manager-go/services/batch/internal/infrastructure/system"
+	"github.com/tokane888/router-manager-go/services/batch/internal/usecase"
+	"go.uber.org/zap"
+)
+
+// batchRunner executes one batch run: the default command, and runs requested through the API in daemon mode
+type batchRunner struct {
+	database      *db.DB
+	hits          *usecase.BlockHitUseCase
+	feeds         *usecase.FeedUseCase
+	domainBlocker *usecase.DomainBlockerUseCase
+	backup        *usecase.BackupUseCase
+	snapshot      *usecase.RuleSnapshotUseCase
+	lock          *usecase.RunLockUseCase
+	firewall      firewall.Manager
+	status        *status.FileWriter
+	logger        *zap.Logger
+}
+
+// newBatchRunner builds the batch run and its dependencies from the configuration.
+// The daemon builds a new one on SIGHUP to swap in the reloaded DNS, firewall and processing settings.
+func newBatchRunner(cfg *config.Config, database *db.DB, logger *zap.Logger) (*batchRunner, error) {
+	firewallManager, err := firewall.NewManager(cfg.Firewall, cfg.NFTables, cfg.IPTables, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize firewall manager: %w", err)
+	}
+
+	domainBlocker := usecase.NewDomainBlockerUseCase(
+		database,
+		dns.NewDNSResolver(cfg.DNS, dns.NewNetResolver(cfg.DNS.Servers), logger),
+		firewallManager,
+		system.NewRebootDetector(logger),
+		logger,
+		cfg.Processing,
+	)
+
+	// DBに接続できない場合、ロックファイルは同じホストの実行のみ直列化する
+	var lockFallback repository.RunLocker
+	if lockFile := runlock.NewFileLock(cfg.RunLockFile); lockFile.Enabled() {
+		lockFallback = lockFile
+	}
+	return &batchRunner{
+		database:      database,
+		hits:          usecase.NewBlockHitUseCase(database, firewallManager, logger, cfg.HitRetention, cfg.NFTables.Policy != firewall.PolicyAllowlist),
+		feeds:         usecase.NewFeedUseCase(database, feed.NewFetcher(cfg.Feed, logger), firewallManager, logger),
+		domainBlocker: domainBlocker,
+		backup:        usecase.NewBackupUseCase(database, backup.NewFileStore(cfg.Backup, logger), firewallManager, logger),
+		snapshot:      usecase.NewRuleSnapshotUseCase(snapshot.NewFileStore(cfg.RulesSnapshotFile), firewallManager, logger),
+		lock:          usecase.NewRunLockUseCase(database, lockFallback, fmt.Sprintf("%s pid=%d", cfg.Node, os.Getpid()), logger, cfg.RunLock),
+		firewall:      firewallManager,
+		status:        status.NewFileWriter(cfg.StatusFile),
+		logger:        logger,
+	}, nil
+}
+
+// runExclusive runs the batch while holding the run lock, so that it does not overlap with runs of other processes.
+// Returns an error wrapping db.ErrRunLockHeld, without running, if another run holds the lock.
+func (r *batchRunner) runExclusive(ctx context.Context) (*runStatus, error) {
+	var report *runStatus
+	err := r.lock.Do(ctx, func(ctx context.Context) error {
+		report = r.run(ctx)
+		return nil
+	})
+	return report, err
+}
+
+// run processes all domains once and returns its outcome, which is also written to the status file if configured
+func (r *batchRunner) run(ctx context.Context) *runStatus {
+	report := newRunStatus(time.Now())
+
+	// Record block hits before any rule is removed or recreated, since their counters are lost with them
+	if err := report.step("hits", func() error { return r.hits.RecordHits(ctx) }); err != nil {
+		r.logger.Error("Failed to record block hits", zap.Error(err))
+	}
+
+	// Refresh subscribed blocklist feeds first so that newly listed domains are processed in this run
+	if err := report.step("feeds", func() error { return r.feeds.RefreshFeeds(ctx, false) }); err != nil {
+		r.logger.Error("Failed to refresh blocklist feeds", zap.Error(err))
+	}
+
+	// Record the run so that its outcome can be inspected later (routerctl runs)
+	runID, err := r.database.StartBatchRun(ctx)
+	if err != nil {
+		r.logger.Error("Failed to record batch run start", zap.Error(err))
+		report.addError("record", err)
+	}
+
+	r.logger.Info("Starting domain processing")
+
+	// Execute domain processing
+	var result *usecase.ProcessResult
+	processErr := report.step("domains", func() error {
+		var err error
+		result, err = r.domainBlocker.ProcessAllDomains(ctx)
+		return err
+	})
+	if processErr != nil {
+		r.logger.Error("Failed to process domains", zap.Error(processErr))
+	}
+
+	runResult := batchRunResult(result, processErr)
+	// Record how many managed rules are present so that the API health check can tell whether they were lost
+	if rules, err := r.firewall.ListBlockRules(ctx); err != nil {
+		r.logger.Error("Failed to count firewall rules", zap.Error(err))
+		report.addError("firewall", err)
+	} else {
+		count := len(rules)
+		runResult.FirewallRules = &count
+		// 複数のrouterでDBを共有する場合に、nodeごとのfirewallの状態を確認できるよう記録する
+		if runResult.Status != db.BatchRunStatusFailed {
+			if err := r.database.RecordNodeApplied(ctx, count); err != nil {
+				r.logger.Error("Failed to record node firewall state", zap.Error(err))
+				report.addError("node", err)
+			}
+		}
+		// 失敗・中断した実行のルールは不完全な可能性があるため、前回のスナップショットを残す
+		if runResult.Status != db.BatchRunStatusFailed && ctx.Err() == nil {
+			if err := report.step("snapshot", func() error { return r.snapshot.Save(rules, time.Now()) }); err != nil {
+				r.logger.Error("Failed to save rule snapshot", zap.Error(err))
+			}
+		}
+	}
+	if runID != 0 {
+		// キャンセルされた場合も実行結果を記録する
+		if err := r.database.FinishBatchRun(context.WithoutCancel(ctx), runID, runResult); err != nil {
+			r.logger.Error("Failed to record batch run result", zap.Error(err))
+			report.addError("record", err)
+		}
+	}
+
+	// Write today's configuration backup if automatic backup is enabled
+	if err := report.step("backup", func() error { return r.backup.RunDailyBackup(ctx, time.Now()) }); err != nil {
+		r.logger.Error("Failed to write configuration backup", zap.Error(err))
+	}
+
+	report.finish(time.Now(), runID, runResult, result, ctx.Err() != nil)
+	if r.status.Enabled() {
+		if err := r.status.Write(report); err != nil {
+			r.logger.Error("Failed to write run status file", zap.String("file", r.status.Path()), zap.Error(err))
+		}
+	}
+	return report
+}
+
+// batchRunResult converts the outcome of ProcessAllDomains into a batch run record
+func batchRunResult(result *usecase.ProcessResult, err error) db.BatchRunResult {
+	if err != nil {
+		return db.BatchRunResult{Status: db.BatchRunStatusFailed, Error: err.Error()}
+	}
+
+	runResult := db.BatchRunResult{
+		Status:        db.BatchRunStatusSucceeded,
+		DomainsTotal:  result.Domains,
+		DomainsFailed: result.Failed,
+	}
+	switch {
+	case result.Failed > 0 && result.Failed == result.Domains-result.Exempt:
+		runResult.Status = db.BatchRunStatusFailed
+		runResult.Error = "failed to process every domain"
+	case result.Failed > 0:
+		runResult.Status = db.BatchRunStatusPartial
+	}
+	return runResult
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/tokane888/router-manager-go/services/batch/internal/usecase"
+)
+
+// runRestoreRules implements the "restore-rules" subcommand, which loads the rule snapshot saved by the last
+// batch run into the firewall. It runs early at boot without connecting to the database.
+//
+//	router-manager-batch restore-rules
+func runRestoreRules(ctx context.Context, snapshot *usecase.RuleSnapshotUseCase, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("restore-rules", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("usage: restore-rules")
+	}
+
+	restored, err := snapshot.Restore(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "restored %d rules\n", restored)
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/batch/internal/usecase"
+)
+
+// Exit codes of a batch run, so that systemd marks failed runs
+const (
+	exitSucceeded = 0
+	exitFailed    = 1 // ドメインを処理できなかった(logger.Fatalと同じ)
+	exitPartial   = 2 // 一部のドメインまたは処理が失敗した
+	exitSkipped   = 3 // 他の実行がロックを保持していたため実行しなかった
+)
+
+// runStatus is the outcome of a batch run, written to STATUS_FILE
+type runStatus struct {
+	Version    string    `json:"version"`
+	RunID      int64     `json:"run_id"` // batch_runsに記録できなかった場合0
+	Status     string    `json:"status"` // db.BatchRunStatus*
+	Cancelled  bool      `json:"cancelled"`
+	Resolver   string    `json:"resolver"` // ドメインの名前解決を担当したnode
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// DurationSeconds is the duration of the whole run, StepSeconds of each step
+	DurationSeconds float64                 `json:"duration_seconds"`
+	StepSeconds     map[string]float64      `json:"step_seconds"`
+	Counts          runCounts               `json:"counts"`
+	Domains         []usecase.DomainOutcome `json:"domains"`
+	Errors          []string                `json:"errors"`
+}
+
+// runCounts summarizes the domains of a batch run
+type runCounts struct {
+	Domains       int  `json:"domains"`
+	Processed     int  `json:"processed"`
+	Failed        int  `json:"failed"`
+	Exempt        int  `json:"exempt"`
+	FirewallRules *int `json:"firewall_rules"` // 数えられなかった場合nil
+}
+
+func newRunStatus(startedAt time.Time) *runStatus {
+	return &runStatus{
+		Version:     version,
+		StartedAt:   startedAt,
+		StepSeconds: make(map[string]float64),
+		Domains:     []usecase.DomainOutcome{},
+		Errors:      []string{},
+	}
+}
+
+// step runs fn, recording its duration and error under name, and returns the error
+func (s *runStatus) step(name string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	s.StepSeconds[name] = time.Since(start).Seconds()
+	if err != nil {
+		s.addError(name, err)
+	}
+	return err
+}
+
+// addError records an error of the named step
+func (s *runStatus) addError(name string, err error) {
+	s.Errors = append(s.Errors, fmt.Sprintf("%s: %v", name, err))
+}
+
+// finish completes the status with the outcome of the domain processing.
+// A run whose domains were processed but some other step failed is partial.
+func (s *runStatus) finish(finishedAt time.Time, runID int64, runResult db.BatchRunResult, result *usecase.ProcessResult, cancelled bool) {
+	s.RunID = runID
+	s.Cancelled = cancelled
+	s.FinishedAt = finishedAt
+	s.DurationSeconds = finishedAt.Sub(s.StartedAt).Seconds()
+	s.Counts.FirewallRules = runResult.FirewallRules
+
+	s.Status = runResult.Status
+	if s.Status == db.BatchRunStatusSucceeded && len(s.Errors) > 0 {
+		s.Status = db.BatchRunStatusPartial
+	}
+	if result == nil {
+		return
+	}
+	s.Resolver = result.Resolver
+	s.Counts.Domains = result.Domains
+	s.Counts.Failed = result.Failed
+	s.Counts.Exempt = result.Exempt
+	s.Counts.Processed = result.Domains - result.Failed - result.Exempt
+	if result.Outcomes != nil {
+		s.Domains = result.Outcomes
+	}
+}
+
+// exitCode returns the process exit code of the run
+func (s *runStatus) exitCode() int {
+	switch s.Status {
+	case db.BatchRunStatusFailed:
+		return exitFailed
+	case db.BatchRunStatusPartial:
+		return exitPartial
+	default:
+		return exitSucceeded
+	}
+}
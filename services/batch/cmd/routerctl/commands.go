@@ -0,0 +1,529 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/batch/internal/usecase"
+)
+
+// app holds the dependencies shared by routerctl commands
+type app struct {
+	domains    *usecase.DomainUseCase
+	hits       *usecase.BlockHitUseCase
+	clients    *usecase.ClientHitUseCase
+	overrides  *usecase.OverrideUseCase
+	newBlocker func(iterations int) *usecase.DomainBlockerUseCase // resolve, override時のみ生成
+	lock       *usecase.RunLockUseCase                            // resolve, overrideでバッチ実行と重複しないように取得する
+	output     outputFormat
+	stdout     io.Writer
+}
+
+// dispatch runs the named command
+func (a *app) dispatch(ctx context.Context, command string, args []string) error {
+	switch command {
+	case "add":
+		return a.add(ctx, args)
+	case "remove":
+		return a.remove(ctx, args)
+	case "list":
+		return a.list(ctx)
+	case "show":
+		return a.show(ctx, args)
+	case "action":
+		return a.action(ctx, args)
+	case "runs":
+		return a.runs(ctx, args)
+	case "nodes":
+		return a.nodes(ctx)
+	case "hits":
+		return a.hitsCommand(ctx, args)
+	case "clients":
+		return a.clientsCommand(ctx, args)
+	case "resolve":
+		return a.resolve(ctx, args)
+	case "override":
+		return a.override(ctx, args)
+	default:
+		return fmt.Errorf("unknown command %q\n%s", command, usage)
+	}
+}
+
+// add registers each given domain
+func (a *app) add(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("add", flag.ContinueOnError)
+	actionFlag := fs.String("action", string(db.BlockActionDrop), "block action (drop, reject, log)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("usage: add [-action drop|reject|log] <domain>...")
+	}
+	action, err := db.ParseBlockAction(*actionFlag)
+	if err != nil {
+		return err
+	}
+
+	type addResult struct {
+		Domain string         `json:"domain"`
+		Action db.BlockAction `json:"action"`
+	}
+	var added []addResult
+	for _, arg := range fs.Args() {
+		name, err := a.domains.AddDomain(ctx, arg, action)
+		if err != nil {
+			return err
+		}
+		added = append(added, addResult{Domain: name, Action: action})
+	}
+
+	if a.output == outputJSON {
+		return writeJSON(a.stdout, added)
+	}
+	for _, r := range added {
+		fmt.Fprintf(a.stdout, "added %s (%s)\n", r.Domain, r.Action)
+	}
+	return nil
+}
+
+// action changes the block action of a domain and replaces the firewall rules of its IPs
+func (a *app) action(ctx context.Context, args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: action <domain> drop|reject|log")
+	}
+	name := strings.ToLower(args[0])
+	action, err := db.ParseBlockAction(args[1])
+	if err != nil {
+		return err
+	}
+
+	updated, err := a.domains.SetAction(ctx, name, action)
+	if err != nil {
+		return err
+	}
+
+	if a.output == outputJSON {
+		return writeJSON(a.stdout, struct {
+			Domain     string         `json:"domain"`
+			Action     db.BlockAction `json:"action"`
+			UpdatedIPs []string       `json:"updated_ips"`
+		}{Domain: name, Action: action, UpdatedIPs: updated})
+	}
+	fmt.Fprintf(a.stdout, "set action of %s to %s (%d IPs updated)\n", name, action, len(updated))
+	return nil
+}
+
+// remove deletes each given domain and its firewall rules
+func (a *app) remove(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: remove <domain>...")
+	}
+
+	type removeResult struct {
+		Domain     string   `json:"domain"`
+		RemovedIPs []string `json:"removed_ips"`
+	}
+	var removed []removeResult
+	for _, name := range args {
+		ips, err := a.domains.RemoveDomain(ctx, strings.ToLower(name))
+		if err != nil {
+			return err
+		}
+		r := removeResult{Domain: name, RemovedIPs: []string{}}
+		for _, ip := range ips {
+			r.RemovedIPs = append(r.RemovedIPs, ip.IPAddress)
+		}
+		removed = append(removed, r)
+	}
+
+	if a.output == outputJSON {
+		return writeJSON(a.stdout, removed)
+	}
+	for _, r := range removed {
+		fmt.Fprintf(a.stdout, "removed %s (%d IPs)\n", r.Domain, len(r.RemovedIPs))
+	}
+	return nil
+}
+
+// list prints all domains
+func (a *app) list(ctx context.Context) error {
+	summaries, err := a.domains.ListDomains(ctx)
+	if err != nil {
+		return err
+	}
+
+	if a.output == outputJSON {
+		return writeJSON(a.stdout, summaries)
+	}
+
+	now := time.Now()
+	w := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DOMAIN\tSOURCE\tACTION\tIPS\tLAST SEEN")
+	for _, s := range summaries {
+		lastSeen := "-"
+		if s.LastSeenAt != nil {
+			lastSeen = formatAge(now.Sub(*s.LastSeenAt)) + " ago"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", s.Name, domainSource(s.Manual), s.Action, s.IPCount, lastSeen)
+	}
+	return w.Flush()
+}
+
+// show prints a domain's IPs and their ages
+func (a *app) show(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: show <domain>")
+	}
+
+	detail, err := a.domains.GetDomain(ctx, strings.ToLower(args[0]), time.Now())
+	if err != nil {
+		return err
+	}
+
+	if a.output == outputJSON {
+		return writeJSON(a.stdout, detail)
+	}
+
+	fmt.Fprintf(a.stdout, "domain:  %s\nsource:  %s\naction:  %s\ncreated: %s\n\n",
+		detail.Name, domainSource(detail.Manual), detail.Action, detail.CreatedAt.Format(time.RFC3339))
+	w := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "IP\tFIRST SEEN\tLAST SEEN\tAGE")
+	for _, ip := range detail.IPs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+			ip.IP, ip.CreatedAt.Format(time.RFC3339), ip.UpdatedAt.Format(time.RFC3339), formatAge(ip.Age))
+	}
+	return w.Flush()
+}
+
+// runs prints the latest batch runs
+func (a *app) runs(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("runs", flag.ContinueOnError)
+	limit := fs.Int("n", 10, "number of runs to show")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	runs, err := a.domains.ListRuns(ctx, *limit)
+	if err != nil {
+		return err
+	}
+
+	if a.output == outputJSON {
+		return writeJSON(a.stdout, runs)
+	}
+
+	w := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNODE\tSTARTED\tDURATION\tSTATUS\tDOMAINS\tFAILED\tERROR")
+	for _, run := range runs {
+		duration := "-"
+		if run.FinishedAt != nil {
+			duration = formatAge(run.FinishedAt.Sub(run.StartedAt))
+		}
+		node := run.NodeName
+		if node == "" {
+			node = "-"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%d\t%s\n",
+			run.ID, node, run.StartedAt.Format(time.RFC3339), duration, run.Status,
+			run.DomainsTotal, run.DomainsFailed, run.Error)
+	}
+	return w.Flush()
+}
+
+// nodes prints the routers sharing the database, the one resolving the domains and the state of their firewalls
+func (a *app) nodes(ctx context.Context) error {
+	nodes, err := a.domains.ListNodes(ctx)
+	if err != nil {
+		return err
+	}
+
+	if a.output == outputJSON {
+		return writeJSON(a.stdout, nodes)
+	}
+
+	formatTime := func(t *time.Time) string {
+		if t == nil {
+			return "-"
+		}
+		return t.Format(time.RFC3339)
+	}
+	w := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tRESOLVER\tRULES\tAPPLIED\tBOOTED\tLAST SEEN")
+	for _, node := range nodes {
+		rules := "-"
+		if node.FirewallRules != nil {
+			rules = strconv.Itoa(*node.FirewallRules)
+		}
+		resolver := ""
+		if node.Resolver {
+			resolver = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			node.Name, resolver, rules, formatTime(node.AppliedAt), formatTime(node.BootedAt),
+			node.LastSeenAt.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+// hitsCommand prints the traffic blocked per domain, most blocked first
+func (a *app) hitsCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("hits", flag.ContinueOnError)
+	window := fs.Duration("window", 24*time.Hour, "time window to sum (hourly resolution)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *window <= 0 {
+		return errors.New("window must be positive")
+	}
+
+	hits, err := a.hits.DomainHits(ctx, *window)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Packets > hits[j].Packets })
+
+	if a.output == outputJSON {
+		return writeJSON(a.stdout, hits)
+	}
+
+	w := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DOMAIN\tACTION\tPACKETS\tBYTES")
+	for _, h := range hits {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\n", h.DomainName, h.Action, h.Packets, h.Bytes)
+	}
+	return w.Flush()
+}
+
+// clientsCommand prints which LAN clients sent packets to blocked domains, most recent first
+func (a *app) clientsCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("clients", flag.ContinueOnError)
+	window := fs.Duration("window", 24*time.Hour, "time window to show")
+	client := fs.String("client", "", "show only this client IP")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *window <= 0 {
+		return errors.New("window must be positive")
+	}
+
+	summaries, err := a.clients.Summaries(ctx, *window, *client)
+	if err != nil {
+		return err
+	}
+
+	if a.output == outputJSON {
+		return writeJSON(a.stdout, summaries)
+	}
+
+	now := time.Now()
+	w := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CLIENT\tDOMAIN\tHITS\tLAST HIT\tDEST IPS")
+	for _, s := range summaries {
+		domain := "-"
+		if s.DomainName != nil {
+			domain = *s.DomainName
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s ago\t%s\n",
+			s.ClientIP, domain, s.Hits, formatAge(now.Sub(s.LastHitAt)), strings.Join(s.DestIPs, ","))
+	}
+	return w.Flush()
+}
+
+// resolve resolves a registered domain immediately and updates its firewall rules
+func (a *app) resolve(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("resolve", flag.ContinueOnError)
+	iterations := fs.Int("iterations", 1, "number of DNS resolutions (0 uses MAX_DNS_ITERATIONS)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: resolve [-iterations N] <domain>")
+	}
+	name := strings.ToLower(fs.Arg(0))
+
+	// 未登録ドメインのIPはFK制約で登録できないため事前に確認
+	domain, err := a.domains.GetDomain(ctx, name, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var resolved []string
+	err = a.lock.Do(ctx, func(ctx context.Context) error {
+		resolved, err = a.newBlocker(*iterations).ProcessDomain(ctx, db.Domain{DomainName: name, Action: domain.Action})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	slices.Sort(resolved)
+
+	if a.output == outputJSON {
+		detail, err := a.domains.GetDomain(ctx, name, time.Now())
+		if err != nil {
+			return err
+		}
+		return writeJSON(a.stdout, struct {
+			Resolved []string              `json:"resolved"`
+			Domain   *usecase.DomainDetail `json:"domain"`
+		}{Resolved: resolved, Domain: detail})
+	}
+
+	fmt.Fprintf(a.stdout, "resolved %d IPs: %s\n\n", len(resolved), strings.Join(resolved, ", "))
+	// 解決結果反映後の状態を表示
+	return a.show(ctx, []string{name})
+}
+
+// override dispatches the override subcommands
+func (a *app) override(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: override list|exempt|block|end")
+	}
+	switch args[0] {
+	case "list":
+		return a.overrideList(ctx)
+	case "exempt":
+		return a.overrideSet(ctx, db.OverrideKindExempt, args[1:])
+	case "block":
+		return a.overrideSet(ctx, db.OverrideKindBlock, args[1:])
+	case "end":
+		return a.overrideEnd(ctx, args[1:])
+	default:
+		return fmt.Errorf("unknown override command %q (must be list, exempt, block or end)", args[0])
+	}
+}
+
+// overrideList prints the active temporary blocks and exemptions, soonest expiry first
+func (a *app) overrideList(ctx context.Context) error {
+	overrides, err := a.overrides.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	if a.output == outputJSON {
+		return writeJSON(a.stdout, overrides)
+	}
+
+	now := time.Now()
+	w := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DOMAIN\tKIND\tEXPIRES\tREMAINING")
+	for _, o := range overrides {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+			o.DomainName, o.Kind, o.ExpiresAt.Local().Format(time.RFC3339), formatAge(o.ExpiresAt.Sub(now)))
+	}
+	return w.Flush()
+}
+
+// overrideSet sets a temporary block or exemption and applies it to the firewall immediately
+func (a *app) overrideSet(ctx context.Context, kind db.OverrideKind, args []string) error {
+	fs := flag.NewFlagSet("override "+string(kind), flag.ContinueOnError)
+	forFlag := fs.Duration("for", 0, "how long the override lasts")
+	untilFlag := fs.String("until", "", "when the override ends (RFC 3339 or \"2006-01-02 15:04\" in local time)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: override %s (-for 1h | -until time) <domain>", kind)
+	}
+	duration, err := overrideDuration(*forFlag, *untilFlag, time.Now())
+	if err != nil {
+		return err
+	}
+
+	override, err := a.overrides.Set(ctx, fs.Arg(0), kind, duration)
+	if err != nil {
+		return err
+	}
+	// 一時ブロックは1回だけ名前解決してすぐにルールを追加する
+	if kind == db.OverrideKindBlock {
+		err := a.lock.Do(ctx, func(ctx context.Context) error {
+			_, err := a.newBlocker(1).ProcessDomain(ctx, db.Domain{DomainName: override.DomainName, Action: db.BlockActionDrop})
+			return err
+		})
+		if err != nil {
+			fmt.Fprintf(a.stdout, "warning: failed to resolve %s now, it is blocked in the next batch run: %v\n", override.DomainName, err)
+		}
+	}
+	if err := a.applyOverrides(ctx); err != nil {
+		return err
+	}
+
+	if a.output == outputJSON {
+		return writeJSON(a.stdout, override)
+	}
+	verb := "exempted"
+	if kind == db.OverrideKindBlock {
+		verb = "blocked"
+	}
+	fmt.Fprintf(a.stdout, "%s %s until %s\n", verb, override.DomainName, override.ExpiresAt.Local().Format(time.RFC3339))
+	return nil
+}
+
+// overrideEnd ends the override of a domain now and applies it to the firewall
+func (a *app) overrideEnd(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: override end <domain>")
+	}
+	name := strings.ToLower(args[0])
+	if err := a.overrides.End(ctx, name); err != nil {
+		return err
+	}
+	if err := a.applyOverrides(ctx); err != nil {
+		return err
+	}
+
+	if a.output == outputJSON {
+		return writeJSON(a.stdout, struct {
+			Domain string `json:"domain"`
+		}{Domain: name})
+	}
+	fmt.Fprintf(a.stdout, "ended override of %s\n", name)
+	return nil
+}
+
+// applyOverrides expires ended overrides and updates the firewall rules accordingly, while holding the run lock
+func (a *app) applyOverrides(ctx context.Context) error {
+	if err := a.lock.Do(ctx, a.newBlocker(0).ApplyOverrides); err != nil {
+		// DBへの登録は完了しているため、daemonまたは次回のバッチ実行で反映される
+		return fmt.Errorf("override saved but the firewall could not be updated (retried by the daemon and the next batch run): %w", err)
+	}
+	return nil
+}
+
+// overrideDuration returns how long an override lasts from -for or -until, exactly one of which must be given
+func overrideDuration(forDuration time.Duration, until string, now time.Time) (time.Duration, error) {
+	switch {
+	case forDuration != 0 && until != "":
+		return 0, errors.New("-for and -until cannot be used together")
+	case forDuration != 0:
+		return forDuration, nil
+	case until == "":
+		return 0, errors.New("either -for or -until is required")
+	}
+
+	end, err := time.Parse(time.RFC3339, until)
+	if err != nil {
+		end, err = time.ParseInLocation("2006-01-02 15:04", until, time.Local)
+		if err != nil {
+			return 0, fmt.Errorf("invalid -until %q (must be RFC 3339 or \"2006-01-02 15:04\")", until)
+		}
+	}
+	return end.Sub(now).Round(time.Second), nil
+}
+
+// domainSource describes who registered a domain
+func domainSource(manual bool) string {
+	if manual {
+		return "manual"
+	}
+	return "feed"
+}
@@ -0,0 +1,154 @@
+// routerctl is a command-line tool for managing blocked domains on the router.
+// It reads the same configuration as the batch service and talks to the database directly.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/joho/godotenv"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	pkglogger "github.com/tokane888/router-manager-go/pkg/logger"
+	"github.com/tokane888/router-manager-go/services/batch/internal/config"
+	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
+	"github.com/tokane888/router-manager-go/services/batch/internal/infrastructure/dns"
+	"github.com/tokane888/router-manager-go/services/batch/internal/infrastructure/firewall"
+	"github.com/tokane888/router-manager-go/services/batch/internal/infrastructure/runlock"
+	"github.com/tokane888/router-manager-go/services/batch/internal/infrastructure/system"
+	"github.com/tokane888/router-manager-go/services/batch/internal/usecase"
+)
+
+// アプリのversion。デフォルトは開発版。cloud上ではbuild時に-ldflagsフラグ経由でバージョンを埋め込む
+var version = "dev"
+
+// defaultEnvFile is the environment file installed by the batch Debian package
+const defaultEnvFile = "/etc/default/router-manager-batch"
+
+const usage = `usage: routerctl [-o table|json] [-env-file file] [-config file] [-set key=value]... [-v] <command> [args]
+
+commands:
+  config                   print the effective configuration with its sources, secrets redacted
+  add [-action drop|reject|log] <domain>...
+                           register domains
+  remove <domain>...       delete domains and their firewall rules
+  list                     list domains with IP counts
+  show <domain>            show a domain's IPs and how long ago they were last resolved
+  action <domain> drop|reject|log
+                           change how a domain is blocked and update its firewall rules
+  runs [-n 10]             show the latest batch runs
+  nodes                    show the routers sharing the database and which one resolves the domains
+  hits [-window 24h]       show the traffic blocked per domain
+  clients [-window 24h] [-client ip]
+                           show the LAN clients that tried to reach blocked domains (NFLOG_GROUP)
+  resolve [-iterations N] <domain>
+                           resolve a domain now and update its firewall rules
+  override list            list active temporary blocks and exemptions
+  override exempt (-for 30m | -until time) <domain>
+                           lift the block of a domain until the time
+  override block (-for 2h | -until time) <domain>
+                           block a domain until the time, then delete it
+  override end <domain>    end a temporary block or exemption now`
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, "routerctl:", err)
+		os.Exit(1)
+	}
+}
+
+// run parses global flags, sets up dependencies and dispatches the command
+func run(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("routerctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { fmt.Fprintln(stderr, usage) }
+	outputFlag := fs.String("o", string(outputTable), "output format (table, json)")
+	envFile := fs.String("env-file", defaultEnvFile, "environment file to load if it exists")
+	verbose := fs.Bool("v", false, "print info level logs to stderr")
+	var opts config.Options
+	opts.RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New(usage)
+	}
+
+	output, err := parseOutputFormat(*outputFlag)
+	if err != nil {
+		return err
+	}
+
+	// 環境変数が優先され、ファイルの値は未設定の変数にのみ適用される
+	if _, err := os.Stat(*envFile); err == nil {
+		if err := godotenv.Load(*envFile); err != nil {
+			return fmt.Errorf("failed to load %s: %w", *envFile, err)
+		}
+	}
+
+	cfg, err := config.NewConfig(version, opts)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if fs.Arg(0) == "config" {
+		return cfg.WriteEffective(stdout)
+	}
+	// コマンドの出力を読みやすくするため、-v指定時以外はwarn以上のみ出力
+	if !*verbose {
+		cfg.Logger.Level = "warn"
+	}
+	logger := pkglogger.NewLogger(cfg.Logger)
+	//nolint: errcheck
+	defer logger.Sync()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	database, err := db.NewDB(cfg.Database, logger)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer database.Close()
+
+	firewallManager, err := firewall.NewManager(cfg.Firewall, cfg.NFTables, cfg.IPTables, logger)
+	if err != nil {
+		return fmt.Errorf("failed to initialize firewall manager: %w", err)
+	}
+
+	// DBに接続できない場合、ロックファイルは同じホストの実行のみ直列化する
+	var lockFallback repository.RunLocker
+	if lockFile := runlock.NewFileLock(cfg.RunLockFile); lockFile.Enabled() {
+		lockFallback = lockFile
+	}
+
+	app := &app{
+		domains:   usecase.NewDomainUseCase(database, database, firewallManager, logger),
+		hits:      usecase.NewBlockHitUseCase(database, firewallManager, logger, cfg.HitRetention, cfg.NFTables.Policy != firewall.PolicyAllowlist),
+		clients:   usecase.NewClientHitUseCase(database, firewall.NewNFLogListener(cfg.NFLogGroup, logger), logger, cfg.ClientHits),
+		overrides: usecase.NewOverrideUseCase(database, logger, cfg.OverrideCheckInterval),
+		newBlocker: func(iterations int) *usecase.DomainBlockerUseCase {
+			processing := cfg.Processing
+			if iterations > 0 {
+				processing.MaxDNSIterations = iterations
+			}
+			return usecase.NewDomainBlockerUseCase(
+				database,
+				dns.NewDNSResolver(cfg.DNS, dns.NewNetResolver(cfg.DNS.Servers), logger),
+				firewallManager,
+				system.NewRebootDetector(logger),
+				logger,
+				processing,
+			)
+		},
+		lock:   usecase.NewRunLockUseCase(database, lockFallback, fmt.Sprintf("%s routerctl pid=%d", cfg.Node, os.Getpid()), logger, cfg.RunLock),
+		output: output,
+		stdout: stdout,
+	}
+
+	return app.dispatch(ctx, fs.Arg(0), fs.Args()[1:])
+}
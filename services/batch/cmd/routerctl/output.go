@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// outputFormat is the output format of routerctl commands
+type outputFormat string
+
+const (
+	outputTable outputFormat = "table"
+	outputJSON  outputFormat = "json"
+)
+
+// parseOutputFormat converts a string into an outputFormat
+func parseOutputFormat(s string) (outputFormat, error) {
+	switch f := outputFormat(s); f {
+	case outputTable, outputJSON:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown output format: %q (must be table or json)", s)
+	}
+}
+
+// writeJSON writes v as indented JSON
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// formatAge formats a duration for table output with second precision
+func formatAge(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	return d.Round(time.Second).String()
+}
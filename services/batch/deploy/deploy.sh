@@ -66,6 +66,8 @@ echo -e "${GREEN}Docker compose file installed to ${DOCKER_DIR}${NC}"
 echo -e "${YELLOW}Step 6: Installing systemd units...${NC}"
 cp systemd/router-manager-batch.service ${SYSTEMD_DIR}/
 cp systemd/router-manager-batch.timer ${SYSTEMD_DIR}/
+cp systemd/router-manager-batch-daemon.service ${SYSTEMD_DIR}/
+cp systemd/router-manager-batch-restore.service ${SYSTEMD_DIR}/
 systemctl daemon-reload
 echo -e "${GREEN}Systemd units installed${NC}"
 
@@ -80,6 +82,8 @@ echo -e "${YELLOW}Step 8: Service status...${NC}"
 echo "To enable and start the service:"
 echo "  systemctl enable router-manager-batch.timer"
 echo "  systemctl start router-manager-batch.timer"
+echo "  systemctl enable --now router-manager-batch-daemon.service  # 管理画面からの実行要求・NFLOG記録を使う場合"
+echo "  systemctl enable router-manager-batch-restore.service  # 再起動直後にDBを待たずブロックルールを復元する場合"
 echo ""
 echo "To check status:"
 echo "  systemctl status router-manager-batch.timer"
@@ -5,9 +5,11 @@ go 1.26.3
 require (
 	github.com/joho/godotenv v1.5.1
 	github.com/stretchr/testify v1.11.1
+	github.com/tokane888/router-manager-go/pkg/blocklist v0.0.0
 	github.com/tokane888/router-manager-go/pkg/db v0.0.0
 	github.com/tokane888/router-manager-go/pkg/logger v0.0.0
 	go.uber.org/zap v1.28.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -68,9 +70,10 @@ require (
 	golang.org/x/sync v0.20.0 // indirect
 	golang.org/x/sys v0.44.0 // indirect
 	golang.org/x/text v0.37.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
 
+replace github.com/tokane888/router-manager-go/pkg/blocklist => ../../pkg/blocklist
+
 replace github.com/tokane888/router-manager-go/pkg/db => ../../pkg/db
 
 replace github.com/tokane888/router-manager-go/pkg/logger => ../../pkg/logger
@@ -3,14 +3,17 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
-	"github.com/joho/godotenv"
 	"github.com/tokane888/router-manager-go/pkg/db"
 	"github.com/tokane888/router-manager-go/pkg/logger"
+	"github.com/tokane888/router-manager-go/services/batch/internal/infrastructure/backup"
 	"github.com/tokane888/router-manager-go/services/batch/internal/infrastructure/dns"
+	"github.com/tokane888/router-manager-go/services/batch/internal/infrastructure/feed"
 	"github.com/tokane888/router-manager-go/services/batch/internal/infrastructure/firewall"
 	"github.com/tokane888/router-manager-go/services/batch/internal/usecase"
 )
@@ -21,20 +24,50 @@ type Config struct {
 	Logger     logger.LoggerConfig
 	Database   db.Config
 	DNS        dns.DNSConfig
+	Firewall   string // 使用するfirewall backend(nftables or iptables)
 	NFTables   firewall.NFTablesManagerConfig
+	IPTables   firewall.IPTablesManagerConfig
 	Processing usecase.ProcessingConfig
+	Feed       feed.FetcherConfig
+	Backup     backup.StoreConfig
+	// HitRetention is how long hourly block hit counts are kept
+	HitRetention time.Duration
+	// NFLogGroup is the NFLOG group blocked packets are sent to (0: disabled)
+	NFLogGroup int
+	ClientHits usecase.ClientHitConfig
+	// RunRequestPollInterval is how often the daemon checks for runs requested through the API
+	RunRequestPollInterval time.Duration
+	// OverrideCheckInterval is how often the daemon applies set, ended and expired domain overrides
+	OverrideCheckInterval time.Duration
+	// MigrateOnStart applies pending database migrations when the batch starts
+	MigrateOnStart bool
+	// StatusFile is where the outcome of each batch run is written as JSON ("": disabled)
+	StatusFile string
+	// RulesSnapshotFile is where the managed firewall rules are saved after each batch run,
+	// restored at boot by the restore-rules command ("": disabled)
+	RulesSnapshotFile string
+	RunLock           usecase.RunLockConfig
+	// RunLockFile is the lock file used when the database run lock is unavailable ("": disabled)
+	RunLockFile string
+	// Node identifies this router among the routers sharing the database (default: host name)
+	Node string
+
+	// sources records where each setting came from, keyed by environment variable (for WriteEffective)
+	sources map[string]string
 }
 
-// NewConfig loads configuration from environment variables and defaults
-// Priority: environment variables > defaults
-func NewConfig(version string) (*Config, error) {
+// NewConfig loads configuration from flags, environment variables, the config file and defaults
+// Priority: flags (-set) > environment variables > config file > defaults
+func NewConfig(version string, opts Options) (*Config, error) {
+	sources, restore, err := applyLayers(opts)
+	defer restore()
+	if err != nil {
+		return nil, err
+	}
+
 	// Determine environment from environment variable
 	env := getEnv("ENV", "local")
 
-	// Load environment file (optional)
-	envFile := ".env/.env." + env
-	_ = godotenv.Load(envFile) // Ignore error if file doesn't exist
-
 	maxConcurrency, err := getIntEnv("MAX_CONCURRENCY", 10)
 	if err != nil {
 		return nil, err
@@ -50,6 +83,11 @@ func NewConfig(version string) (*Config, error) {
 		return nil, err
 	}
 
+	migrateOnStart, err := getBoolEnv("DB_MIGRATE_ON_START", true)
+	if err != nil {
+		return nil, err
+	}
+
 	nftablesDryRun, err := getBoolEnv("NFTABLES_DRY_RUN", true)
 	if err != nil {
 		return nil, err
@@ -60,6 +98,16 @@ func NewConfig(version string) (*Config, error) {
 		return nil, err
 	}
 
+	iptablesDryRun, err := getBoolEnv("IPTABLES_DRY_RUN", true)
+	if err != nil {
+		return nil, err
+	}
+
+	iptablesTimeout, err := getDurationEnv("IPTABLES_COMMAND_TIMEOUT", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
 	domainTimeout, err := getDurationEnv("DOMAIN_TIMEOUT", 30*time.Second)
 	if err != nil {
 		return nil, err
@@ -80,6 +128,68 @@ func NewConfig(version string) (*Config, error) {
 		return nil, err
 	}
 
+	feedFetchTimeout, err := getDurationEnv("FEED_FETCH_TIMEOUT", 60*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	feedMaxSize, err := getIntEnv("FEED_MAX_SIZE", 64*1024*1024)
+	if err != nil {
+		return nil, err
+	}
+
+	backupRetention, err := getIntEnv("BACKUP_RETENTION", 7)
+	if err != nil {
+		return nil, err
+	}
+
+	hitRetention, err := getDurationEnv("HIT_RETENTION", 30*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	nflogGroup, err := getIntEnv("NFLOG_GROUP", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	nflogFlushInterval, err := getDurationEnv("NFLOG_FLUSH_INTERVAL", 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	blockHitRetention, err := getDurationEnv("BLOCK_HIT_RETENTION", 7*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	runRequestPollInterval, err := getDurationEnv("RUN_REQUEST_POLL_INTERVAL", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	overrideCheckInterval, err := getDurationEnv("OVERRIDE_CHECK_INTERVAL", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	runLockTimeout, err := getDurationEnv("RUN_LOCK_TIMEOUT", 30*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	resolverLease, err := getDurationEnv("RESOLVER_LEASE", 2*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	// 複数のrouterでDBを共有する場合に区別できるよう、デフォルトはホスト名
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+	node := getEnv("NODE_NAME", hostname)
+
 	// Load configuration from environment variables
 	logLevel := getEnv("LOG_LEVEL", "info")
 	logFormat := getEnv("LOG_FORMAT", "local")
@@ -95,13 +205,27 @@ func NewConfig(version string) (*Config, error) {
 		DNS: dns.DNSConfig{
 			Timeout:       dnsTimeout,
 			RetryAttempts: dnsRetryAttempts,
+			Servers:       getListEnv("DNS_SERVERS"),
 		},
+		Firewall: getEnv("FIREWALL_BACKEND", firewall.BackendNFTables),
 		NFTables: firewall.NFTablesManagerConfig{
 			DryRun:         nftablesDryRun,
 			CommandTimeout: nftablesTimeout,
 			Family:         getEnv("NFTABLES_FAMILY", "ip"),
 			Table:          getEnv("NFTABLES_TABLE", "filter"),
 			Chain:          getEnv("NFTABLES_CHAIN", "OUTPUT"),
+			LogGroup:       nflogGroup,
+			Policy:         getEnv("FIREWALL_POLICY", firewall.PolicyBlocklist),
+			AllowSet:       getEnv("NFTABLES_ALLOW_SET", "router_manager_allow"),
+			AllowClients:   getListEnv("ALLOWLIST_CLIENTS"),
+		},
+		IPTables: firewall.IPTablesManagerConfig{
+			DryRun:         iptablesDryRun,
+			CommandTimeout: iptablesTimeout,
+			Command:        getEnv("IPTABLES_COMMAND", "iptables"),
+			Chain:          getEnv("IPTABLES_CHAIN", "OUTPUT"),
+			SetName:        getEnv("IPSET_NAME", "router-manager-blocked"),
+			LogGroup:       nflogGroup,
 		},
 		Processing: usecase.ProcessingConfig{
 			MaxConcurrency:   maxConcurrency,
@@ -109,6 +233,24 @@ func NewConfig(version string) (*Config, error) {
 			MaxDNSIterations: maxDNSIterations,
 			DNSRetryInterval: dnsRetryInterval,
 			IPExpiryDuration: ipExpiryDuration,
+			ResolverLease:    resolverLease,
+		},
+		Feed: feed.FetcherConfig{
+			Timeout: feedFetchTimeout,
+			MaxSize: int64(feedMaxSize),
+		},
+		Backup: backup.StoreConfig{
+			Dir:       getEnv("BACKUP_DIR", ""),
+			Retention: backupRetention,
+			Format:    db.BackupFormat(getEnv("BACKUP_FORMAT", "json")),
+		},
+		HitRetention:           hitRetention,
+		NFLogGroup:             nflogGroup,
+		RunRequestPollInterval: runRequestPollInterval,
+		OverrideCheckInterval:  overrideCheckInterval,
+		ClientHits: usecase.ClientHitConfig{
+			FlushInterval: nflogFlushInterval,
+			Retention:     blockHitRetention,
 		},
 		Database: db.Config{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -117,7 +259,18 @@ func NewConfig(version string) (*Config, error) {
 			User:     getEnv("DB_USER", "postgres"),
 			Password: getEnv("DB_PASSWORD", ""),
 			SSLMode:  getEnv("DB_SSL_MODE", "disable"),
+			Node:     node,
 		},
+		MigrateOnStart:    migrateOnStart,
+		StatusFile:        getEnv("STATUS_FILE", "/run/router-manager-batch/status.json"),
+		RulesSnapshotFile: getEnv("RULES_SNAPSHOT_FILE", "/var/lib/router-manager-batch/rules.json"),
+		RunLock: usecase.RunLockConfig{
+			Mode:    getEnv("RUN_LOCK_MODE", usecase.RunLockModeExit),
+			Timeout: runLockTimeout,
+		},
+		RunLockFile: getEnv("RUN_LOCK_FILE", "/run/lock/router-manager-batch.lock"),
+		Node:        node,
+		sources:     sources,
 	}
 
 	// Validate configuration
@@ -135,6 +288,17 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+// getListEnv returns the comma-separated values of an environment variable, or nil if it is unset or empty
+func getListEnv(key string) []string {
+	var values []string
+	for _, value := range strings.Split(getEnv(key, ""), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 func getIntEnv(key string, fallback int) (int, error) {
 	if s, exists := os.LookupEnv(key); exists {
 		i, err := strconv.Atoi(s)
@@ -206,19 +370,74 @@ func validateConfig(cfg *Config) error {
 	if cfg.DNS.RetryAttempts > 10 {
 		return fmt.Errorf("DNS retry attempts too high: %d (maximum: 10)", cfg.DNS.RetryAttempts)
 	}
-
-	// Validate nftables configuration
-	if cfg.NFTables.CommandTimeout <= 0 {
-		return fmt.Errorf("nftables command timeout must be positive, got: %v", cfg.NFTables.CommandTimeout)
-	}
-	if cfg.NFTables.Family == "" {
-		return errors.New("nftables family cannot be empty")
+	for _, server := range cfg.DNS.Servers {
+		// DNSサーバー自体の名前解決はできないため、IPアドレスのみ許可する
+		host := server
+		if h, _, err := net.SplitHostPort(server); err == nil {
+			host = h
+		}
+		if net.ParseIP(host) == nil {
+			return fmt.Errorf("invalid DNS server: %s (must be an IP address with an optional port)", server)
+		}
 	}
-	if cfg.NFTables.Table == "" {
-		return errors.New("nftables table cannot be empty")
+
+	// Validate firewall configuration (選択されたbackendの設定のみ検証)
+	switch cfg.Firewall {
+	case firewall.BackendNFTables:
+		if cfg.NFTables.CommandTimeout <= 0 {
+			return fmt.Errorf("nftables command timeout must be positive, got: %v", cfg.NFTables.CommandTimeout)
+		}
+		if cfg.NFTables.Family == "" {
+			return errors.New("nftables family cannot be empty")
+		}
+		if cfg.NFTables.Table == "" {
+			return errors.New("nftables table cannot be empty")
+		}
+		if cfg.NFTables.Chain == "" {
+			return errors.New("nftables chain cannot be empty")
+		}
+	case firewall.BackendIPTables:
+		if cfg.IPTables.CommandTimeout <= 0 {
+			return fmt.Errorf("iptables command timeout must be positive, got: %v", cfg.IPTables.CommandTimeout)
+		}
+		if cfg.IPTables.Command == "" {
+			return errors.New("iptables command cannot be empty")
+		}
+		if cfg.IPTables.Chain == "" {
+			return errors.New("iptables chain cannot be empty")
+		}
+		if cfg.IPTables.SetName == "" {
+			return errors.New("ipset name cannot be empty")
+		}
+		// ipsetの名前は31文字まで。reject用のsetには"-reject"が付与される
+		if len(cfg.IPTables.SetName) > 24 {
+			return fmt.Errorf("ipset name too long: %s (maximum: 24 characters)", cfg.IPTables.SetName)
+		}
+	default:
+		return fmt.Errorf("invalid firewall backend: %s (must be '%s' or '%s')", cfg.Firewall, firewall.BackendNFTables, firewall.BackendIPTables)
 	}
-	if cfg.NFTables.Chain == "" {
-		return errors.New("nftables chain cannot be empty")
+
+	// Validate firewall policy
+	switch cfg.NFTables.Policy {
+	case firewall.PolicyBlocklist:
+	case firewall.PolicyAllowlist:
+		if cfg.Firewall != firewall.BackendNFTables {
+			return fmt.Errorf("firewall policy %s requires the %s backend, got: %s", firewall.PolicyAllowlist, firewall.BackendNFTables, cfg.Firewall)
+		}
+		if cfg.NFTables.AllowSet == "" {
+			return errors.New("nftables allow set cannot be empty")
+		}
+		// 対象クライアントがない場合は何も制限されないため設定ミスとして扱う
+		if len(cfg.NFTables.AllowClients) == 0 {
+			return errors.New("allowlist clients cannot be empty with the allowlist policy")
+		}
+		for _, client := range cfg.NFTables.AllowClients {
+			if !isIPv4OrCIDR(client) {
+				return fmt.Errorf("invalid allowlist client: %s (must be an IPv4 address or CIDR)", client)
+			}
+		}
+	default:
+		return fmt.Errorf("invalid firewall policy: %s (must be '%s' or '%s')", cfg.NFTables.Policy, firewall.PolicyBlocklist, firewall.PolicyAllowlist)
 	}
 
 	// Validate domain timeout
@@ -236,5 +455,74 @@ func validateConfig(cfg *Config) error {
 		return fmt.Errorf("IP expiry duration must be positive, got: %v", cfg.Processing.IPExpiryDuration)
 	}
 
+	// Validate feed configuration
+	if cfg.Feed.Timeout <= 0 {
+		return fmt.Errorf("feed fetch timeout must be positive, got: %v", cfg.Feed.Timeout)
+	}
+	if cfg.Feed.MaxSize <= 0 {
+		return fmt.Errorf("feed max size must be positive, got: %d", cfg.Feed.MaxSize)
+	}
+
+	// Validate backup configuration
+	if cfg.Backup.Dir != "" {
+		if cfg.Backup.Retention <= 0 {
+			return fmt.Errorf("backup retention must be positive, got: %d", cfg.Backup.Retention)
+		}
+		if cfg.Backup.Format != db.BackupFormatJSON && cfg.Backup.Format != db.BackupFormatYAML {
+			return fmt.Errorf("invalid backup format: %s (must be 'json' or 'yaml')", cfg.Backup.Format)
+		}
+	}
+
+	// 直近24時間のhit数を返せるよう、最低24時間は保持する
+	if cfg.HitRetention < 24*time.Hour {
+		return fmt.Errorf("hit retention must be at least 24h, got: %v", cfg.HitRetention)
+	}
+
+	if cfg.RunRequestPollInterval <= 0 {
+		return fmt.Errorf("run request poll interval must be positive, got: %v", cfg.RunRequestPollInterval)
+	}
+
+	if cfg.OverrideCheckInterval <= 0 {
+		return fmt.Errorf("override check interval must be positive, got: %v", cfg.OverrideCheckInterval)
+	}
+
+	// nodes.nameの長さまで
+	if cfg.Node == "" || len(cfg.Node) > 255 {
+		return fmt.Errorf("invalid node name: %q (must be 1 to 255 characters)", cfg.Node)
+	}
+	if cfg.Processing.ResolverLease <= 0 {
+		return fmt.Errorf("resolver lease must be positive, got: %v", cfg.Processing.ResolverLease)
+	}
+
+	// Validate run lock configuration
+	if cfg.RunLock.Mode != usecase.RunLockModeExit && cfg.RunLock.Mode != usecase.RunLockModeWait {
+		return fmt.Errorf("invalid run lock mode: %s (must be '%s' or '%s')", cfg.RunLock.Mode, usecase.RunLockModeExit, usecase.RunLockModeWait)
+	}
+	if cfg.RunLock.Timeout < 0 {
+		return fmt.Errorf("run lock timeout cannot be negative, got: %v", cfg.RunLock.Timeout)
+	}
+
+	// Validate NFLOG configuration
+	if cfg.NFLogGroup < 0 || cfg.NFLogGroup > 65535 {
+		return fmt.Errorf("invalid NFLOG group: %d (must be between 1 and 65535, or 0 to disable)", cfg.NFLogGroup)
+	}
+	if cfg.NFLogGroup > 0 {
+		if cfg.ClientHits.FlushInterval <= 0 {
+			return fmt.Errorf("NFLOG flush interval must be positive, got: %v", cfg.ClientHits.FlushInterval)
+		}
+		if cfg.ClientHits.Retention <= 0 {
+			return fmt.Errorf("block hit retention must be positive, got: %v", cfg.ClientHits.Retention)
+		}
+	}
+
 	return nil
 }
+
+// isIPv4OrCIDR reports whether s is an IPv4 address or an IPv4 CIDR
+func isIPv4OrCIDR(s string) bool {
+	if ip := net.ParseIP(s); ip != nil {
+		return ip.To4() != nil
+	}
+	ip, _, err := net.ParseCIDR(s)
+	return err == nil && ip.To4() != nil
+}
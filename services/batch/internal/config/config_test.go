@@ -6,8 +6,11 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/tokane888/router-manager-go/pkg/db"
 	"github.com/tokane888/router-manager-go/pkg/logger"
+	"github.com/tokane888/router-manager-go/services/batch/internal/infrastructure/backup"
 	"github.com/tokane888/router-manager-go/services/batch/internal/infrastructure/dns"
+	"github.com/tokane888/router-manager-go/services/batch/internal/infrastructure/feed"
 	"github.com/tokane888/router-manager-go/services/batch/internal/infrastructure/firewall"
 	"github.com/tokane888/router-manager-go/services/batch/internal/usecase"
 )
@@ -29,17 +32,47 @@ func validConfig() *Config {
 			DomainTimeout:    30 * time.Second,
 			DNSRetryInterval: 60 * time.Second,
 			IPExpiryDuration: 24 * time.Hour,
+			ResolverLease:    2 * time.Hour,
 		},
 		DNS: dns.DNSConfig{
 			Timeout:       5 * time.Second,
 			RetryAttempts: 3,
 		},
+		Firewall: firewall.BackendNFTables,
 		NFTables: firewall.NFTablesManagerConfig{
 			CommandTimeout: 10 * time.Second,
 			Family:         "ip",
 			Table:          "filter",
 			Chain:          "OUTPUT",
+			Policy:         firewall.PolicyBlocklist,
+			AllowSet:       "router_manager_allow",
 		},
+		IPTables: firewall.IPTablesManagerConfig{
+			CommandTimeout: 10 * time.Second,
+			Command:        "iptables",
+			Chain:          "OUTPUT",
+			SetName:        "router-manager-blocked",
+		},
+		Feed: feed.FetcherConfig{
+			Timeout: 60 * time.Second,
+			MaxSize: 64 * 1024 * 1024,
+		},
+		Backup: backup.StoreConfig{
+			Retention: 7,
+			Format:    db.BackupFormatJSON,
+		},
+		HitRetention: 720 * time.Hour,
+		ClientHits: usecase.ClientHitConfig{
+			FlushInterval: 5 * time.Second,
+			Retention:     7 * 24 * time.Hour,
+		},
+		RunRequestPollInterval: 10 * time.Second,
+		OverrideCheckInterval:  30 * time.Second,
+		RunLock: usecase.RunLockConfig{
+			Mode:    usecase.RunLockModeExit,
+			Timeout: 30 * time.Minute,
+		},
+		Node: "main",
 	}
 }
 
@@ -204,6 +237,145 @@ func Test_validateConfig(t *testing.T) {
 			wantErr:     true,
 			errContains: "nftables chain cannot be empty",
 		},
+		{
+			name: "invalid firewall backend",
+			args: args{
+				cfg: func() *Config {
+					cfg := validConfig()
+					cfg.Firewall = "pf"
+					return cfg
+				}(),
+			},
+			wantErr:     true,
+			errContains: "invalid firewall backend",
+		},
+		{
+			name: "iptables backend ignores nftables settings",
+			args: args{
+				cfg: func() *Config {
+					cfg := validConfig()
+					cfg.Firewall = firewall.BackendIPTables
+					cfg.NFTables.Table = ""
+					return cfg
+				}(),
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid firewall policy",
+			args: args{
+				cfg: func() *Config {
+					cfg := validConfig()
+					cfg.NFTables.Policy = "denylist"
+					return cfg
+				}(),
+			},
+			wantErr:     true,
+			errContains: "invalid firewall policy",
+		},
+		{
+			name: "valid allowlist policy",
+			args: args{
+				cfg: func() *Config {
+					cfg := validConfig()
+					cfg.NFTables.Policy = firewall.PolicyAllowlist
+					cfg.NFTables.AllowClients = []string{"192.168.20.0/24", "192.168.1.30"}
+					return cfg
+				}(),
+			},
+			wantErr: false,
+		},
+		{
+			name: "allowlist policy without clients",
+			args: args{
+				cfg: func() *Config {
+					cfg := validConfig()
+					cfg.NFTables.Policy = firewall.PolicyAllowlist
+					return cfg
+				}(),
+			},
+			wantErr:     true,
+			errContains: "allowlist clients cannot be empty",
+		},
+		{
+			name: "invalid allowlist client",
+			args: args{
+				cfg: func() *Config {
+					cfg := validConfig()
+					cfg.NFTables.Policy = firewall.PolicyAllowlist
+					cfg.NFTables.AllowClients = []string{"2001:db8::/64"}
+					return cfg
+				}(),
+			},
+			wantErr:     true,
+			errContains: "invalid allowlist client",
+		},
+		{
+			name: "allowlist policy with iptables backend",
+			args: args{
+				cfg: func() *Config {
+					cfg := validConfig()
+					cfg.Firewall = firewall.BackendIPTables
+					cfg.NFTables.Policy = firewall.PolicyAllowlist
+					cfg.NFTables.AllowClients = []string{"192.168.20.0/24"}
+					return cfg
+				}(),
+			},
+			wantErr:     true,
+			errContains: "requires the nftables backend",
+		},
+		{
+			name: "invalid iptables command timeout",
+			args: args{
+				cfg: func() *Config {
+					cfg := validConfig()
+					cfg.Firewall = firewall.BackendIPTables
+					cfg.IPTables.CommandTimeout = 0
+					return cfg
+				}(),
+			},
+			wantErr:     true,
+			errContains: "iptables command timeout must be positive",
+		},
+		{
+			name: "empty iptables chain",
+			args: args{
+				cfg: func() *Config {
+					cfg := validConfig()
+					cfg.Firewall = firewall.BackendIPTables
+					cfg.IPTables.Chain = ""
+					return cfg
+				}(),
+			},
+			wantErr:     true,
+			errContains: "iptables chain cannot be empty",
+		},
+		{
+			name: "empty ipset name",
+			args: args{
+				cfg: func() *Config {
+					cfg := validConfig()
+					cfg.Firewall = firewall.BackendIPTables
+					cfg.IPTables.SetName = ""
+					return cfg
+				}(),
+			},
+			wantErr:     true,
+			errContains: "ipset name cannot be empty",
+		},
+		{
+			name: "too long ipset name",
+			args: args{
+				cfg: func() *Config {
+					cfg := validConfig()
+					cfg.Firewall = firewall.BackendIPTables
+					cfg.IPTables.SetName = "router-manager-blocked-ips"
+					return cfg
+				}(),
+			},
+			wantErr:     true,
+			errContains: "ipset name too long",
+		},
 		{
 			name: "invalid domain timeout",
 			args: args{
@@ -240,6 +412,152 @@ func Test_validateConfig(t *testing.T) {
 			wantErr:     true,
 			errContains: "IP expiry duration must be positive",
 		},
+		{
+			name: "invalid feed fetch timeout",
+			args: args{
+				cfg: func() *Config {
+					cfg := validConfig()
+					cfg.Feed.Timeout = 0
+					return cfg
+				}(),
+			},
+			wantErr:     true,
+			errContains: "feed fetch timeout must be positive",
+		},
+		{
+			name: "invalid feed max size",
+			args: args{
+				cfg: func() *Config {
+					cfg := validConfig()
+					cfg.Feed.MaxSize = 0
+					return cfg
+				}(),
+			},
+			wantErr:     true,
+			errContains: "feed max size must be positive",
+		},
+		{
+			name: "invalid backup retention",
+			args: args{
+				cfg: func() *Config {
+					cfg := validConfig()
+					cfg.Backup.Dir = "/var/backups"
+					cfg.Backup.Retention = 0
+					return cfg
+				}(),
+			},
+			wantErr:     true,
+			errContains: "backup retention must be positive",
+		},
+		{
+			name: "invalid backup format",
+			args: args{
+				cfg: func() *Config {
+					cfg := validConfig()
+					cfg.Backup.Dir = "/var/backups"
+					cfg.Backup.Format = "xml"
+					return cfg
+				}(),
+			},
+			wantErr:     true,
+			errContains: "invalid backup format",
+		},
+		{
+			name: "hit retention shorter than 24h",
+			args: args{
+				cfg: func() *Config {
+					cfg := validConfig()
+					cfg.HitRetention = 12 * time.Hour
+					return cfg
+				}(),
+			},
+			wantErr:     true,
+			errContains: "hit retention must be at least 24h",
+		},
+		{
+			name: "invalid run request poll interval",
+			args: args{
+				cfg: func() *Config {
+					cfg := validConfig()
+					cfg.RunRequestPollInterval = 0
+					return cfg
+				}(),
+			},
+			wantErr:     true,
+			errContains: "run request poll interval must be positive",
+		},
+		{
+			name: "invalid override check interval",
+			args: args{
+				cfg: func() *Config {
+					cfg := validConfig()
+					cfg.OverrideCheckInterval = 0
+					return cfg
+				}(),
+			},
+			wantErr:     true,
+			errContains: "override check interval must be positive",
+		},
+		{
+			name: "invalid run lock mode",
+			args: args{
+				cfg: func() *Config {
+					cfg := validConfig()
+					cfg.RunLock.Mode = "skip"
+					return cfg
+				}(),
+			},
+			wantErr:     true,
+			errContains: "invalid run lock mode: skip",
+		},
+		{
+			name: "empty node name",
+			args: args{
+				cfg: func() *Config {
+					cfg := validConfig()
+					cfg.Node = ""
+					return cfg
+				}(),
+			},
+			wantErr:     true,
+			errContains: "invalid node name",
+		},
+		{
+			name: "valid NFLOG group",
+			args: args{
+				cfg: func() *Config {
+					cfg := validConfig()
+					cfg.NFLogGroup = 5
+					return cfg
+				}(),
+			},
+			wantErr: false,
+		},
+		{
+			name: "NFLOG group out of range",
+			args: args{
+				cfg: func() *Config {
+					cfg := validConfig()
+					cfg.NFLogGroup = 65536
+					return cfg
+				}(),
+			},
+			wantErr:     true,
+			errContains: "invalid NFLOG group",
+		},
+		{
+			name: "invalid block hit retention",
+			args: args{
+				cfg: func() *Config {
+					cfg := validConfig()
+					cfg.NFLogGroup = 5
+					cfg.ClientHits.Retention = 0
+					return cfg
+				}(),
+			},
+			wantErr:     true,
+			errContains: "block hit retention must be positive",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
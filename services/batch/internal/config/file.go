@@ -0,0 +1,352 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Options are the command-line settings, which take precedence over environment variables and the config file
+type Options struct {
+	// File is the YAML config file to read. Empty uses CONFIG_FILE; no file is read if both are empty.
+	File string
+	// Set holds the values given with -set key=value, keyed by config file key (e.g. dns.timeout)
+	Set map[string]string
+}
+
+// RegisterFlags registers the -config and -set flags that fill the options
+func (o *Options) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.File, "config", "", "YAML config file (default $CONFIG_FILE)")
+	fs.Var(setFlag{o}, "set", "override a setting as key=value, e.g. dns.timeout=10s (repeatable)")
+}
+
+// setFlag collects repeated -set key=value flags into Options.Set
+type setFlag struct {
+	opts *Options
+}
+
+func (f setFlag) String() string {
+	return ""
+}
+
+func (f setFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value: %q", value)
+	}
+	if _, ok := settingByKey(key); !ok {
+		return fmt.Errorf("unknown setting %q", key)
+	}
+	if f.opts.Set == nil {
+		f.opts.Set = make(map[string]string)
+	}
+	f.opts.Set[key] = val
+	return nil
+}
+
+// Sources of setting values, shown by WriteEffective
+const (
+	sourceFlag    = "flag"
+	sourceEnv     = "env"
+	sourceFile    = "file"
+	sourceDefault = "default"
+)
+
+// setting maps an environment variable to its key in the config file
+type setting struct {
+	env    string
+	key    string
+	get    func(cfg *Config) any
+	secret bool
+}
+
+// settings lists every setting in the order of the effective config output.
+// Lists are comma-separated in environment variables and -set values.
+var settings = []setting{
+	{env: "ENV", key: "env", get: func(c *Config) any { return c.Env }},
+	{env: "APP_NAME", key: "app_name", get: func(c *Config) any { return c.Logger.AppName }},
+	{env: "LOG_LEVEL", key: "log.level", get: func(c *Config) any { return c.Logger.Level }},
+	{env: "LOG_FORMAT", key: "log.format", get: func(c *Config) any { return c.Logger.Format }},
+	{env: "DB_HOST", key: "database.host", get: func(c *Config) any { return c.Database.Host }},
+	{env: "DB_PORT", key: "database.port", get: func(c *Config) any { return c.Database.Port }},
+	{env: "DB_NAME", key: "database.name", get: func(c *Config) any { return c.Database.DBName }},
+	{env: "DB_USER", key: "database.user", get: func(c *Config) any { return c.Database.User }},
+	{env: "DB_PASSWORD", key: "database.password", get: func(c *Config) any { return c.Database.Password }, secret: true},
+	{env: "DB_SSL_MODE", key: "database.ssl_mode", get: func(c *Config) any { return c.Database.SSLMode }},
+	{env: "DB_MIGRATE_ON_START", key: "database.migrate_on_start", get: func(c *Config) any { return c.MigrateOnStart }},
+	{env: "DNS_TIMEOUT", key: "dns.timeout", get: func(c *Config) any { return c.DNS.Timeout }},
+	{env: "DNS_RETRY_ATTEMPTS", key: "dns.retry_attempts", get: func(c *Config) any { return c.DNS.RetryAttempts }},
+	{env: "DNS_SERVERS", key: "dns.servers", get: func(c *Config) any { return c.DNS.Servers }},
+	{env: "FIREWALL_BACKEND", key: "firewall.backend", get: func(c *Config) any { return c.Firewall }},
+	{env: "FIREWALL_POLICY", key: "firewall.policy", get: func(c *Config) any { return c.NFTables.Policy }},
+	{env: "ALLOWLIST_CLIENTS", key: "firewall.allowlist_clients", get: func(c *Config) any { return c.NFTables.AllowClients }},
+	{env: "NFTABLES_DRY_RUN", key: "nftables.dry_run", get: func(c *Config) any { return c.NFTables.DryRun }},
+	{env: "NFTABLES_COMMAND_TIMEOUT", key: "nftables.command_timeout", get: func(c *Config) any { return c.NFTables.CommandTimeout }},
+	{env: "NFTABLES_FAMILY", key: "nftables.family", get: func(c *Config) any { return c.NFTables.Family }},
+	{env: "NFTABLES_TABLE", key: "nftables.table", get: func(c *Config) any { return c.NFTables.Table }},
+	{env: "NFTABLES_CHAIN", key: "nftables.chain", get: func(c *Config) any { return c.NFTables.Chain }},
+	{env: "NFTABLES_ALLOW_SET", key: "nftables.allow_set", get: func(c *Config) any { return c.NFTables.AllowSet }},
+	{env: "IPTABLES_DRY_RUN", key: "iptables.dry_run", get: func(c *Config) any { return c.IPTables.DryRun }},
+	{env: "IPTABLES_COMMAND_TIMEOUT", key: "iptables.command_timeout", get: func(c *Config) any { return c.IPTables.CommandTimeout }},
+	{env: "IPTABLES_COMMAND", key: "iptables.command", get: func(c *Config) any { return c.IPTables.Command }},
+	{env: "IPTABLES_CHAIN", key: "iptables.chain", get: func(c *Config) any { return c.IPTables.Chain }},
+	{env: "IPSET_NAME", key: "iptables.ipset_name", get: func(c *Config) any { return c.IPTables.SetName }},
+	{env: "MAX_CONCURRENCY", key: "processing.max_concurrency", get: func(c *Config) any { return c.Processing.MaxConcurrency }},
+	{env: "DOMAIN_TIMEOUT", key: "processing.domain_timeout", get: func(c *Config) any { return c.Processing.DomainTimeout }},
+	{env: "MAX_DNS_ITERATIONS", key: "processing.max_dns_iterations", get: func(c *Config) any { return c.Processing.MaxDNSIterations }},
+	{env: "DNS_RETRY_INTERVAL", key: "processing.dns_retry_interval", get: func(c *Config) any { return c.Processing.DNSRetryInterval }},
+	{env: "IP_EXPIRY_DURATION", key: "processing.ip_expiry_duration", get: func(c *Config) any { return c.Processing.IPExpiryDuration }},
+	{env: "FEED_FETCH_TIMEOUT", key: "feed.fetch_timeout", get: func(c *Config) any { return c.Feed.Timeout }},
+	{env: "FEED_MAX_SIZE", key: "feed.max_size", get: func(c *Config) any { return c.Feed.MaxSize }},
+	{env: "BACKUP_DIR", key: "backup.dir", get: func(c *Config) any { return c.Backup.Dir }},
+	{env: "BACKUP_RETENTION", key: "backup.retention", get: func(c *Config) any { return c.Backup.Retention }},
+	{env: "BACKUP_FORMAT", key: "backup.format", get: func(c *Config) any { return string(c.Backup.Format) }},
+	{env: "STATUS_FILE", key: "status_file", get: func(c *Config) any { return c.StatusFile }},
+	{env: "RULES_SNAPSHOT_FILE", key: "rules_snapshot_file", get: func(c *Config) any { return c.RulesSnapshotFile }},
+	{env: "RUN_LOCK_MODE", key: "run_lock.mode", get: func(c *Config) any { return c.RunLock.Mode }},
+	{env: "RUN_LOCK_TIMEOUT", key: "run_lock.timeout", get: func(c *Config) any { return c.RunLock.Timeout }},
+	{env: "RUN_LOCK_FILE", key: "run_lock.file", get: func(c *Config) any { return c.RunLockFile }},
+	{env: "NODE_NAME", key: "node.name", get: func(c *Config) any { return c.Node }},
+	{env: "RESOLVER_LEASE", key: "node.resolver_lease", get: func(c *Config) any { return c.Processing.ResolverLease }},
+	{env: "HIT_RETENTION", key: "hits.retention", get: func(c *Config) any { return c.HitRetention }},
+	{env: "NFLOG_GROUP", key: "nflog.group", get: func(c *Config) any { return c.NFLogGroup }},
+	{env: "NFLOG_FLUSH_INTERVAL", key: "nflog.flush_interval", get: func(c *Config) any { return c.ClientHits.FlushInterval }},
+	{env: "BLOCK_HIT_RETENTION", key: "nflog.retention", get: func(c *Config) any { return c.ClientHits.Retention }},
+	{env: "RUN_REQUEST_POLL_INTERVAL", key: "daemon.run_request_poll_interval", get: func(c *Config) any { return c.RunRequestPollInterval }},
+	{env: "OVERRIDE_CHECK_INTERVAL", key: "daemon.override_check_interval", get: func(c *Config) any { return c.OverrideCheckInterval }},
+}
+
+// settingByKey returns the setting with the given config file key
+func settingByKey(key string) (setting, bool) {
+	i := slices.IndexFunc(settings, func(s setting) bool { return s.key == key })
+	if i < 0 {
+		return setting{}, false
+	}
+	return settings[i], true
+}
+
+// applyLayers makes the -set values, the .env file and the config file visible as environment variables,
+// so that the get*Env helpers resolve each setting as flags > environment variables > config file > defaults.
+// Returns where each set value comes from, keyed by environment variable, and a function that removes the
+// -set and config file values from the environment again so that a later reload reads them afresh.
+func applyLayers(opts Options) (map[string]string, func(), error) {
+	sources := make(map[string]string)
+	for _, s := range settings {
+		if _, ok := os.LookupEnv(s.env); ok {
+			sources[s.env] = sourceEnv
+		}
+	}
+
+	var applied []string
+	original := make(map[string]*string)
+	restore := func() {
+		for _, key := range applied {
+			if value := original[key]; value != nil {
+				_ = os.Setenv(key, *value)
+			} else {
+				_ = os.Unsetenv(key)
+			}
+		}
+	}
+	setenv := func(key, value string) error {
+		if _, saved := original[key]; !saved {
+			if current, ok := os.LookupEnv(key); ok {
+				original[key] = &current
+			} else {
+				original[key] = nil
+			}
+			applied = append(applied, key)
+		}
+		return os.Setenv(key, value)
+	}
+
+	for key, value := range opts.Set {
+		s, ok := settingByKey(key)
+		if !ok {
+			return nil, restore, fmt.Errorf("unknown setting %q in -set", key)
+		}
+		if err := setenv(s.env, value); err != nil {
+			return nil, restore, err
+		}
+		sources[s.env] = sourceFlag
+	}
+
+	path := opts.File
+	if path == "" {
+		path = getEnv("CONFIG_FILE", "")
+	}
+	var fileValues map[string]string
+	if path != "" {
+		var err error
+		if fileValues, err = readConfigFile(path); err != nil {
+			return nil, restore, err
+		}
+	}
+
+	// .env/.env.<ENV>はENVの値で選ぶため、ENVは設定ファイルの値も参照する
+	env := getEnv("ENV", fileValues["env"])
+	if env == "" {
+		env = "local"
+	}
+	_ = godotenv.Load(".env/.env." + env) // Ignore error if file doesn't exist
+	for _, s := range settings {
+		if _, ok := os.LookupEnv(s.env); ok && sources[s.env] == "" {
+			sources[s.env] = sourceEnv
+		}
+	}
+
+	for key, value := range fileValues {
+		s, _ := settingByKey(key)
+		if _, ok := os.LookupEnv(s.env); ok {
+			continue
+		}
+		if err := setenv(s.env, value); err != nil {
+			return nil, restore, err
+		}
+		sources[s.env] = sourceFile
+	}
+	return sources, restore, nil
+}
+
+// readConfigFile reads a YAML config file into values keyed by config file key
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var doc map[string]any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	if err := flattenConfig("", doc, values); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// flattenConfig converts nested YAML mappings into dotted keys. Lists become comma-separated values.
+func flattenConfig(prefix string, doc map[string]any, values map[string]string) error {
+	for name, value := range doc {
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+		if nested, ok := value.(map[string]any); ok {
+			if err := flattenConfig(key, nested, values); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, ok := settingByKey(key); !ok {
+			return fmt.Errorf("unknown setting %q", key)
+		}
+
+		switch v := value.(type) {
+		case nil:
+			// 値のないキーは未設定として扱う
+		case []any:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				switch item.(type) {
+				case map[string]any, []any:
+					return fmt.Errorf("setting %q must be a list of values", key)
+				}
+				items = append(items, fmt.Sprint(item))
+			}
+			values[key] = strings.Join(items, ",")
+		default:
+			values[key] = fmt.Sprint(v)
+		}
+	}
+	return nil
+}
+
+// ChangedKeys returns the config file keys of the settings whose values differ in other, in output order
+func (cfg *Config) ChangedKeys(other *Config) []string {
+	var keys []string
+	for _, s := range settings {
+		if !reflect.DeepEqual(s.get(cfg), s.get(other)) {
+			keys = append(keys, s.key)
+		}
+	}
+	return keys
+}
+
+// WriteEffective writes the merged configuration as a YAML config file, annotating each value with its
+// source (flag, env, file or default). Secrets are redacted.
+func (cfg *Config) WriteEffective(w io.Writer) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	for _, s := range settings {
+		parent := root
+		parts := strings.Split(s.key, ".")
+		for _, part := range parts[:len(parts)-1] {
+			parent = mappingChild(parent, part)
+		}
+
+		value := effectiveValueNode(s.get(cfg))
+		if s.secret && value.Value != "" {
+			value = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "<redacted>"}
+		}
+		source := cfg.sources[s.env]
+		if source == "" {
+			source = sourceDefault
+		}
+		value.LineComment = source
+		parent.Content = append(parent.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: parts[len(parts)-1]}, value)
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}}); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// mappingChild returns the mapping under key in parent, adding it if missing
+func mappingChild(parent *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(parent.Content); i += 2 {
+		if parent.Content[i].Value == key {
+			return parent.Content[i+1]
+		}
+	}
+	child := &yaml.Node{Kind: yaml.MappingNode}
+	parent.Content = append(parent.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, child)
+	return child
+}
+
+// effectiveValueNode converts a setting value into a YAML node in the format accepted by the config file
+func effectiveValueNode(value any) *yaml.Node {
+	switch v := value.(type) {
+	case time.Duration:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v.String()}
+	case int:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(v)}
+	case int64:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.FormatInt(v, 10)}
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(v)}
+	case []string:
+		list := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		for _, item := range v {
+			list.Content = append(list.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: item})
+		}
+		return list
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v}
+	default:
+		panic(fmt.Sprintf("unsupported setting type %T", value))
+	}
+}
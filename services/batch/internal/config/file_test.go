@@ -0,0 +1,218 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unsetSettingEnv unsets every setting's environment variable for the duration of the test
+func unsetSettingEnv(t *testing.T) {
+	t.Helper()
+	keys := []string{"CONFIG_FILE"}
+	for _, s := range settings {
+		keys = append(keys, s.env)
+	}
+	for _, key := range keys {
+		// t.Setenvで終了時の復元を登録してから未設定にする
+		t.Setenv(key, "")
+		require.NoError(t, os.Unsetenv(key))
+	}
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "batch.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func Test_readConfigFile(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		want        map[string]string
+		errContains string
+	}{
+		{
+			name: "nested keys and lists",
+			content: `
+log:
+  level: debug
+dns:
+  timeout: 3s
+  retry_attempts: 2
+  servers: [1.1.1.1, "9.9.9.9:53"]
+nftables:
+  dry_run: false
+backup:
+  dir:
+`,
+			want: map[string]string{
+				"log.level":          "debug",
+				"dns.timeout":        "3s",
+				"dns.retry_attempts": "2",
+				"dns.servers":        "1.1.1.1,9.9.9.9:53",
+				"nftables.dry_run":   "false",
+			},
+		},
+		{
+			name:        "unknown key",
+			content:     "dns:\n  resolver: 1.1.1.1\n",
+			errContains: `unknown setting "dns.resolver"`,
+		},
+		{
+			name:        "list of mappings",
+			content:     "dns:\n  servers:\n    - host: 1.1.1.1\n",
+			errContains: `setting "dns.servers" must be a list of values`,
+		},
+		{
+			name:        "invalid YAML",
+			content:     "dns: [",
+			errContains: "failed to parse config file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readConfigFile(writeConfigFile(t, tt.content))
+			if tt.errContains != "" {
+				assert.ErrorContains(t, err, tt.errContains)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewConfig_precedence(t *testing.T) {
+	unsetSettingEnv(t)
+	path := writeConfigFile(t, `
+log:
+  level: debug
+database:
+  password: secret
+dns:
+  timeout: 7s
+  retry_attempts: 2
+  servers: [1.1.1.1, "9.9.9.9:53"]
+`)
+	t.Setenv("DNS_RETRY_ATTEMPTS", "4")
+
+	cfg, err := NewConfig("test", Options{File: path, Set: map[string]string{"log.level": "warn"}})
+	require.NoError(t, err)
+
+	assert.Equal(t, "warn", cfg.Logger.Level)                           // flag > file
+	assert.Equal(t, 4, cfg.DNS.RetryAttempts)                           // env > file
+	assert.Equal(t, 7*time.Second, cfg.DNS.Timeout)                     // file > default
+	assert.Equal(t, []string{"1.1.1.1", "9.9.9.9:53"}, cfg.DNS.Servers) // list
+	assert.Equal(t, 10, cfg.Processing.MaxConcurrency)                  // default
+
+	// 設定ファイルと-setの値は環境変数に残らない
+	_, ok := os.LookupEnv("DNS_TIMEOUT")
+	assert.False(t, ok)
+	_, ok = os.LookupEnv("LOG_LEVEL")
+	assert.False(t, ok)
+
+	var out bytes.Buffer
+	require.NoError(t, cfg.WriteEffective(&out))
+	for _, line := range []string{
+		"  level: warn # flag\n",
+		"  password: <redacted> # file\n",
+		"  timeout: 7s # file\n",
+		"  retry_attempts: 4 # env\n",
+		"  servers: [1.1.1.1, '9.9.9.9:53'] # file\n",
+		"  max_concurrency: 10 # default\n",
+	} {
+		assert.Contains(t, out.String(), line)
+	}
+	assert.NotContains(t, out.String(), "secret")
+
+	// 出力はそのまま設定ファイルとして読み込める
+	_, err = readConfigFile(writeConfigFile(t, out.String()))
+	assert.NoError(t, err)
+}
+
+func TestNewConfig_invalidLayers(t *testing.T) {
+	unsetSettingEnv(t)
+
+	_, err := NewConfig("test", Options{Set: map[string]string{"dns.resolver": "1.1.1.1"}})
+	assert.ErrorContains(t, err, `unknown setting "dns.resolver" in -set`)
+
+	// マージ後の値にも検証が適用される
+	_, err = NewConfig("test", Options{File: writeConfigFile(t, "dns:\n  servers: [dns.example]\n")})
+	assert.ErrorContains(t, err, "invalid DNS server: dns.example")
+
+	_, err = NewConfig("test", Options{File: filepath.Join(t.TempDir(), "missing.yaml")})
+	assert.ErrorContains(t, err, "failed to read config file")
+}
+
+func TestOptions_RegisterFlags(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		want        Options
+		errContains string
+	}{
+		{
+			name: "repeated -set",
+			args: []string{"-config", "/etc/batch.yaml", "-set", "dns.timeout=10s", "-set", "dns.servers=1.1.1.1,8.8.8.8", "-set", "log.level="},
+			want: Options{
+				File: "/etc/batch.yaml",
+				Set:  map[string]string{"dns.timeout": "10s", "dns.servers": "1.1.1.1,8.8.8.8", "log.level": ""},
+			},
+		},
+		{
+			name: "no flags",
+			args: []string{},
+			want: Options{},
+		},
+		{
+			name:        "missing value",
+			args:        []string{"-set", "dns.timeout"},
+			errContains: "expected key=value",
+		},
+		{
+			name:        "unknown key",
+			args:        []string{"-set", "dns.resolver=1.1.1.1"},
+			errContains: `unknown setting "dns.resolver"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts Options
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			opts.RegisterFlags(fs)
+			err := fs.Parse(tt.args)
+			if tt.errContains != "" {
+				assert.ErrorContains(t, err, tt.errContains)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, opts)
+		})
+	}
+}
+
+func TestConfig_ChangedKeys(t *testing.T) {
+	base := validConfig()
+	base.DNS.Servers = []string{"1.1.1.1"}
+
+	changed := validConfig()
+	changed.DNS.Servers = []string{"1.1.1.1", "8.8.8.8"}
+	changed.Logger.Level = "debug"
+	changed.NFTables.Chain = "FORWARD"
+
+	assert.Empty(t, base.ChangedKeys(base))
+	assert.Equal(t, []string{"log.level", "dns.servers", "nftables.chain"}, base.ChangedKeys(changed))
+}
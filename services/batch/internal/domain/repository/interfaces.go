@@ -12,28 +12,211 @@ type DNSResolver interface {
 	ResolveIPs(ctx context.Context, domain string) ([]string, error)
 }
 
+// BlockRule is a firewall rule created by this service
+type BlockRule struct {
+	IP     string
+	Action db.BlockAction
+	// Packets and Bytes are the traffic blocked by the rule since it was created
+	Packets int64
+	Bytes   int64
+}
+
 // FirewallManager defines the interface for firewall rule management
 type FirewallManager interface {
-	AddBlockRule(ctx context.Context, ip string) error
+	// PreparePolicy creates the rules the firewall policy needs besides the rules of each IP
+	// (the client restriction of the allowlist policy). Calling it again recreates the rules that are missing.
+	PreparePolicy(ctx context.Context) error
+	AddBlockRule(ctx context.Context, ip string, action db.BlockAction) error
+	// RemoveBlockRule removes every rule for the IP regardless of its action
 	RemoveBlockRule(ctx context.Context, ip string) error
+	// ListBlockRules returns the rules this service created, for reconciliation
+	ListBlockRules(ctx context.Context) ([]BlockRule, error)
+}
+
+// RuleSnapshot is the set of managed firewall rules saved after a batch run,
+// so that they can be restored at boot before the database is available
+type RuleSnapshot struct {
+	SavedAt time.Time      `json:"saved_at"`
+	Rules   []SnapshotRule `json:"rules"`
+}
+
+// SnapshotRule is a firewall rule in a RuleSnapshot
+type SnapshotRule struct {
+	IP     string         `json:"ip"`
+	Action db.BlockAction `json:"action"`
+}
+
+// RuleSnapshotStore defines the interface for persisting the rule snapshot on local disk
+type RuleSnapshotStore interface {
+	Enabled() bool
+	Save(snapshot *RuleSnapshot) error
+	// Load returns nil without an error when no snapshot has been saved yet
+	Load() (*RuleSnapshot, error)
+}
+
+// RunLocker defines the interface for the lock that keeps batch runs from overlapping
+type RunLocker interface {
+	// AcquireRunLock returns the function releasing the lock.
+	// If wait is false and another run holds the lock, db.ErrRunLockHeld is returned.
+	AcquireRunLock(ctx context.Context, holder string, wait bool) (func(context.Context) error, error)
+	// RunLockHolder returns "" when the lock is free
+	RunLockHolder(ctx context.Context) (string, error)
+}
+
+// FirewallScripter renders the firewall commands that a FirewallManager executes, for plan output
+type FirewallScripter interface {
+	AddBlockRuleCommands(ip string, action db.BlockAction) []string
+	RemoveBlockRuleCommands(ctx context.Context, ip string) ([]string, error)
 }
 
 // RebootDetector defines the interface for reboot detection operations
 type RebootDetector interface {
 	CheckAndHandleReboot(ctx context.Context) (bool, error)
+	// IsFirstRunAfterReboot reports the same condition as CheckAndHandleReboot without recording the run
+	IsFirstRunAfterReboot(ctx context.Context) (bool, error)
+}
+
+// FirewallOpRepository defines the interface for applying the firewall operations that the database queues
+// together with the changes of domain IPs, domain actions and exempt overrides
+type FirewallOpRepository interface {
+	ApplyFirewallOps(ctx context.Context, limit int, apply func(ctx context.Context, ops []db.FirewallOp) map[int64]error) (int, error)
+	GetPendingFirewallOps(ctx context.Context) ([]db.FirewallOp, error)
 }
 
 // DomainRepository defines the interface for domain data operations
 type DomainRepository interface {
+	FirewallOpRepository
+	NodeRepository
+
 	// Domain operations
 	GetAllDomains(ctx context.Context) ([]db.Domain, error)
+	GetDomain(ctx context.Context, domainName string) (*db.Domain, error)
 	CreateDomain(ctx context.Context, domainName string) error
+	DeleteDomain(ctx context.Context, domainName string) ([]db.DomainIP, error)
+	SetDomainAction(ctx context.Context, domainName string, action db.BlockAction) error
 
-	// Domain IP operations
+	// Domain IP operations. IPは1文で一括して更新する
 	GetDomainIPs(ctx context.Context, domainName string) ([]db.DomainIP, error)
-	CreateDomainIP(ctx context.Context, domainName, ipAddress string) error
-	DeleteDomainIP(ctx context.Context, domainName, ipAddress string) error
+	UpsertDomainIPs(ctx context.Context, domainName string, ipAddresses []string) ([]string, error)
+	TouchDomainIPs(ctx context.Context, domainName string, ipAddresses []string) (int64, error)
+	DeleteDomainIPs(ctx context.Context, domainName string, ipAddresses []string) ([]db.DomainIP, error)
 	GetAllDomainIPs(ctx context.Context) ([]db.DomainIP, error)
-	UpdateDomainIPUpdatedAt(ctx context.Context, domainName, ipAddress string) error
 	DeleteExpiredDomainIPs(ctx context.Context, cutoff time.Time) ([]db.DomainIP, error)
+
+	// Domain override operations
+	GetActiveDomainOverrides(ctx context.Context) ([]db.DomainOverride, error)
+	ExpireDomainOverrides(ctx context.Context) ([]db.DomainOverride, []db.DomainIP, error)
+	PreviewExpiredDomainOverrides(ctx context.Context) ([]db.DomainOverride, []string, error)
+}
+
+// NodeRepository defines the interface for the state of this router (node) among the routers sharing the database
+type NodeRepository interface {
+	RegisterNode(ctx context.Context) error
+	RecordNodeBoot(ctx context.Context) error
+	RecordNodeApplied(ctx context.Context, rules int) error
+	// ClaimResolver reports whether this node resolves the domains and returns the node that does
+	ClaimResolver(ctx context.Context, ttl time.Duration) (bool, string, error)
+	// CheckResolver reports the same as ClaimResolver without taking the lease ("": no node holds it)
+	CheckResolver(ctx context.Context) (bool, string, error)
+	GetAllNodes(ctx context.Context) ([]db.Node, error)
+}
+
+// DomainOverrideRepository defines the interface for managing time-bounded domain overrides
+type DomainOverrideRepository interface {
+	SetDomainOverride(ctx context.Context, domainName string, kind db.OverrideKind, duration time.Duration) (*db.DomainOverride, error)
+	GetActiveDomainOverrides(ctx context.Context) ([]db.DomainOverride, error)
+	EndDomainOverride(ctx context.Context, domainName string) error
+}
+
+// BatchRunRepository defines the interface for batch run history operations
+type BatchRunRepository interface {
+	StartBatchRun(ctx context.Context) (int64, error)
+	FinishBatchRun(ctx context.Context, runID int64, result db.BatchRunResult) error
+	GetRecentBatchRuns(ctx context.Context, limit int) ([]db.BatchRun, error)
+}
+
+// BlockHitRepository defines the interface for block hit counter operations
+type BlockHitRepository interface {
+	RecordBlockCounters(ctx context.Context, counters []db.BlockCounter) (int, error)
+	GetDomainHits(ctx context.Context, window time.Duration) ([]db.DomainHits, error)
+	DeleteDomainHitsOlderThan(ctx context.Context, retention time.Duration) (int64, error)
+}
+
+// RunRequestRepository defines the interface for consuming batch runs requested through the API
+type RunRequestRepository interface {
+	ClaimRunRequest(ctx context.Context) (int64, error)
+	FinishRunRequest(ctx context.Context, requestID, batchRunID int64) error
+	AbandonRunRequests(ctx context.Context) (int64, error)
+}
+
+// ClientHitRepository defines the interface for operations on the packets of LAN clients to blocked IPs
+type ClientHitRepository interface {
+	InsertBlockHits(ctx context.Context, hits []db.BlockHit) (int64, error)
+	GetBlockHitSummaries(ctx context.Context, since time.Time, clientIP string) ([]db.BlockHitSummary, error)
+	DeleteBlockHitsBefore(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+// BlockedPacket is a packet to a blocked IP reported by the firewall log
+type BlockedPacket struct {
+	SrcIP string
+	DstIP string
+	Time  time.Time
+}
+
+// BlockedPacketListener receives the packets logged by the managed firewall rules
+type BlockedPacketListener interface {
+	// Listen calls handle for each logged packet until ctx is cancelled
+	Listen(ctx context.Context, handle func(BlockedPacket)) error
+}
+
+// DomainChangeListener receives the changes of domains and domain overrides committed to the database
+type DomainChangeListener interface {
+	// ListenDomainChanges calls handle for each change until ctx is cancelled or the connection fails
+	ListenDomainChanges(ctx context.Context, handle func(db.DomainChange)) error
+}
+
+// DomainImportRepository defines the interface for bulk domain import operations
+type DomainImportRepository interface {
+	PreviewDomainImport(ctx context.Context, domainNames []string) (*db.DomainImportDiff, error)
+	ImportDomains(ctx context.Context, domainNames []string) (int, error)
+}
+
+// FeedContent represents the result of fetching a blocklist feed
+type FeedContent struct {
+	Body         []byte
+	ETag         string
+	LastModified string
+	NotModified  bool // 前回取得時から変更なし(Bodyは空)
+}
+
+// FeedFetcher defines the interface for retrieving blocklist feeds
+type FeedFetcher interface {
+	Fetch(ctx context.Context, url, etag, lastModified string) (*FeedContent, error)
+}
+
+// FeedRepository defines the interface for blocklist feed data operations
+type FeedRepository interface {
+	FirewallOpRepository
+
+	CreateFeed(ctx context.Context, url, format string, refreshInterval time.Duration) (*db.Feed, error)
+	GetAllFeeds(ctx context.Context) ([]db.Feed, error)
+	GetDueFeeds(ctx context.Context, now time.Time) ([]db.Feed, error)
+	DeleteFeed(ctx context.Context, feedID int64) ([]db.DomainIP, error)
+	SyncFeedDomains(ctx context.Context, feedID int64, domainNames []string) (*db.FeedSyncResult, error)
+	UpdateFeedFetchResult(ctx context.Context, feedID int64, result db.FeedFetchResult) error
+}
+
+// BackupRepository defines the interface for configuration export and restore operations
+type BackupRepository interface {
+	FirewallOpRepository
+
+	ExportBackup(ctx context.Context) (*db.Backup, error)
+	RestoreBackup(ctx context.Context, backup *db.Backup, mode db.RestoreMode) (*db.RestoreResult, error)
+}
+
+// BackupStore defines the interface for persisting automatic configuration backups
+type BackupStore interface {
+	Enabled() bool
+	Exists(day time.Time) (bool, error)
+	Save(day time.Time, backup *db.Backup) (string, error)
 }
@@ -0,0 +1,119 @@
+package backup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"go.uber.org/zap"
+)
+
+// fileNamePrefix is the prefix of automatic backup file names (router-manager-backup-YYYYMMDD.<ext>)
+const fileNamePrefix = "router-manager-backup-"
+
+// StoreConfig contains automatic backup configuration
+type StoreConfig struct {
+	Dir       string          // 空の場合は自動バックアップ無効
+	Retention int             // 保持する世代数
+	Format    db.BackupFormat // json or yaml
+}
+
+// FileStore writes daily configuration backups to a local directory and rotates old ones
+type FileStore struct {
+	logger    *zap.Logger
+	dir       string
+	retention int
+	format    db.BackupFormat
+}
+
+// NewFileStore creates a new backup file store
+func NewFileStore(cfg StoreConfig, logger *zap.Logger) *FileStore {
+	return &FileStore{
+		logger:    logger,
+		dir:       cfg.Dir,
+		retention: cfg.Retention,
+		format:    cfg.Format,
+	}
+}
+
+// Enabled reports whether automatic backups are configured
+func (s *FileStore) Enabled() bool {
+	return s.dir != ""
+}
+
+// Exists reports whether the backup for the given day has already been written
+func (s *FileStore) Exists(day time.Time) (bool, error) {
+	_, err := os.Stat(s.path(day))
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to check backup file: %w", err)
+}
+
+// Save atomically writes the backup for the given day and removes backups beyond the retention count
+func (s *FileStore) Save(day time.Time, backup *db.Backup) (string, error) {
+	if err := os.MkdirAll(s.dir, 0o750); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	path := s.path(day)
+	tmp, err := os.CreateTemp(s.dir, ".tmp-"+filepath.Base(path)+"-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary backup file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck // no-op after a successful rename
+
+	if err := db.EncodeBackup(tmp, backup, s.format); err != nil {
+		_ = tmp.Close()
+		return "", err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return "", fmt.Errorf("failed to sync backup file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to close backup file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to rename backup file: %w", err)
+	}
+
+	s.logger.Info("Configuration backup written", zap.String("file", path))
+
+	if err := s.rotate(); err != nil {
+		s.logger.Warn("Failed to rotate old backups", zap.Error(err))
+	}
+	return path, nil
+}
+
+// rotate deletes the oldest backups so that at most retention files remain
+func (s *FileStore) rotate() error {
+	files, err := filepath.Glob(filepath.Join(s.dir, fileNamePrefix+"*."+string(s.format)))
+	if err != nil {
+		return err
+	}
+	if len(files) <= s.retention {
+		return nil
+	}
+
+	// ファイル名に日付(YYYYMMDD)を含むため名前順 = 日付順
+	slices.Sort(files)
+	for _, file := range files[:len(files)-s.retention] {
+		if err := os.Remove(file); err != nil {
+			return fmt.Errorf("failed to remove old backup %s: %w", file, err)
+		}
+		s.logger.Info("Old configuration backup removed", zap.String("file", file))
+	}
+	return nil
+}
+
+// path returns the backup file path for the given day
+func (s *FileStore) path(day time.Time) string {
+	return filepath.Join(s.dir, fileNamePrefix+day.Format("20060102")+"."+string(s.format))
+}
@@ -0,0 +1,58 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"go.uber.org/zap"
+)
+
+func TestFileStore_SaveAndRotate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "backups")
+	store := NewFileStore(StoreConfig{Dir: dir, Retention: 2, Format: db.BackupFormatJSON}, zap.NewNop())
+	assert.True(t, store.Enabled())
+
+	backup := &db.Backup{Version: db.BackupVersion, Domains: []db.BackupDomain{{Name: "example.com"}}}
+	day := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	exists, err := store.Exists(day)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	for i := range 3 {
+		_, err := store.Save(day.AddDate(0, 0, i), backup)
+		require.NoError(t, err)
+	}
+
+	exists, err = store.Exists(day.AddDate(0, 0, 2))
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.Equal(t, []string{
+		"router-manager-backup-20260102.json",
+		"router-manager-backup-20260103.json",
+	}, names)
+
+	f, err := os.Open(filepath.Join(dir, names[1]))
+	require.NoError(t, err)
+	defer f.Close()
+	decoded, err := db.DecodeBackup(f, db.BackupFormatJSON)
+	require.NoError(t, err)
+	assert.Equal(t, backup.Domains, decoded.Domains)
+}
+
+func TestFileStore_Disabled(t *testing.T) {
+	store := NewFileStore(StoreConfig{}, zap.NewNop())
+	assert.False(t, store.Enabled())
+}
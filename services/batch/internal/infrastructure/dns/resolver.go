@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"sync/atomic"
 	"time"
 
 	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
@@ -31,6 +32,34 @@ type dnsResolverImpl struct {
 type DNSConfig struct {
 	Timeout       time.Duration
 	RetryAttempts int
+	// Servers are the upstream DNS servers ("ip" or "ip:port"). Empty uses the system configuration.
+	Servers []string
+}
+
+// NewNetResolver returns a resolver that queries the given upstream DNS servers,
+// or net.DefaultResolver if servers is empty
+func NewNetResolver(servers []string) NetResolver {
+	if len(servers) == 0 {
+		return net.DefaultResolver
+	}
+	addrs := make([]string, 0, len(servers))
+	for _, server := range servers {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		addrs = append(addrs, server)
+	}
+
+	var next atomic.Uint64
+	var dialer net.Dialer
+	return &net.Resolver{
+		PreferGo: true,
+		// 問い合わせごとに順番にサーバーを使い、応答しないサーバーがあっても再試行で別のサーバーに問い合わせる
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			addr := addrs[(next.Add(1)-1)%uint64(len(addrs))]
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
 }
 
 func NewDNSResolver(cfg DNSConfig, resolver NetResolver, logger *zap.Logger) repository.DNSResolver {
@@ -157,3 +157,21 @@ func (m *mockResolver) LookupIP(ctx context.Context, network, host string) ([]ne
 
 	return m.ipv4Results, m.ipv4Error
 }
+
+func TestNewNetResolver(t *testing.T) {
+	assert.Same(t, net.DefaultResolver, NewNetResolver(nil))
+
+	resolver, ok := NewNetResolver([]string{"127.0.0.1", "127.0.0.2:5353"}).(*net.Resolver)
+	require.True(t, ok)
+	require.NotNil(t, resolver.Dial)
+
+	// UDPのdialは通信しないため、接続先の切り替わりのみ確認できる
+	var remotes []string
+	for range 3 {
+		conn, err := resolver.Dial(context.Background(), "udp", "ignored:53")
+		require.NoError(t, err)
+		remotes = append(remotes, conn.RemoteAddr().String())
+		require.NoError(t, conn.Close())
+	}
+	assert.Equal(t, []string{"127.0.0.1:53", "127.0.0.2:5353", "127.0.0.1:53"}, remotes)
+}
@@ -0,0 +1,82 @@
+package feed
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newTestFetcher() *Fetcher {
+	return NewFetcher(FetcherConfig{Timeout: 5 * time.Second, MaxSize: 1024}, zap.NewNop())
+}
+
+func TestFetch_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+	require.NoError(t, os.WriteFile(path, []byte("0.0.0.0 ads.example.com\n"), 0o600))
+
+	f := newTestFetcher()
+	content, err := f.Fetch(context.Background(), "file://"+path, "", "")
+	require.NoError(t, err)
+	assert.False(t, content.NotModified)
+	assert.Equal(t, "0.0.0.0 ads.example.com\n", string(content.Body))
+	assert.NotEmpty(t, content.LastModified)
+
+	// Same modification time is reported as not modified
+	content, err = f.Fetch(context.Background(), "file://"+path, "", content.LastModified)
+	require.NoError(t, err)
+	assert.True(t, content.NotModified)
+	assert.Empty(t, content.Body)
+
+	_, err = f.Fetch(context.Background(), "file://"+filepath.Join(t.TempDir(), "missing"), "", "")
+	assert.Error(t, err)
+}
+
+func TestFetch_HTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/list.txt":
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			_, _ = w.Write([]byte("||ads.example.com^\n"))
+		case "/large.txt":
+			_, _ = w.Write(make([]byte, 2048))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	f := newTestFetcher()
+
+	content, err := f.Fetch(context.Background(), server.URL+"/list.txt", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, `"v1"`, content.ETag)
+	assert.Equal(t, "||ads.example.com^\n", string(content.Body))
+
+	content, err = f.Fetch(context.Background(), server.URL+"/list.txt", `"v1"`, "")
+	require.NoError(t, err)
+	assert.True(t, content.NotModified)
+	assert.Equal(t, `"v1"`, content.ETag)
+
+	_, err = f.Fetch(context.Background(), server.URL+"/missing.txt", "", "")
+	assert.Error(t, err)
+
+	_, err = f.Fetch(context.Background(), server.URL+"/large.txt", "", "")
+	assert.ErrorContains(t, err, "maximum size")
+}
+
+func TestFetch_UnsupportedScheme(t *testing.T) {
+	_, err := newTestFetcher().Fetch(context.Background(), "ftp://example.com/list.txt", "", "")
+	assert.ErrorContains(t, err, "unsupported feed URL scheme")
+}
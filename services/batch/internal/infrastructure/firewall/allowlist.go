@@ -0,0 +1,363 @@
+package firewall
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
+	"go.uber.org/zap"
+)
+
+// NFTablesAllowlistManager implements the FirewallManager interface for the allowlist policy with nftables.
+// The resolved IPs of the domains are accepted instead of blocked: they are added to named sets that the policy
+// rules accept for the restricted clients, and every other packet from those clients is dropped.
+// As with IPTablesManager, the IPs are kept in one set per block action so that they can be listed back with
+// the action of their domain. The action itself has no effect on the allowed traffic.
+
+// policyRuleComment tags the policy rules of the allowlist. The rules are identified by the full comment,
+// which includes the settings they are built from, so that rules built from other settings are replaced.
+const policyRuleComment = "router-manager allowlist"
+
+// clientSetSuffix is appended to AllowSet for the set of restricted clients
+const clientSetSuffix = "-clients"
+
+type NFTablesAllowlistManager struct {
+	nft     *NFTablesManager
+	logger  *zap.Logger
+	dryRun  bool
+	setName string
+	clients []string
+
+	mu sync.Mutex // PreparePolicyの並行実行でポリシールールが重複して挿入されないようにする
+}
+
+// NewNFTablesAllowlistManager creates a new nftables manager for the allowlist policy
+func NewNFTablesAllowlistManager(cfg NFTablesManagerConfig, logger *zap.Logger) *NFTablesAllowlistManager {
+	return &NFTablesAllowlistManager{
+		nft:     NewNFTablesManager(cfg, logger),
+		logger:  logger,
+		dryRun:  cfg.DryRun,
+		setName: cfg.AllowSet,
+		clients: cfg.AllowClients,
+	}
+}
+
+// PreparePolicy creates the sets and inserts the policy rules at the beginning of the chain if missing,
+// and replaces the members of the client set with the configured clients.
+// Everything is checked on every call, so rules flushed by another tool are recreated by the next call.
+func (a *NFTablesAllowlistManager) PreparePolicy(ctx context.Context) error {
+	if a.dryRun {
+		a.logger.Info("DRY RUN: Would prepare nftables allowlist policy",
+			zap.String("set", a.setName),
+			zap.Strings("clients", a.clients))
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.nft.ensureTableAndChainExist(ctx); err != nil {
+		return fmt.Errorf("failed to check table and chain: %w", err)
+	}
+
+	// add setは既に存在する場合も成功する
+	for _, args := range a.setArgs() {
+		if err := a.nft.executeCommand(ctx, args); err != nil {
+			return fmt.Errorf("failed to create nftables set: %w", err)
+		}
+	}
+	// 1回のnft実行は1つのtransactionとして適用されるため、入れ替えの途中でクライアントが制限から外れることはない
+	if err := a.nft.executeCommand(ctx, a.clientArgs()); err != nil {
+		return fmt.Errorf("failed to set allowlist clients: %w", err)
+	}
+
+	output, err := a.nft.outputCommand(ctx, []string{"-j", "-a", "list", "chain", a.nft.family, a.nft.tableName, a.nft.chainName})
+	if err != nil {
+		return fmt.Errorf("failed to list nftables rules: %w", err)
+	}
+	current, err := parsePolicyRules(output)
+	if err != nil {
+		return err
+	}
+	if args := a.replacePolicyArgs(current); args != nil {
+		a.logger.Info("Inserting nftables allowlist policy rules",
+			zap.String("chain", a.nft.chainName),
+			zap.Int("replaced", len(current)))
+		if err := a.nft.executeCommand(ctx, args); err != nil {
+			return fmt.Errorf("failed to insert allowlist policy rules: %w", err)
+		}
+	}
+	return nil
+}
+
+// AddBlockRule adds the IP to the set of the given action so that the restricted clients may reach it
+func (a *NFTablesAllowlistManager) AddBlockRule(ctx context.Context, ip string, action db.BlockAction) error {
+	setName := a.actionSetName(action)
+	if a.dryRun {
+		a.logger.Info("DRY RUN: Would allow IP", zap.String("ip", ip), zap.String("set", setName))
+		return nil
+	}
+
+	err := a.nft.executeCommand(ctx, a.addElementArgs(setName, ip))
+	// setが存在しない(再起動、外部からのflush等)場合はポリシーを準備して再試行する
+	if err != nil && strings.Contains(err.Error(), "No such file or directory") {
+		if err := a.PreparePolicy(ctx); err != nil {
+			return err
+		}
+		err = a.nft.executeCommand(ctx, a.addElementArgs(setName, ip))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to add IP %s to nftables set %s: %w", ip, setName, err)
+	}
+
+	a.logger.Info("Successfully allowed IP", zap.String("ip", ip), zap.String("set", setName))
+	return nil
+}
+
+// RemoveBlockRule removes the IP from the sets containing it
+func (a *NFTablesAllowlistManager) RemoveBlockRule(ctx context.Context, ip string) error {
+	if a.dryRun {
+		a.logger.Info("DRY RUN: Would stop allowing IP", zap.String("ip", ip))
+		return nil
+	}
+
+	// 存在しない要素のdeleteはエラーになるため、含むsetのみから削除する
+	commands, err := a.removeArgs(ctx, ip)
+	if err != nil {
+		return err
+	}
+	if len(commands) == 0 {
+		a.logger.Warn("Allowed IP to remove was not found", zap.String("ip", ip))
+		return nil
+	}
+	for _, args := range commands {
+		if err := a.nft.executeCommand(ctx, args); err != nil {
+			return fmt.Errorf("failed to delete IP %s from nftables set: %w", ip, err)
+		}
+	}
+
+	a.logger.Info("Successfully stopped allowing IP", zap.String("ip", ip))
+	return nil
+}
+
+// ListBlockRules returns the allowed IPs in the sets of every action. Missing sets are reported as no IPs.
+// Listing is read-only and is performed even in dry run mode.
+func (a *NFTablesAllowlistManager) ListBlockRules(ctx context.Context) ([]repository.BlockRule, error) {
+	var rules []repository.BlockRule
+	for _, action := range blockActions {
+		setName := a.actionSetName(action)
+		output, err := a.nft.outputCommand(ctx, []string{"-j", "list", "set", a.nft.family, a.nft.tableName, setName})
+		if err != nil {
+			// setが存在しない(未使用のaction、再起動直後等)場合
+			if strings.Contains(err.Error(), "No such file or directory") {
+				continue
+			}
+			return nil, fmt.Errorf("failed to list nftables set %s: %w", setName, err)
+		}
+		ips, err := parseSetElements(output)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			rules = append(rules, repository.BlockRule{IP: ip, Action: action})
+		}
+	}
+	return rules, nil
+}
+
+// AddBlockRuleCommands returns the nft command that AddBlockRule executes for ip, in nft -f script syntax
+func (a *NFTablesAllowlistManager) AddBlockRuleCommands(ip string, action db.BlockAction) []string {
+	return []string{strings.Join(a.addElementArgs(a.actionSetName(action), ip), " ")}
+}
+
+// RemoveBlockRuleCommands returns the nft commands that RemoveBlockRule executes for ip, in nft -f script syntax
+func (a *NFTablesAllowlistManager) RemoveBlockRuleCommands(ctx context.Context, ip string) ([]string, error) {
+	commands, err := a.removeArgs(ctx, ip)
+	if err != nil {
+		return nil, err
+	}
+	scripts := make([]string, 0, len(commands))
+	for _, args := range commands {
+		scripts = append(scripts, strings.Join(args, " "))
+	}
+	return scripts, nil
+}
+
+// removeArgs returns the nft arguments deleting ip from the sets containing it
+func (a *NFTablesAllowlistManager) removeArgs(ctx context.Context, ip string) ([][]string, error) {
+	rules, err := a.ListBlockRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var commands [][]string
+	for _, rule := range rules {
+		if rule.IP == ip {
+			commands = append(commands, []string{"delete", "element", a.nft.family, a.nft.tableName, a.actionSetName(rule.Action), "{", ip, "}"})
+		}
+	}
+	return commands, nil
+}
+
+// actionSetName returns the name of the set holding the IPs allowed for domains with action
+func (a *NFTablesAllowlistManager) actionSetName(action db.BlockAction) string {
+	return a.setName + ipsetNameSuffixes[action]
+}
+
+// clientSetName returns the name of the set holding the restricted clients
+func (a *NFTablesAllowlistManager) clientSetName() string {
+	return a.setName + clientSetSuffix
+}
+
+// addElementArgs returns the nft arguments adding ip to the set. Adding an existing element succeeds.
+func (a *NFTablesAllowlistManager) addElementArgs(setName, ip string) []string {
+	return []string{"add", "element", a.nft.family, a.nft.tableName, setName, "{", ip, "}"}
+}
+
+// setArgs returns the nft arguments creating the sets of every action and the client set
+func (a *NFTablesAllowlistManager) setArgs() [][]string {
+	var commands [][]string
+	for _, action := range blockActions {
+		commands = append(commands, []string{"add", "set", a.nft.family, a.nft.tableName, a.actionSetName(action), "{", "type", "ipv4_addr", ";", "}"})
+	}
+	// クライアントはアドレス範囲(CIDR)でも指定できる
+	return append(commands, []string{"add", "set", a.nft.family, a.nft.tableName, a.clientSetName(), "{", "type", "ipv4_addr", ";", "flags", "interval", ";", "}"})
+}
+
+// clientArgs returns the nft arguments replacing the members of the client set with the configured clients
+func (a *NFTablesAllowlistManager) clientArgs() []string {
+	args := []string{"flush", "set", a.nft.family, a.nft.tableName, a.clientSetName()}
+	if len(a.clients) == 0 {
+		return args
+	}
+	args = append(args, ";", "add", "element", a.nft.family, a.nft.tableName, a.clientSetName(), "{")
+	args = append(args, strings.Join(a.clients, ", "))
+	return append(args, "}")
+}
+
+// policyComment returns the comment of the policy rules built from the current settings
+func (a *NFTablesAllowlistManager) policyComment() string {
+	return fmt.Sprintf("%s set=%s log=%d", policyRuleComment, a.setName, a.nft.logGroup)
+}
+
+// policyRuleArgs returns the nft arguments inserting the policy rules: the packets of the clients to the IPs
+// of every set are accepted and the other packets of the clients are dropped.
+// The rules are inserted in order, so the last one ends up first in the chain.
+func (a *NFTablesAllowlistManager) policyRuleArgs() [][]string {
+	comment := strconv.Quote(a.policyComment())
+	clients := "@" + a.clientSetName()
+
+	drop := []string{"insert", "rule", a.nft.family, a.nft.tableName, a.nft.chainName, "ip", "saddr", clients, "counter"}
+	if a.nft.logGroup > 0 {
+		drop = append(drop, "log", "prefix", strconv.Quote(blockLogPrefix), "group", strconv.Itoa(a.nft.logGroup))
+	}
+	drop = append(drop, "drop", "comment", comment)
+
+	commands := [][]string{drop}
+	for i := len(blockActions) - 1; i >= 0; i-- {
+		commands = append(commands, []string{
+			"insert", "rule", a.nft.family, a.nft.tableName, a.nft.chainName,
+			"ip", "saddr", clients, "ip", "daddr", "@" + a.actionSetName(blockActions[i]), "accept", "comment", comment,
+		})
+	}
+	return commands
+}
+
+// replacePolicyArgs returns the nft arguments replacing the current policy rules with the rules built from
+// the current settings as one transaction, or nil if the chain already has exactly those rules.
+// The new rules are inserted before the old ones are deleted, so the clients stay restricted throughout.
+func (a *NFTablesAllowlistManager) replacePolicyArgs(current []policyRule) []string {
+	rules := a.policyRuleArgs()
+	upToDate := len(current) == len(rules)
+	for _, rule := range current {
+		if rule.Comment != a.policyComment() {
+			upToDate = false
+		}
+	}
+	if upToDate {
+		return nil
+	}
+
+	var args []string
+	for _, rule := range rules {
+		if args != nil {
+			args = append(args, ";")
+		}
+		args = append(args, rule...)
+	}
+	for _, rule := range current {
+		args = append(args, ";", "delete", "rule", a.nft.family, a.nft.tableName, a.nft.chainName, "handle", strconv.FormatInt(rule.Handle, 10))
+	}
+	return args
+}
+
+// policyRule is a policy rule of the allowlist in the chain
+type policyRule struct {
+	Handle  int64
+	Comment string
+}
+
+// parsePolicyRules extracts the rules tagged with policyRuleComment from `nft -j -a list chain` output
+func parsePolicyRules(data []byte) ([]policyRule, error) {
+	var listing struct {
+		Nftables []struct {
+			Rule *struct {
+				Handle  int64  `json:"handle"`
+				Comment string `json:"comment"`
+			} `json:"rule"`
+		} `json:"nftables"`
+	}
+	if err := json.Unmarshal(data, &listing); err != nil {
+		return nil, fmt.Errorf("failed to parse nft JSON output: %w", err)
+	}
+
+	var rules []policyRule
+	for _, item := range listing.Nftables {
+		if item.Rule != nil && strings.HasPrefix(item.Rule.Comment, policyRuleComment) {
+			rules = append(rules, policyRule{Handle: item.Rule.Handle, Comment: item.Rule.Comment})
+		}
+	}
+	return rules, nil
+}
+
+// parseSetElements extracts the elements of the set from `nft -j list set` output
+func parseSetElements(data []byte) ([]string, error) {
+	var listing struct {
+		Nftables []struct {
+			Set *struct {
+				Elem []json.RawMessage `json:"elem"`
+			} `json:"set"`
+		} `json:"nftables"`
+	}
+	if err := json.Unmarshal(data, &listing); err != nil {
+		return nil, fmt.Errorf("failed to parse nft JSON output: %w", err)
+	}
+
+	var ips []string
+	for _, item := range listing.Nftables {
+		if item.Set == nil {
+			continue
+		}
+		for _, raw := range item.Set.Elem {
+			// counter、comment等を持つ要素は {"elem": {"val": ...}} の形式で出力される
+			var ip string
+			if err := json.Unmarshal(raw, &ip); err == nil {
+				ips = append(ips, ip)
+				continue
+			}
+			var elem struct {
+				Elem struct {
+					Val string `json:"val"`
+				} `json:"elem"`
+			}
+			if err := json.Unmarshal(raw, &elem); err == nil && elem.Elem.Val != "" {
+				ips = append(ips, elem.Elem.Val)
+			}
+		}
+	}
+	return ips, nil
+}
@@ -0,0 +1,137 @@
+package firewall
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"go.uber.org/zap"
+)
+
+func newTestAllowlistManager(logGroup int) *NFTablesAllowlistManager {
+	return NewNFTablesAllowlistManager(NFTablesManagerConfig{
+		Family:       "ip",
+		Table:        "filter",
+		Chain:        "forward",
+		LogGroup:     logGroup,
+		Policy:       PolicyAllowlist,
+		AllowSet:     "allow",
+		AllowClients: []string{"192.168.20.0/24", "192.168.1.30"},
+	}, zap.NewNop())
+}
+
+func Test_parseSetElements(t *testing.T) {
+	// Output of `nft -j list set ip filter allow`
+	output := `{"nftables": [
+  {"metainfo": {"version": "1.0.6", "release_name": "Lester Gooch #5", "json_schema_version": 1}},
+  {"set": {"family": "ip", "name": "allow", "table": "filter", "type": "ipv4_addr", "handle": 3,
+    "elem": ["192.0.2.1", {"elem": {"val": "192.0.2.2", "comment": "example.com"}}, "192.0.2.3"]}}
+]}`
+
+	ips, err := parseSetElements([]byte(output))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"}, ips)
+
+	// 要素のないsetにはelemが出力されない
+	ips, err = parseSetElements([]byte(`{"nftables": [{"set": {"family": "ip", "name": "allow", "table": "filter", "type": "ipv4_addr", "handle": 3}}]}`))
+	require.NoError(t, err)
+	assert.Empty(t, ips)
+
+	_, err = parseSetElements([]byte("not json"))
+	assert.Error(t, err)
+}
+
+func Test_parsePolicyRules(t *testing.T) {
+	output := `{"nftables": [
+  {"chain": {"family": "ip", "table": "filter", "name": "forward", "handle": 1, "type": "filter", "hook": "forward", "prio": 0, "policy": "accept"}},
+  {"rule": {"family": "ip", "table": "filter", "chain": "forward", "handle": 12, "comment": "router-manager allowlist set=allow log=0",
+    "expr": [{"match": {"op": "==", "left": {"payload": {"protocol": "ip", "field": "saddr"}}, "right": "@allow-clients"}}, {"drop": null}]}},
+  {"rule": {"family": "ip", "table": "filter", "chain": "forward", "handle": 7, "comment": "router-manager",
+    "expr": [{"match": {"op": "==", "left": {"payload": {"protocol": "ip", "field": "daddr"}}, "right": "192.0.2.1"}}, {"drop": null}]}},
+  {"rule": {"family": "ip", "table": "filter", "chain": "forward", "handle": 5,
+    "expr": [{"accept": null}]}}
+]}`
+
+	rules, err := parsePolicyRules([]byte(output))
+	require.NoError(t, err)
+	assert.Equal(t, []policyRule{{Handle: 12, Comment: "router-manager allowlist set=allow log=0"}}, rules)
+
+	// ポリシールールはブロックルールとして扱わない
+	managed, err := parseManagedRules([]byte(output))
+	require.NoError(t, err)
+	assert.Len(t, managed, 1)
+}
+
+func TestNFTablesAllowlistManager_AddBlockRuleCommands(t *testing.T) {
+	a := newTestAllowlistManager(0)
+
+	assert.Equal(t, []string{"add element ip filter allow { 192.0.2.1 }"}, a.AddBlockRuleCommands("192.0.2.1", db.BlockActionDrop))
+	assert.Equal(t, []string{"add element ip filter allow-reject { 192.0.2.1 }"}, a.AddBlockRuleCommands("192.0.2.1", db.BlockActionReject))
+}
+
+func TestNFTablesAllowlistManager_clientArgs(t *testing.T) {
+	a := newTestAllowlistManager(0)
+
+	assert.Equal(t,
+		"flush set ip filter allow-clients ; add element ip filter allow-clients { 192.168.20.0/24, 192.168.1.30 }",
+		strings.Join(a.clientArgs(), " "))
+}
+
+func TestNFTablesAllowlistManager_replacePolicyArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		logGroup int
+		current  []policyRule
+		want     string
+	}{
+		{
+			name: "no policy rules",
+			want: `insert rule ip filter forward ip saddr @allow-clients counter drop comment "router-manager allowlist set=allow log=0" ; ` +
+				`insert rule ip filter forward ip saddr @allow-clients ip daddr @allow-log accept comment "router-manager allowlist set=allow log=0" ; ` +
+				`insert rule ip filter forward ip saddr @allow-clients ip daddr @allow-reject accept comment "router-manager allowlist set=allow log=0" ; ` +
+				`insert rule ip filter forward ip saddr @allow-clients ip daddr @allow accept comment "router-manager allowlist set=allow log=0"`,
+		},
+		{
+			name: "up to date",
+			current: []policyRule{
+				{Handle: 4, Comment: "router-manager allowlist set=allow log=0"},
+				{Handle: 5, Comment: "router-manager allowlist set=allow log=0"},
+				{Handle: 6, Comment: "router-manager allowlist set=allow log=0"},
+				{Handle: 7, Comment: "router-manager allowlist set=allow log=0"},
+			},
+			want: "",
+		},
+		{
+			name:     "built from other settings",
+			logGroup: 5,
+			current: []policyRule{
+				{Handle: 4, Comment: "router-manager allowlist set=allow log=0"},
+				{Handle: 5, Comment: "router-manager allowlist set=allow log=0"},
+			},
+			want: `insert rule ip filter forward ip saddr @allow-clients counter log prefix "router-manager block: " group 5 drop comment "router-manager allowlist set=allow log=5" ; ` +
+				`insert rule ip filter forward ip saddr @allow-clients ip daddr @allow-log accept comment "router-manager allowlist set=allow log=5" ; ` +
+				`insert rule ip filter forward ip saddr @allow-clients ip daddr @allow-reject accept comment "router-manager allowlist set=allow log=5" ; ` +
+				`insert rule ip filter forward ip saddr @allow-clients ip daddr @allow accept comment "router-manager allowlist set=allow log=5" ; ` +
+				`delete rule ip filter forward handle 4 ; delete rule ip filter forward handle 5`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAllowlistManager(tt.logGroup)
+			assert.Equal(t, tt.want, strings.Join(a.replacePolicyArgs(tt.current), " "))
+		})
+	}
+}
+
+func TestNewManager_allowlistPolicy(t *testing.T) {
+	nftCfg := NFTablesManagerConfig{Policy: PolicyAllowlist, AllowSet: "allow"}
+
+	m, err := NewManager(BackendNFTables, nftCfg, IPTablesManagerConfig{}, zap.NewNop())
+	require.NoError(t, err)
+	assert.IsType(t, &NFTablesAllowlistManager{}, m)
+
+	_, err = NewManager(BackendIPTables, nftCfg, IPTablesManagerConfig{}, zap.NewNop())
+	assert.Error(t, err)
+}
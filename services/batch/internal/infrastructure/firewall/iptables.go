@@ -0,0 +1,304 @@
+package firewall
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
+	"go.uber.org/zap"
+)
+
+// IPTablesManager implements the FirewallManager interface for iptables with ipset.
+// Blocked IPs are stored in one hash:ip set per block action, each referenced by its own rules in the chain.
+
+// IPTablesManagerConfig contains iptables/ipset management configuration
+type IPTablesManagerConfig struct {
+	DryRun         bool
+	CommandTimeout time.Duration
+	Command        string // iptables command (iptables, iptables-legacy等)
+	Chain          string // filter table chain name
+	SetName        string // ipset set name. reject/logのsetには "-reject", "-log" が付与される
+	LogGroup       int    // 0以外の場合、ブロックしたパケットをこのNFLOG groupに送る
+}
+
+// ipsetNameSuffixes are appended to SetName for the sets of each block action
+var ipsetNameSuffixes = map[db.BlockAction]string{
+	db.BlockActionDrop:   "",
+	db.BlockActionReject: "-reject",
+	db.BlockActionLog:    "-log",
+}
+
+// blockActions lists the block actions in a stable order
+var blockActions = []db.BlockAction{db.BlockActionDrop, db.BlockActionReject, db.BlockActionLog}
+
+type IPTablesManager struct {
+	logger         *zap.Logger
+	dryRun         bool // For development environments
+	commandTimeout time.Duration
+	command        string
+	chainName      string
+	setName        string
+	logGroup       int
+
+	mu       sync.Mutex
+	prepared map[db.BlockAction]bool // setとルールの存在確認済みのaction。ipset/iptablesは再起動で消えるためプロセス毎に確認する
+}
+
+// NewIPTablesManager creates a new iptables/ipset manager implementation
+func NewIPTablesManager(cfg IPTablesManagerConfig, logger *zap.Logger) *IPTablesManager {
+	return &IPTablesManager{
+		logger:         logger,
+		dryRun:         cfg.DryRun,
+		commandTimeout: cfg.CommandTimeout,
+		command:        cfg.Command,
+		chainName:      cfg.Chain,
+		setName:        cfg.SetName,
+		logGroup:       cfg.LogGroup,
+		prepared:       make(map[db.BlockAction]bool),
+	}
+}
+
+// PreparePolicy does nothing: the set and the rules of each action are created when an IP is first added to it
+func (m *IPTablesManager) PreparePolicy(_ context.Context) error {
+	return nil
+}
+
+// AddBlockRule adds the IP to the set of the given action, creating the set and its rules if needed
+func (m *IPTablesManager) AddBlockRule(ctx context.Context, ip string, action db.BlockAction) error {
+	setName := m.actionSetName(action)
+	if m.dryRun {
+		m.logger.Info("DRY RUN: Would add IP to ipset", zap.String("ip", ip), zap.String("set", setName))
+		return nil
+	}
+
+	if err := m.ensureSetAndRules(ctx, action); err != nil {
+		return err
+	}
+
+	if _, err := m.executeCommand(ctx, "ipset", addArgs(setName, ip)); err != nil {
+		return fmt.Errorf("failed to add IP %s to ipset %s: %w", ip, setName, err)
+	}
+
+	m.logger.Info("Successfully added IP to ipset", zap.String("ip", ip), zap.String("set", setName))
+	return nil
+}
+
+// RemoveBlockRule removes the IP from the sets of every action
+func (m *IPTablesManager) RemoveBlockRule(ctx context.Context, ip string) error {
+	if m.dryRun {
+		m.logger.Info("DRY RUN: Would remove IP from ipset", zap.String("ip", ip), zap.String("set", m.setName))
+		return nil
+	}
+
+	for _, action := range blockActions {
+		setName := m.actionSetName(action)
+		if _, err := m.executeCommand(ctx, "ipset", delArgs(setName, ip)); err != nil {
+			// setが存在しない(未使用のaction、再起動直後等)場合もブロックされていないため処理を継続する
+			m.logger.Debug("Failed to remove IP from ipset (set may not exist)",
+				zap.String("ip", ip),
+				zap.String("set", setName),
+				zap.Error(err))
+		}
+	}
+
+	m.logger.Info("Successfully removed IP from ipset", zap.String("ip", ip), zap.String("set", m.setName))
+	return nil
+}
+
+// ListBlockRules returns the IPs in the sets of every action. Missing sets are reported as no blocked IPs.
+func (m *IPTablesManager) ListBlockRules(ctx context.Context) ([]repository.BlockRule, error) {
+	var rules []repository.BlockRule
+	for _, action := range blockActions {
+		setName := m.actionSetName(action)
+		output, err := m.executeCommand(ctx, "ipset", []string{"save", setName})
+		if err != nil {
+			if bytes.Contains(output, []byte("does not exist")) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to list ipset %s: %w", setName, err)
+		}
+		for _, entry := range parseIPSetSave(output, setName) {
+			rules = append(rules, repository.BlockRule{
+				IP:      entry.IP,
+				Action:  action,
+				Packets: entry.Packets,
+				Bytes:   entry.Bytes,
+			})
+		}
+	}
+	return rules, nil
+}
+
+// AddBlockRuleCommands returns the command that AddBlockRule executes for ip
+func (m *IPTablesManager) AddBlockRuleCommands(ip string, action db.BlockAction) []string {
+	return []string{"ipset " + strings.Join(addArgs(m.actionSetName(action), ip), " ")}
+}
+
+// RemoveBlockRuleCommands returns the commands that RemoveBlockRule executes for ip, limited to the sets containing it
+func (m *IPTablesManager) RemoveBlockRuleCommands(ctx context.Context, ip string) ([]string, error) {
+	rules, err := m.ListBlockRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var commands []string
+	for _, rule := range rules {
+		if rule.IP == ip {
+			commands = append(commands, "ipset "+strings.Join(delArgs(m.actionSetName(rule.Action), ip), " "))
+		}
+	}
+	return commands, nil
+}
+
+// actionSetName returns the name of the ipset holding the IPs blocked with action
+func (m *IPTablesManager) actionSetName(action db.BlockAction) string {
+	return m.setName + ipsetNameSuffixes[action]
+}
+
+// addArgs returns the ipset arguments adding ip to the set
+func addArgs(setName, ip string) []string {
+	return []string{"add", setName, ip, "-exist"}
+}
+
+// delArgs returns the ipset arguments deleting ip from the set
+func delArgs(setName, ip string) []string {
+	return []string{"del", setName, ip, "-exist"}
+}
+
+// ruleSpecs returns the iptables rules matching the set of action, in chain order
+func (m *IPTablesManager) ruleSpecs(action db.BlockAction) [][]string {
+	rule := func(match []string, target ...string) []string {
+		spec := append([]string{m.chainName}, match...)
+		spec = append(spec,
+			"-m", "set", "--match-set", m.actionSetName(action), "dst",
+			"-m", "comment", "--comment", managedRuleComment,
+			"-j")
+		return append(spec, target...)
+	}
+
+	var specs [][]string
+	if m.logGroup > 0 {
+		// NFLOGは終端しないため、後続のルールでブロックされる
+		specs = append(specs, rule(nil, "NFLOG", "--nflog-group", strconv.Itoa(m.logGroup), "--nflog-prefix", blockLogPrefix))
+	}
+
+	switch action {
+	case db.BlockActionReject:
+		// TCPはRSTで即座に切断し、それ以外はICMP admin-prohibitedを返す
+		return append(specs,
+			rule([]string{"-p", "tcp"}, "REJECT", "--reject-with", "tcp-reset"),
+			rule(nil, "REJECT", "--reject-with", "icmp-admin-prohibited"),
+		)
+	case db.BlockActionLog:
+		return append(specs,
+			rule(nil, "LOG", "--log-prefix", blockLogPrefix),
+			rule(nil, "DROP"),
+		)
+	default:
+		return append(specs, rule(nil, "DROP"))
+	}
+}
+
+// ensureSetAndRules creates the ipset of action and inserts its rules at the beginning of the chain if missing
+func (m *IPTablesManager) ensureSetAndRules(ctx context.Context, action db.BlockAction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.prepared[action] {
+		return nil
+	}
+
+	setName := m.actionSetName(action)
+	// countersを付けるとエントリ毎のpackets/bytesがipset saveに出力される
+	output, err := m.executeCommand(ctx, "ipset", []string{"create", setName, "hash:ip", "family", "inet", "counters", "-exist"})
+	if err != nil {
+		if !bytes.Contains(output, []byte("already exists")) {
+			return fmt.Errorf("failed to create ipset %s: %w", setName, err)
+		}
+		// counters導入前に作成されたsetは再起動で作り直されるまでhit数が0のまま
+		m.logger.Warn("ipset exists without counters; block hits are not counted until it is recreated",
+			zap.String("set", setName))
+	}
+
+	// -Iは先頭に挿入するため、chain内の順序を保つよう逆順に挿入する
+	specs := m.ruleSpecs(action)
+	for i := len(specs) - 1; i >= 0; i-- {
+		// -C: ルールが存在しない場合は非0で終了
+		if _, err := m.executeCommand(ctx, m.command, append([]string{"-C"}, specs[i]...)); err == nil {
+			continue
+		}
+		m.logger.Info("Inserting iptables rule for ipset", zap.String("chain", m.chainName), zap.String("set", setName))
+		if _, err := m.executeCommand(ctx, m.command, append([]string{"-I"}, specs[i]...)); err != nil {
+			return fmt.Errorf("failed to insert iptables rule for ipset %s: %w", setName, err)
+		}
+	}
+
+	m.prepared[action] = true
+	return nil
+}
+
+// executeCommand executes an iptables/ipset command and returns its combined output
+func (m *IPTablesManager) executeCommand(ctx context.Context, name string, args []string) ([]byte, error) {
+	m.logger.Debug("Executing command", zap.String("command", name), zap.Strings("args", args))
+
+	if m.commandTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.commandTimeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, name, args...) //nolint:gosec // G204: command and args are internally generated (config values and DNS results), not external input
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		m.logger.Debug("Command failed",
+			zap.String("command", name),
+			zap.Strings("args", args),
+			zap.String("output", string(output)),
+			zap.Error(err))
+		return output, fmt.Errorf("%s command failed: %s: %w", name, strings.TrimSpace(string(output)), err)
+	}
+
+	return output, nil
+}
+
+// ipsetEntry is a member of an ipset with its counters (zero for sets created without counters)
+type ipsetEntry struct {
+	IP      string
+	Packets int64
+	Bytes   int64
+}
+
+// parseIPSetSave extracts the members of setName from `ipset save` output
+func parseIPSetSave(data []byte, setName string) []ipsetEntry {
+	var entries []ipsetEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		// add <set> <ip> [packets N bytes M]
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[0] != "add" || fields[1] != setName {
+			continue
+		}
+		entry := ipsetEntry{IP: fields[2]}
+		for i := 3; i+1 < len(fields); i += 2 {
+			value, err := strconv.ParseInt(fields[i+1], 10, 64)
+			if err != nil {
+				continue
+			}
+			switch fields[i] {
+			case "packets":
+				entry.Packets = value
+			case "bytes":
+				entry.Bytes = value
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
@@ -0,0 +1,49 @@
+package firewall
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"go.uber.org/zap"
+)
+
+func Test_parseIPSetSave(t *testing.T) {
+	output := `create router-manager-blocked hash:ip family inet hashsize 1024 maxelem 65536 counters
+add router-manager-blocked 192.0.2.1 packets 12 bytes 720
+add router-manager-blocked 192.0.2.2 packets 0 bytes 0
+add other-set 198.51.100.1 packets 5 bytes 300
+`
+	assert.Equal(t, []ipsetEntry{
+		{IP: "192.0.2.1", Packets: 12, Bytes: 720},
+		{IP: "192.0.2.2"},
+	}, parseIPSetSave([]byte(output), "router-manager-blocked"))
+	// counters無しで作成されたset
+	assert.Equal(t, []ipsetEntry{{IP: "192.0.2.1"}},
+		parseIPSetSave([]byte("add router-manager-blocked 192.0.2.1\n"), "router-manager-blocked"))
+	assert.Empty(t, parseIPSetSave([]byte("create router-manager-blocked hash:ip\n"), "router-manager-blocked"))
+}
+
+func TestIPTablesManager_ruleSpecs(t *testing.T) {
+	m := NewIPTablesManager(IPTablesManagerConfig{Command: "iptables", Chain: "FORWARD", SetName: "blocked"}, zap.NewNop())
+
+	assert.Equal(t, [][]string{
+		{"FORWARD", "-m", "set", "--match-set", "blocked", "dst", "-m", "comment", "--comment", "router-manager", "-j", "DROP"},
+	}, m.ruleSpecs(db.BlockActionDrop))
+	assert.Equal(t, [][]string{
+		{"FORWARD", "-p", "tcp", "-m", "set", "--match-set", "blocked-reject", "dst", "-m", "comment", "--comment", "router-manager", "-j", "REJECT", "--reject-with", "tcp-reset"},
+		{"FORWARD", "-m", "set", "--match-set", "blocked-reject", "dst", "-m", "comment", "--comment", "router-manager", "-j", "REJECT", "--reject-with", "icmp-admin-prohibited"},
+	}, m.ruleSpecs(db.BlockActionReject))
+	assert.Equal(t, [][]string{
+		{"FORWARD", "-m", "set", "--match-set", "blocked-log", "dst", "-m", "comment", "--comment", "router-manager", "-j", "LOG", "--log-prefix", "router-manager block: "},
+		{"FORWARD", "-m", "set", "--match-set", "blocked-log", "dst", "-m", "comment", "--comment", "router-manager", "-j", "DROP"},
+	}, m.ruleSpecs(db.BlockActionLog))
+
+	logged := NewIPTablesManager(IPTablesManagerConfig{Command: "iptables", Chain: "FORWARD", SetName: "blocked", LogGroup: 5}, zap.NewNop())
+	assert.Equal(t, [][]string{
+		{"FORWARD", "-m", "set", "--match-set", "blocked", "dst", "-m", "comment", "--comment", "router-manager", "-j", "NFLOG", "--nflog-group", "5", "--nflog-prefix", "router-manager block: "},
+		{"FORWARD", "-m", "set", "--match-set", "blocked", "dst", "-m", "comment", "--comment", "router-manager", "-j", "DROP"},
+	}, logged.ruleSpecs(db.BlockActionDrop))
+
+	assert.Equal(t, []string{"ipset add blocked-log 192.0.2.1 -exist"}, m.AddBlockRuleCommands("192.0.2.1", db.BlockActionLog))
+}
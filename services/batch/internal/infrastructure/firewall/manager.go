@@ -0,0 +1,57 @@
+package firewall
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
+	"go.uber.org/zap"
+)
+
+// Firewall backends selectable through FIREWALL_BACKEND
+const (
+	BackendNFTables = "nftables"
+	BackendIPTables = "iptables"
+)
+
+// Firewall policies selectable through FIREWALL_POLICY
+const (
+	PolicyBlocklist = "blocklist" // ドメインのIPをブロックする
+	PolicyAllowlist = "allowlist" // 対象クライアントにはドメインのIP以外への通信をブロックする(nftablesのみ)
+)
+
+// managedRuleComment tags the firewall rules created by this service so that they can be
+// listed for reconciliation without touching rules managed by others
+const managedRuleComment = "router-manager"
+
+// blockLogPrefix is prepended to kernel log messages of IPs blocked with the log action
+const blockLogPrefix = "router-manager block: "
+
+// Manager is implemented by every firewall backend
+type Manager interface {
+	PreparePolicy(ctx context.Context) error
+	AddBlockRule(ctx context.Context, ip string, action db.BlockAction) error
+	RemoveBlockRule(ctx context.Context, ip string) error
+	ListBlockRules(ctx context.Context) ([]repository.BlockRule, error)
+	AddBlockRuleCommands(ip string, action db.BlockAction) []string
+	RemoveBlockRuleCommands(ctx context.Context, ip string) ([]string, error)
+}
+
+// NewManager creates the firewall manager of the given backend
+func NewManager(backend string, nftCfg NFTablesManagerConfig, iptCfg IPTablesManagerConfig, logger *zap.Logger) (Manager, error) {
+	switch backend {
+	case BackendNFTables:
+		if nftCfg.Policy == PolicyAllowlist {
+			return NewNFTablesAllowlistManager(nftCfg, logger), nil
+		}
+		return NewNFTablesManager(nftCfg, logger), nil
+	case BackendIPTables:
+		if nftCfg.Policy == PolicyAllowlist {
+			return nil, fmt.Errorf("firewall policy %s is not supported by the %s backend", PolicyAllowlist, BackendIPTables)
+		}
+		return NewIPTablesManager(iptCfg, logger), nil
+	default:
+		return nil, fmt.Errorf("unknown firewall backend: %q (must be %s or %s)", backend, BackendNFTables, BackendIPTables)
+	}
+}
@@ -0,0 +1,202 @@
+package firewall
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
+	"go.uber.org/zap"
+)
+
+// NFLogListener receives the packets sent to an NFLOG group by the managed rules (LogGroup)
+// and reports those logged with blockLogPrefix.
+// It implements repository.BlockedPacketListener; Listen is only supported on Linux.
+type NFLogListener struct {
+	logger *zap.Logger
+	group  uint16
+}
+
+// NewNFLogListener creates a listener of the given NFLOG group
+func NewNFLogListener(group int, logger *zap.Logger) *NFLogListener {
+	return &NFLogListener{
+		logger: logger,
+		group:  uint16(group), //nolint:gosec // G115: the group is validated to fit in uint16 by the config
+	}
+}
+
+// netlink/nfnetlink_log constants (linux/netlink.h, linux/netfilter/nfnetlink_log.h)
+const (
+	netlinkNetfilter = 12 // NETLINK_NETFILTER
+
+	nlmsgHeaderLen  = 16
+	nfgenmsgLen     = 4
+	nlattrHeaderLen = 4
+
+	nlmsgError  = 2 // NLMSG_ERROR
+	nlmFRequest = 0x1
+	nlmFAck     = 0x4
+
+	nfnlSubsysULog   = 4
+	nfulnlMsgPacket  = nfnlSubsysULog<<8 | 0
+	nfulnlMsgConfig  = nfnlSubsysULog<<8 | 1
+	nfulaCfgCmd      = 1
+	nfulaCfgMode     = 2
+	nfulnlCfgCmdBind = 1
+	nfulnlCopyPacket = 2
+
+	nfulaTimestamp = 3
+	nfulaPayload   = 9
+	nfulaPrefix    = 10
+
+	nlaTypeMask = 0x3fff // NLA_F_NESTED, NLA_F_NET_BYTEORDERを除く
+
+	// IPv6ヘッダ(40バイト)が収まれば送信元・宛先を取得できる
+	nflogCopyRange = 64
+)
+
+// nflogConfigMessages returns the requests binding the socket to group and asking for packet headers
+func nflogConfigMessages(group uint16) [][]byte {
+	bind := []byte{nfulnlCfgCmdBind}
+
+	mode := make([]byte, 6)
+	binary.BigEndian.PutUint32(mode, nflogCopyRange)
+	mode[4] = nfulnlCopyPacket
+
+	return [][]byte{
+		nfnlRequest(nfulnlMsgConfig, group, 1, nfulaCfgCmd, bind),
+		nfnlRequest(nfulnlMsgConfig, group, 2, nfulaCfgMode, mode),
+	}
+}
+
+// nfnlRequest encodes an nfnetlink request with a single attribute, asking for an acknowledgement
+func nfnlRequest(msgType, resID uint16, seq uint32, attrType uint16, value []byte) []byte {
+	attrLen := nlattrHeaderLen + len(value)
+	total := nlmsgHeaderLen + nfgenmsgLen + nlAlign(attrLen)
+	msg := make([]byte, total)
+
+	binary.NativeEndian.PutUint32(msg[0:], uint32(total)) //nolint:gosec // G115: small fixed size
+	binary.NativeEndian.PutUint16(msg[4:], msgType)
+	binary.NativeEndian.PutUint16(msg[6:], nlmFRequest|nlmFAck)
+	binary.NativeEndian.PutUint32(msg[8:], seq)
+
+	// nfgenmsg: family AF_UNSPEC, version NFNETLINK_V0, res_id(group)はbig endian
+	binary.BigEndian.PutUint16(msg[nlmsgHeaderLen+2:], resID)
+
+	attr := msg[nlmsgHeaderLen+nfgenmsgLen:]
+	binary.NativeEndian.PutUint16(attr[0:], uint16(attrLen)) //nolint:gosec // G115: small fixed size
+	binary.NativeEndian.PutUint16(attr[2:], attrType)
+	copy(attr[nlattrHeaderLen:], value)
+	return msg
+}
+
+// nlAlign rounds n up to the netlink alignment of 4 bytes
+func nlAlign(n int) int {
+	return (n + 3) &^ 3
+}
+
+// netlinkMessage is a netlink message split into its type and payload
+type netlinkMessage struct {
+	Type uint16
+	Data []byte // nlmsghdrを除いた部分
+}
+
+// splitNetlinkMessages splits a datagram received from a netlink socket into messages
+func splitNetlinkMessages(data []byte) ([]netlinkMessage, error) {
+	var messages []netlinkMessage
+	for len(data) >= nlmsgHeaderLen {
+		length := int(binary.NativeEndian.Uint32(data[0:]))
+		if length < nlmsgHeaderLen || length > len(data) {
+			return nil, fmt.Errorf("invalid netlink message length: %d", length)
+		}
+		messages = append(messages, netlinkMessage{
+			Type: binary.NativeEndian.Uint16(data[4:]),
+			Data: data[nlmsgHeaderLen:length],
+		})
+		data = data[min(nlAlign(length), len(data)):]
+	}
+	return messages, nil
+}
+
+// netlinkAckError returns the error reported by an NLMSG_ERROR message, or nil for an acknowledgement
+func netlinkAckError(msg netlinkMessage) error {
+	if msg.Type != nlmsgError {
+		return nil
+	}
+	if len(msg.Data) < 4 {
+		return errors.New("truncated netlink error message")
+	}
+	if code := int32(binary.NativeEndian.Uint32(msg.Data)); code != 0 { //nolint:gosec // G115: errno is a signed int32
+		return errnoError(-code)
+	}
+	return nil
+}
+
+// parseNFLogPacket extracts a blocked packet from an NFULNL_MSG_PACKET message.
+// ok is false for packets logged by other rules (different prefix) or without an IP header.
+func parseNFLogPacket(msg netlinkMessage, now time.Time) (packet repository.BlockedPacket, ok bool) {
+	if msg.Type != nfulnlMsgPacket || len(msg.Data) < nfgenmsgLen {
+		return packet, false
+	}
+
+	var prefix string
+	var payload []byte
+	packet.Time = now
+	attrs := msg.Data[nfgenmsgLen:]
+	for len(attrs) >= nlattrHeaderLen {
+		length := int(binary.NativeEndian.Uint16(attrs[0:]))
+		if length < nlattrHeaderLen || length > len(attrs) {
+			break
+		}
+		value := attrs[nlattrHeaderLen:length]
+		switch binary.NativeEndian.Uint16(attrs[2:]) & nlaTypeMask {
+		case nfulaPrefix:
+			prefix = strings.TrimRight(string(value), "\x00")
+		case nfulaPayload:
+			payload = value
+		case nfulaTimestamp:
+			// struct nfulnl_msg_packet_timestamp { __be64 sec; __be64 usec; }
+			if len(value) >= 16 {
+				sec := int64(binary.BigEndian.Uint64(value[0:]))  //nolint:gosec // G115: kernel timestamp
+				usec := int64(binary.BigEndian.Uint64(value[8:])) //nolint:gosec // G115: kernel timestamp
+				packet.Time = time.Unix(sec, usec*int64(time.Microsecond))
+			}
+		}
+		attrs = attrs[min(nlAlign(length), len(attrs)):]
+	}
+
+	if prefix != blockLogPrefix {
+		return packet, false
+	}
+	src, dst, ok := parseIPAddresses(payload)
+	if !ok {
+		return packet, false
+	}
+	packet.SrcIP = src.String()
+	packet.DstIP = dst.String()
+	return packet, true
+}
+
+// parseIPAddresses returns the source and destination addresses of an IPv4 or IPv6 packet
+func parseIPAddresses(packet []byte) (src, dst netip.Addr, ok bool) {
+	if len(packet) == 0 {
+		return src, dst, false
+	}
+	switch packet[0] >> 4 {
+	case 4:
+		if len(packet) < 20 {
+			return src, dst, false
+		}
+		return netip.AddrFrom4([4]byte(packet[12:16])), netip.AddrFrom4([4]byte(packet[16:20])), true
+	case 6:
+		if len(packet) < 40 {
+			return src, dst, false
+		}
+		return netip.AddrFrom16([16]byte(packet[8:24])), netip.AddrFrom16([16]byte(packet[24:40])), true
+	default:
+		return src, dst, false
+	}
+}
@@ -0,0 +1,100 @@
+//go:build linux
+
+package firewall
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+	"time"
+
+	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
+	"go.uber.org/zap"
+)
+
+// nflogReceiveTimeout bounds each receive so that cancellation of the context is noticed
+const nflogReceiveTimeout = time.Second
+
+// errnoError converts a netlink error code into a syscall error
+func errnoError(code int32) error {
+	return syscall.Errno(code)
+}
+
+// Listen binds to the NFLOG group and calls handle for each packet logged by the managed rules
+// until ctx is cancelled. Binding requires CAP_NET_ADMIN and fails if another process uses the group.
+func (l *NFLogListener) Listen(ctx context.Context, handle func(repository.BlockedPacket)) error {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, netlinkNetfilter)
+	if err != nil {
+		return fmt.Errorf("failed to open netfilter netlink socket: %w", err)
+	}
+	defer syscall.Close(fd) //nolint:errcheck // nothing to do on close failure
+
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return fmt.Errorf("failed to bind netlink socket: %w", err)
+	}
+	timeout := syscall.NsecToTimeval(nflogReceiveTimeout.Nanoseconds())
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &timeout); err != nil {
+		return fmt.Errorf("failed to set netlink receive timeout: %w", err)
+	}
+
+	buf := make([]byte, 64*1024)
+	for _, request := range nflogConfigMessages(l.group) {
+		if err := syscall.Sendto(fd, request, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+			return fmt.Errorf("failed to configure NFLOG group %d: %w", l.group, err)
+		}
+		if err := receiveAck(fd, buf); err != nil {
+			return fmt.Errorf("failed to configure NFLOG group %d: %w", l.group, err)
+		}
+	}
+	l.logger.Info("Listening for blocked packets", zap.Uint16("nflog_group", l.group))
+
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			switch {
+			case errors.Is(err, syscall.EAGAIN), errors.Is(err, syscall.EINTR):
+				continue
+			case errors.Is(err, syscall.ENOBUFS):
+				// 受信が追いつかずカーネル側でパケットが破棄された
+				l.logger.Warn("NFLOG receive buffer overrun; some blocked packets were not recorded")
+				continue
+			default:
+				return fmt.Errorf("failed to receive NFLOG packets: %w", err)
+			}
+		}
+
+		messages, err := splitNetlinkMessages(buf[:n])
+		if err != nil {
+			l.logger.Warn("Failed to parse NFLOG message", zap.Error(err))
+			continue
+		}
+		now := time.Now()
+		for _, msg := range messages {
+			if packet, ok := parseNFLogPacket(msg, now); ok {
+				handle(packet)
+			}
+		}
+	}
+}
+
+// receiveAck waits for the acknowledgement of the last request
+func receiveAck(fd int, buf []byte) error {
+	n, _, err := syscall.Recvfrom(fd, buf, 0)
+	if err != nil {
+		return err
+	}
+	messages, err := splitNetlinkMessages(buf[:n])
+	if err != nil {
+		return err
+	}
+	for _, msg := range messages {
+		if err := netlinkAckError(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package firewall
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
+)
+
+// errnoError converts a netlink error code into an error
+func errnoError(code int32) error {
+	return fmt.Errorf("netlink error %d", code)
+}
+
+// Listen is not supported outside Linux
+func (l *NFLogListener) Listen(_ context.Context, _ func(repository.BlockedPacket)) error {
+	return errors.New("NFLOG is only supported on Linux")
+}
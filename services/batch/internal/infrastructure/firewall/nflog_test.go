@@ -0,0 +1,111 @@
+package firewall
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// nflogPacketMessage encodes an NFULNL_MSG_PACKET message as received from the kernel
+func nflogPacketMessage(prefix string, payload []byte, sec int64) []byte {
+	var attrs []byte
+	attr := func(attrType uint16, value []byte) {
+		header := make([]byte, nlattrHeaderLen)
+		binary.NativeEndian.PutUint16(header[0:], uint16(nlattrHeaderLen+len(value)))
+		binary.NativeEndian.PutUint16(header[2:], attrType)
+		a := append(header, value...)
+		attrs = append(attrs, a...)
+		attrs = append(attrs, make([]byte, nlAlign(len(a))-len(a))...)
+	}
+	attr(nfulaPrefix, append([]byte(prefix), 0))
+	if sec != 0 {
+		ts := make([]byte, 16)
+		binary.BigEndian.PutUint64(ts[0:], uint64(sec))
+		binary.BigEndian.PutUint64(ts[8:], 500000)
+		attr(nfulaTimestamp, ts)
+	}
+	attr(nfulaPayload, payload)
+
+	msg := make([]byte, nlmsgHeaderLen+nfgenmsgLen, nlmsgHeaderLen+nfgenmsgLen+len(attrs))
+	msg = append(msg, attrs...)
+	binary.NativeEndian.PutUint32(msg[0:], uint32(len(msg)))
+	binary.NativeEndian.PutUint16(msg[4:], nfulnlMsgPacket)
+	msg[nlmsgHeaderLen] = 2 // AF_INET
+	return msg
+}
+
+// ipv4Header returns the first 20 bytes of an IPv4 packet from src to dst
+func ipv4Header(src, dst [4]byte) []byte {
+	header := make([]byte, 20)
+	header[0] = 0x45
+	copy(header[12:], src[:])
+	copy(header[16:], dst[:])
+	return header
+}
+
+func Test_parseNFLogPacket(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var ipv6 [40]byte
+	ipv6[0] = 0x60
+	ipv6[8], ipv6[9], ipv6[23] = 0xfd, 0x00, 0x10                   // fd00::10
+	ipv6[24], ipv6[25], ipv6[26], ipv6[27] = 0x20, 0x01, 0x0d, 0xb8 // 2001:db8::1
+	ipv6[39] = 0x01
+
+	data := append(nflogPacketMessage(blockLogPrefix, ipv4Header([4]byte{192, 168, 1, 10}, [4]byte{192, 0, 2, 1}), 1767225600),
+		nflogPacketMessage("other rule: ", ipv4Header([4]byte{192, 168, 1, 11}, [4]byte{192, 0, 2, 2}), 0)...)
+	data = append(data, nflogPacketMessage(blockLogPrefix, ipv6[:], 0)...)
+	data = append(data, nflogPacketMessage(blockLogPrefix, []byte{0x45, 0x00}, 0)...)
+
+	messages, err := splitNetlinkMessages(data)
+	require.NoError(t, err)
+	require.Len(t, messages, 4)
+
+	packet, ok := parseNFLogPacket(messages[0], now)
+	require.True(t, ok)
+	assert.Equal(t, "192.168.1.10", packet.SrcIP)
+	assert.Equal(t, "192.0.2.1", packet.DstIP)
+	assert.Equal(t, time.Unix(1767225600, 500000*int64(time.Microsecond)), packet.Time)
+
+	// 他のルールがlogしたパケットは対象外
+	_, ok = parseNFLogPacket(messages[1], now)
+	assert.False(t, ok)
+
+	packet, ok = parseNFLogPacket(messages[2], now)
+	require.True(t, ok)
+	assert.Equal(t, "fd00::10", packet.SrcIP)
+	assert.Equal(t, "2001:db8::1", packet.DstIP)
+	assert.Equal(t, now, packet.Time)
+
+	// 切り詰められたIPヘッダ
+	_, ok = parseNFLogPacket(messages[3], now)
+	assert.False(t, ok)
+
+	_, err = splitNetlinkMessages([]byte{0xff, 0xff, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	assert.Error(t, err)
+}
+
+func Test_nflogConfigMessages(t *testing.T) {
+	messages := nflogConfigMessages(5)
+	require.Len(t, messages, 2)
+
+	bind, err := splitNetlinkMessages(messages[0])
+	require.NoError(t, err)
+	require.Len(t, bind, 1)
+	assert.Equal(t, uint16(nfulnlMsgConfig), bind[0].Type)
+	assert.Equal(t, uint16(5), binary.BigEndian.Uint16(bind[0].Data[2:]))
+	assert.Equal(t, uint16(nfulaCfgCmd), binary.NativeEndian.Uint16(bind[0].Data[nfgenmsgLen+2:]))
+	assert.Equal(t, byte(nfulnlCfgCmdBind), bind[0].Data[nfgenmsgLen+nlattrHeaderLen])
+}
+
+func Test_netlinkAckError(t *testing.T) {
+	ack := make([]byte, 4)
+	assert.NoError(t, netlinkAckError(netlinkMessage{Type: nlmsgError, Data: ack}))
+
+	busy := make([]byte, 4)
+	binary.NativeEndian.PutUint32(busy, uint32(0xfffffff0)) // -EBUSY
+	assert.Error(t, netlinkAckError(netlinkMessage{Type: nlmsgError, Data: busy}))
+}
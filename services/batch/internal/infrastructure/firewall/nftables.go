@@ -2,10 +2,15 @@ package firewall
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os/exec"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
 	"go.uber.org/zap"
 )
 
@@ -18,6 +23,12 @@ type NFTablesManagerConfig struct {
 	Family         string // nftables address family (ip, ip6, inet, etc.)
 	Table          string // nftables table name
 	Chain          string // nftables chain name
+	LogGroup       int    // 0以外の場合、ブロックしたパケットをこのNFLOG groupに送る
+	Policy         string // PolicyBlocklist or PolicyAllowlist
+	// AllowSet is the name of the sets of allowed IPs in the allowlist policy.
+	// The sets of the reject and log actions and of the clients get "-reject", "-log" and "-clients" appended.
+	AllowSet     string
+	AllowClients []string // allowlist policyで制限するクライアントのIPまたはCIDR
 }
 
 type NFTablesManager struct {
@@ -26,6 +37,16 @@ type NFTablesManager struct {
 	family    string // nftables address family
 	tableName string // nftables table name
 	chainName string // nftables chain name
+	logGroup  int    // NFLOG group (0: disabled)
+}
+
+// nftRule is a rule created by this service, identified by its handle
+type nftRule struct {
+	Handle  int64
+	IP      string
+	Action  db.BlockAction
+	Packets int64
+	Bytes   int64
 }
 
 // NewNFTablesManager creates a new nftables manager implementation
@@ -36,17 +57,23 @@ func NewNFTablesManager(cfg NFTablesManagerConfig, logger *zap.Logger) *NFTables
 		family:    cfg.Family,
 		tableName: cfg.Table,
 		chainName: cfg.Chain,
+		logGroup:  cfg.LogGroup,
 	}
 }
 
-// AddBlockRule adds a blocking rule for the specified IP
-func (n *NFTablesManager) AddBlockRule(ctx context.Context, ip string) error {
+// PreparePolicy does nothing: the blocking rules of each IP need no other rules
+func (n *NFTablesManager) PreparePolicy(_ context.Context) error {
+	return nil
+}
+
+// AddBlockRule adds the blocking rules for the specified IP with the given action
+func (n *NFTablesManager) AddBlockRule(ctx context.Context, ip string, action db.BlockAction) error {
 	if n.dryRun {
-		n.logger.Info("DRY RUN: Would add nftables rule", zap.String("ip", ip))
+		n.logger.Info("DRY RUN: Would add nftables rule", zap.String("ip", ip), zap.String("action", string(action)))
 		return nil
 	}
 
-	n.logger.Info("Adding nftables rule", zap.String("ip", ip))
+	n.logger.Info("Adding nftables rule", zap.String("ip", ip), zap.String("action", string(action)))
 
 	// Check if table and chain exist (do not create)
 	if err := n.ensureTableAndChainExist(ctx); err != nil {
@@ -55,16 +82,17 @@ func (n *NFTablesManager) AddBlockRule(ctx context.Context, ip string) error {
 
 	// Insert the blocking rule at the beginning of the chain for higher priority
 	// Using "insert" instead of "add" to place the rule at the beginning
-	args := []string{"insert", "rule", n.family, n.tableName, n.chainName, "ip", "daddr", ip, "drop"}
-	if err := n.executeCommand(ctx, args); err != nil {
-		return fmt.Errorf("failed to insert blocking rule for IP %s: %w", ip, err)
+	for _, args := range n.addRuleArgs(ip, action) {
+		if err := n.executeCommand(ctx, args); err != nil {
+			return fmt.Errorf("failed to insert blocking rule for IP %s: %w", ip, err)
+		}
 	}
 
 	n.logger.Info("Successfully inserted nftables rule at the beginning of chain", zap.String("ip", ip))
 	return nil
 }
 
-// RemoveBlockRule removes a blocking rule for the specified IP
+// RemoveBlockRule removes the blocking rules for the specified IP
 func (n *NFTablesManager) RemoveBlockRule(ctx context.Context, ip string) error {
 	if n.dryRun {
 		n.logger.Info("DRY RUN: Would remove nftables rule", zap.String("ip", ip))
@@ -73,22 +101,203 @@ func (n *NFTablesManager) RemoveBlockRule(ctx context.Context, ip string) error
 
 	n.logger.Info("Removing nftables rule", zap.String("ip", ip))
 
-	// Delete the specific rule (nftables will find and remove the matching rule)
-	args := []string{"delete", "rule", n.family, n.tableName, n.chainName, "ip", "daddr", ip, "drop"}
-	if err := n.executeCommand(ctx, args); err != nil {
-		// If the rule doesn't exist, nftables will return an error, but we can log and continue
-		n.logger.Warn("Failed to remove nftables rule (may not exist)",
-			zap.String("ip", ip),
-			zap.Error(err))
-		return nil // Don't return error to continue processing other IPs
+	// nftablesのルール削除にはhandleが必要なため、管理対象ルールから該当IPのhandleを探す
+	rules, err := n.listManagedRules(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list nftables rules: %w", err)
 	}
 
-	n.logger.Info("Successfully removed nftables rule", zap.String("ip", ip))
+	removed := 0
+	for _, rule := range rules {
+		if rule.IP != ip {
+			continue
+		}
+		if err := n.executeCommand(ctx, n.removeRuleArgs(rule.Handle)); err != nil {
+			return fmt.Errorf("failed to delete blocking rule for IP %s: %w", ip, err)
+		}
+		removed++
+	}
+
+	if removed == 0 {
+		n.logger.Warn("nftables rule to remove was not found", zap.String("ip", ip))
+		return nil
+	}
+
+	n.logger.Info("Successfully removed nftables rule", zap.String("ip", ip), zap.Int("rules", removed))
 	return nil
 }
 
+// ListBlockRules returns the rules created by this service.
+// Listing is read-only and is performed even in dry run mode.
+func (n *NFTablesManager) ListBlockRules(ctx context.Context) ([]repository.BlockRule, error) {
+	rules, err := n.listManagedRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	blockRules := make([]repository.BlockRule, 0, len(rules))
+	for _, rule := range rules {
+		blockRules = append(blockRules, repository.BlockRule{
+			IP:      rule.IP,
+			Action:  rule.Action,
+			Packets: rule.Packets,
+			Bytes:   rule.Bytes,
+		})
+	}
+	return blockRules, nil
+}
+
+// AddBlockRuleCommands returns the nft commands that AddBlockRule executes for ip, in nft -f script syntax
+func (n *NFTablesManager) AddBlockRuleCommands(ip string, action db.BlockAction) []string {
+	var commands []string
+	for _, args := range n.addRuleArgs(ip, action) {
+		commands = append(commands, strings.Join(args, " "))
+	}
+	return commands
+}
+
+// RemoveBlockRuleCommands returns the nft commands that RemoveBlockRule executes for ip, in nft -f script syntax
+func (n *NFTablesManager) RemoveBlockRuleCommands(ctx context.Context, ip string) ([]string, error) {
+	rules, err := n.listManagedRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var commands []string
+	for _, rule := range rules {
+		if rule.IP == ip {
+			commands = append(commands, strings.Join(n.removeRuleArgs(rule.Handle), " "))
+		}
+	}
+	return commands, nil
+}
+
+// addRuleArgs returns the nft arguments inserting the blocking rules for ip.
+// The rules are inserted in order, so the last one ends up first in the chain.
+// Every rule carries a counter so that blocked traffic can be read back by ListBlockRules,
+// and sends the packets to the NFLOG group if one is configured.
+func (n *NFTablesManager) addRuleArgs(ip string, action db.BlockAction) [][]string {
+	rule := func(statement ...string) []string {
+		args := []string{"insert", "rule", n.family, n.tableName, n.chainName, "ip", "daddr", ip}
+		args = append(args, "counter")
+		if n.logGroup > 0 {
+			args = append(args, "log", "prefix", strconv.Quote(blockLogPrefix), "group", strconv.Itoa(n.logGroup))
+		}
+		args = append(args, statement...)
+		return append(args, "comment", managedRuleComment)
+	}
+
+	switch action {
+	case db.BlockActionReject:
+		// TCPはRSTで即座に切断し、それ以外はICMP admin-prohibitedを返す
+		return [][]string{
+			rule("reject", "with", n.icmpRejectType(), "type", "admin-prohibited"),
+			rule("meta", "l4proto", "tcp", "reject", "with", "tcp", "reset"),
+		}
+	case db.BlockActionLog:
+		return [][]string{rule("log", "prefix", strconv.Quote(blockLogPrefix), "drop")}
+	default:
+		return [][]string{rule("drop")}
+	}
+}
+
+// icmpRejectType returns the ICMP type keyword for reject statements in the configured family
+func (n *NFTablesManager) icmpRejectType() string {
+	switch n.family {
+	case "ip":
+		return "icmp"
+	case "ip6":
+		return "icmpv6"
+	default:
+		// inet, bridge等
+		return "icmpx"
+	}
+}
+
+// removeRuleArgs returns the nft arguments deleting the rule with the given handle
+func (n *NFTablesManager) removeRuleArgs(handle int64) []string {
+	return []string{"delete", "rule", n.family, n.tableName, n.chainName, "handle", strconv.FormatInt(handle, 10)}
+}
+
+// listManagedRules lists the rules in the chain tagged with managedRuleComment
+func (n *NFTablesManager) listManagedRules(ctx context.Context) ([]nftRule, error) {
+	output, err := n.outputCommand(ctx, []string{"-j", "-a", "list", "chain", n.family, n.tableName, n.chainName})
+	if err != nil {
+		return nil, err
+	}
+	return parseManagedRules(output)
+}
+
+// parseManagedRules extracts the rules tagged with managedRuleComment from `nft -j -a list chain` output
+func parseManagedRules(data []byte) ([]nftRule, error) {
+	var listing struct {
+		Nftables []struct {
+			Rule *struct {
+				Handle  int64  `json:"handle"`
+				Comment string `json:"comment"`
+				Expr    []struct {
+					Match *struct {
+						Left struct {
+							Payload *struct {
+								Protocol string `json:"protocol"`
+								Field    string `json:"field"`
+							} `json:"payload"`
+						} `json:"left"`
+						Right json.RawMessage `json:"right"`
+					} `json:"match"`
+					Counter *struct {
+						Packets int64 `json:"packets"`
+						Bytes   int64 `json:"bytes"`
+					} `json:"counter"`
+					Log *struct {
+						Group *int `json:"group"`
+					} `json:"log"`
+					Reject json.RawMessage `json:"reject"`
+				} `json:"expr"`
+			} `json:"rule"`
+		} `json:"nftables"`
+	}
+	if err := json.Unmarshal(data, &listing); err != nil {
+		return nil, fmt.Errorf("failed to parse nft JSON output: %w", err)
+	}
+
+	var rules []nftRule
+	for _, item := range listing.Nftables {
+		if item.Rule == nil || item.Rule.Comment != managedRuleComment {
+			continue
+		}
+		rule := nftRule{Handle: item.Rule.Handle, Action: db.BlockActionDrop}
+		for _, expr := range item.Rule.Expr {
+			switch {
+			case expr.Counter != nil:
+				rule.Packets = expr.Counter.Packets
+				rule.Bytes = expr.Counter.Bytes
+			case expr.Log != nil && expr.Log.Group == nil:
+				// groupを持つlogはNFLOG用で、actionとは無関係
+				rule.Action = db.BlockActionLog
+			case expr.Reject != nil:
+				rule.Action = db.BlockActionReject
+			case expr.Match != nil && expr.Match.Left.Payload != nil &&
+				expr.Match.Left.Payload.Protocol == "ip" && expr.Match.Left.Payload.Field == "daddr":
+				// 単一IP以外(集合等)は管理対象外
+				_ = json.Unmarshal(expr.Match.Right, &rule.IP)
+			}
+		}
+		if rule.IP != "" {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
 // executeCommand executes nftables commands
 func (n *NFTablesManager) executeCommand(ctx context.Context, args []string) error {
+	_, err := n.outputCommand(ctx, args)
+	return err
+}
+
+// outputCommand executes nftables commands and returns their output
+func (n *NFTablesManager) outputCommand(ctx context.Context, args []string) ([]byte, error) {
 	n.logger.Debug("Executing nft command", zap.Strings("args", args))
 
 	cmd := exec.CommandContext(ctx, "nft", args...) //nolint:gosec // G204: args are internally generated (config values and DNS results), not external input
@@ -98,14 +307,14 @@ func (n *NFTablesManager) executeCommand(ctx context.Context, args []string) err
 			zap.Strings("args", args),
 			zap.String("output", string(output)),
 			zap.Error(err))
-		return fmt.Errorf("nft command failed: %s: %w", string(output), err)
+		return nil, fmt.Errorf("nft command failed: %s: %w", string(output), err)
 	}
 
 	n.logger.Debug("nft command executed successfully",
 		zap.Strings("args", args),
 		zap.String("output", string(output)))
 
-	return nil
+	return output, nil
 }
 
 // ensureTableAndChainExist ensures the nftables table and chain exist
@@ -0,0 +1,66 @@
+package firewall
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"go.uber.org/zap"
+)
+
+func Test_parseManagedRules(t *testing.T) {
+	// Output of `nft -j -a list chain ip filter OUTPUT`
+	output := `{"nftables": [
+  {"metainfo": {"version": "1.0.6", "release_name": "Lester Gooch #5", "json_schema_version": 1}},
+  {"chain": {"family": "ip", "table": "filter", "name": "OUTPUT", "handle": 1, "type": "filter", "hook": "output", "prio": 0, "policy": "accept"}},
+  {"rule": {"family": "ip", "table": "filter", "chain": "OUTPUT", "handle": 7, "comment": "router-manager",
+    "expr": [{"match": {"op": "==", "left": {"payload": {"protocol": "ip", "field": "daddr"}}, "right": "192.0.2.1"}}, {"counter": {"packets": 12, "bytes": 720}}, {"drop": null}]}},
+  {"rule": {"family": "ip", "table": "filter", "chain": "OUTPUT", "handle": 5,
+    "expr": [{"match": {"op": "==", "left": {"payload": {"protocol": "ip", "field": "daddr"}}, "right": "198.51.100.1"}}, {"drop": null}]}},
+  {"rule": {"family": "ip", "table": "filter", "chain": "OUTPUT", "handle": 4, "comment": "router-manager",
+    "expr": [{"match": {"op": "==", "left": {"payload": {"protocol": "ip", "field": "daddr"}}, "right": {"set": ["192.0.2.8", "192.0.2.9"]}}}, {"drop": null}]}},
+  {"rule": {"family": "ip", "table": "filter", "chain": "OUTPUT", "handle": 3, "comment": "router-manager",
+    "expr": [{"match": {"op": "==", "left": {"payload": {"protocol": "ip", "field": "daddr"}}, "right": "192.0.2.2"}}, {"log": {"prefix": "router-manager block: ", "group": 5}}, {"drop": null}]}},
+  {"rule": {"family": "ip", "table": "filter", "chain": "OUTPUT", "handle": 2, "comment": "router-manager",
+    "expr": [{"match": {"op": "==", "left": {"payload": {"protocol": "ip", "field": "daddr"}}, "right": "192.0.2.3"}}, {"counter": {"packets": 3, "bytes": 180}}, {"log": {"prefix": "router-manager block: "}}, {"drop": null}]}},
+  {"rule": {"family": "ip", "table": "filter", "chain": "OUTPUT", "handle": 9, "comment": "router-manager",
+    "expr": [{"match": {"op": "==", "left": {"payload": {"protocol": "ip", "field": "daddr"}}, "right": "192.0.2.4"}}, {"match": {"op": "==", "left": {"meta": {"key": "l4proto"}}, "right": "tcp"}}, {"reject": {"type": "tcp reset"}}]}}
+]}`
+
+	rules, err := parseManagedRules([]byte(output))
+	require.NoError(t, err)
+	assert.Equal(t, []nftRule{
+		{Handle: 7, IP: "192.0.2.1", Action: db.BlockActionDrop, Packets: 12, Bytes: 720},
+		// counter導入前に作成されたルール
+		{Handle: 3, IP: "192.0.2.2", Action: db.BlockActionDrop},
+		{Handle: 2, IP: "192.0.2.3", Action: db.BlockActionLog, Packets: 3, Bytes: 180},
+		{Handle: 9, IP: "192.0.2.4", Action: db.BlockActionReject},
+	}, rules)
+
+	_, err = parseManagedRules([]byte("not json"))
+	assert.Error(t, err)
+}
+
+func TestNFTablesManager_AddBlockRuleCommands(t *testing.T) {
+	n := NewNFTablesManager(NFTablesManagerConfig{Family: "ip", Table: "filter", Chain: "forward"}, zap.NewNop())
+
+	assert.Equal(t, []string{
+		"insert rule ip filter forward ip daddr 192.0.2.1 counter drop comment router-manager",
+	}, n.AddBlockRuleCommands("192.0.2.1", db.BlockActionDrop))
+	assert.Equal(t, []string{
+		"insert rule ip filter forward ip daddr 192.0.2.1 counter reject with icmp type admin-prohibited comment router-manager",
+		"insert rule ip filter forward ip daddr 192.0.2.1 counter meta l4proto tcp reject with tcp reset comment router-manager",
+	}, n.AddBlockRuleCommands("192.0.2.1", db.BlockActionReject))
+	assert.Equal(t, []string{
+		`insert rule ip filter forward ip daddr 192.0.2.1 counter log prefix "router-manager block: " drop comment router-manager`,
+	}, n.AddBlockRuleCommands("192.0.2.1", db.BlockActionLog))
+
+	logged := NewNFTablesManager(NFTablesManagerConfig{Family: "ip", Table: "filter", Chain: "forward", LogGroup: 5}, zap.NewNop())
+	assert.Equal(t, []string{
+		`insert rule ip filter forward ip daddr 192.0.2.1 counter log prefix "router-manager block: " group 5 log prefix "router-manager block: " drop comment router-manager`,
+	}, logged.AddBlockRuleCommands("192.0.2.1", db.BlockActionLog))
+
+	inet := NewNFTablesManager(NFTablesManagerConfig{Family: "inet", Table: "filter", Chain: "forward"}, zap.NewNop())
+	assert.Contains(t, inet.AddBlockRuleCommands("192.0.2.1", db.BlockActionReject)[0], "reject with icmpx type admin-prohibited")
+}
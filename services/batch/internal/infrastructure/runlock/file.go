@@ -0,0 +1,106 @@
+package runlock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tokane888/router-manager-go/pkg/db"
+)
+
+// pollInterval is how often a waiting AcquireRunLock retries the lock file
+const pollInterval = time.Second
+
+// FileLock is the run lock taken with flock on a local file, used when the database advisory lock is unavailable.
+// It only keeps runs on the same host from overlapping.
+type FileLock struct {
+	path         string
+	pollInterval time.Duration
+}
+
+// NewFileLock creates a new FileLock. An empty path disables the lock file.
+func NewFileLock(path string) *FileLock {
+	return &FileLock{path: path, pollInterval: pollInterval}
+}
+
+// Enabled reports whether a lock file is configured
+func (l *FileLock) Enabled() bool {
+	return l.path != ""
+}
+
+// AcquireRunLock takes the lock and writes holder to the lock file, and returns the function releasing the lock.
+// If wait is false and another process holds the lock, db.ErrRunLockHeld is returned;
+// otherwise it waits until the lock is released or ctx is done.
+func (l *FileLock) AcquireRunLock(ctx context.Context, holder string, wait bool) (func(context.Context) error, error) {
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create lock file directory: %w", err)
+	}
+	f, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	for {
+		err := tryLock(f)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, db.ErrRunLockHeld) || !wait {
+			_ = f.Close()
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			_ = f.Close()
+			return nil, fmt.Errorf("failed to wait for lock file: %w", ctx.Err())
+		case <-time.After(l.pollInterval):
+		}
+	}
+
+	if err := f.Truncate(0); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("failed to truncate lock file: %w", err)
+	}
+	if _, err := f.WriteAt([]byte(holder+"\n"), 0); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("failed to write lock file: %w", err)
+	}
+
+	release := func(context.Context) error {
+		// ロックはファイルを閉じると解放される。保持者の表示が残らないよう先に空にする
+		_ = f.Truncate(0)
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("failed to close lock file: %w", err)
+		}
+		return nil
+	}
+	return release, nil
+}
+
+// RunLockHolder returns the holder written by the process holding the lock, or "" if the lock is free
+func (l *FileLock) RunLockHolder(context.Context) (string, error) {
+	f, err := os.OpenFile(l.path, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to open lock file: %w", err)
+	}
+	defer f.Close() //nolint:errcheck // read only
+
+	// 異常終了したプロセスの保持者が残っている場合があるため、ロックを取得できるかで判定する
+	if err := tryLock(f); err == nil {
+		return "", nil
+	} else if !errors.Is(err, db.ErrRunLockHeld) {
+		return "", err
+	}
+	data, err := os.ReadFile(l.path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read lock file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
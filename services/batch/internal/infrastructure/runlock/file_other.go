@@ -0,0 +1,13 @@
+//go:build !unix
+
+package runlock
+
+import (
+	"errors"
+	"os"
+)
+
+// tryLock is not supported outside Unix
+func tryLock(_ *os.File) error {
+	return errors.New("lock file is only supported on Unix")
+}
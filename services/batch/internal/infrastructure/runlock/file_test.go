@@ -0,0 +1,50 @@
+package runlock
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tokane888/router-manager-go/pkg/db"
+)
+
+func TestFileLock(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "lock", "batch.lock")
+	first := NewFileLock(path)
+	second := NewFileLock(path)
+	second.pollInterval = 10 * time.Millisecond
+
+	holder, err := first.RunLockHolder(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, holder)
+
+	release, err := first.AcquireRunLock(ctx, "pi pid=100", false)
+	require.NoError(t, err)
+
+	_, err = second.AcquireRunLock(ctx, "pi pid=200", false)
+	assert.ErrorIs(t, err, db.ErrRunLockHeld)
+	holder, err = second.RunLockHolder(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "pi pid=100", holder)
+
+	waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = second.AcquireRunLock(waitCtx, "pi pid=200", true)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	require.NoError(t, release(ctx))
+	holder, err = second.RunLockHolder(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, holder)
+
+	release, err = second.AcquireRunLock(ctx, "pi pid=200", true)
+	require.NoError(t, err)
+	holder, err = first.RunLockHolder(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "pi pid=200", holder)
+	require.NoError(t, release(ctx))
+}
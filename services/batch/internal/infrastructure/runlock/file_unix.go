@@ -0,0 +1,24 @@
+//go:build unix
+
+package runlock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/tokane888/router-manager-go/pkg/db"
+)
+
+// tryLock takes an exclusive flock on f without waiting
+func tryLock(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return db.ErrRunLockHeld
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock file: %w", err)
+	}
+	return nil
+}
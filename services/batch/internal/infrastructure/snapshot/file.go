@@ -0,0 +1,91 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
+)
+
+// fileVersion is the version of the snapshot file format
+const fileVersion = 1
+
+// file is the JSON document of a snapshot file
+type file struct {
+	Version int `json:"version"`
+	*repository.RuleSnapshot
+}
+
+// FileStore persists the rule snapshot in a local file, which is readable at boot without the database
+type FileStore struct {
+	path string
+}
+
+// NewFileStore creates a new FileStore. An empty path disables the snapshot.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Enabled reports whether a snapshot file is configured
+func (s *FileStore) Enabled() bool {
+	return s.path != ""
+}
+
+// Path returns the snapshot file
+func (s *FileStore) Path() string {
+	return s.path
+}
+
+// Save atomically replaces the snapshot file
+func (s *FileStore) Save(snapshot *repository.RuleSnapshot) error {
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	// 書き込み中に電源が切れても前回のスナップショットが残るよう、同じディレクトリに書き込んでからrenameする
+	tmp, err := os.CreateTemp(dir, ".tmp-"+filepath.Base(s.path)+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary snapshot file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck // no-op after a successful rename
+
+	if err := json.NewEncoder(tmp).Encode(file{Version: fileVersion, RuleSnapshot: snapshot}); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to sync snapshot file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close snapshot file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to rename snapshot file: %w", err)
+	}
+	return nil
+}
+
+// Load reads the snapshot file. Returns nil without an error when the file does not exist.
+func (s *FileStore) Load() (*repository.RuleSnapshot, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot file: %w", err)
+	}
+
+	f := file{RuleSnapshot: &repository.RuleSnapshot{}}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot file %s: %w", s.path, err)
+	}
+	if f.Version != fileVersion {
+		return nil, fmt.Errorf("unsupported snapshot file version %d in %s (expected %d)", f.Version, s.path, fileVersion)
+	}
+	return f.RuleSnapshot, nil
+}
@@ -0,0 +1,56 @@
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
+)
+
+func TestFileStore_SaveLoad(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+	s := NewFileStore(filepath.Join(dir, "rules.json"))
+	assert.True(t, s.Enabled())
+
+	// 保存前は何も読み込まない
+	loaded, err := s.Load()
+	require.NoError(t, err)
+	assert.Nil(t, loaded)
+
+	snapshot := &repository.RuleSnapshot{
+		SavedAt: time.Date(2026, 1, 1, 4, 0, 0, 0, time.UTC),
+		Rules: []repository.SnapshotRule{
+			{IP: "192.0.2.1", Action: db.BlockActionDrop},
+			{IP: "2001:db8::1", Action: db.BlockActionReject},
+		},
+	}
+	require.NoError(t, s.Save(&repository.RuleSnapshot{}))
+	require.NoError(t, s.Save(snapshot))
+
+	loaded, err = s.Load()
+	require.NoError(t, err)
+	assert.Equal(t, snapshot, loaded)
+
+	// 一時ファイルは残らない
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestFileStore_LoadInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	s := NewFileStore(path)
+
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0o600))
+	_, err := s.Load()
+	assert.Error(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"version": 2, "rules": []}`), 0o600))
+	_, err = s.Load()
+	assert.ErrorContains(t, err, "unsupported snapshot file version")
+}
@@ -0,0 +1,66 @@
+package status
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// FileWriter writes a JSON document to a file atomically, so that readers never see a partially written file
+type FileWriter struct {
+	path string
+}
+
+// NewFileWriter creates a new FileWriter. An empty path disables writing.
+func NewFileWriter(path string) *FileWriter {
+	return &FileWriter{path: path}
+}
+
+// Enabled reports whether a file is configured
+func (w *FileWriter) Enabled() bool {
+	return w.path != ""
+}
+
+// Path returns the file written
+func (w *FileWriter) Path() string {
+	return w.path
+}
+
+// Write replaces the file with v encoded as JSON
+func (w *FileWriter) Write(v any) error {
+	dir := filepath.Dir(w.path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create status directory: %w", err)
+	}
+
+	// 同じディレクトリに書き込んでからrenameすることで、読み手は常に完全なファイルを参照する
+	tmp, err := os.CreateTemp(dir, ".tmp-"+filepath.Base(w.path)+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary status file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck // no-op after a successful rename
+
+	encoder := json.NewEncoder(tmp)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to encode status: %w", err)
+	}
+	// 監視ツールが読めるよう、CreateTempの0600ではなく0644にする
+	if err := tmp.Chmod(0o644); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to set status file permissions: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to sync status file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close status file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), w.path); err != nil {
+		return fmt.Errorf("failed to rename status file: %w", err)
+	}
+	return nil
+}
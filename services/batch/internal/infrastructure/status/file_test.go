@@ -0,0 +1,47 @@
+package status
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileWriter_Write(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "run")
+	w := NewFileWriter(filepath.Join(dir, "status.json"))
+	assert.True(t, w.Enabled())
+
+	require.NoError(t, w.Write(map[string]any{"status": "partial"}))
+	require.NoError(t, w.Write(map[string]any{"status": "succeeded"}))
+
+	data, err := os.ReadFile(w.Path())
+	require.NoError(t, err)
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(data, &got))
+	assert.Equal(t, "succeeded", got["status"])
+
+	info, err := os.Stat(w.Path())
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o644), info.Mode().Perm())
+
+	// 一時ファイルは残らない
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestFileWriter_WriteUnencodable(t *testing.T) {
+	w := NewFileWriter(filepath.Join(t.TempDir(), "status.json"))
+
+	assert.Error(t, w.Write(func() {}))
+	_, err := os.Stat(w.Path())
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestFileWriter_Disabled(t *testing.T) {
+	assert.False(t, NewFileWriter("").Enabled())
+}
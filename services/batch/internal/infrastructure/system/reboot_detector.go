@@ -30,18 +30,29 @@ func NewRebootDetector(logger *zap.Logger) *RebootDetector {
 	}
 }
 
-// CheckAndHandleReboot checks if this is first run after reboot and returns true if cleanup is needed
-func (rd *RebootDetector) CheckAndHandleReboot(ctx context.Context) (bool, error) {
-	// Check if flag file exists
+// IsFirstRunAfterReboot reports whether the batch has not run since the last reboot without creating the flag file
+func (rd *RebootDetector) IsFirstRunAfterReboot(_ context.Context) (bool, error) {
 	if _, err := os.Stat(rd.flagFile); err == nil {
-		// Flag file exists - not first run after reboot
-		rd.logger.Info("Flag file exists - not first run after reboot")
 		return false, nil
 	} else if !os.IsNotExist(err) {
 		// Stat failed for reason other than file not existing
 		rd.logger.Error("Failed to check flag file", zap.Error(err))
 		return false, fmt.Errorf("failed to check flag file: %w", err)
 	}
+	return true, nil
+}
+
+// CheckAndHandleReboot checks if this is first run after reboot and returns true if cleanup is needed
+func (rd *RebootDetector) CheckAndHandleReboot(ctx context.Context) (bool, error) {
+	isReboot, err := rd.IsFirstRunAfterReboot(ctx)
+	if err != nil {
+		return false, err
+	}
+	if !isReboot {
+		// Flag file exists - not first run after reboot
+		rd.logger.Info("Flag file exists - not first run after reboot")
+		return false, nil
+	}
 
 	// Flag file doesn't exist - first run after reboot
 	rd.logger.Info("Flag file not found - first run after reboot, cleanup needed")
@@ -123,3 +123,26 @@ func TestRebootDetector_CreateFlagFile(t *testing.T) {
 	_, err = os.Stat(testFlagFile)
 	assert.NoError(t, err, "Flag file should exist")
 }
+
+func TestRebootDetector_IsFirstRunAfterReboot(t *testing.T) {
+	tempDir := t.TempDir()
+	testFlagDir := tempDir + "/test-flag"
+	testFlagFile := testFlagDir + "/executed"
+
+	detector := newRebootDetectorWithPaths(zap.NewNop(), testFlagDir, testFlagFile)
+
+	isReboot, err := detector.IsFirstRunAfterReboot(context.Background())
+	require.NoError(t, err)
+	assert.True(t, isReboot)
+
+	// The check must not create the flag file
+	_, err = os.Stat(testFlagFile)
+	assert.True(t, os.IsNotExist(err), "Flag file should not be created")
+
+	require.NoError(t, os.MkdirAll(testFlagDir, 0o755))
+	require.NoError(t, detector.createFlagFile())
+
+	isReboot, err = detector.IsFirstRunAfterReboot(context.Background())
+	require.NoError(t, err)
+	assert.False(t, isReboot)
+}
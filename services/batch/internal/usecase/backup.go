@@ -0,0 +1,77 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
+	"go.uber.org/zap"
+)
+
+type BackupUseCase struct {
+	backupRepo      repository.BackupRepository
+	store           repository.BackupStore
+	firewallManager repository.FirewallManager
+	logger          *zap.Logger
+}
+
+// NewBackupUseCase creates a new instance of BackupUseCase
+func NewBackupUseCase(
+	backupRepo repository.BackupRepository,
+	store repository.BackupStore,
+	firewallManager repository.FirewallManager,
+	logger *zap.Logger,
+) *BackupUseCase {
+	return &BackupUseCase{
+		backupRepo:      backupRepo,
+		store:           store,
+		firewallManager: firewallManager,
+		logger:          logger,
+	}
+}
+
+// Export dumps the current configuration
+func (uc *BackupUseCase) Export(ctx context.Context) (*db.Backup, error) {
+	return uc.backupRepo.ExportBackup(ctx)
+}
+
+// Restore loads a configuration backup and removes nftables rules of domains deleted by a replace
+func (uc *BackupUseCase) Restore(ctx context.Context, backup *db.Backup, mode db.RestoreMode) (*db.RestoreResult, error) {
+	result, err := uc.backupRepo.RestoreBackup(ctx, backup, mode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore backup: %w", err)
+	}
+	if err := applyFirewallOps(ctx, uc.backupRepo, uc.firewallManager, uc.logger); err != nil {
+		// 適用できなかった操作は残り、次回のバッチ実行で再試行される
+		uc.logger.Warn("Failed to remove firewall rules of deleted domains", zap.Error(err))
+	}
+	return result, nil
+}
+
+// RunDailyBackup writes today's automatic backup if it is enabled and has not been written yet
+func (uc *BackupUseCase) RunDailyBackup(ctx context.Context, now time.Time) error {
+	if !uc.store.Enabled() {
+		return nil
+	}
+
+	exists, err := uc.store.Exists(now)
+	if err != nil {
+		return err
+	}
+	if exists {
+		uc.logger.Debug("Today's configuration backup already exists")
+		return nil
+	}
+
+	backup, err := uc.backupRepo.ExportBackup(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to export configuration: %w", err)
+	}
+
+	if _, err := uc.store.Save(now, backup); err != nil {
+		return fmt.Errorf("failed to save configuration backup: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"go.uber.org/zap"
+)
+
+type mockBackupRepo struct {
+	mockFirewallOps
+	exportErr     error
+	restoreResult *db.RestoreResult
+	exported      int
+}
+
+func (m *mockBackupRepo) ExportBackup(_ context.Context) (*db.Backup, error) {
+	if m.exportErr != nil {
+		return nil, m.exportErr
+	}
+	m.exported++
+	return &db.Backup{Version: db.BackupVersion}, nil
+}
+
+func (m *mockBackupRepo) RestoreBackup(_ context.Context, _ *db.Backup, _ db.RestoreMode) (*db.RestoreResult, error) {
+	m.queueOps("remove", m.restoreResult.RemovedIPs, nil)
+	return m.restoreResult, nil
+}
+
+type mockBackupStore struct {
+	enabled bool
+	exists  bool
+	saved   []time.Time
+}
+
+func (m *mockBackupStore) Enabled() bool { return m.enabled }
+
+func (m *mockBackupStore) Exists(_ time.Time) (bool, error) { return m.exists, nil }
+
+func (m *mockBackupStore) Save(day time.Time, _ *db.Backup) (string, error) {
+	m.saved = append(m.saved, day)
+	return "backup.json", nil
+}
+
+func TestBackupUseCase_RunDailyBackup(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		store     *mockBackupStore
+		exportErr error
+		wantSaved int
+		wantErr   bool
+	}{
+		{name: "disabled does nothing", store: &mockBackupStore{}},
+		{name: "writes today's backup", store: &mockBackupStore{enabled: true}, wantSaved: 1},
+		{name: "skips when today's backup exists", store: &mockBackupStore{enabled: true, exists: true}},
+		{
+			name:      "export error is propagated",
+			store:     &mockBackupStore{enabled: true},
+			exportErr: errors.New("db error"),
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := NewBackupUseCase(&mockBackupRepo{exportErr: tt.exportErr}, tt.store, &mockFirewallManager{}, zap.NewNop())
+			err := uc.RunDailyBackup(context.Background(), now)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, tt.store.saved, tt.wantSaved)
+		})
+	}
+}
+
+func TestBackupUseCase_Restore(t *testing.T) {
+	repo := &mockBackupRepo{restoreResult: &db.RestoreResult{
+		DomainsRemoved: 1,
+		RemovedIPs:     []db.DomainIP{{DomainName: "old.example.com", IPAddress: "192.0.2.1"}},
+	}}
+	fw := &mockFirewallManager{rules: dropRules("192.0.2.1")}
+	uc := NewBackupUseCase(repo, &mockBackupStore{}, fw, zap.NewNop())
+
+	result, err := uc.Restore(context.Background(), &db.Backup{Version: db.BackupVersion}, db.RestoreModeReplace)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.DomainsRemoved)
+	assert.Equal(t, []string{"192.0.2.1"}, fw.removedRules)
+}
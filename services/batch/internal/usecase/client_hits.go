@@ -0,0 +1,140 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
+	"go.uber.org/zap"
+)
+
+// clientHitBufferSize is the number of packets buffered between the listener and the database.
+// Packets arriving while the buffer is full are dropped so that the listener never blocks.
+const clientHitBufferSize = 4096
+
+// clientHitPruneInterval is how often block hits older than the retention period are deleted
+const clientHitPruneInterval = time.Hour
+
+// ClientHitConfig contains configuration for recording the LAN clients that hit blocked IPs
+type ClientHitConfig struct {
+	FlushInterval time.Duration // 受信したパケットをまとめてDBに書き込む間隔
+	Retention     time.Duration // block_hitsを保持する期間
+}
+
+// ClientHitUseCase records the packets of LAN clients to blocked IPs reported by the firewall log
+type ClientHitUseCase struct {
+	hitRepo  repository.ClientHitRepository
+	listener repository.BlockedPacketListener
+	logger   *zap.Logger
+	config   ClientHitConfig
+}
+
+// NewClientHitUseCase creates a new instance of ClientHitUseCase
+func NewClientHitUseCase(
+	hitRepo repository.ClientHitRepository,
+	listener repository.BlockedPacketListener,
+	logger *zap.Logger,
+	config ClientHitConfig,
+) *ClientHitUseCase {
+	return &ClientHitUseCase{
+		hitRepo:  hitRepo,
+		listener: listener,
+		logger:   logger,
+		config:   config,
+	}
+}
+
+// Run listens for blocked packets and records them until ctx is cancelled or the listener fails.
+// Packets are written in batches every FlushInterval, and old hits are deleted hourly.
+func (uc *ClientHitUseCase) Run(ctx context.Context) error {
+	packets := make(chan repository.BlockedPacket, clientHitBufferSize)
+	var dropped atomic.Int64
+
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- uc.listener.Listen(ctx, func(packet repository.BlockedPacket) {
+			select {
+			case packets <- packet:
+			default:
+				dropped.Add(1)
+			}
+		})
+	}()
+
+	flushTicker := time.NewTicker(uc.config.FlushInterval)
+	defer flushTicker.Stop()
+	pruneTicker := time.NewTicker(clientHitPruneInterval)
+	defer pruneTicker.Stop()
+
+	uc.prune(ctx)
+
+	var pending []db.BlockHit
+	flush := func(ctx context.Context) {
+		if n := dropped.Swap(0); n > 0 {
+			uc.logger.Warn("Dropped blocked packets because the buffer was full", zap.Int64("packets", n))
+		}
+		if len(pending) == 0 {
+			return
+		}
+		if _, err := uc.hitRepo.InsertBlockHits(ctx, pending); err != nil {
+			// DBの一時的な障害でlistenerを止めないよう、記録できなかった分は破棄して継続する
+			uc.logger.Error("Failed to record block hits", zap.Int("hits", len(pending)), zap.Error(err))
+		}
+		pending = pending[:0]
+	}
+
+	for {
+		select {
+		case packet := <-packets:
+			pending = append(pending, db.BlockHit{ClientIP: packet.SrcIP, DestIP: packet.DstIP, HitAt: packet.Time})
+			if len(pending) >= clientHitBufferSize {
+				flush(ctx)
+			}
+		case <-flushTicker.C:
+			flush(ctx)
+		case <-pruneTicker.C:
+			uc.prune(ctx)
+		case err := <-listenErr:
+			uc.drain(packets, &pending)
+			// 停止時も受信済みのパケットは記録する
+			flush(context.WithoutCancel(ctx))
+			if err != nil {
+				return fmt.Errorf("blocked packet listener stopped: %w", err)
+			}
+			return nil
+		}
+	}
+}
+
+// drain moves the packets left in the buffer to pending
+func (uc *ClientHitUseCase) drain(packets <-chan repository.BlockedPacket, pending *[]db.BlockHit) {
+	for {
+		select {
+		case packet := <-packets:
+			*pending = append(*pending, db.BlockHit{ClientIP: packet.SrcIP, DestIP: packet.DstIP, HitAt: packet.Time})
+		default:
+			return
+		}
+	}
+}
+
+// prune deletes block hits older than the retention period
+func (uc *ClientHitUseCase) prune(ctx context.Context) {
+	deleted, err := uc.hitRepo.DeleteBlockHitsBefore(ctx, time.Now().Add(-uc.config.Retention))
+	if err != nil {
+		uc.logger.Error("Failed to delete old block hits", zap.Error(err))
+		return
+	}
+	if deleted > 0 {
+		uc.logger.Info("Deleted old block hits", zap.Int64("hits", deleted), zap.Duration("retention", uc.config.Retention))
+	}
+}
+
+// Summaries aggregates the block hits within the last window per client and domain.
+// An empty clientIP returns every client.
+func (uc *ClientHitUseCase) Summaries(ctx context.Context, window time.Duration, clientIP string) ([]db.BlockHitSummary, error) {
+	return uc.hitRepo.GetBlockHitSummaries(ctx, time.Now().Add(-window), clientIP)
+}
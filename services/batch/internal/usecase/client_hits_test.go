@@ -0,0 +1,94 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
+	"go.uber.org/zap"
+)
+
+type mockClientHitRepo struct {
+	mu       sync.Mutex
+	inserted []db.BlockHit
+	pruned   int
+}
+
+func (m *mockClientHitRepo) InsertBlockHits(_ context.Context, hits []db.BlockHit) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inserted = append(m.inserted, hits...)
+	return int64(len(hits)), nil
+}
+
+func (m *mockClientHitRepo) GetBlockHitSummaries(_ context.Context, _ time.Time, _ string) ([]db.BlockHitSummary, error) {
+	return nil, nil
+}
+
+func (m *mockClientHitRepo) DeleteBlockHitsBefore(_ context.Context, _ time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pruned++
+	return 0, nil
+}
+
+// mockPacketListener reports packets and then waits for cancellation or returns err
+type mockPacketListener struct {
+	packets []repository.BlockedPacket
+	err     error
+}
+
+func (m *mockPacketListener) Listen(ctx context.Context, handle func(repository.BlockedPacket)) error {
+	for _, packet := range m.packets {
+		handle(packet)
+	}
+	if m.err != nil {
+		return m.err
+	}
+	<-ctx.Done()
+	return nil
+}
+
+func TestClientHitUseCase_Run(t *testing.T) {
+	at := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	packets := []repository.BlockedPacket{
+		{SrcIP: "192.168.1.10", DstIP: "192.0.2.1", Time: at},
+		{SrcIP: "192.168.1.10", DstIP: "192.0.2.1", Time: at.Add(time.Second)},
+	}
+	config := ClientHitConfig{FlushInterval: 10 * time.Millisecond, Retention: 24 * time.Hour}
+
+	t.Run("records packets until cancelled", func(t *testing.T) {
+		repo := &mockClientHitRepo{}
+		uc := NewClientHitUseCase(repo, &mockPacketListener{packets: packets}, zap.NewNop(), config)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- uc.Run(ctx) }()
+
+		require.Eventually(t, func() bool {
+			repo.mu.Lock()
+			defer repo.mu.Unlock()
+			return len(repo.inserted) == 2
+		}, time.Second, 5*time.Millisecond)
+		cancel()
+		require.NoError(t, <-done)
+
+		assert.Equal(t, db.BlockHit{ClientIP: "192.168.1.10", DestIP: "192.0.2.1", HitAt: at}, repo.inserted[0])
+		assert.Equal(t, 1, repo.pruned)
+	})
+
+	t.Run("listener error flushes received packets", func(t *testing.T) {
+		repo := &mockClientHitRepo{}
+		listener := &mockPacketListener{packets: packets, err: errors.New("EBUSY")}
+		uc := NewClientHitUseCase(repo, listener, zap.NewNop(), ClientHitConfig{FlushInterval: time.Hour, Retention: time.Hour})
+
+		assert.Error(t, uc.Run(context.Background()))
+		assert.Len(t, repo.inserted, 2)
+	})
+}
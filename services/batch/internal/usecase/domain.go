@@ -0,0 +1,210 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tokane888/router-manager-go/pkg/blocklist"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
+	"go.uber.org/zap"
+)
+
+// errFeedOwnedDomain is returned when removing a domain that would be re-added by its feed
+var errFeedOwnedDomain = errors.New("domain is provided by a blocklist feed; remove the feed instead")
+
+// DomainSummary represents a registered domain with its resolved IP statistics
+type DomainSummary struct {
+	Name       string         `json:"name"`
+	Manual     bool           `json:"manual"`
+	Action     db.BlockAction `json:"action"`
+	IPCount    int            `json:"ip_count"`
+	LastSeenAt *time.Time     `json:"last_seen_at"` // 最も新しいIPのupdated_at。IP未解決の場合nil
+	CreatedAt  time.Time      `json:"created_at"`
+}
+
+// DomainIPStatus represents a resolved IP of a domain and how long ago DNS last returned it
+type DomainIPStatus struct {
+	IP         string        `json:"ip"`
+	CreatedAt  time.Time     `json:"created_at"`
+	UpdatedAt  time.Time     `json:"updated_at"`
+	Age        time.Duration `json:"-"`
+	AgeSeconds int64         `json:"age_seconds"`
+}
+
+// DomainDetail represents a domain together with all of its resolved IPs
+type DomainDetail struct {
+	DomainSummary
+	IPs []DomainIPStatus `json:"ips"`
+}
+
+type DomainUseCase struct {
+	domainRepo      repository.DomainRepository
+	runRepo         repository.BatchRunRepository
+	firewallManager repository.FirewallManager
+	logger          *zap.Logger
+}
+
+// NewDomainUseCase creates a new instance of DomainUseCase
+func NewDomainUseCase(
+	domainRepo repository.DomainRepository,
+	runRepo repository.BatchRunRepository,
+	firewallManager repository.FirewallManager,
+	logger *zap.Logger,
+) *DomainUseCase {
+	return &DomainUseCase{
+		domainRepo:      domainRepo,
+		runRepo:         runRepo,
+		firewallManager: firewallManager,
+		logger:          logger,
+	}
+}
+
+// AddDomain normalizes and registers a domain with the given block action. Returns the normalized name.
+func (uc *DomainUseCase) AddDomain(ctx context.Context, name string, action db.BlockAction) (string, error) {
+	normalized, err := blocklist.NormalizeDomain(name)
+	if err != nil {
+		return "", err
+	}
+	if err := uc.domainRepo.CreateDomain(ctx, normalized); err != nil {
+		return "", err
+	}
+	// 新規ドメインはdropで作成されるため、それ以外の場合のみ更新する
+	if action != db.BlockActionDrop {
+		if err := uc.domainRepo.SetDomainAction(ctx, normalized, action); err != nil {
+			return "", err
+		}
+	}
+	return normalized, nil
+}
+
+// SetAction changes the block action of a domain and replaces the firewall rules of its IPs
+// by applying the firewall operations queued with the change. Returns the IPs of the domain.
+func (uc *DomainUseCase) SetAction(ctx context.Context, name string, action db.BlockAction) ([]string, error) {
+	if err := uc.domainRepo.SetDomainAction(ctx, name, action); err != nil {
+		return nil, err
+	}
+	ips, err := uc.domainRepo.GetDomainIPs(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyFirewallOps(ctx, uc.domainRepo, uc.firewallManager, uc.logger); err != nil {
+		// 適用できなかった操作は残り、次回のバッチ実行で再試行される
+		uc.logger.Warn("Failed to replace firewall rules with the new action",
+			zap.String("domain", name),
+			zap.String("action", string(action)),
+			zap.Error(err))
+	}
+
+	updated := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		updated = append(updated, ip.IPAddress)
+	}
+	return updated, nil
+}
+
+// RemoveDomain deletes a manually registered domain and removes the nftables rules of its IPs
+// that no other domain has
+func (uc *DomainUseCase) RemoveDomain(ctx context.Context, name string) ([]db.DomainIP, error) {
+	domain, err := uc.domainRepo.GetDomain(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if !domain.Manual {
+		return nil, fmt.Errorf("failed to remove %s: %w", name, errFeedOwnedDomain)
+	}
+
+	removedIPs, err := uc.domainRepo.DeleteDomain(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyFirewallOps(ctx, uc.domainRepo, uc.firewallManager, uc.logger); err != nil {
+		// 適用できなかった操作は残り、次回のバッチ実行で再試行される
+		uc.logger.Warn("Failed to remove firewall rules of deleted domain", zap.String("domain", name), zap.Error(err))
+	}
+	return removedIPs, nil
+}
+
+// ListDomains returns all domains with the number of resolved IPs and when they were last seen
+func (uc *DomainUseCase) ListDomains(ctx context.Context) ([]DomainSummary, error) {
+	domains, err := uc.domainRepo.GetAllDomains(ctx)
+	if err != nil {
+		return nil, err
+	}
+	allIPs, err := uc.domainRepo.GetAllDomainIPs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ipsByDomain := make(map[string][]db.DomainIP, len(domains))
+	for _, ip := range allIPs {
+		ipsByDomain[ip.DomainName] = append(ipsByDomain[ip.DomainName], ip)
+	}
+
+	summaries := make([]DomainSummary, 0, len(domains))
+	for _, domain := range domains {
+		summaries = append(summaries, summarizeDomain(domain, ipsByDomain[domain.DomainName]))
+	}
+	return summaries, nil
+}
+
+// GetDomain returns a domain with its resolved IPs and their ages at now
+func (uc *DomainUseCase) GetDomain(ctx context.Context, name string, now time.Time) (*DomainDetail, error) {
+	domain, err := uc.domainRepo.GetDomain(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := uc.domainRepo.GetDomainIPs(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	detail := &DomainDetail{
+		DomainSummary: summarizeDomain(*domain, ips),
+		IPs:           make([]DomainIPStatus, 0, len(ips)),
+	}
+	for _, ip := range ips {
+		age := now.Sub(ip.UpdatedAt)
+		detail.IPs = append(detail.IPs, DomainIPStatus{
+			IP:         ip.IPAddress,
+			CreatedAt:  ip.CreatedAt,
+			UpdatedAt:  ip.UpdatedAt,
+			Age:        age,
+			AgeSeconds: int64(age.Seconds()),
+		})
+	}
+	return detail, nil
+}
+
+// ListRuns returns the latest batch runs, newest first
+func (uc *DomainUseCase) ListRuns(ctx context.Context, limit int) ([]db.BatchRun, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit must be positive, got: %d", limit)
+	}
+	return uc.runRepo.GetRecentBatchRuns(ctx, limit)
+}
+
+// ListNodes returns the routers sharing the database and the state of their firewalls
+func (uc *DomainUseCase) ListNodes(ctx context.Context) ([]db.Node, error) {
+	return uc.domainRepo.GetAllNodes(ctx)
+}
+
+// summarizeDomain builds a DomainSummary from a domain and its IPs
+func summarizeDomain(domain db.Domain, ips []db.DomainIP) DomainSummary {
+	summary := DomainSummary{
+		Name:      domain.DomainName,
+		Manual:    domain.Manual,
+		Action:    domain.Action,
+		IPCount:   len(ips),
+		CreatedAt: domain.CreatedAt,
+	}
+	for _, ip := range ips {
+		if summary.LastSeenAt == nil || ip.UpdatedAt.After(*summary.LastSeenAt) {
+			updatedAt := ip.UpdatedAt
+			summary.LastSeenAt = &updatedAt
+		}
+	}
+	return summary
+}
@@ -2,9 +2,12 @@ package usecase
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
 	"time"
 
+	"github.com/tokane888/router-manager-go/pkg/db"
 	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
 	"go.uber.org/zap"
 )
@@ -16,6 +19,34 @@ type ProcessingConfig struct {
 	MaxDNSIterations int           // Configurable via environment variable, default 5
 	DNSRetryInterval time.Duration // Configurable via environment variable, default 60 seconds
 	IPExpiryDuration time.Duration // Configurable via environment variable, default 24h
+	// ResolverLease is how long this node keeps resolving the domains for the other nodes after a run,
+	// before another node takes over. Configurable via environment variable, default 2h
+	ResolverLease time.Duration
+}
+
+// ProcessResult summarizes a ProcessAllDomains run
+type ProcessResult struct {
+	Domains  int // 処理対象のドメイン数
+	Failed   int // 処理に失敗したドメイン数
+	Exempt   int // 一時除外中のため処理しなかったドメイン数
+	Outcomes []DomainOutcome
+	// Resolver is the node resolving the domains. Other nodes only apply the IPs it records ("": unknown).
+	Resolver string
+}
+
+// Domain outcome statuses
+const (
+	DomainOutcomeProcessed = "processed"
+	DomainOutcomeFailed    = "failed"
+	DomainOutcomeExempt    = "exempt"
+)
+
+// DomainOutcome is what happened to one domain during a run
+type DomainOutcome struct {
+	Domain string   `json:"domain"`
+	Status string   `json:"status"`        // DomainOutcome*
+	IPs    []string `json:"ips,omitempty"` // 名前解決で見つかったIP
+	Error  string   `json:"error,omitempty"`
 }
 
 type DomainBlockerUseCase struct {
@@ -47,7 +78,18 @@ func NewDomainBlockerUseCase(
 }
 
 // ProcessAllDomains processes all domains from the database
-func (uc *DomainBlockerUseCase) ProcessAllDomains(ctx context.Context) error {
+// When another node resolves the domains (several routers sharing the database), only the IPs it recorded are applied.
+func (uc *DomainBlockerUseCase) ProcessAllDomains(ctx context.Context) (*ProcessResult, error) {
+	// Register this node first so that the firewall operations of this run are queued for it
+	if err := uc.domainRepo.RegisterNode(ctx); err != nil {
+		uc.logger.Error("Failed to register node", zap.Error(err))
+	}
+
+	// Restrict the clients of the allowlist policy before any IP is applied, even when no domain is allowed yet
+	if err := uc.firewallManager.PreparePolicy(ctx); err != nil {
+		uc.logger.Error("Failed to prepare firewall policy", zap.Error(err))
+	}
+
 	// On first run after reboot, re-apply all existing DB rules to nftables immediately.
 	// nftables resets on reboot, so rules must be re-added from DB before DNS resolution begins.
 	// Subsequent runs skip this to avoid duplicate nftables rules.
@@ -58,29 +100,68 @@ func (uc *DomainBlockerUseCase) ProcessAllDomains(ctx context.Context) error {
 		uc.logger.Info("System reboot detected - applying existing IP blocks from database")
 		if applyErr := uc.applyExistingIPBlocks(ctx); applyErr != nil {
 			uc.logger.Error("Failed to apply existing IP blocks after reboot", zap.Error(applyErr))
+		} else if err := uc.domainRepo.RecordNodeBoot(ctx); err != nil {
+			uc.logger.Error("Failed to record node boot", zap.Error(err))
+		}
+	}
+
+	// Replay the firewall operations left pending by an earlier run or by changes made outside the batch
+	if err := uc.applyFirewallOps(ctx); err != nil {
+		uc.logger.Error("Failed to apply pending firewall operations", zap.Error(err))
+	}
+
+	resolver, holder := uc.claimResolver(ctx)
+	if !resolver {
+		uc.logger.Info("Domains are resolved by another node, applying the IPs it recorded", zap.String("resolver", holder))
+		if err := uc.reconcileFirewall(ctx); err != nil {
+			uc.logger.Error("Failed to reconcile firewall rules", zap.Error(err))
 		}
+		return &ProcessResult{Resolver: holder}, nil
+	}
+
+	// Expire overrides first so that expired temporary blocks are not resolved again
+	if err := uc.expireOverrides(ctx); err != nil {
+		uc.logger.Error("Failed to expire domain overrides", zap.Error(err))
+	}
+	exempt, err := uc.exemptDomains(ctx)
+	if err != nil {
+		uc.logger.Error("Failed to get exempt domains", zap.Error(err))
 	}
 
 	// Retrieve all domains from the database
 	domains, err := uc.domainRepo.GetAllDomains(ctx)
 	if err != nil {
 		uc.logger.Error("Failed to retrieve domains from database", zap.Error(err))
-		return err
+		return nil, err
 	}
 
 	uc.logger.Info("Retrieved domains from database", zap.Int("count", len(domains)))
 
+	result := &ProcessResult{Domains: len(domains), Resolver: holder}
+
 	// Process each domain
 	for _, domain := range domains {
+		if exempt[domain.DomainName] {
+			uc.logger.Info("Skipping exempt domain", zap.String("domain", domain.DomainName))
+			result.Exempt++
+			result.Outcomes = append(result.Outcomes, DomainOutcome{Domain: domain.DomainName, Status: DomainOutcomeExempt})
+			continue
+		}
 		uc.logger.Info("Processing domain", zap.String("domain", domain.DomainName))
 
-		if err := uc.processDomain(ctx, domain.DomainName); err != nil {
+		ips, err := uc.ProcessDomain(ctx, domain)
+		if err != nil {
 			uc.logger.Error("Failed to process domain",
 				zap.String("domain", domain.DomainName),
 				zap.Error(err))
+			result.Failed++
+			result.Outcomes = append(result.Outcomes, DomainOutcome{
+				Domain: domain.DomainName, Status: DomainOutcomeFailed, Error: err.Error(),
+			})
 			// Continue processing other domains even if one fails
 			continue
 		}
+		result.Outcomes = append(result.Outcomes, DomainOutcome{Domain: domain.DomainName, Status: DomainOutcomeProcessed, IPs: ips})
 	}
 
 	// Remove IPs that have not appeared in DNS results for longer than IPExpiryDuration
@@ -88,21 +169,304 @@ func (uc *DomainBlockerUseCase) ProcessAllDomains(ctx context.Context) error {
 		uc.logger.Error("Failed to cleanup expired IPs", zap.Error(err))
 	}
 
+	// Repair drift between the database and the firewall (rules removed by hand, IPs shared by domains, etc.)
+	if err := uc.reconcileFirewall(ctx); err != nil {
+		uc.logger.Error("Failed to reconcile firewall rules", zap.Error(err))
+	}
+
+	return result, nil
+}
+
+// ApplyOverrides expires the domain overrides whose time is up and brings the firewall in line
+// with the overrides still active: rules of expired temporary blocks and exempt domains are removed
+// and rules of domains whose exemption ended are restored. Pending firewall operations are applied as well.
+func (uc *DomainBlockerUseCase) ApplyOverrides(ctx context.Context) error {
+	if err := uc.expireOverrides(ctx); err != nil {
+		return err
+	}
+	if err := uc.applyFirewallOps(ctx); err != nil {
+		uc.logger.Error("Failed to apply pending firewall operations", zap.Error(err))
+	}
+	return uc.reconcileFirewall(ctx)
+}
+
+// ProcessNewDomains resolves the given newly added domains and brings the firewall in line with the database,
+// which also applies changed block actions, deleted domains and set or ended overrides.
+// Domains that already have IPs (processed by a batch run in the meantime), were deleted or are exempt are skipped.
+func (uc *DomainBlockerUseCase) ProcessNewDomains(ctx context.Context, names []string) (*ProcessResult, error) {
+	// 他のnodeが名前解決する場合、そのnodeが記録したIPのみ反映する
+	resolver, holder := uc.claimResolver(ctx)
+	if !resolver {
+		uc.logger.Info("New domains are resolved by another node", zap.String("resolver", holder), zap.Strings("domains", names))
+		if err := uc.applyFirewallOps(ctx); err != nil {
+			uc.logger.Error("Failed to apply pending firewall operations", zap.Error(err))
+		}
+		if err := uc.reconcileFirewall(ctx); err != nil {
+			return &ProcessResult{Resolver: holder}, fmt.Errorf("failed to reconcile firewall rules: %w", err)
+		}
+		return &ProcessResult{Resolver: holder}, nil
+	}
+
+	if err := uc.expireOverrides(ctx); err != nil {
+		uc.logger.Error("Failed to expire domain overrides", zap.Error(err))
+	}
+	exempt, err := uc.exemptDomains(ctx)
+	if err != nil {
+		uc.logger.Error("Failed to get exempt domains", zap.Error(err))
+	}
+
+	result := &ProcessResult{Resolver: holder}
+	for _, name := range names {
+		if exempt[name] {
+			uc.logger.Info("Skipping exempt domain", zap.String("domain", name))
+			result.Domains++
+			result.Exempt++
+			result.Outcomes = append(result.Outcomes, DomainOutcome{Domain: name, Status: DomainOutcomeExempt})
+			continue
+		}
+		processed, ips, err := uc.processNewDomain(ctx, name)
+		if !processed {
+			continue
+		}
+		result.Domains++
+		if err != nil {
+			uc.logger.Error("Failed to process new domain", zap.String("domain", name), zap.Error(err))
+			result.Failed++
+			result.Outcomes = append(result.Outcomes, DomainOutcome{Domain: name, Status: DomainOutcomeFailed, Error: err.Error()})
+			continue
+		}
+		result.Outcomes = append(result.Outcomes, DomainOutcome{Domain: name, Status: DomainOutcomeProcessed, IPs: ips})
+	}
+
+	// 削除やactionの変更で登録された操作を適用する
+	if err := uc.applyFirewallOps(ctx); err != nil {
+		uc.logger.Error("Failed to apply pending firewall operations", zap.Error(err))
+	}
+	if err := uc.reconcileFirewall(ctx); err != nil {
+		return result, fmt.Errorf("failed to reconcile firewall rules: %w", err)
+	}
+	return result, nil
+}
+
+// claimResolver reports whether this node resolves the domains, taking over the resolver lease once it expired,
+// and returns the node that does. If the lease cannot be claimed this node resolves them,
+// so that blocking goes on at the cost of resolving on several nodes.
+func (uc *DomainBlockerUseCase) claimResolver(ctx context.Context) (bool, string) {
+	resolver, holder, err := uc.domainRepo.ClaimResolver(ctx, uc.config.ResolverLease)
+	if err != nil {
+		uc.logger.Error("Failed to claim resolver lease, resolving domains on this node", zap.Error(err))
+		return true, ""
+	}
+	return resolver, holder
+}
+
+// processNewDomain resolves a newly added domain unless it was deleted or already has IPs.
+// Reports whether the domain was processed and returns the discovered IPs.
+func (uc *DomainBlockerUseCase) processNewDomain(ctx context.Context, name string) (bool, []string, error) {
+	domain, err := uc.domainRepo.GetDomain(ctx, name)
+	if errors.Is(err, db.ErrDomainNotFound) {
+		return false, nil, nil
+	}
+	if err != nil {
+		return true, nil, fmt.Errorf("failed to get domain %s: %w", name, err)
+	}
+	existingIPs, err := uc.getExistingIPs(ctx, name)
+	if err != nil {
+		return true, nil, fmt.Errorf("failed to get existing IPs for domain %s: %w", name, err)
+	}
+	if len(existingIPs) > 0 {
+		return false, nil, nil
+	}
+	ips, err := uc.ProcessDomain(ctx, *domain)
+	return true, ips, err
+}
+
+// expireOverrides deletes expired overrides together with the domains of expired temporary blocks.
+// The rules of their IPs are updated by the firewall operations queued with the deletion.
+func (uc *DomainBlockerUseCase) expireOverrides(ctx context.Context) error {
+	expired, removedIPs, err := uc.domainRepo.ExpireDomainOverrides(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to expire domain overrides: %w", err)
+	}
+	for _, o := range expired {
+		uc.logger.Info("Domain override expired",
+			zap.String("domain", o.DomainName),
+			zap.String("kind", string(o.Kind)))
+	}
+	if len(removedIPs) > 0 {
+		uc.logger.Info("Deleted IPs of expired temporary blocks", zap.Int("count", len(removedIPs)))
+	}
+	return nil
+}
+
+// exemptDomains returns the domains whose blocking is lifted by an active exempt override
+func (uc *DomainBlockerUseCase) exemptDomains(ctx context.Context) (map[string]bool, error) {
+	overrides, err := uc.domainRepo.GetActiveDomainOverrides(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get domain overrides: %w", err)
+	}
+	exempt := make(map[string]bool)
+	for _, o := range overrides {
+		if o.Kind == db.OverrideKindExempt {
+			exempt[o.DomainName] = true
+		}
+	}
+	return exempt, nil
+}
+
+// withoutExempt returns the domain IPs that do not belong to exempt domains
+func withoutExempt(domainIPs []db.DomainIP, exempt map[string]bool) []db.DomainIP {
+	if len(exempt) == 0 {
+		return domainIPs
+	}
+	blocked := make([]db.DomainIP, 0, len(domainIPs))
+	for _, domainIP := range domainIPs {
+		if !exempt[domainIP.DomainName] {
+			blocked = append(blocked, domainIP)
+		}
+	}
+	return blocked
+}
+
+// reconcileFirewall makes the rules managed by this service match the IPs in the database:
+// missing rules are added, rules with a stale action are replaced and rules for IPs
+// no longer in the database or belonging only to exempt domains are removed.
+// The rules of the firewall policy are prepared first, so that they are recreated if they were flushed.
+func (uc *DomainBlockerUseCase) reconcileFirewall(ctx context.Context) error {
+	if err := uc.firewallManager.PreparePolicy(ctx); err != nil {
+		uc.logger.Error("Failed to prepare firewall policy", zap.Error(err))
+	}
+	allIPs, err := uc.domainRepo.GetAllDomainIPs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get all domain IPs: %w", err)
+	}
+	exempt, err := uc.exemptDomains(ctx)
+	if err != nil {
+		return err
+	}
+	allIPs = withoutExempt(allIPs, exempt)
+	rules, err := uc.firewallManager.ListBlockRules(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list firewall rules: %w", err)
+	}
+
+	missing, changed, extra := diffFirewall(allIPs, rules)
+	if len(missing) == 0 && len(changed) == 0 && len(extra) == 0 {
+		uc.logger.Debug("Firewall rules are in sync with the database")
+		return nil
+	}
+
+	uc.logger.Info("Reconciling firewall rules",
+		zap.Int("missing", len(missing)),
+		zap.Int("changed", len(changed)),
+		zap.Int("extra", len(extra)))
+
+	for _, domainIP := range missing {
+		if err := uc.firewallManager.AddBlockRule(ctx, domainIP.IPAddress, domainIP.Action); err != nil {
+			uc.logger.Warn("Failed to restore missing firewall rule",
+				zap.String("domain", domainIP.DomainName),
+				zap.String("ip", domainIP.IPAddress),
+				zap.Error(err))
+		}
+	}
+	for _, domainIP := range changed {
+		if err := uc.firewallManager.RemoveBlockRule(ctx, domainIP.IPAddress); err != nil {
+			uc.logger.Warn("Failed to remove firewall rule with stale action",
+				zap.String("domain", domainIP.DomainName),
+				zap.String("ip", domainIP.IPAddress),
+				zap.Error(err))
+			continue
+		}
+		if err := uc.firewallManager.AddBlockRule(ctx, domainIP.IPAddress, domainIP.Action); err != nil {
+			uc.logger.Warn("Failed to update firewall rule action",
+				zap.String("domain", domainIP.DomainName),
+				zap.String("ip", domainIP.IPAddress),
+				zap.String("action", string(domainIP.Action)),
+				zap.Error(err))
+		}
+	}
+	for _, ip := range extra {
+		if err := uc.firewallManager.RemoveBlockRule(ctx, ip); err != nil {
+			uc.logger.Warn("Failed to remove unmanaged firewall rule",
+				zap.String("ip", ip),
+				zap.Error(err))
+		}
+	}
+
 	return nil
 }
 
-// applyExistingIPBlocks loads all domain IPs from the database and applies nftables rules for each.
+// diffFirewall compares the IPs in the database with the rules in the firewall.
+// missing holds one entry per IP without a rule, changed one entry per IP with a rule of
+// another action, and extra holds blocked IPs not in the database.
+// When several domains share an IP, the action of the first of them in domainIPs is used.
+func diffFirewall(domainIPs []db.DomainIP, rules []repository.BlockRule) (missing, changed []db.DomainIP, extra []string) {
+	actions := make(map[string][]db.BlockAction, len(rules))
+	for _, rule := range rules {
+		actions[rule.IP] = append(actions[rule.IP], rule.Action)
+	}
+	desired := make(map[string]bool, len(domainIPs))
+
+	for _, domainIP := range domainIPs {
+		// 複数ドメインが同じIPを持つ場合ルールは1つでよい
+		if desired[domainIP.IPAddress] {
+			continue
+		}
+		desired[domainIP.IPAddress] = true
+
+		current, blocked := actions[domainIP.IPAddress]
+		switch {
+		case !blocked:
+			missing = append(missing, domainIP)
+		case slices.ContainsFunc(current, func(a db.BlockAction) bool { return a != domainIP.Action }):
+			changed = append(changed, domainIP)
+		}
+	}
+
+	seen := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		if !desired[rule.IP] && !seen[rule.IP] {
+			extra = append(extra, rule.IP)
+		}
+		seen[rule.IP] = true
+	}
+	return missing, changed, extra
+}
+
+// applyExistingIPBlocks loads all domain IPs from the database and applies nftables rules for each,
+// except for the IPs of exempt domains and IPs that already have a rule (restored from the rule snapshot).
 // Called only on first run after reboot since nftables rules are lost on system restart.
 func (uc *DomainBlockerUseCase) applyExistingIPBlocks(ctx context.Context) error {
 	allIPs, err := uc.domainRepo.GetAllDomainIPs(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get all domain IPs: %w", err)
 	}
+	exempt, err := uc.exemptDomains(ctx)
+	if err != nil {
+		return err
+	}
+	allIPs = withoutExempt(allIPs, exempt)
 
-	uc.logger.Info("Applying existing IP blocks from database", zap.Int("count", len(allIPs)))
+	// 起動直後にスナップショットから復元したルールは重複して追加しない。actionの差分は最後の照合で解消される
+	rules, err := uc.firewallManager.ListBlockRules(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list firewall rules: %w", err)
+	}
+	present := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		present[rule.IP] = true
+	}
+
+	uc.logger.Info("Applying existing IP blocks from database",
+		zap.Int("count", len(allIPs)),
+		zap.Int("present", len(rules)))
 
 	for _, domainIP := range allIPs {
-		if err := uc.firewallManager.AddBlockRule(ctx, domainIP.IPAddress); err != nil {
+		if present[domainIP.IPAddress] {
+			continue
+		}
+		present[domainIP.IPAddress] = true
+		if err := uc.firewallManager.AddBlockRule(ctx, domainIP.IPAddress, domainIP.Action); err != nil {
 			uc.logger.Warn("Failed to apply existing nftables rule",
 				zap.String("domain", domainIP.DomainName),
 				zap.String("ip", domainIP.IPAddress),
@@ -116,7 +480,8 @@ func (uc *DomainBlockerUseCase) applyExistingIPBlocks(ctx context.Context) error
 }
 
 // cleanupExpiredIPs removes IPs from DB and nftables that have not been seen in DNS results
-// for longer than IPExpiryDuration.
+// for longer than IPExpiryDuration. The rules are removed by the firewall operations queued with the deletion,
+// except for IPs still belonging to another domain.
 func (uc *DomainBlockerUseCase) cleanupExpiredIPs(ctx context.Context) error {
 	cutoff := time.Now().Add(-uc.config.IPExpiryDuration)
 	expiredIPs, err := uc.domainRepo.DeleteExpiredDomainIPs(ctx, cutoff)
@@ -129,28 +494,18 @@ func (uc *DomainBlockerUseCase) cleanupExpiredIPs(ctx context.Context) error {
 	}
 
 	uc.logger.Info("Removing nftables rules for expired IPs", zap.Int("count", len(expiredIPs)))
-
-	for _, domainIP := range expiredIPs {
-		if err := uc.firewallManager.RemoveBlockRule(ctx, domainIP.IPAddress); err != nil {
-			uc.logger.Warn("Failed to remove nftables rule for expired IP",
-				zap.String("domain", domainIP.DomainName),
-				zap.String("ip", domainIP.IPAddress),
-				zap.Error(err))
-			// Continue with remaining IPs
-		}
-	}
-
-	return nil
+	return uc.applyFirewallOps(ctx)
 }
 
-// processDomain processes a single domain
-func (uc *DomainBlockerUseCase) processDomain(ctx context.Context, domain string) error {
+// ProcessDomain resolves a single domain and updates its nftables rules. Returns the discovered IPs.
+func (uc *DomainBlockerUseCase) ProcessDomain(ctx context.Context, d db.Domain) ([]string, error) {
+	domain := d.DomainName
 	uc.logger.Info("Processing single domain", zap.String("domain", domain))
 
 	// Discover all IPs for the domain
 	discoveredIPs, err := uc.discoverAllIPs(ctx, domain)
 	if err != nil {
-		return fmt.Errorf("failed to discover IPs for domain %s: %w", domain, err)
+		return nil, fmt.Errorf("failed to discover IPs for domain %s: %w", domain, err)
 	}
 
 	uc.logger.Info("Discovered IPs for domain",
@@ -159,11 +514,11 @@ func (uc *DomainBlockerUseCase) processDomain(ctx context.Context, domain string
 
 	// Update nftables rules based on discovered IPs
 	if err := uc.updateFirewallRules(ctx, domain, discoveredIPs); err != nil {
-		return fmt.Errorf("failed to update nftables rules for domain %s: %w", domain, err)
+		return nil, fmt.Errorf("failed to update nftables rules for domain %s: %w", domain, err)
 	}
 
 	uc.logger.Info("Successfully processed domain", zap.String("domain", domain))
-	return nil
+	return discoveredIPs, nil
 }
 
 // discoverAllIPs discovers all IP addresses for a domain
@@ -265,40 +620,69 @@ func (uc *DomainBlockerUseCase) discoverAllIPs(ctx context.Context, domain strin
 }
 
 // updateFirewallRules updates nftables rules and database based on discovered IPs.
-// Existing IPs found in DNS results have their updated_at refreshed.
-// New IPs are added to both nftables and the database.
+// Each kind of change is recorded in one statement: existing IPs found in DNS results have their updated_at
+// refreshed, new IPs are inserted and IPs of the domain not found for longer than IPExpiryDuration are deleted.
+// The nftables rules of the inserted and deleted IPs are then updated, with the domain's block action,
+// by applying the firewall operations queued with them.
 func (uc *DomainBlockerUseCase) updateFirewallRules(ctx context.Context, domain string, resolvedIPs []string) error {
-	existingIPs, err := uc.getExistingIPs(ctx, domain)
+	if len(resolvedIPs) == 0 {
+		return nil
+	}
+
+	existingIPs, err := uc.domainRepo.GetDomainIPs(ctx, domain)
 	if err != nil {
 		return fmt.Errorf("failed to get existing IPs for domain %s: %w", domain, err)
 	}
-
-	existingIPsMap := make(map[string]bool, len(existingIPs))
-	for _, ip := range existingIPs {
-		existingIPsMap[ip] = true
+	resolved := make(map[string]bool, len(resolvedIPs))
+	for _, ip := range resolvedIPs {
+		resolved[ip] = true
+	}
+	cutoff := time.Now().Add(-uc.config.IPExpiryDuration)
+	existing := make(map[string]bool, len(existingIPs))
+	var refreshIPs, expiredIPs, newIPs []string
+	for _, domainIP := range existingIPs {
+		existing[domainIP.IPAddress] = true
+		if resolved[domainIP.IPAddress] {
+			refreshIPs = append(refreshIPs, domainIP.IPAddress)
+		} else if domainIP.UpdatedAt.Before(cutoff) {
+			expiredIPs = append(expiredIPs, domainIP.IPAddress)
+		}
 	}
-
-	var added, refreshed int
 	for _, ip := range resolvedIPs {
-		if existingIPsMap[ip] {
-			if err := uc.domainRepo.UpdateDomainIPUpdatedAt(ctx, domain, ip); err != nil {
-				uc.logger.Warn("Failed to refresh domain IP timestamp",
-					zap.String("domain", domain),
-					zap.String("ip", ip),
-					zap.Error(err))
-			} else {
-				refreshed++
-			}
-		} else {
-			uc.addIP(ctx, domain, ip)
-			added++
+		if !existing[ip] {
+			newIPs = append(newIPs, ip)
+		}
+	}
+
+	if _, err := uc.domainRepo.TouchDomainIPs(ctx, domain, refreshIPs); err != nil {
+		return fmt.Errorf("failed to refresh IPs of domain %s: %w", domain, err)
+	}
+	// 取得後に他の実行が追加したIPは、upsertで更新日時のみ更新される
+	added, err := uc.domainRepo.UpsertDomainIPs(ctx, domain, newIPs)
+	if err != nil {
+		return fmt.Errorf("failed to record IPs of domain %s: %w", domain, err)
+	}
+	if len(added) > 0 {
+		uc.logger.Info("Added domain IPs", zap.String("domain", domain), zap.Strings("ips", added))
+	}
+	expired, err := uc.domainRepo.DeleteDomainIPs(ctx, domain, expiredIPs)
+	if err != nil {
+		return fmt.Errorf("failed to delete expired IPs of domain %s: %w", domain, err)
+	}
+	if len(expired) > 0 {
+		uc.logger.Info("Deleted expired domain IPs", zap.String("domain", domain), zap.Strings("ips", expiredIPs))
+	}
+	if len(added) > 0 || len(expired) > 0 {
+		if err := uc.applyFirewallOps(ctx); err != nil {
+			return err
 		}
 	}
 
 	uc.logger.Info("Completed nftables rules update",
 		zap.String("domain", domain),
-		zap.Int("added", added),
-		zap.Int("refreshed", refreshed))
+		zap.Int("added", len(added)),
+		zap.Int("refreshed", len(resolvedIPs)-len(added)),
+		zap.Int("expired", len(expired)))
 
 	return nil
 }
@@ -317,39 +701,7 @@ func (uc *DomainBlockerUseCase) getExistingIPs(ctx context.Context, domain strin
 	return existingIPs, nil
 }
 
-// addIP adds a new IP address to both nftables and database
-func (uc *DomainBlockerUseCase) addIP(ctx context.Context, domain, ip string) {
-	uc.logger.Info("Adding nftables rule and domain IP",
-		zap.String("domain", domain),
-		zap.String("ip", ip))
-
-	// Add nftables rule first
-	if err := uc.firewallManager.AddBlockRule(ctx, ip); err != nil {
-		uc.logger.Warn("Failed to add nftables rule, continuing with others",
-			zap.String("domain", domain),
-			zap.String("ip", ip),
-			zap.Error(err))
-		return
-	}
-
-	// Then add to database
-	if err := uc.domainRepo.CreateDomainIP(ctx, domain, ip); err != nil {
-		// If database insertion fails, try to remove the nftables rule
-		if rollbackErr := uc.firewallManager.RemoveBlockRule(ctx, ip); rollbackErr != nil {
-			uc.logger.Error("Failed to rollback nftables rule after database error",
-				zap.String("domain", domain),
-				zap.String("ip", ip),
-				zap.Error(rollbackErr))
-		}
-
-		uc.logger.Warn("Failed to create domain IP, continuing with others",
-			zap.String("domain", domain),
-			zap.String("ip", ip),
-			zap.Error(err))
-		return
-	}
-
-	uc.logger.Info("Successfully added nftables rule and domain IP",
-		zap.String("domain", domain),
-		zap.String("ip", ip))
+// applyFirewallOps applies the firewall operations queued by the database
+func (uc *DomainBlockerUseCase) applyFirewallOps(ctx context.Context) error {
+	return applyFirewallOps(ctx, uc.domainRepo, uc.firewallManager, uc.logger)
 }
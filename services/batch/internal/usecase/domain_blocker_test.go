@@ -3,77 +3,286 @@ package usecase
 import (
 	"context"
 	"errors"
+	"slices"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
 	"go.uber.org/zap"
 )
 
 // --- mock implementations ---
 
+// mockFirewallOps queues firewall operations as the database triggers do, with the desired action of the IP
+type mockFirewallOps struct {
+	pendingOps []db.FirewallOp
+	applyErr   error
+}
+
+// queueOps queues an operation for each IP, which should be blocked with action (nil: not blocked)
+func (m *mockFirewallOps) queueOps(op string, domainIPs []db.DomainIP, action *db.BlockAction) {
+	for _, domainIP := range domainIPs {
+		m.pendingOps = append(m.pendingOps, db.FirewallOp{
+			ID:         int64(len(m.pendingOps) + 1),
+			IPAddress:  domainIP.IPAddress,
+			Op:         op,
+			DomainName: domainIP.DomainName,
+			Action:     action,
+		})
+	}
+}
+
+func (m *mockFirewallOps) ApplyFirewallOps(ctx context.Context, _ int, apply func(context.Context, []db.FirewallOp) map[int64]error) (int, error) {
+	if m.applyErr != nil {
+		return 0, m.applyErr
+	}
+	ops := m.pendingOps
+	if len(ops) == 0 {
+		return 0, nil
+	}
+	failed := apply(ctx, ops)
+	m.pendingOps = nil
+	for _, op := range ops {
+		if err, ok := failed[op.ID]; ok {
+			op.Attempts++
+			op.LastError = err.Error()
+			m.pendingOps = append(m.pendingOps, op)
+		}
+	}
+	return len(ops), nil
+}
+
+func (m *mockFirewallOps) GetPendingFirewallOps(context.Context) ([]db.FirewallOp, error) {
+	return m.pendingOps, nil
+}
+
+// mockNodes records the state of this node. resolver is the node holding the resolver lease ("": this node)
+type mockNodes struct {
+	resolver     string
+	claimErr     error
+	registered   bool
+	booted       bool
+	appliedRules *int
+}
+
+func (m *mockNodes) RegisterNode(context.Context) error {
+	m.registered = true
+	return nil
+}
+
+func (m *mockNodes) RecordNodeBoot(context.Context) error {
+	m.booted = true
+	return nil
+}
+
+func (m *mockNodes) RecordNodeApplied(_ context.Context, rules int) error {
+	m.appliedRules = &rules
+	return nil
+}
+
+func (m *mockNodes) ClaimResolver(context.Context, time.Duration) (bool, string, error) {
+	if m.claimErr != nil {
+		return false, "", m.claimErr
+	}
+	if m.resolver == "" {
+		return true, "main", nil
+	}
+	return false, m.resolver, nil
+}
+
+func (m *mockNodes) CheckResolver(ctx context.Context) (bool, string, error) {
+	return m.ClaimResolver(ctx, 0)
+}
+
+func (m *mockNodes) GetAllNodes(context.Context) ([]db.Node, error) {
+	return nil, nil
+}
+
 type mockDomainRepo struct {
+	mockFirewallOps
+	mockNodes
 	domains            []db.Domain
 	domainIPs          map[string][]db.DomainIP // key: domainName
 	allIPs             []db.DomainIP
 	updatedIPs         []string // "domain/ip" pairs that had updated_at refreshed
 	deletedExpiredIPs  []db.DomainIP
+	overrides          []db.DomainOverride // 有効なオーバーライド
+	expiredOverrides   []db.DomainOverride // ExpireDomainOverridesで失効するオーバーライド
+	expiredDomains     []string            // 失効したオーバーライドとともに削除されるドメイン
 	getDomainsErr      error
 	getDomainIPsErr    error
 	getAllDomainIPsErr error
-	createDomainIPErr  error
-	updateTimestampErr error
+	upsertErr          error
 	deleteExpiredErr   error
 }
 
 func (m *mockDomainRepo) GetAllDomains(_ context.Context) ([]db.Domain, error) {
-	return m.domains, m.getDomainsErr
+	if m.getDomainsErr != nil {
+		return nil, m.getDomainsErr
+	}
+	domains := make([]db.Domain, 0, len(m.domains))
+	for _, d := range m.domains {
+		// domains.actionのデフォルト値
+		if d.Action == "" {
+			d.Action = db.BlockActionDrop
+		}
+		domains = append(domains, d)
+	}
+	return domains, nil
+}
+
+func (m *mockDomainRepo) GetDomain(_ context.Context, domainName string) (*db.Domain, error) {
+	for _, d := range m.domains {
+		if d.DomainName == domainName {
+			return &d, nil
+		}
+	}
+	return nil, db.ErrDomainNotFound
 }
 
-func (m *mockDomainRepo) CreateDomain(_ context.Context, _ string) error { return nil }
+func (m *mockDomainRepo) CreateDomain(_ context.Context, domainName string) error {
+	m.domains = append(m.domains, db.Domain{DomainName: domainName, Manual: true, Action: db.BlockActionDrop})
+	return nil
+}
+
+func (m *mockDomainRepo) SetDomainAction(_ context.Context, domainName string, action db.BlockAction) error {
+	for i := range m.domains {
+		if m.domains[i].DomainName == domainName {
+			m.domains[i].Action = action
+			m.queueOps("update", m.domainIPs[domainName], &action)
+			return nil
+		}
+	}
+	return db.ErrDomainNotFound
+}
+
+func (m *mockDomainRepo) DeleteDomain(_ context.Context, domainName string) ([]db.DomainIP, error) {
+	if _, err := m.GetDomain(context.Background(), domainName); err != nil {
+		return nil, err
+	}
+	m.queueOps("remove", m.domainIPs[domainName], nil)
+	return m.domainIPs[domainName], nil
+}
 
 func (m *mockDomainRepo) GetDomainIPs(_ context.Context, domainName string) ([]db.DomainIP, error) {
 	if m.getDomainIPsErr != nil {
 		return nil, m.getDomainIPsErr
 	}
-	return m.domainIPs[domainName], nil
+	return withDefaultAction(m.domainIPs[domainName]), nil
 }
 
-func (m *mockDomainRepo) CreateDomainIP(_ context.Context, _, _ string) error {
-	return m.createDomainIPErr
+func (m *mockDomainRepo) UpsertDomainIPs(_ context.Context, domainName string, ipAddresses []string) ([]string, error) {
+	if m.upsertErr != nil {
+		return nil, m.upsertErr
+	}
+	action := db.BlockActionDrop
+	if d, err := m.GetDomain(context.Background(), domainName); err == nil && d.Action != "" {
+		action = d.Action
+	}
+	var inserted []string
+	for _, ip := range ipAddresses {
+		if slices.ContainsFunc(m.domainIPs[domainName], func(d db.DomainIP) bool { return d.IPAddress == ip }) {
+			m.updatedIPs = append(m.updatedIPs, domainName+"/"+ip)
+			continue
+		}
+		inserted = append(inserted, ip)
+		m.queueOps("add", []db.DomainIP{{DomainName: domainName, IPAddress: ip}}, &action)
+	}
+	return inserted, nil
 }
 
-func (m *mockDomainRepo) DeleteDomainIP(_ context.Context, _, _ string) error { return nil }
+func (m *mockDomainRepo) TouchDomainIPs(_ context.Context, domainName string, ipAddresses []string) (int64, error) {
+	for _, ip := range ipAddresses {
+		m.updatedIPs = append(m.updatedIPs, domainName+"/"+ip)
+	}
+	return int64(len(ipAddresses)), nil
+}
+
+func (m *mockDomainRepo) DeleteDomainIPs(_ context.Context, domainName string, ipAddresses []string) ([]db.DomainIP, error) {
+	var deleted, kept []db.DomainIP
+	for _, domainIP := range m.domainIPs[domainName] {
+		if slices.Contains(ipAddresses, domainIP.IPAddress) {
+			deleted = append(deleted, domainIP)
+		} else {
+			kept = append(kept, domainIP)
+		}
+	}
+	if len(deleted) > 0 {
+		m.domainIPs[domainName] = kept
+	}
+	m.queueOps("remove", deleted, nil)
+	return deleted, nil
+}
 
 func (m *mockDomainRepo) GetAllDomainIPs(_ context.Context) ([]db.DomainIP, error) {
-	return m.allIPs, m.getAllDomainIPsErr
+	if m.getAllDomainIPsErr != nil {
+		return nil, m.getAllDomainIPsErr
+	}
+	return withDefaultAction(m.allIPs), nil
 }
 
-func (m *mockDomainRepo) UpdateDomainIPUpdatedAt(_ context.Context, domain, ip string) error {
-	if m.updateTimestampErr != nil {
-		return m.updateTimestampErr
+// withDefaultAction fills the action joined from domains as the database does for domains created with the default action
+func withDefaultAction(domainIPs []db.DomainIP) []db.DomainIP {
+	if domainIPs == nil {
+		return nil
 	}
-	m.updatedIPs = append(m.updatedIPs, domain+"/"+ip)
-	return nil
+	filled := make([]db.DomainIP, 0, len(domainIPs))
+	for _, domainIP := range domainIPs {
+		if domainIP.Action == "" {
+			domainIP.Action = db.BlockActionDrop
+		}
+		filled = append(filled, domainIP)
+	}
+	return filled
 }
 
 func (m *mockDomainRepo) DeleteExpiredDomainIPs(_ context.Context, _ time.Time) ([]db.DomainIP, error) {
-	return m.deletedExpiredIPs, m.deleteExpiredErr
+	if m.deleteExpiredErr != nil {
+		return nil, m.deleteExpiredErr
+	}
+	m.queueOps("remove", m.deletedExpiredIPs, nil)
+	return m.deletedExpiredIPs, nil
+}
+
+func (m *mockDomainRepo) GetActiveDomainOverrides(_ context.Context) ([]db.DomainOverride, error) {
+	return m.overrides, nil
+}
+
+func (m *mockDomainRepo) ExpireDomainOverrides(_ context.Context) ([]db.DomainOverride, []db.DomainIP, error) {
+	expired := m.expiredOverrides
+	m.expiredOverrides = nil
+	return expired, nil, nil
+}
+
+func (m *mockDomainRepo) PreviewExpiredDomainOverrides(_ context.Context) ([]db.DomainOverride, []string, error) {
+	return m.expiredOverrides, m.expiredDomains, nil
 }
 
 type mockFirewallManager struct {
 	addedRules   []string
+	addedActions []db.BlockAction
 	removedRules []string
+	rules        []repository.BlockRule
 	addErr       error
 	removeErr    error
+	listErr      error
+	prepared     int // PreparePolicyの呼び出し回数
+	prepareErr   error
+}
+
+func (m *mockFirewallManager) PreparePolicy(_ context.Context) error {
+	m.prepared++
+	return m.prepareErr
 }
 
-func (m *mockFirewallManager) AddBlockRule(_ context.Context, ip string) error {
+func (m *mockFirewallManager) AddBlockRule(_ context.Context, ip string, action db.BlockAction) error {
 	if m.addErr != nil {
 		return m.addErr
 	}
 	m.addedRules = append(m.addedRules, ip)
+	m.addedActions = append(m.addedActions, action)
 	return nil
 }
 
@@ -85,6 +294,19 @@ func (m *mockFirewallManager) RemoveBlockRule(_ context.Context, ip string) erro
 	return nil
 }
 
+func (m *mockFirewallManager) ListBlockRules(_ context.Context) ([]repository.BlockRule, error) {
+	return m.rules, m.listErr
+}
+
+// dropRules returns firewall rules blocking ips with the drop action
+func dropRules(ips ...string) []repository.BlockRule {
+	rules := make([]repository.BlockRule, 0, len(ips))
+	for _, ip := range ips {
+		rules = append(rules, repository.BlockRule{IP: ip, Action: db.BlockActionDrop})
+	}
+	return rules
+}
+
 type mockDNSResolver struct {
 	ips []string
 	err error
@@ -103,6 +325,10 @@ func (m *mockRebootDetector) CheckAndHandleReboot(_ context.Context) (bool, erro
 	return m.isReboot, m.err
 }
 
+func (m *mockRebootDetector) IsFirstRunAfterReboot(_ context.Context) (bool, error) {
+	return m.isReboot, m.err
+}
+
 // --- helpers ---
 
 func newTestUseCase(
@@ -122,6 +348,7 @@ func defaultConfig() ProcessingConfig {
 		MaxDNSIterations: 1,
 		DNSRetryInterval: time.Millisecond,
 		IPExpiryDuration: 24 * time.Hour,
+		ResolverLease:    2 * time.Hour,
 	}
 }
 
@@ -132,6 +359,7 @@ func Test_applyExistingIPBlocks(t *testing.T) {
 		name      string
 		allIPs    []db.DomainIP
 		getAllErr error
+		rules     []repository.BlockRule
 		addErr    error
 		wantAdded []string
 		wantErr   bool
@@ -145,6 +373,16 @@ func Test_applyExistingIPBlocks(t *testing.T) {
 			wantAdded: []string{"1.2.3.4", "5.6.7.8"},
 			wantErr:   false,
 		},
+		{
+			name: "IPs restored from the snapshot or shared by domains are added once",
+			allIPs: []db.DomainIP{
+				{DomainName: "example.com", IPAddress: "1.2.3.4"},
+				{DomainName: "example.com", IPAddress: "5.6.7.8"},
+				{DomainName: "example.org", IPAddress: "5.6.7.8"},
+			},
+			rules:     dropRules("1.2.3.4"),
+			wantAdded: []string{"5.6.7.8"},
+		},
 		{
 			name:      "empty DB returns no error",
 			allIPs:    []db.DomainIP{},
@@ -170,7 +408,7 @@ func Test_applyExistingIPBlocks(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			repo := &mockDomainRepo{allIPs: tt.allIPs, getAllDomainIPsErr: tt.getAllErr}
-			fw := &mockFirewallManager{addErr: tt.addErr}
+			fw := &mockFirewallManager{rules: tt.rules, addErr: tt.addErr}
 			uc := newTestUseCase(repo, fw, &mockDNSResolver{}, &mockRebootDetector{}, defaultConfig())
 
 			err := uc.applyExistingIPBlocks(context.Background())
@@ -192,6 +430,7 @@ func Test_cleanupExpiredIPs(t *testing.T) {
 		deleteErr   error
 		removeErr   error
 		wantRemoved []string
+		wantPending int
 		wantErr     bool
 	}{
 		{
@@ -215,20 +454,21 @@ func Test_cleanupExpiredIPs(t *testing.T) {
 			wantErr:   true,
 		},
 		{
-			name: "RemoveBlockRule failure is logged and skipped",
+			name: "RemoveBlockRule failure keeps the operation for a retry",
 			expiredIPs: []db.DomainIP{
 				{DomainName: "example.com", IPAddress: "1.2.3.4"},
 			},
 			removeErr:   errors.New("nft error"),
 			wantRemoved: nil,
-			wantErr:     false,
+			wantPending: 1,
+			wantErr:     true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			repo := &mockDomainRepo{deletedExpiredIPs: tt.expiredIPs, deleteExpiredErr: tt.deleteErr}
-			fw := &mockFirewallManager{removeErr: tt.removeErr}
+			fw := &mockFirewallManager{rules: dropRules("1.2.3.4", "5.6.7.8"), removeErr: tt.removeErr}
 			uc := newTestUseCase(repo, fw, &mockDNSResolver{}, &mockRebootDetector{}, defaultConfig())
 
 			err := uc.cleanupExpiredIPs(context.Background())
@@ -237,8 +477,9 @@ func Test_cleanupExpiredIPs(t *testing.T) {
 				assert.Error(t, err)
 			} else {
 				assert.NoError(t, err)
-				assert.Equal(t, tt.wantRemoved, fw.removedRules)
 			}
+			assert.Equal(t, tt.wantRemoved, fw.removedRules)
+			assert.Len(t, repo.pendingOps, tt.wantPending)
 		})
 	}
 }
@@ -250,6 +491,7 @@ func Test_updateFirewallRules(t *testing.T) {
 		resolvedIPs   []string
 		wantAdded     []string
 		wantRefreshed []string
+		wantRemoved   []string
 	}{
 		{
 			name: "new IPs are added, existing IPs have timestamp refreshed",
@@ -277,6 +519,16 @@ func Test_updateFirewallRules(t *testing.T) {
 			wantAdded:     nil,
 			wantRefreshed: []string{"example.com/1.2.3.4", "example.com/5.6.7.8"},
 		},
+		{
+			name: "IPs not found for longer than the expiry are deleted",
+			existingIPs: []db.DomainIP{
+				{DomainName: "example.com", IPAddress: "1.2.3.4", UpdatedAt: time.Now().Add(-48 * time.Hour)},
+				{DomainName: "example.com", IPAddress: "9.9.9.9", UpdatedAt: time.Now().Add(-time.Hour)},
+			},
+			resolvedIPs: []string{"5.6.7.8"},
+			wantAdded:   []string{"5.6.7.8"},
+			wantRemoved: []string{"1.2.3.4"},
+		},
 		{
 			name:          "no resolved IPs is a no-op",
 			existingIPs:   []db.DomainIP{},
@@ -289,22 +541,39 @@ func Test_updateFirewallRules(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			repo := &mockDomainRepo{
+				domains: []db.Domain{{DomainName: "example.com", Action: db.BlockActionReject}},
 				domainIPs: map[string][]db.DomainIP{
 					"example.com": tt.existingIPs,
 				},
 			}
-			fw := &mockFirewallManager{}
+			fw := &mockFirewallManager{rules: dropRules(tt.wantRemoved...)}
 			uc := newTestUseCase(repo, fw, &mockDNSResolver{}, &mockRebootDetector{}, defaultConfig())
 
 			err := uc.updateFirewallRules(context.Background(), "example.com", tt.resolvedIPs)
 
 			assert.NoError(t, err)
 			assert.Equal(t, tt.wantAdded, fw.addedRules)
+			for _, action := range fw.addedActions {
+				assert.Equal(t, db.BlockActionReject, action)
+			}
 			assert.Equal(t, tt.wantRefreshed, repo.updatedIPs)
+			assert.Equal(t, tt.wantRemoved, fw.removedRules)
 		})
 	}
 }
 
+func Test_updateFirewallRules_upsertError(t *testing.T) {
+	repo := &mockDomainRepo{upsertErr: errors.New("db error")}
+	fw := &mockFirewallManager{}
+	uc := newTestUseCase(repo, fw, &mockDNSResolver{}, &mockRebootDetector{}, defaultConfig())
+
+	err := uc.updateFirewallRules(context.Background(), "example.com", []string{"1.2.3.4"})
+
+	assert.Error(t, err)
+	assert.Empty(t, fw.addedRules)
+	assert.Empty(t, repo.pendingOps)
+}
+
 func TestProcessAllDomains_rebootAppliesExistingBlocks(t *testing.T) {
 	existingIP := db.DomainIP{DomainName: "example.com", IPAddress: "1.2.3.4"}
 	repo := &mockDomainRepo{
@@ -319,11 +588,18 @@ func TestProcessAllDomains_rebootAppliesExistingBlocks(t *testing.T) {
 	reboot := &mockRebootDetector{isReboot: true}
 
 	uc := newTestUseCase(repo, fw, dns, reboot, defaultConfig())
-	err := uc.ProcessAllDomains(context.Background())
+	result, err := uc.ProcessAllDomains(context.Background())
 
 	assert.NoError(t, err)
+	assert.Equal(t, &ProcessResult{
+		Domains:  1,
+		Outcomes: []DomainOutcome{{Domain: "example.com", Status: DomainOutcomeProcessed, IPs: []string{"1.2.3.4"}}},
+		Resolver: "main",
+	}, result)
 	// applyExistingIPBlocks should have added the rule
 	assert.Contains(t, fw.addedRules, "1.2.3.4")
+	assert.True(t, repo.registered)
+	assert.True(t, repo.booted)
 }
 
 func TestProcessAllDomains_noRebootSkipsApplyExistingBlocks(t *testing.T) {
@@ -334,14 +610,270 @@ func TestProcessAllDomains_noRebootSkipsApplyExistingBlocks(t *testing.T) {
 			"example.com": {{DomainName: "example.com", IPAddress: "1.2.3.4"}},
 		},
 	}
-	fw := &mockFirewallManager{}
+	fw := &mockFirewallManager{rules: dropRules("1.2.3.4")}
 	dns := &mockDNSResolver{ips: []string{"1.2.3.4"}}
 	reboot := &mockRebootDetector{isReboot: false}
 
 	uc := newTestUseCase(repo, fw, dns, reboot, defaultConfig())
-	err := uc.ProcessAllDomains(context.Background())
+	_, err := uc.ProcessAllDomains(context.Background())
 
 	assert.NoError(t, err)
 	// applyExistingIPBlocks should NOT have been called — no rules added for existing IPs
 	assert.Empty(t, fw.addedRules)
 }
+
+func TestProcessAllDomains_preparesPolicyWithoutDomains(t *testing.T) {
+	// allowlist policyでは許可するドメインがなくても対象クライアントの通信を制限する
+	fw := &mockFirewallManager{prepareErr: errors.New("nft error")}
+
+	uc := newTestUseCase(&mockDomainRepo{}, fw, &mockDNSResolver{}, &mockRebootDetector{}, defaultConfig())
+	result, err := uc.ProcessAllDomains(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, 0, result.Domains)
+	assert.NotZero(t, fw.prepared)
+}
+
+func TestProcessAllDomains_skipsExemptDomains(t *testing.T) {
+	repo := &mockDomainRepo{
+		domains: []db.Domain{{DomainName: "example.com"}, {DomainName: "example.org"}},
+		overrides: []db.DomainOverride{
+			{DomainName: "example.org", Kind: db.OverrideKindExempt, ExpiresAt: time.Now().Add(time.Hour)},
+		},
+	}
+	fw := &mockFirewallManager{}
+	dns := &mockDNSResolver{ips: []string{"1.2.3.4"}}
+
+	uc := newTestUseCase(repo, fw, dns, &mockRebootDetector{}, defaultConfig())
+	result, err := uc.ProcessAllDomains(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, &ProcessResult{
+		Domains: 2,
+		Exempt:  1,
+		Outcomes: []DomainOutcome{
+			{Domain: "example.com", Status: DomainOutcomeProcessed, IPs: []string{"1.2.3.4"}},
+			{Domain: "example.org", Status: DomainOutcomeExempt},
+		},
+		Resolver: "main",
+	}, result)
+	assert.Equal(t, []string{"1.2.3.4"}, fw.addedRules)
+}
+
+func TestProcessAllDomains_appliesIPsOfAnotherResolver(t *testing.T) {
+	repo := &mockDomainRepo{
+		mockNodes: mockNodes{resolver: "guest"},
+		domains:   []db.Domain{{DomainName: "example.com"}},
+		allIPs:    []db.DomainIP{{DomainName: "example.com", IPAddress: "1.2.3.4", Action: db.BlockActionDrop}},
+	}
+	fw := &mockFirewallManager{rules: dropRules("5.6.7.8")}
+	dns := &mockDNSResolver{err: errors.New("must not resolve")}
+
+	uc := newTestUseCase(repo, fw, dns, &mockRebootDetector{}, defaultConfig())
+	result, err := uc.ProcessAllDomains(context.Background())
+
+	// 名前解決せず、他のnodeが記録したIPとルールを照合する
+	assert.NoError(t, err)
+	assert.Equal(t, &ProcessResult{Resolver: "guest"}, result)
+	assert.Equal(t, []string{"1.2.3.4"}, fw.addedRules)
+	assert.Equal(t, []string{"5.6.7.8"}, fw.removedRules)
+	assert.True(t, repo.registered)
+}
+
+func TestProcessAllDomains_resolvesWhenLeaseCannotBeClaimed(t *testing.T) {
+	repo := &mockDomainRepo{
+		mockNodes: mockNodes{resolver: "guest", claimErr: errors.New("connection reset")},
+		domains:   []db.Domain{{DomainName: "example.com"}},
+	}
+	fw := &mockFirewallManager{}
+	dns := &mockDNSResolver{ips: []string{"1.2.3.4"}}
+
+	uc := newTestUseCase(repo, fw, dns, &mockRebootDetector{}, defaultConfig())
+	result, err := uc.ProcessAllDomains(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Domains)
+	assert.Equal(t, []string{"1.2.3.4"}, fw.addedRules)
+}
+
+func TestReconcileFirewall(t *testing.T) {
+	exemptOrg := []db.DomainOverride{{DomainName: "example.org", Kind: db.OverrideKindExempt}}
+	tests := []struct {
+		name        string
+		allIPs      []db.DomainIP
+		overrides   []db.DomainOverride
+		rules       []repository.BlockRule
+		listErr     error
+		wantErr     bool
+		wantAdded   []string
+		wantRemoved []string
+	}{
+		{
+			name:   "in sync",
+			allIPs: []db.DomainIP{{DomainName: "example.com", IPAddress: "1.1.1.1"}},
+			rules:  dropRules("1.1.1.1"),
+		},
+		{
+			name: "missing rules are restored once per IP",
+			allIPs: []db.DomainIP{
+				{DomainName: "example.com", IPAddress: "1.1.1.1"},
+				{DomainName: "example.org", IPAddress: "1.1.1.1"},
+			},
+			wantAdded: []string{"1.1.1.1"},
+		},
+		{
+			name:        "rules for IPs not in the database are removed",
+			allIPs:      []db.DomainIP{{DomainName: "example.com", IPAddress: "1.1.1.1"}},
+			rules:       dropRules("1.1.1.1", "9.9.9.9"),
+			wantRemoved: []string{"9.9.9.9"},
+		},
+		{
+			name: "rules with a stale action are replaced",
+			allIPs: []db.DomainIP{
+				{DomainName: "example.com", IPAddress: "1.1.1.1", Action: db.BlockActionReject},
+			},
+			rules:       dropRules("1.1.1.1"),
+			wantAdded:   []string{"1.1.1.1"},
+			wantRemoved: []string{"1.1.1.1"},
+		},
+		{
+			name: "rules for IPs only of exempt domains are removed",
+			allIPs: []db.DomainIP{
+				{DomainName: "example.com", IPAddress: "1.1.1.1"},
+				{DomainName: "example.org", IPAddress: "1.1.1.1"},
+				{DomainName: "example.org", IPAddress: "2.2.2.2"},
+			},
+			overrides:   exemptOrg,
+			rules:       dropRules("1.1.1.1", "2.2.2.2"),
+			wantRemoved: []string{"2.2.2.2"},
+		},
+		{
+			name:      "temporary blocks do not lift rules",
+			allIPs:    []db.DomainIP{{DomainName: "example.org", IPAddress: "2.2.2.2"}},
+			overrides: []db.DomainOverride{{DomainName: "example.org", Kind: db.OverrideKindBlock}},
+			rules:     dropRules("2.2.2.2"),
+		},
+		{
+			name:    "listing failure",
+			allIPs:  []db.DomainIP{{DomainName: "example.com", IPAddress: "1.1.1.1"}},
+			listErr: errors.New("nft: permission denied"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockDomainRepo{allIPs: tt.allIPs, overrides: tt.overrides}
+			fw := &mockFirewallManager{rules: tt.rules, listErr: tt.listErr}
+			uc := newTestUseCase(repo, fw, &mockDNSResolver{}, &mockRebootDetector{}, defaultConfig())
+
+			err := uc.reconcileFirewall(context.Background())
+
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantAdded, fw.addedRules)
+			assert.Equal(t, tt.wantRemoved, fw.removedRules)
+			assert.Equal(t, 1, fw.prepared, "policy rules are checked on every reconcile")
+		})
+	}
+}
+
+func TestReconcileFirewall_allowlistOverrides(t *testing.T) {
+	// allowlist policyではルールは許可するIPを表す。一時解除(exempt)したドメインのIPは許可されなくなり、
+	// 一時ブロック(block)したドメインのIPは期限まで許可される
+	repo := &mockDomainRepo{
+		allIPs: []db.DomainIP{
+			{DomainName: "example.com", IPAddress: "1.1.1.1"},
+			{DomainName: "example.org", IPAddress: "2.2.2.2"},
+		},
+		overrides: []db.DomainOverride{
+			{DomainName: "example.com", Kind: db.OverrideKindExempt},
+			{DomainName: "example.org", Kind: db.OverrideKindBlock},
+		},
+	}
+	fw := &mockFirewallManager{rules: dropRules("1.1.1.1")}
+	uc := newTestUseCase(repo, fw, &mockDNSResolver{}, &mockRebootDetector{}, defaultConfig())
+
+	assert.NoError(t, uc.reconcileFirewall(context.Background()))
+	assert.Equal(t, []string{"1.1.1.1"}, fw.removedRules, "exempt domain is no longer allowed")
+	assert.Equal(t, []string{"2.2.2.2"}, fw.addedRules, "temporarily blocked domain is allowed")
+}
+
+func TestApplyOverrides_preparesPolicyEveryCall(t *testing.T) {
+	// 外部からflushされたポリシールールを次回の反映で作り直せるよう、毎回確認する
+	fw := &mockFirewallManager{}
+	uc := newTestUseCase(&mockDomainRepo{}, fw, &mockDNSResolver{}, &mockRebootDetector{}, defaultConfig())
+
+	assert.NoError(t, uc.ApplyOverrides(context.Background()))
+	assert.NoError(t, uc.ApplyOverrides(context.Background()))
+	assert.Equal(t, 2, fw.prepared)
+}
+
+func TestProcessNewDomains(t *testing.T) {
+	repo := &mockDomainRepo{
+		domains: []db.Domain{
+			{DomainName: "new.example.com", Action: db.BlockActionDrop},
+			{DomainName: "done.example.com", Action: db.BlockActionDrop},
+			{DomainName: "exempt.example.com", Action: db.BlockActionDrop},
+		},
+		domainIPs: map[string][]db.DomainIP{
+			"done.example.com": {{DomainName: "done.example.com", IPAddress: "5.6.7.8"}},
+		},
+		allIPs: []db.DomainIP{{DomainName: "done.example.com", IPAddress: "5.6.7.8"}},
+		overrides: []db.DomainOverride{
+			{DomainName: "exempt.example.com", Kind: db.OverrideKindExempt, ExpiresAt: time.Now().Add(time.Hour)},
+		},
+	}
+	fw := &mockFirewallManager{rules: dropRules("5.6.7.8")}
+	dns := &mockDNSResolver{ips: []string{"1.2.3.4"}}
+
+	uc := newTestUseCase(repo, fw, dns, &mockRebootDetector{}, defaultConfig())
+	// 削除済みのドメインと解決済みのドメインは処理しない
+	result, err := uc.ProcessNewDomains(context.Background(),
+		[]string{"new.example.com", "done.example.com", "deleted.example.com", "exempt.example.com"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, &ProcessResult{
+		Domains: 2,
+		Exempt:  1,
+		Outcomes: []DomainOutcome{
+			{Domain: "new.example.com", Status: DomainOutcomeProcessed, IPs: []string{"1.2.3.4"}},
+			{Domain: "exempt.example.com", Status: DomainOutcomeExempt},
+		},
+		Resolver: "main",
+	}, result)
+	assert.Equal(t, []string{"1.2.3.4"}, fw.addedRules)
+	assert.Empty(t, fw.removedRules)
+
+	// 他のnodeが名前解決する場合は、そのnodeが記録したIPのみ反映する
+	repo = &mockDomainRepo{
+		mockNodes: mockNodes{resolver: "guest"},
+		domains:   []db.Domain{{DomainName: "new.example.com"}},
+		allIPs:    []db.DomainIP{{DomainName: "new.example.com", IPAddress: "5.6.7.8", Action: db.BlockActionDrop}},
+	}
+	fw = &mockFirewallManager{}
+	uc = newTestUseCase(repo, fw, dns, &mockRebootDetector{}, defaultConfig())
+	result, err = uc.ProcessNewDomains(context.Background(), []string{"new.example.com"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, &ProcessResult{Resolver: "guest"}, result)
+	assert.Equal(t, []string{"5.6.7.8"}, fw.addedRules)
+}
+
+func TestProcessAllDomains_recordsFailedDomains(t *testing.T) {
+	repo := &mockDomainRepo{domains: []db.Domain{{DomainName: "example.com"}}}
+	dns := &mockDNSResolver{err: errors.New("SERVFAIL")}
+
+	uc := newTestUseCase(repo, &mockFirewallManager{}, dns, &mockRebootDetector{}, defaultConfig())
+	result, err := uc.ProcessAllDomains(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Failed)
+	if assert.Len(t, result.Outcomes, 1) {
+		assert.Equal(t, DomainOutcomeFailed, result.Outcomes[0].Status)
+		assert.Contains(t, result.Outcomes[0].Error, "example.com")
+	}
+}
@@ -0,0 +1,101 @@
+package usecase
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
+	"go.uber.org/zap"
+)
+
+// domainChangeDelay is how long changes are collected before they are applied,
+// so that a burst of changes (e.g. an import) is applied at once
+const domainChangeDelay = 2 * time.Second
+
+// domainChangeRetryInterval is how long to wait before listening again after the connection failed
+const domainChangeRetryInterval = 10 * time.Second
+
+// DomainChangeUseCase applies domain changes as soon as the database publishes them,
+// instead of waiting for the next scheduled batch run
+type DomainChangeUseCase struct {
+	listener      repository.DomainChangeListener
+	logger        *zap.Logger
+	delay         time.Duration
+	retryInterval time.Duration
+}
+
+// NewDomainChangeUseCase creates a new instance of DomainChangeUseCase
+func NewDomainChangeUseCase(listener repository.DomainChangeListener, logger *zap.Logger) *DomainChangeUseCase {
+	return &DomainChangeUseCase{
+		listener:      listener,
+		logger:        logger,
+		delay:         domainChangeDelay,
+		retryInterval: domainChangeRetryInterval,
+	}
+}
+
+// Watch listens for domain changes until ctx is cancelled and calls apply with the names of the added domains
+// (possibly none) shortly after changes arrive. Lost connections are re-established; the changes committed
+// in between are left to the scheduled batch run.
+func (uc *DomainChangeUseCase) Watch(ctx context.Context, apply func(ctx context.Context, added []string) error) error {
+	changes := make(chan db.DomainChange)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		uc.listen(ctx, changes)
+	}()
+	defer wg.Wait()
+
+	var added []string
+	var pending bool
+	var timer <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case change := <-changes:
+			for _, name := range change.Domains {
+				if !slices.Contains(added, name) {
+					added = append(added, name)
+				}
+			}
+			if !pending {
+				pending = true
+				timer = time.After(uc.delay)
+			}
+		case <-timer:
+			uc.logger.Info("Applying domain changes", zap.Int("added_domains", len(added)))
+			if err := apply(ctx, added); err != nil {
+				// 反映できなかった変更は次回のバッチ実行で反映される
+				uc.logger.Error("Failed to apply domain changes", zap.Error(err))
+			}
+			added, pending, timer = nil, false, nil
+		}
+	}
+}
+
+// listen forwards domain changes to changes until ctx is cancelled, listening again after connection failures
+func (uc *DomainChangeUseCase) listen(ctx context.Context, changes chan<- db.DomainChange) {
+	for {
+		err := uc.listener.ListenDomainChanges(ctx, func(change db.DomainChange) {
+			select {
+			case changes <- change:
+			case <-ctx.Done():
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		uc.logger.Warn("Stopped listening for domain changes, retrying",
+			zap.Duration("retry_interval", uc.retryInterval), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(uc.retryInterval):
+		}
+	}
+}
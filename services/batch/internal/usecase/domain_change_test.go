@@ -0,0 +1,79 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"go.uber.org/zap"
+)
+
+type mockDomainChangeListener struct {
+	mu      sync.Mutex
+	listens int
+	changes chan db.DomainChange
+}
+
+func (m *mockDomainChangeListener) ListenDomainChanges(ctx context.Context, handle func(db.DomainChange)) error {
+	m.mu.Lock()
+	m.listens++
+	first := m.listens == 1
+	m.mu.Unlock()
+	if first {
+		return errors.New("connection refused")
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case change := <-m.changes:
+			handle(change)
+		}
+	}
+}
+
+func TestDomainChangeUseCase_Watch(t *testing.T) {
+	listener := &mockDomainChangeListener{changes: make(chan db.DomainChange)}
+	uc := NewDomainChangeUseCase(listener, zap.NewNop())
+	uc.delay = 20 * time.Millisecond
+	uc.retryInterval = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	applied := make(chan []string, 4)
+	done := make(chan error, 1)
+	go func() {
+		done <- uc.Watch(ctx, func(_ context.Context, added []string) error {
+			applied <- added
+			return errors.New("nft: permission denied")
+		})
+	}()
+
+	// 接続失敗後に再接続し、まとめて届いた変更を1回で反映する
+	listener.changes <- db.DomainChange{Table: "domains", Op: "INSERT", Domains: []string{"a.example.com", "b.example.com"}}
+	listener.changes <- db.DomainChange{Table: "domains", Op: "INSERT", Domains: []string{"b.example.com", "c.example.com"}}
+	listener.changes <- db.DomainChange{Table: "domain_overrides", Op: "DELETE"}
+	select {
+	case added := <-applied:
+		assert.Equal(t, []string{"a.example.com", "b.example.com", "c.example.com"}, added)
+	case <-time.After(time.Second):
+		t.Fatal("changes were not applied")
+	}
+
+	// 反映に失敗しても監視を続け、ドメイン名のない変更も反映する
+	listener.changes <- db.DomainChange{Table: "domains", Op: "UPDATE"}
+	select {
+	case added := <-applied:
+		assert.Empty(t, added)
+	case <-time.After(time.Second):
+		t.Fatal("changes were not applied")
+	}
+
+	cancel()
+	require.NoError(t, <-done)
+	assert.Equal(t, 2, listener.listens)
+}
@@ -0,0 +1,86 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/tokane888/router-manager-go/pkg/blocklist"
+	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
+	"go.uber.org/zap"
+)
+
+// ImportResult represents the outcome of a domain import
+type ImportResult struct {
+	Format   blocklist.Format `json:"format"`
+	Parsed   int              `json:"parsed"`   // 取り込み元から得られたドメイン数(重複排除後)
+	Skipped  int              `json:"skipped"`  // ドメインとして解釈できなかった行数
+	ToAdd    []string         `json:"to_add"`   // 未登録のため追加対象となるドメイン
+	Existing int              `json:"existing"` // 登録済みのドメイン数
+	Added    int              `json:"added"`    // 実際に追加されたドメイン数(dry runでは常に0)
+	DryRun   bool             `json:"dry_run"`
+}
+
+type DomainImportUseCase struct {
+	importRepo repository.DomainImportRepository
+	logger     *zap.Logger
+}
+
+// NewDomainImportUseCase creates a new instance of DomainImportUseCase
+func NewDomainImportUseCase(importRepo repository.DomainImportRepository, logger *zap.Logger) *DomainImportUseCase {
+	return &DomainImportUseCase{
+		importRepo: importRepo,
+		logger:     logger,
+	}
+}
+
+// Import parses a blocklist source, previews the diff against the domains table
+// and, unless dryRun is set, inserts the new domains in a single transaction
+func (uc *DomainImportUseCase) Import(ctx context.Context, r io.Reader, format blocklist.Format, dryRun bool) (*ImportResult, error) {
+	parsed, err := blocklist.Parse(r, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse blocklist: %w", err)
+	}
+
+	uc.logger.Info("Parsed blocklist",
+		zap.String("format", string(format)),
+		zap.Int("lines", parsed.Lines),
+		zap.Int("domains", len(parsed.Domains)),
+		zap.Int("skipped", parsed.Skipped))
+
+	result := &ImportResult{
+		Format:  format,
+		Parsed:  len(parsed.Domains),
+		Skipped: parsed.Skipped,
+		ToAdd:   []string{},
+		DryRun:  dryRun,
+	}
+	if len(parsed.Domains) == 0 {
+		return result, nil
+	}
+
+	diff, err := uc.importRepo.PreviewDomainImport(ctx, parsed.Domains)
+	if err != nil {
+		return nil, fmt.Errorf("failed to preview domain import: %w", err)
+	}
+	if diff.ToAdd != nil {
+		result.ToAdd = diff.ToAdd
+	}
+	result.Existing = len(diff.Existing)
+
+	if dryRun || len(diff.ToAdd) == 0 {
+		return result, nil
+	}
+
+	added, err := uc.importRepo.ImportDomains(ctx, diff.ToAdd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import domains: %w", err)
+	}
+	result.Added = added
+
+	uc.logger.Info("Imported domains",
+		zap.Int("added", added),
+		zap.Int("existing", result.Existing))
+
+	return result, nil
+}
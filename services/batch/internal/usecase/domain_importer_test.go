@@ -0,0 +1,108 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tokane888/router-manager-go/pkg/blocklist"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"go.uber.org/zap"
+)
+
+type mockImportRepo struct {
+	existing   map[string]bool
+	imported   []string
+	previewErr error
+	importErr  error
+}
+
+func (m *mockImportRepo) PreviewDomainImport(_ context.Context, domainNames []string) (*db.DomainImportDiff, error) {
+	if m.previewErr != nil {
+		return nil, m.previewErr
+	}
+	diff := &db.DomainImportDiff{}
+	for _, d := range domainNames {
+		if m.existing[d] {
+			diff.Existing = append(diff.Existing, d)
+		} else {
+			diff.ToAdd = append(diff.ToAdd, d)
+		}
+	}
+	return diff, nil
+}
+
+func (m *mockImportRepo) ImportDomains(_ context.Context, domainNames []string) (int, error) {
+	if m.importErr != nil {
+		return 0, m.importErr
+	}
+	m.imported = append(m.imported, domainNames...)
+	return len(domainNames), nil
+}
+
+func TestDomainImportUseCase_Import(t *testing.T) {
+	const source = `0.0.0.0 ads.example.com
+||tracker.example.com^
+existing.example.com
+not a domain
+`
+	tests := []struct {
+		name         string
+		dryRun       bool
+		previewErr   error
+		importErr    error
+		wantToAdd    []string
+		wantImported []string
+		wantAdded    int
+		wantErr      bool
+	}{
+		{
+			name:         "imports only new domains",
+			wantToAdd:    []string{"ads.example.com", "tracker.example.com"},
+			wantImported: []string{"ads.example.com", "tracker.example.com"},
+			wantAdded:    2,
+		},
+		{
+			name:      "dry run does not import",
+			dryRun:    true,
+			wantToAdd: []string{"ads.example.com", "tracker.example.com"},
+		},
+		{
+			name:       "preview error is propagated",
+			previewErr: errors.New("db error"),
+			wantErr:    true,
+		},
+		{
+			name:      "import error is propagated",
+			importErr: errors.New("db error"),
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockImportRepo{
+				existing:   map[string]bool{"existing.example.com": true},
+				previewErr: tt.previewErr,
+				importErr:  tt.importErr,
+			}
+			uc := NewDomainImportUseCase(repo, zap.NewNop())
+
+			result, err := uc.Import(context.Background(), strings.NewReader(source), blocklist.FormatAuto, tt.dryRun)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, 3, result.Parsed)
+			assert.Equal(t, 1, result.Skipped)
+			assert.Equal(t, 1, result.Existing)
+			assert.Equal(t, tt.wantToAdd, result.ToAdd)
+			assert.Equal(t, tt.wantAdded, result.Added)
+			assert.Equal(t, tt.wantImported, repo.imported)
+		})
+	}
+}
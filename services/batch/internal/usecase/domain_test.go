@@ -0,0 +1,144 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tokane888/router-manager-go/pkg/blocklist"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"go.uber.org/zap"
+)
+
+type mockBatchRunRepo struct {
+	runs     []db.BatchRun
+	finished map[int64]db.BatchRunResult
+}
+
+func (m *mockBatchRunRepo) StartBatchRun(_ context.Context) (int64, error) {
+	m.runs = append(m.runs, db.BatchRun{ID: int64(len(m.runs) + 1), Status: db.BatchRunStatusRunning})
+	return int64(len(m.runs)), nil
+}
+
+func (m *mockBatchRunRepo) FinishBatchRun(_ context.Context, runID int64, result db.BatchRunResult) error {
+	if m.finished == nil {
+		m.finished = make(map[int64]db.BatchRunResult)
+	}
+	m.finished[runID] = result
+	return nil
+}
+
+func (m *mockBatchRunRepo) GetRecentBatchRuns(_ context.Context, limit int) ([]db.BatchRun, error) {
+	if len(m.runs) > limit {
+		return m.runs[:limit], nil
+	}
+	return m.runs, nil
+}
+
+func TestDomainUseCase_AddDomain(t *testing.T) {
+	repo := &mockDomainRepo{}
+	uc := NewDomainUseCase(repo, &mockBatchRunRepo{}, &mockFirewallManager{}, zap.NewNop())
+
+	name, err := uc.AddDomain(context.Background(), "*.Example.COM.", db.BlockActionDrop)
+	require.NoError(t, err)
+	assert.Equal(t, "example.com", name)
+	assert.Equal(t, []db.Domain{{DomainName: "example.com", Manual: true, Action: db.BlockActionDrop}}, repo.domains)
+
+	_, err = uc.AddDomain(context.Background(), "reject.example.com", db.BlockActionReject)
+	require.NoError(t, err)
+	assert.Equal(t, db.BlockActionReject, repo.domains[1].Action)
+
+	_, err = uc.AddDomain(context.Background(), "localhost", db.BlockActionDrop)
+	assert.True(t, errors.Is(err, blocklist.ErrInvalidDomain))
+}
+
+func TestDomainUseCase_SetAction(t *testing.T) {
+	repo := &mockDomainRepo{
+		domains: []db.Domain{{DomainName: "example.com", Manual: true, Action: db.BlockActionDrop}},
+		domainIPs: map[string][]db.DomainIP{
+			"example.com": {{DomainName: "example.com", IPAddress: "1.1.1.1"}, {DomainName: "example.com", IPAddress: "2.2.2.2"}},
+		},
+	}
+	fw := &mockFirewallManager{rules: dropRules("1.1.1.1", "2.2.2.2")}
+	uc := NewDomainUseCase(repo, &mockBatchRunRepo{}, fw, zap.NewNop())
+
+	updated, err := uc.SetAction(context.Background(), "example.com", db.BlockActionLog)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.1.1.1", "2.2.2.2"}, updated)
+	assert.Equal(t, db.BlockActionLog, repo.domains[0].Action)
+	assert.Equal(t, []string{"1.1.1.1", "2.2.2.2"}, fw.removedRules)
+	assert.Equal(t, []db.BlockAction{db.BlockActionLog, db.BlockActionLog}, fw.addedActions)
+
+	_, err = uc.SetAction(context.Background(), "missing.example.com", db.BlockActionLog)
+	assert.True(t, errors.Is(err, db.ErrDomainNotFound))
+}
+
+func TestDomainUseCase_RemoveDomain(t *testing.T) {
+	repo := &mockDomainRepo{
+		domains: []db.Domain{
+			{DomainName: "manual.example.com", Manual: true},
+			{DomainName: "feed.example.com", Manual: false},
+		},
+		domainIPs: map[string][]db.DomainIP{
+			"manual.example.com": {{DomainName: "manual.example.com", IPAddress: "192.0.2.1"}},
+		},
+	}
+	fw := &mockFirewallManager{rules: dropRules("192.0.2.1")}
+	uc := NewDomainUseCase(repo, &mockBatchRunRepo{}, fw, zap.NewNop())
+
+	removed, err := uc.RemoveDomain(context.Background(), "manual.example.com")
+	require.NoError(t, err)
+	assert.Len(t, removed, 1)
+	assert.Equal(t, []string{"192.0.2.1"}, fw.removedRules)
+
+	_, err = uc.RemoveDomain(context.Background(), "feed.example.com")
+	assert.True(t, errors.Is(err, errFeedOwnedDomain))
+
+	_, err = uc.RemoveDomain(context.Background(), "missing.example.com")
+	assert.True(t, errors.Is(err, db.ErrDomainNotFound))
+}
+
+func TestDomainUseCase_ListAndGetDomain(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	older := now.Add(-2 * time.Hour)
+	newer := now.Add(-10 * time.Minute)
+	ips := []db.DomainIP{
+		{DomainName: "example.com", IPAddress: "192.0.2.1", UpdatedAt: older},
+		{DomainName: "example.com", IPAddress: "192.0.2.2", UpdatedAt: newer},
+	}
+	repo := &mockDomainRepo{
+		domains:   []db.Domain{{DomainName: "example.com", Manual: true}, {DomainName: "empty.example.com", Manual: true}},
+		domainIPs: map[string][]db.DomainIP{"example.com": ips},
+		allIPs:    ips,
+	}
+	uc := NewDomainUseCase(repo, &mockBatchRunRepo{}, &mockFirewallManager{}, zap.NewNop())
+
+	summaries, err := uc.ListDomains(context.Background())
+	require.NoError(t, err)
+	require.Len(t, summaries, 2)
+	assert.Equal(t, 2, summaries[0].IPCount)
+	assert.Equal(t, newer, *summaries[0].LastSeenAt)
+	assert.Equal(t, 0, summaries[1].IPCount)
+	assert.Nil(t, summaries[1].LastSeenAt)
+
+	detail, err := uc.GetDomain(context.Background(), "example.com", now)
+	require.NoError(t, err)
+	require.Len(t, detail.IPs, 2)
+	assert.Equal(t, 2*time.Hour, detail.IPs[0].Age)
+	assert.Equal(t, int64(600), detail.IPs[1].AgeSeconds)
+}
+
+func TestDomainUseCase_ListRuns(t *testing.T) {
+	runs := &mockBatchRunRepo{runs: []db.BatchRun{{ID: 2}, {ID: 1}}}
+	uc := NewDomainUseCase(&mockDomainRepo{}, runs, &mockFirewallManager{}, zap.NewNop())
+
+	got, err := uc.ListRuns(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, []db.BatchRun{{ID: 2}}, got)
+
+	_, err = uc.ListRuns(context.Background(), 0)
+	assert.Error(t, err)
+}
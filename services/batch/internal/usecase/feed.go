@@ -0,0 +1,200 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/tokane888/router-manager-go/pkg/blocklist"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
+	"go.uber.org/zap"
+)
+
+// errEmptyFeed is returned when a feed yields no domains.
+// An empty result is treated as a failed fetch so that a broken source does not wipe all feed domains.
+var errEmptyFeed = errors.New("feed contains no domains")
+
+type FeedUseCase struct {
+	feedRepo        repository.FeedRepository
+	fetcher         repository.FeedFetcher
+	firewallManager repository.FirewallManager
+	logger          *zap.Logger
+}
+
+// NewFeedUseCase creates a new instance of FeedUseCase
+func NewFeedUseCase(
+	feedRepo repository.FeedRepository,
+	fetcher repository.FeedFetcher,
+	firewallManager repository.FirewallManager,
+	logger *zap.Logger,
+) *FeedUseCase {
+	return &FeedUseCase{
+		feedRepo:        feedRepo,
+		fetcher:         fetcher,
+		firewallManager: firewallManager,
+		logger:          logger,
+	}
+}
+
+// AddFeed subscribes to a blocklist feed. The feed is fetched on the next refresh.
+func (uc *FeedUseCase) AddFeed(ctx context.Context, rawURL string, format blocklist.Format, refreshInterval time.Duration) (*db.Feed, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid feed URL %q: %w", rawURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "file" {
+		return nil, fmt.Errorf("unsupported feed URL scheme %q (must be http, https, or file)", u.Scheme)
+	}
+	if refreshInterval <= 0 {
+		return nil, fmt.Errorf("refresh interval must be positive, got: %v", refreshInterval)
+	}
+
+	return uc.feedRepo.CreateFeed(ctx, rawURL, string(format), refreshInterval)
+}
+
+// ListFeeds returns all feed subscriptions
+func (uc *FeedUseCase) ListFeeds(ctx context.Context) ([]db.Feed, error) {
+	return uc.feedRepo.GetAllFeeds(ctx)
+}
+
+// RemoveFeed unsubscribes from a feed and removes firewall rules of the domains that disappeared with it
+func (uc *FeedUseCase) RemoveFeed(ctx context.Context, feedID int64) error {
+	if _, err := uc.feedRepo.DeleteFeed(ctx, feedID); err != nil {
+		return err
+	}
+	uc.applyFirewallOps(ctx)
+	return nil
+}
+
+// RefreshFeeds fetches every feed whose refresh interval has elapsed.
+// With force set, all feeds are fetched unconditionally, ignoring ETag/Last-Modified.
+// A failing feed does not prevent the others from being refreshed.
+func (uc *FeedUseCase) RefreshFeeds(ctx context.Context, force bool) error {
+	var (
+		feeds []db.Feed
+		err   error
+	)
+	if force {
+		feeds, err = uc.feedRepo.GetAllFeeds(ctx)
+	} else {
+		feeds, err = uc.feedRepo.GetDueFeeds(ctx, time.Now())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get feeds: %w", err)
+	}
+
+	if len(feeds) == 0 {
+		uc.logger.Debug("No feeds due for refresh")
+		return nil
+	}
+
+	uc.logger.Info("Refreshing blocklist feeds", zap.Int("count", len(feeds)))
+
+	var failed int
+	for _, feed := range feeds {
+		if err := uc.refreshFeed(ctx, feed, force); err != nil {
+			failed++
+			uc.logger.Error("Failed to refresh feed",
+				zap.Int64("feed_id", feed.ID),
+				zap.String("url", feed.URL),
+				zap.Error(err))
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d feeds failed to refresh", failed, len(feeds))
+	}
+	return nil
+}
+
+// refreshFeed fetches a single feed, synchronizes its domains and records the outcome
+func (uc *FeedUseCase) refreshFeed(ctx context.Context, feed db.Feed, force bool) error {
+	etag, lastModified := feed.ETag, feed.LastModified
+	if force {
+		etag, lastModified = "", ""
+	}
+
+	content, err := uc.fetcher.Fetch(ctx, feed.URL, etag, lastModified)
+	if err != nil {
+		uc.recordFailure(ctx, feed, err)
+		return err
+	}
+
+	if content.NotModified {
+		uc.logger.Info("Feed not modified", zap.Int64("feed_id", feed.ID), zap.String("url", feed.URL))
+		return uc.feedRepo.UpdateFeedFetchResult(ctx, feed.ID, db.FeedFetchResult{
+			Status:       db.FeedStatusNotModified,
+			ETag:         content.ETag,
+			LastModified: content.LastModified,
+			DomainCount:  feed.LastDomainCount,
+		})
+	}
+
+	format, err := blocklist.ParseFormat(feed.Format)
+	if err != nil {
+		uc.recordFailure(ctx, feed, err)
+		return err
+	}
+
+	parsed, err := blocklist.Parse(bytes.NewReader(content.Body), format)
+	if err != nil {
+		uc.recordFailure(ctx, feed, err)
+		return err
+	}
+	if len(parsed.Domains) == 0 {
+		uc.recordFailure(ctx, feed, errEmptyFeed)
+		return errEmptyFeed
+	}
+
+	result, err := uc.feedRepo.SyncFeedDomains(ctx, feed.ID, parsed.Domains)
+	if err != nil {
+		uc.recordFailure(ctx, feed, err)
+		return fmt.Errorf("failed to sync feed domains: %w", err)
+	}
+
+	uc.applyFirewallOps(ctx)
+
+	uc.logger.Info("Feed refreshed",
+		zap.Int64("feed_id", feed.ID),
+		zap.String("url", feed.URL),
+		zap.Int("domains", len(parsed.Domains)),
+		zap.Int("added", result.AddedDomains),
+		zap.Int("dropped", len(result.DroppedDomains)),
+		zap.Int("removed", len(result.RemovedDomains)))
+
+	return uc.feedRepo.UpdateFeedFetchResult(ctx, feed.ID, db.FeedFetchResult{
+		Status:       db.FeedStatusUpdated,
+		ETag:         content.ETag,
+		LastModified: content.LastModified,
+		DomainCount:  len(parsed.Domains),
+	})
+}
+
+// recordFailure stores a failed fetch on the feed, keeping its previous validators
+func (uc *FeedUseCase) recordFailure(ctx context.Context, feed db.Feed, cause error) {
+	err := uc.feedRepo.UpdateFeedFetchResult(ctx, feed.ID, db.FeedFetchResult{
+		Status:       db.FeedStatusError,
+		ETag:         feed.ETag,
+		LastModified: feed.LastModified,
+		Error:        cause.Error(),
+		DomainCount:  feed.LastDomainCount,
+	})
+	if err != nil {
+		uc.logger.Warn("Failed to record feed fetch failure",
+			zap.Int64("feed_id", feed.ID),
+			zap.Error(err))
+	}
+}
+
+// applyFirewallOps removes the firewall rules of the domains that disappeared with a feed
+// by applying the firewall operations queued with their deletion
+func (uc *FeedUseCase) applyFirewallOps(ctx context.Context) {
+	if err := applyFirewallOps(ctx, uc.feedRepo, uc.firewallManager, uc.logger); err != nil {
+		// 適用できなかった操作は残り、次回のバッチ実行で再試行される
+		uc.logger.Warn("Failed to remove firewall rules of deleted domains", zap.Error(err))
+	}
+}
@@ -0,0 +1,194 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tokane888/router-manager-go/pkg/blocklist"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
+	"go.uber.org/zap"
+)
+
+type mockFeedRepo struct {
+	mockFirewallOps
+	feeds      []db.Feed
+	synced     map[int64][]string
+	results    map[int64]db.FeedFetchResult
+	syncResult *db.FeedSyncResult
+	syncErr    error
+	deletedIPs []db.DomainIP
+}
+
+func (m *mockFeedRepo) CreateFeed(_ context.Context, url, format string, refreshInterval time.Duration) (*db.Feed, error) {
+	feed := db.Feed{ID: int64(len(m.feeds) + 1), URL: url, Format: format, RefreshIntervalSeconds: int(refreshInterval.Seconds())}
+	m.feeds = append(m.feeds, feed)
+	return &feed, nil
+}
+
+func (m *mockFeedRepo) GetAllFeeds(_ context.Context) ([]db.Feed, error) { return m.feeds, nil }
+
+func (m *mockFeedRepo) GetDueFeeds(_ context.Context, _ time.Time) ([]db.Feed, error) {
+	var due []db.Feed
+	for _, f := range m.feeds {
+		if f.LastFetchedAt == nil {
+			due = append(due, f)
+		}
+	}
+	return due, nil
+}
+
+func (m *mockFeedRepo) DeleteFeed(_ context.Context, _ int64) ([]db.DomainIP, error) {
+	m.queueOps("remove", m.deletedIPs, nil)
+	return m.deletedIPs, nil
+}
+
+func (m *mockFeedRepo) SyncFeedDomains(_ context.Context, feedID int64, domainNames []string) (*db.FeedSyncResult, error) {
+	if m.syncErr != nil {
+		return nil, m.syncErr
+	}
+	if m.synced == nil {
+		m.synced = make(map[int64][]string)
+	}
+	m.synced[feedID] = domainNames
+	if m.syncResult != nil {
+		m.queueOps("remove", m.syncResult.RemovedIPs, nil)
+		return m.syncResult, nil
+	}
+	return &db.FeedSyncResult{}, nil
+}
+
+func (m *mockFeedRepo) UpdateFeedFetchResult(_ context.Context, feedID int64, result db.FeedFetchResult) error {
+	if m.results == nil {
+		m.results = make(map[int64]db.FeedFetchResult)
+	}
+	m.results[feedID] = result
+	return nil
+}
+
+type mockFeedFetcher struct {
+	contents map[string]*repository.FeedContent
+	err      error
+	gotETag  string
+}
+
+func (m *mockFeedFetcher) Fetch(_ context.Context, url, etag, _ string) (*repository.FeedContent, error) {
+	m.gotETag = etag
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.contents[url], nil
+}
+
+func TestFeedUseCase_RefreshFeeds(t *testing.T) {
+	fetchedAt := time.Now()
+	tests := []struct {
+		name        string
+		feeds       []db.Feed
+		content     *repository.FeedContent
+		fetchErr    error
+		syncResult  *db.FeedSyncResult
+		force       bool
+		wantErr     bool
+		wantSynced  []string
+		wantStatus  string
+		wantRemoved []string
+		wantETag    string
+	}{
+		{
+			name:        "syncs parsed domains and removes rules of dropped domains",
+			feeds:       []db.Feed{{ID: 1, URL: "file:///list", Format: "auto"}},
+			content:     &repository.FeedContent{Body: []byte("0.0.0.0 a.example.com\n||b.example.com^\n"), ETag: `"v2"`},
+			syncResult:  &db.FeedSyncResult{RemovedIPs: []db.DomainIP{{DomainName: "old.example.com", IPAddress: "192.0.2.1"}}},
+			wantSynced:  []string{"a.example.com", "b.example.com"},
+			wantStatus:  db.FeedStatusUpdated,
+			wantRemoved: []string{"192.0.2.1"},
+		},
+		{
+			name:       "not modified keeps membership untouched",
+			feeds:      []db.Feed{{ID: 1, URL: "file:///list", Format: "auto", ETag: `"v1"`}},
+			content:    &repository.FeedContent{NotModified: true, ETag: `"v1"`},
+			wantStatus: db.FeedStatusNotModified,
+			wantETag:   `"v1"`,
+		},
+		{
+			name:       "fetch error is recorded",
+			feeds:      []db.Feed{{ID: 1, URL: "file:///list", Format: "auto"}},
+			fetchErr:   errors.New("connection refused"),
+			wantErr:    true,
+			wantStatus: db.FeedStatusError,
+		},
+		{
+			name:       "empty feed is treated as failure",
+			feeds:      []db.Feed{{ID: 1, URL: "file:///list", Format: "auto"}},
+			content:    &repository.FeedContent{Body: []byte("# nothing here\n")},
+			wantErr:    true,
+			wantStatus: db.FeedStatusError,
+		},
+		{
+			name:  "feeds that are not due are skipped",
+			feeds: []db.Feed{{ID: 1, URL: "file:///list", Format: "auto", LastFetchedAt: &fetchedAt}},
+		},
+		{
+			name:       "force refreshes all feeds without validators",
+			feeds:      []db.Feed{{ID: 1, URL: "file:///list", Format: "auto", ETag: `"v1"`, LastFetchedAt: &fetchedAt}},
+			content:    &repository.FeedContent{Body: []byte("a.example.com\n")},
+			force:      true,
+			wantSynced: []string{"a.example.com"},
+			wantStatus: db.FeedStatusUpdated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockFeedRepo{feeds: tt.feeds, syncResult: tt.syncResult}
+			fetcher := &mockFeedFetcher{contents: map[string]*repository.FeedContent{"file:///list": tt.content}, err: tt.fetchErr}
+			fw := &mockFirewallManager{rules: dropRules("192.0.2.1")}
+			uc := NewFeedUseCase(repo, fetcher, fw, zap.NewNop())
+
+			err := uc.RefreshFeeds(context.Background(), tt.force)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.wantSynced, repo.synced[1])
+			assert.Equal(t, tt.wantStatus, repo.results[1].Status)
+			assert.Equal(t, tt.wantRemoved, fw.removedRules)
+			if tt.force {
+				assert.Empty(t, fetcher.gotETag)
+			}
+			if tt.wantETag != "" {
+				assert.Equal(t, tt.wantETag, repo.results[1].ETag)
+			}
+		})
+	}
+}
+
+func TestFeedUseCase_AddFeed(t *testing.T) {
+	uc := NewFeedUseCase(&mockFeedRepo{}, &mockFeedFetcher{}, &mockFirewallManager{}, zap.NewNop())
+
+	feed, err := uc.AddFeed(context.Background(), "https://example.com/hosts", blocklist.FormatHosts, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, "hosts", feed.Format)
+
+	_, err = uc.AddFeed(context.Background(), "ftp://example.com/hosts", blocklist.FormatHosts, time.Hour)
+	assert.Error(t, err)
+
+	_, err = uc.AddFeed(context.Background(), "https://example.com/hosts", blocklist.FormatHosts, 0)
+	assert.Error(t, err)
+}
+
+func TestFeedUseCase_RemoveFeed(t *testing.T) {
+	repo := &mockFeedRepo{deletedIPs: []db.DomainIP{{DomainName: "a.example.com", IPAddress: "192.0.2.1"}}}
+	fw := &mockFirewallManager{rules: dropRules("192.0.2.1")}
+	uc := NewFeedUseCase(repo, &mockFeedFetcher{}, fw, zap.NewNop())
+
+	require.NoError(t, uc.RemoveFeed(context.Background(), 1))
+	assert.Equal(t, []string{"192.0.2.1"}, fw.removedRules)
+}
@@ -0,0 +1,101 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
+	"go.uber.org/zap"
+)
+
+// firewallOpBatchSize is how many queued firewall operations are applied per transaction
+const firewallOpBatchSize = 500
+
+// applyFirewallOps applies the firewall operations the database queued together with the changes of
+// domain IPs, domain actions and exempt overrides, until none is left.
+// Operations that fail stay queued and are retried by the next call.
+func applyFirewallOps(ctx context.Context, repo repository.FirewallOpRepository, firewallManager repository.FirewallManager, logger *zap.Logger) error {
+	var failed int
+	for {
+		claimed, err := repo.ApplyFirewallOps(ctx, firewallOpBatchSize, func(ctx context.Context, ops []db.FirewallOp) map[int64]error {
+			errs := convergeFirewallOps(ctx, firewallManager, logger, ops)
+			failed += len(errs)
+			return errs
+		})
+		if err != nil {
+			return fmt.Errorf("failed to apply firewall operations: %w", err)
+		}
+		if failed > 0 {
+			return fmt.Errorf("failed to apply %d firewall operations", failed)
+		}
+		// 失敗した操作を同じ呼び出しで繰り返し取得しないよう、取得しきれなかった場合のみ続ける
+		if claimed < firewallOpBatchSize {
+			return nil
+		}
+	}
+}
+
+// convergeFirewallOps brings the rule of each IP of ops to the action the IP should have, adding, replacing or
+// removing it as needed, so that applying an operation again has no effect. Returns the errors by operation ID.
+func convergeFirewallOps(ctx context.Context, firewallManager repository.FirewallManager, logger *zap.Logger, ops []db.FirewallOp) map[int64]error {
+	errs := make(map[int64]error)
+	rules, err := firewallManager.ListBlockRules(ctx)
+	if err != nil {
+		for _, op := range ops {
+			errs[op.ID] = fmt.Errorf("failed to list firewall rules: %w", err)
+		}
+		return errs
+	}
+	current := make(map[string][]db.BlockAction, len(rules))
+	for _, rule := range rules {
+		current[rule.IP] = append(current[rule.IP], rule.Action)
+	}
+
+	// 同じIPの操作は最後に登録された操作のactionでまとめて1回適用する
+	desired := make(map[string]*db.BlockAction, len(ops))
+	var ips []string
+	for _, op := range ops {
+		if _, ok := desired[op.IPAddress]; !ok {
+			ips = append(ips, op.IPAddress)
+		}
+		desired[op.IPAddress] = op.Action
+	}
+
+	logger.Info("Applying firewall operations", zap.Int("operations", len(ops)), zap.Int("ips", len(ips)))
+	ipErrs := make(map[string]error)
+	for _, ip := range ips {
+		if err := convergeBlockRule(ctx, firewallManager, ip, desired[ip], current[ip]); err != nil {
+			logger.Warn("Failed to apply firewall operation, keeping it for a retry",
+				zap.String("ip", ip),
+				zap.Error(err))
+			ipErrs[ip] = err
+		}
+	}
+	for _, op := range ops {
+		if err, ok := ipErrs[op.IPAddress]; ok {
+			errs[op.ID] = err
+		}
+	}
+	return errs
+}
+
+// convergeBlockRule makes the rules of ip match desired (nil: not blocked), given the actions of its current rules
+func convergeBlockRule(ctx context.Context, firewallManager repository.FirewallManager, ip string, desired *db.BlockAction, current []db.BlockAction) error {
+	switch {
+	case desired == nil:
+		if len(current) == 0 {
+			return nil
+		}
+		return firewallManager.RemoveBlockRule(ctx, ip)
+	case len(current) == 0:
+		return firewallManager.AddBlockRule(ctx, ip, *desired)
+	case slices.ContainsFunc(current, func(a db.BlockAction) bool { return a != *desired }):
+		if err := firewallManager.RemoveBlockRule(ctx, ip); err != nil {
+			return err
+		}
+		return firewallManager.AddBlockRule(ctx, ip, *desired)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
+	"go.uber.org/zap"
+)
+
+func actionPtr(a db.BlockAction) *db.BlockAction { return &a }
+
+func TestApplyFirewallOps(t *testing.T) {
+	tests := []struct {
+		name        string
+		ops         []db.FirewallOp
+		rules       []repository.BlockRule
+		addErr      error
+		listErr     error
+		wantErr     bool
+		wantAdded   []string
+		wantRemoved []string
+		wantPending int
+	}{
+		{
+			name:      "missing rules are added",
+			ops:       []db.FirewallOp{{ID: 1, IPAddress: "1.1.1.1", Op: "add", Action: actionPtr(db.BlockActionDrop)}},
+			wantAdded: []string{"1.1.1.1"},
+		},
+		{
+			name:  "operations already applied have no effect",
+			ops:   []db.FirewallOp{{ID: 1, IPAddress: "1.1.1.1", Op: "add", Action: actionPtr(db.BlockActionDrop)}, {ID: 2, IPAddress: "2.2.2.2", Op: "remove"}},
+			rules: dropRules("1.1.1.1"),
+		},
+		{
+			name:        "rules with another action are replaced",
+			ops:         []db.FirewallOp{{ID: 1, IPAddress: "1.1.1.1", Op: "update", Action: actionPtr(db.BlockActionLog)}},
+			rules:       dropRules("1.1.1.1"),
+			wantAdded:   []string{"1.1.1.1"},
+			wantRemoved: []string{"1.1.1.1"},
+		},
+		{
+			name: "operations of the same IP are applied once with the latest action",
+			ops: []db.FirewallOp{
+				{ID: 1, IPAddress: "1.1.1.1", Op: "add", Action: actionPtr(db.BlockActionDrop)},
+				{ID: 2, IPAddress: "1.1.1.1", Op: "remove"},
+			},
+			rules:       dropRules("1.1.1.1"),
+			wantRemoved: []string{"1.1.1.1"},
+		},
+		{
+			name:        "failed operations are kept",
+			ops:         []db.FirewallOp{{ID: 1, IPAddress: "1.1.1.1", Op: "add", Action: actionPtr(db.BlockActionDrop)}},
+			addErr:      errors.New("nft error"),
+			wantErr:     true,
+			wantPending: 1,
+		},
+		{
+			name:        "listing failure keeps all operations",
+			ops:         []db.FirewallOp{{ID: 1, IPAddress: "1.1.1.1", Op: "remove"}, {ID: 2, IPAddress: "2.2.2.2", Op: "remove"}},
+			listErr:     errors.New("nft: permission denied"),
+			wantErr:     true,
+			wantPending: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockFirewallOps{pendingOps: tt.ops}
+			fw := &mockFirewallManager{rules: tt.rules, addErr: tt.addErr, listErr: tt.listErr}
+
+			err := applyFirewallOps(context.Background(), repo, fw, zap.NewNop())
+
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantAdded, fw.addedRules)
+			assert.Equal(t, tt.wantRemoved, fw.removedRules)
+			assert.Len(t, repo.pendingOps, tt.wantPending)
+		})
+	}
+}
+
+func TestProcessDomain_keepsFirewallOpOnFailure(t *testing.T) {
+	repo := &mockDomainRepo{domains: []db.Domain{{DomainName: "example.com", Action: db.BlockActionDrop}}}
+	fw := &mockFirewallManager{addErr: errors.New("nft error")}
+	dns := &mockDNSResolver{ips: []string{"1.2.3.4"}}
+	uc := newTestUseCase(repo, fw, dns, &mockRebootDetector{}, defaultConfig())
+
+	// DBへの追加とともに登録された操作は、firewallへの反映に失敗しても残り次回適用される
+	_, err := uc.ProcessDomain(context.Background(), repo.domains[0])
+	assert.Error(t, err)
+	if assert.Len(t, repo.pendingOps, 1) {
+		assert.Equal(t, "1.2.3.4", repo.pendingOps[0].IPAddress)
+		assert.Equal(t, 1, repo.pendingOps[0].Attempts)
+	}
+
+	fw.addErr = nil
+	assert.NoError(t, uc.applyFirewallOps(context.Background()))
+	assert.Equal(t, []string{"1.2.3.4"}, fw.addedRules)
+	assert.Empty(t, repo.pendingOps)
+}
@@ -0,0 +1,93 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
+	"go.uber.org/zap"
+)
+
+// ErrHitsNotCounted is returned for the hit counts with the allowlist policy. Its rules hold the allowed IPs
+// of the domains without counters, so there is no blocked traffic to count per domain.
+var ErrHitsNotCounted = errors.New("per-domain hit counts are not recorded with the allowlist policy")
+
+// BlockHitUseCase aggregates the firewall counters of blocked IPs into per-domain hit counts
+type BlockHitUseCase struct {
+	hitRepo         repository.BlockHitRepository
+	firewallManager repository.FirewallManager
+	logger          *zap.Logger
+	retention       time.Duration // hit数を保持する期間
+	counted         bool          // falseの場合(allowlist policy)はhit数を記録しない
+}
+
+// NewBlockHitUseCase creates a new instance of BlockHitUseCase
+func NewBlockHitUseCase(
+	hitRepo repository.BlockHitRepository,
+	firewallManager repository.FirewallManager,
+	logger *zap.Logger,
+	retention time.Duration,
+	counted bool,
+) *BlockHitUseCase {
+	return &BlockHitUseCase{
+		hitRepo:         hitRepo,
+		firewallManager: firewallManager,
+		logger:          logger,
+		retention:       retention,
+		counted:         counted,
+	}
+}
+
+// RecordHits reads the counters of the managed firewall rules, adds the traffic since the previous
+// call to the domains owning each IP and deletes hit counts older than the retention period.
+// It must run before rules are changed in the same run, because recreated rules start counting from zero.
+// Nothing is recorded when the hits are not counted (allowlist policy).
+func (uc *BlockHitUseCase) RecordHits(ctx context.Context) error {
+	if !uc.counted {
+		uc.logger.Debug("Skipping block hits", zap.Error(ErrHitsNotCounted))
+		return nil
+	}
+
+	rules, err := uc.firewallManager.ListBlockRules(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list firewall rules: %w", err)
+	}
+
+	// reject等1つのIPに複数ルールがある場合は合算する
+	counters := make([]db.BlockCounter, 0, len(rules))
+	index := make(map[string]int, len(rules))
+	for _, rule := range rules {
+		if i, ok := index[rule.IP]; ok {
+			counters[i].Packets += rule.Packets
+			counters[i].Bytes += rule.Bytes
+			continue
+		}
+		index[rule.IP] = len(counters)
+		counters = append(counters, db.BlockCounter{IPAddress: rule.IP, Packets: rule.Packets, Bytes: rule.Bytes})
+	}
+
+	if _, err := uc.hitRepo.RecordBlockCounters(ctx, counters); err != nil {
+		return fmt.Errorf("failed to record block counters: %w", err)
+	}
+
+	deleted, err := uc.hitRepo.DeleteDomainHitsOlderThan(ctx, uc.retention)
+	if err != nil {
+		return fmt.Errorf("failed to delete old block hits: %w", err)
+	}
+	if deleted > 0 {
+		uc.logger.Info("Deleted old block hits", zap.Int64("buckets", deleted), zap.Duration("retention", uc.retention))
+	}
+	return nil
+}
+
+// DomainHits returns the blocked traffic of every domain within the last window.
+// ErrHitsNotCounted is returned when the hits are not counted (allowlist policy).
+func (uc *BlockHitUseCase) DomainHits(ctx context.Context, window time.Duration) ([]db.DomainHits, error) {
+	if !uc.counted {
+		return nil, ErrHitsNotCounted
+	}
+	return uc.hitRepo.GetDomainHits(ctx, window)
+}
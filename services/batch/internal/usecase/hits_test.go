@@ -0,0 +1,87 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
+	"go.uber.org/zap"
+)
+
+type mockBlockHitRepo struct {
+	recorded  []db.BlockCounter
+	retention time.Duration
+	recordErr error
+}
+
+func (m *mockBlockHitRepo) RecordBlockCounters(_ context.Context, counters []db.BlockCounter) (int, error) {
+	if m.recordErr != nil {
+		return 0, m.recordErr
+	}
+	m.recorded = counters
+	return len(counters), nil
+}
+
+func (m *mockBlockHitRepo) GetDomainHits(_ context.Context, _ time.Duration) ([]db.DomainHits, error) {
+	return nil, nil
+}
+
+func (m *mockBlockHitRepo) DeleteDomainHitsOlderThan(_ context.Context, retention time.Duration) (int64, error) {
+	m.retention = retention
+	return 0, nil
+}
+
+func TestBlockHitUseCase_RecordHits(t *testing.T) {
+	t.Run("sums the rules of each IP", func(t *testing.T) {
+		repo := &mockBlockHitRepo{}
+		firewall := &mockFirewallManager{rules: []repository.BlockRule{
+			{IP: "192.0.2.1", Action: db.BlockActionDrop, Packets: 10, Bytes: 600},
+			{IP: "192.0.2.2", Action: db.BlockActionReject, Packets: 2, Bytes: 120},
+			{IP: "192.0.2.2", Action: db.BlockActionReject, Packets: 3, Bytes: 180},
+			{IP: "192.0.2.3", Action: db.BlockActionDrop},
+		}}
+		uc := NewBlockHitUseCase(repo, firewall, zap.NewNop(), 720*time.Hour, true)
+
+		require.NoError(t, uc.RecordHits(context.Background()))
+		assert.Equal(t, []db.BlockCounter{
+			{IPAddress: "192.0.2.1", Packets: 10, Bytes: 600},
+			{IPAddress: "192.0.2.2", Packets: 5, Bytes: 300},
+			{IPAddress: "192.0.2.3"},
+		}, repo.recorded)
+		assert.Equal(t, 720*time.Hour, repo.retention)
+	})
+
+	t.Run("list error is propagated", func(t *testing.T) {
+		repo := &mockBlockHitRepo{}
+		uc := NewBlockHitUseCase(repo, &mockFirewallManager{listErr: errors.New("nft error")}, zap.NewNop(), time.Hour, true)
+
+		assert.Error(t, uc.RecordHits(context.Background()))
+		assert.Nil(t, repo.recorded)
+	})
+
+	t.Run("record error is propagated", func(t *testing.T) {
+		repo := &mockBlockHitRepo{recordErr: errors.New("db error")}
+		uc := NewBlockHitUseCase(repo, &mockFirewallManager{rules: dropRules("192.0.2.1")}, zap.NewNop(), time.Hour, true)
+
+		assert.Error(t, uc.RecordHits(context.Background()))
+		assert.Zero(t, repo.retention)
+	})
+}
+
+func TestBlockHitUseCase_notCounted(t *testing.T) {
+	// allowlist policyのルールは許可するIPでありcounterを持たないため、hit数を記録せず一覧も返さない
+	repo := &mockBlockHitRepo{}
+	uc := NewBlockHitUseCase(repo, &mockFirewallManager{rules: dropRules("192.0.2.1")}, zap.NewNop(), time.Hour, false)
+
+	require.NoError(t, uc.RecordHits(context.Background()))
+	assert.Nil(t, repo.recorded)
+	assert.Zero(t, repo.retention)
+
+	_, err := uc.DomainHits(context.Background(), time.Hour)
+	assert.ErrorIs(t, err, ErrHitsNotCounted)
+}
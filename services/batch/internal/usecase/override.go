@@ -0,0 +1,99 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/tokane888/router-manager-go/pkg/blocklist"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
+	"go.uber.org/zap"
+)
+
+// OverrideUseCase manages time-bounded overrides of domains (temporary blocks and exemptions)
+type OverrideUseCase struct {
+	overrideRepo  repository.DomainOverrideRepository
+	logger        *zap.Logger
+	checkInterval time.Duration
+}
+
+// NewOverrideUseCase creates a new instance of OverrideUseCase
+func NewOverrideUseCase(
+	overrideRepo repository.DomainOverrideRepository,
+	logger *zap.Logger,
+	checkInterval time.Duration,
+) *OverrideUseCase {
+	return &OverrideUseCase{
+		overrideRepo:  overrideRepo,
+		logger:        logger,
+		checkInterval: checkInterval,
+	}
+}
+
+// Set normalizes the domain name and sets an override that lasts for duration.
+// The firewall is not changed; call DomainBlockerUseCase.ApplyOverrides afterwards.
+func (uc *OverrideUseCase) Set(ctx context.Context, name string, kind db.OverrideKind, duration time.Duration) (*db.DomainOverride, error) {
+	normalized, err := blocklist.NormalizeDomain(name)
+	if err != nil {
+		return nil, err
+	}
+	return uc.overrideRepo.SetDomainOverride(ctx, normalized, kind, duration)
+}
+
+// List returns the active overrides, soonest expiry first
+func (uc *OverrideUseCase) List(ctx context.Context) ([]db.DomainOverride, error) {
+	return uc.overrideRepo.GetActiveDomainOverrides(ctx)
+}
+
+// End makes the active override of a domain expire now.
+// The firewall is not changed; call DomainBlockerUseCase.ApplyOverrides afterwards.
+func (uc *OverrideUseCase) End(ctx context.Context, name string) error {
+	return uc.overrideRepo.EndDomainOverride(ctx, name)
+}
+
+// Watch checks the active overrides every check interval and calls apply when they were set, ended or
+// expired since the last successful call, until ctx is cancelled. apply is also called once at start.
+func (uc *OverrideUseCase) Watch(ctx context.Context, apply func(ctx context.Context) error) error {
+	ticker := time.NewTicker(uc.checkInterval)
+	defer ticker.Stop()
+
+	applied := ""
+	first := true
+	for {
+		// 失効したオーバーライドは一覧から外れるため、期限到来も差分として検出される
+		overrides, err := uc.overrideRepo.GetActiveDomainOverrides(ctx)
+		if err != nil {
+			uc.logger.Error("Failed to check domain overrides", zap.Error(err))
+		} else if state := overrideState(overrides); first || state != applied {
+			uc.logger.Info("Applying domain overrides", zap.Int("active", len(overrides)))
+			if err := apply(ctx); err != nil {
+				// 次回のチェックで再試行する
+				uc.logger.Error("Failed to apply domain overrides", zap.Error(err))
+			} else {
+				applied = state
+				first = false
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// overrideState returns a string that changes whenever an override is set, extended, ended or expires
+func overrideState(overrides []db.DomainOverride) string {
+	var b strings.Builder
+	for _, o := range overrides {
+		b.WriteString(o.DomainName)
+		b.WriteByte(' ')
+		b.WriteString(string(o.Kind))
+		b.WriteByte(' ')
+		b.WriteString(o.ExpiresAt.Format(time.RFC3339Nano))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
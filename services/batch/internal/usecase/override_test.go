@@ -0,0 +1,107 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"go.uber.org/zap"
+)
+
+type mockOverrideRepo struct {
+	mu        sync.Mutex
+	overrides []db.DomainOverride
+	setName   string
+}
+
+func (m *mockOverrideRepo) SetDomainOverride(_ context.Context, domainName string, kind db.OverrideKind, duration time.Duration) (*db.DomainOverride, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.setName = domainName
+	o := db.DomainOverride{DomainName: domainName, Kind: kind, ExpiresAt: time.Now().Add(duration)}
+	m.overrides = append(m.overrides, o)
+	return &o, nil
+}
+
+func (m *mockOverrideRepo) GetActiveDomainOverrides(_ context.Context) ([]db.DomainOverride, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]db.DomainOverride(nil), m.overrides...), nil
+}
+
+func (m *mockOverrideRepo) EndDomainOverride(_ context.Context, domainName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, o := range m.overrides {
+		if o.DomainName == domainName {
+			m.overrides = append(m.overrides[:i], m.overrides[i+1:]...)
+			return nil
+		}
+	}
+	return db.ErrDomainOverrideNotFound
+}
+
+func TestOverrideUseCase_SetNormalizesName(t *testing.T) {
+	repo := &mockOverrideRepo{}
+	uc := NewOverrideUseCase(repo, zap.NewNop(), time.Minute)
+
+	_, err := uc.Set(context.Background(), "Example.COM.", db.OverrideKindExempt, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, "example.com", repo.setName)
+
+	_, err = uc.Set(context.Background(), "not a domain", db.OverrideKindBlock, time.Hour)
+	assert.Error(t, err)
+}
+
+func TestOverrideUseCase_Watch(t *testing.T) {
+	repo := &mockOverrideRepo{}
+	uc := NewOverrideUseCase(repo, zap.NewNop(), 5*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var mu sync.Mutex
+	applies := 0
+	failNext := false
+	done := make(chan error, 1)
+	go func() {
+		done <- uc.Watch(ctx, func(_ context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			applies++
+			if failNext {
+				failNext = false
+				return errors.New("nft: permission denied")
+			}
+			return nil
+		})
+	}()
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return applies
+	}
+
+	// 起動時に1回適用し、変化がなければ再適用しない
+	require.Eventually(t, func() bool { return count() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 1, count())
+
+	// 設定されたら適用し、失敗した場合は再試行する
+	mu.Lock()
+	failNext = true
+	mu.Unlock()
+	_, err := uc.Set(ctx, "example.com", db.OverrideKindExempt, time.Hour)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return count() == 3 }, time.Second, time.Millisecond)
+
+	// 終了されたら適用する
+	require.NoError(t, uc.End(ctx, "example.com"))
+	require.Eventually(t, func() bool { return count() == 4 }, time.Second, time.Millisecond)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
@@ -0,0 +1,303 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
+	"go.uber.org/zap"
+)
+
+// PlanAction is the kind of change a batch run would make for a domain IP
+type PlanAction string
+
+const (
+	// PlanActionReapply re-adds a firewall rule from the database after a reboot
+	PlanActionReapply PlanAction = "reapply"
+	// PlanActionAdd adds a firewall rule and a domain_ips row for a newly resolved IP
+	PlanActionAdd PlanAction = "add"
+	// PlanActionRefresh refreshes updated_at of an IP that was resolved again
+	PlanActionRefresh PlanAction = "refresh"
+	// PlanActionExpire deletes an IP not resolved for longer than IPExpiryDuration together with its rule
+	PlanActionExpire PlanAction = "expire"
+	// PlanActionRestore re-adds a rule for an IP in the database that is missing from the firewall
+	PlanActionRestore PlanAction = "restore"
+	// PlanActionRemove removes a rule created by this service whose IP is no longer in the database
+	PlanActionRemove PlanAction = "remove"
+	// PlanActionUpdate replaces a rule whose block action differs from its domain's action
+	PlanActionUpdate PlanAction = "update"
+	// PlanActionApplyOp applies the firewall operations the database queued for an IP.
+	// BlockAction is the action its rule gets, empty when the rule is removed.
+	PlanActionApplyOp PlanAction = "apply-op"
+	// PlanActionEndOverride deletes an expired override of a domain (IP is empty).
+	// The domain of an expired temporary block is deleted with it, which removes its rules.
+	PlanActionEndOverride PlanAction = "end-override"
+)
+
+// PlanChange is a single change a batch run would make
+type PlanChange struct {
+	Action      PlanAction     `json:"action"`
+	Domain      string         `json:"domain"`
+	IP          string         `json:"ip"`
+	BlockAction db.BlockAction `json:"block_action,omitempty"` // 追加されるルールのaction(refresh, expire, removeでは空)
+}
+
+// PlanFailure records a domain whose resolution failed while planning
+type PlanFailure struct {
+	Domain string `json:"domain"`
+	Error  string `json:"error"`
+}
+
+// Plan is the full set of database and firewall changes a batch run would make.
+// Changes are ordered in execution order: reapply, apply-op, end-override, add/refresh per domain, expire, then restore/update/remove.
+type Plan struct {
+	Reboot         bool          `json:"reboot"`
+	Changes        []PlanChange  `json:"changes"`
+	Failures       []PlanFailure `json:"failures"`
+	ReconcileError string        `json:"reconcile_error,omitempty"` // firewallの状態を取得できず照合できなかった場合のエラー
+	// Resolver is the other node resolving the domains. The plan then only applies the IPs it recorded.
+	Resolver string `json:"resolver,omitempty"`
+}
+
+// Count returns the number of changes with the given action
+func (p *Plan) Count(action PlanAction) int {
+	n := 0
+	for _, c := range p.Changes {
+		if c.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// Plan resolves all domains and computes the changes ProcessAllDomains would make,
+// without modifying the database, the firewall, the reboot flag or the resolver lease.
+// When another node resolves the domains, only the reconciliation with the IPs it recorded is planned.
+func (uc *DomainBlockerUseCase) Plan(ctx context.Context) (*Plan, error) {
+	plan := &Plan{Changes: []PlanChange{}, Failures: []PlanFailure{}}
+
+	isReboot, err := uc.rebootDetector.IsFirstRunAfterReboot(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check reboot status: %w", err)
+	}
+	plan.Reboot = isReboot
+
+	// firewallの状態を取得できない場合、実行時もキューの操作と照合は失敗するため計画に含めない
+	rules, listErr := uc.firewallManager.ListBlockRules(ctx)
+	if listErr != nil {
+		uc.logger.Warn("Failed to list firewall rules while planning", zap.Error(listErr))
+		plan.ReconcileError = listErr.Error()
+	}
+
+	allIPs, err := uc.domainRepo.GetAllDomainIPs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get all domain IPs: %w", err)
+	}
+	exempt, err := uc.exemptDomains(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// 一時除外中のドメインのIPにはルールを追加しない
+	blockedIPs := withoutExempt(allIPs, exempt)
+	// applyExistingIPBlocksと同様に、スナップショットから復元済みのIPには再適用しない
+	if isReboot && listErr == nil {
+		present := make(map[string]bool, len(rules))
+		for _, rule := range rules {
+			present[rule.IP] = true
+		}
+		for _, domainIP := range blockedIPs {
+			if present[domainIP.IPAddress] {
+				continue
+			}
+			present[domainIP.IPAddress] = true
+			plan.Changes = append(plan.Changes, PlanChange{Action: PlanActionReapply, Domain: domainIP.DomainName, IP: domainIP.IPAddress, BlockAction: domainIP.Action})
+		}
+	}
+
+	if listErr == nil {
+		ops, err := uc.domainRepo.GetPendingFirewallOps(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get pending firewall operations: %w", err)
+		}
+		plan.Changes = append(plan.Changes, planFirewallOps(ops, rules, plan.Changes)...)
+	}
+
+	// leaseを取得せずに確認する。他のnodeが名前解決する場合、そのnodeが記録したIPとの照合のみ行う
+	resolver, holder, err := uc.domainRepo.CheckResolver(ctx)
+	if err != nil {
+		// 実行時はleaseを取得できない場合このnodeが名前解決する
+		uc.logger.Warn("Failed to check resolver lease while planning", zap.Error(err))
+		resolver = true
+	}
+	if !resolver {
+		plan.Resolver = holder
+		if listErr == nil {
+			plan.Changes = append(plan.Changes, planReconcile(blockedIPs, rules, plan.Changes)...)
+		}
+		return plan, nil
+	}
+
+	// 失効したオーバーライドは削除せずに確認する。一時ブロックのドメインは削除されるため名前解決しない
+	expiredOverrides, deletedDomains, err := uc.domainRepo.PreviewExpiredDomainOverrides(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to preview expired domain overrides: %w", err)
+	}
+	for _, o := range expiredOverrides {
+		plan.Changes = append(plan.Changes, PlanChange{Action: PlanActionEndOverride, Domain: o.DomainName})
+	}
+	deleted := make(map[string]bool, len(deletedDomains))
+	for _, name := range deletedDomains {
+		deleted[name] = true
+	}
+	if len(deleted) > 0 {
+		allIPs = slices.DeleteFunc(allIPs, func(domainIP db.DomainIP) bool { return deleted[domainIP.DomainName] })
+		blockedIPs = withoutExempt(allIPs, exempt)
+	}
+
+	domains, err := uc.domainRepo.GetAllDomains(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get all domains: %w", err)
+	}
+
+	existing := make(map[string]map[string]bool, len(domains))
+	for _, domainIP := range allIPs {
+		if existing[domainIP.DomainName] == nil {
+			existing[domainIP.DomainName] = make(map[string]bool)
+		}
+		existing[domainIP.DomainName][domainIP.IPAddress] = true
+	}
+
+	// 今回の実行で再解決されたIPはupdated_atが更新されるため期限切れにならない
+	refreshed := make(map[string]bool)
+	for _, domain := range domains {
+		name := domain.DomainName
+		if exempt[name] || deleted[name] {
+			continue
+		}
+		resolvedIPs, err := uc.discoverAllIPs(ctx, name)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			uc.logger.Warn("Failed to resolve domain while planning", zap.String("domain", name), zap.Error(err))
+			plan.Failures = append(plan.Failures, PlanFailure{Domain: name, Error: err.Error()})
+			continue
+		}
+
+		sort.Strings(resolvedIPs)
+		for _, ip := range resolvedIPs {
+			if existing[name][ip] {
+				plan.Changes = append(plan.Changes, PlanChange{Action: PlanActionRefresh, Domain: name, IP: ip})
+				refreshed[name+"/"+ip] = true
+			} else {
+				plan.Changes = append(plan.Changes, PlanChange{Action: PlanActionAdd, Domain: name, IP: ip, BlockAction: domain.Action})
+			}
+		}
+	}
+
+	cutoff := time.Now().Add(-uc.config.IPExpiryDuration)
+	for _, domainIP := range allIPs {
+		if domainIP.UpdatedAt.Before(cutoff) && !refreshed[domainIP.DomainName+"/"+domainIP.IPAddress] {
+			plan.Changes = append(plan.Changes, PlanChange{Action: PlanActionExpire, Domain: domainIP.DomainName, IP: domainIP.IPAddress})
+		}
+	}
+
+	if listErr != nil {
+		return plan, nil
+	}
+	plan.Changes = append(plan.Changes, planReconcile(blockedIPs, rules, plan.Changes)...)
+
+	return plan, nil
+}
+
+// planFirewallOps returns the changes applyFirewallOps would make for the queued operations ops,
+// given the firewall rules and the changes planned before them. As convergeFirewallOps does, the operations of an IP
+// are applied once with the action of the last of them, and IPs whose rules already match are left out.
+func planFirewallOps(ops []db.FirewallOp, rules []repository.BlockRule, changes []PlanChange) []PlanChange {
+	current := make(map[string][]db.BlockAction, len(rules))
+	for _, rule := range rules {
+		current[rule.IP] = append(current[rule.IP], rule.Action)
+	}
+	for _, c := range changes {
+		if c.Action == PlanActionReapply {
+			current[c.IP] = append(current[c.IP], c.BlockAction)
+		}
+	}
+
+	last := make(map[string]db.FirewallOp, len(ops))
+	var ips []string
+	for _, op := range ops {
+		if _, ok := last[op.IPAddress]; !ok {
+			ips = append(ips, op.IPAddress)
+		}
+		last[op.IPAddress] = op
+	}
+
+	var planned []PlanChange
+	for _, ip := range ips {
+		op := last[ip]
+		var action db.BlockAction
+		if op.Action != nil {
+			action = *op.Action
+		}
+		actions := current[ip]
+		if (action == "" && len(actions) == 0) ||
+			(action != "" && len(actions) > 0 && !slices.ContainsFunc(actions, func(a db.BlockAction) bool { return a != action })) {
+			continue
+		}
+		planned = append(planned, PlanChange{Action: PlanActionApplyOp, Domain: op.DomainName, IP: ip, BlockAction: action})
+	}
+	return planned
+}
+
+// planReconcile simulates the firewall and database state after the planned changes
+// and returns the changes reconcileFirewall would make on top of them.
+func planReconcile(allIPs []db.DomainIP, rules []repository.BlockRule, changes []PlanChange) []PlanChange {
+	after := append([]repository.BlockRule{}, rules...)
+	expired := make(map[string]bool)
+	var added []db.DomainIP
+	for _, c := range changes {
+		switch c.Action {
+		case PlanActionReapply, PlanActionAdd:
+			after = append(after, repository.BlockRule{IP: c.IP, Action: c.BlockAction})
+			if c.Action == PlanActionAdd {
+				added = append(added, db.DomainIP{DomainName: c.Domain, IPAddress: c.IP, Action: c.BlockAction})
+			}
+		case PlanActionApplyOp:
+			// ルールを置き換える。actionが空の場合は削除のみ
+			after = slices.DeleteFunc(after, func(r repository.BlockRule) bool { return r.IP == c.IP })
+			if c.BlockAction != "" {
+				after = append(after, repository.BlockRule{IP: c.IP, Action: c.BlockAction})
+			}
+		case PlanActionExpire:
+			// RemoveBlockRuleはIPの全ルールを削除する
+			after = slices.DeleteFunc(after, func(r repository.BlockRule) bool { return r.IP == c.IP })
+			expired[c.Domain+"/"+c.IP] = true
+		}
+	}
+
+	remaining := make([]db.DomainIP, 0, len(allIPs)+len(added))
+	for _, domainIP := range allIPs {
+		if !expired[domainIP.DomainName+"/"+domainIP.IPAddress] {
+			remaining = append(remaining, domainIP)
+		}
+	}
+	remaining = append(remaining, added...)
+
+	missing, changed, extra := diffFirewall(remaining, after)
+	var reconcile []PlanChange
+	for _, domainIP := range missing {
+		reconcile = append(reconcile, PlanChange{Action: PlanActionRestore, Domain: domainIP.DomainName, IP: domainIP.IPAddress, BlockAction: domainIP.Action})
+	}
+	for _, domainIP := range changed {
+		reconcile = append(reconcile, PlanChange{Action: PlanActionUpdate, Domain: domainIP.DomainName, IP: domainIP.IPAddress, BlockAction: domainIP.Action})
+	}
+	for _, ip := range extra {
+		reconcile = append(reconcile, PlanChange{Action: PlanActionRemove, IP: ip})
+	}
+	return reconcile
+}
@@ -0,0 +1,265 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
+)
+
+func TestDomainBlockerUseCase_Plan(t *testing.T) {
+	now := time.Now()
+	stale := now.Add(-48 * time.Hour)
+	fresh := now.Add(-time.Hour)
+
+	tests := []struct {
+		name         string
+		reboot       bool
+		allIPs       []db.DomainIP
+		rules        []repository.BlockRule
+		resolvedIPs  []string
+		resolveErr   error
+		wantChanges  []PlanChange
+		wantFailures int
+	}{
+		{
+			name: "new, refreshed and expired IPs",
+			allIPs: []db.DomainIP{
+				{DomainName: "example.com", IPAddress: "1.1.1.1", UpdatedAt: fresh},
+				{DomainName: "example.com", IPAddress: "3.3.3.3", UpdatedAt: stale},
+			},
+			rules:       dropRules("1.1.1.1", "3.3.3.3"),
+			resolvedIPs: []string{"2.2.2.2", "1.1.1.1"},
+			wantChanges: []PlanChange{
+				{Action: PlanActionRefresh, Domain: "example.com", IP: "1.1.1.1"},
+				{Action: PlanActionAdd, Domain: "example.com", IP: "2.2.2.2", BlockAction: db.BlockActionDrop},
+				{Action: PlanActionExpire, Domain: "example.com", IP: "3.3.3.3"},
+			},
+		},
+		{
+			name:   "reboot re-applies existing IPs and stale IPs resolved again do not expire",
+			reboot: true,
+			allIPs: []db.DomainIP{
+				{DomainName: "example.com", IPAddress: "1.1.1.1", UpdatedAt: stale},
+			},
+			resolvedIPs: []string{"1.1.1.1"},
+			wantChanges: []PlanChange{
+				{Action: PlanActionReapply, Domain: "example.com", IP: "1.1.1.1", BlockAction: db.BlockActionDrop},
+				{Action: PlanActionRefresh, Domain: "example.com", IP: "1.1.1.1"},
+			},
+		},
+		{
+			name:   "reboot does not re-apply IPs whose rules were restored from the snapshot",
+			reboot: true,
+			allIPs: []db.DomainIP{
+				{DomainName: "example.com", IPAddress: "1.1.1.1", UpdatedAt: fresh},
+				{DomainName: "example.com", IPAddress: "2.2.2.2", UpdatedAt: fresh},
+				{DomainName: "example.org", IPAddress: "2.2.2.2", UpdatedAt: fresh},
+			},
+			rules:       dropRules("1.1.1.1"),
+			resolvedIPs: []string{"1.1.1.1", "2.2.2.2"},
+			wantChanges: []PlanChange{
+				{Action: PlanActionReapply, Domain: "example.com", IP: "2.2.2.2", BlockAction: db.BlockActionDrop},
+				{Action: PlanActionRefresh, Domain: "example.com", IP: "1.1.1.1"},
+				{Action: PlanActionRefresh, Domain: "example.com", IP: "2.2.2.2"},
+			},
+		},
+		{
+			name: "resolution failure is reported and existing IPs may expire",
+			allIPs: []db.DomainIP{
+				{DomainName: "example.com", IPAddress: "1.1.1.1", UpdatedAt: stale},
+			},
+			rules:      dropRules("1.1.1.1"),
+			resolveErr: errors.New("SERVFAIL"),
+			wantChanges: []PlanChange{
+				{Action: PlanActionExpire, Domain: "example.com", IP: "1.1.1.1"},
+			},
+			wantFailures: 1,
+		},
+		{
+			name: "rules missing from or unknown to the database are reconciled",
+			allIPs: []db.DomainIP{
+				{DomainName: "example.com", IPAddress: "1.1.1.1", UpdatedAt: fresh},
+			},
+			rules:       dropRules("9.9.9.9"),
+			resolvedIPs: []string{"1.1.1.1"},
+			wantChanges: []PlanChange{
+				{Action: PlanActionRefresh, Domain: "example.com", IP: "1.1.1.1"},
+				{Action: PlanActionRestore, Domain: "example.com", IP: "1.1.1.1", BlockAction: db.BlockActionDrop},
+				{Action: PlanActionRemove, IP: "9.9.9.9"},
+			},
+		},
+		{
+			name: "rules with another action than their domain are updated",
+			allIPs: []db.DomainIP{
+				{DomainName: "example.com", IPAddress: "1.1.1.1", Action: db.BlockActionLog, UpdatedAt: fresh},
+			},
+			rules:       dropRules("1.1.1.1"),
+			resolvedIPs: []string{"1.1.1.1"},
+			wantChanges: []PlanChange{
+				{Action: PlanActionRefresh, Domain: "example.com", IP: "1.1.1.1"},
+				{Action: PlanActionUpdate, Domain: "example.com", IP: "1.1.1.1", BlockAction: db.BlockActionLog},
+			},
+		},
+		{
+			name: "expiring an IP shared with another domain restores its rule",
+			allIPs: []db.DomainIP{
+				{DomainName: "example.com", IPAddress: "1.1.1.1", UpdatedAt: stale},
+				{DomainName: "example.org", IPAddress: "1.1.1.1", UpdatedAt: fresh},
+			},
+			rules:      dropRules("1.1.1.1"),
+			resolveErr: errors.New("SERVFAIL"),
+			wantChanges: []PlanChange{
+				{Action: PlanActionExpire, Domain: "example.com", IP: "1.1.1.1"},
+				{Action: PlanActionRestore, Domain: "example.org", IP: "1.1.1.1", BlockAction: db.BlockActionDrop},
+			},
+			wantFailures: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockDomainRepo{
+				domains: []db.Domain{{DomainName: "example.com"}},
+				allIPs:  tt.allIPs,
+			}
+			fw := &mockFirewallManager{rules: tt.rules}
+			dns := &mockDNSResolver{ips: tt.resolvedIPs, err: tt.resolveErr}
+			uc := newTestUseCase(repo, fw, dns, &mockRebootDetector{isReboot: tt.reboot}, defaultConfig())
+
+			plan, err := uc.Plan(context.Background())
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.reboot, plan.Reboot)
+			assert.Equal(t, tt.wantChanges, plan.Changes)
+			assert.Len(t, plan.Failures, tt.wantFailures)
+
+			// Planning must not touch the firewall or the database
+			assert.Empty(t, fw.addedRules)
+			assert.Empty(t, fw.removedRules)
+			assert.Empty(t, repo.updatedIPs)
+		})
+	}
+}
+
+func TestDomainBlockerUseCase_Plan_reconcileError(t *testing.T) {
+	repo := &mockDomainRepo{domains: []db.Domain{{DomainName: "example.com"}}}
+	fw := &mockFirewallManager{listErr: errors.New("ipset: permission denied")}
+	dns := &mockDNSResolver{ips: []string{"1.1.1.1"}}
+	uc := newTestUseCase(repo, fw, dns, &mockRebootDetector{}, defaultConfig())
+
+	plan, err := uc.Plan(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, []PlanChange{{Action: PlanActionAdd, Domain: "example.com", IP: "1.1.1.1", BlockAction: db.BlockActionDrop}}, plan.Changes)
+	assert.Equal(t, "ipset: permission denied", plan.ReconcileError)
+}
+
+func TestDomainBlockerUseCase_Plan_expiredOverrides(t *testing.T) {
+	fresh := time.Now().Add(-time.Hour)
+	repo := &mockDomainRepo{
+		domains: []db.Domain{{DomainName: "example.com"}, {DomainName: "temp.example", Manual: true}},
+		allIPs: []db.DomainIP{
+			{DomainName: "example.com", IPAddress: "1.1.1.1", UpdatedAt: fresh},
+			{DomainName: "temp.example", IPAddress: "2.2.2.2", UpdatedAt: fresh},
+		},
+		expiredOverrides: []db.DomainOverride{
+			{DomainName: "temp.example", Kind: db.OverrideKindBlock},
+			{DomainName: "example.com", Kind: db.OverrideKindExempt},
+		},
+		expiredDomains: []string{"temp.example"},
+	}
+	fw := &mockFirewallManager{rules: dropRules("2.2.2.2")}
+	dns := &mockDNSResolver{ips: []string{"1.1.1.1"}}
+	uc := newTestUseCase(repo, fw, dns, &mockRebootDetector{}, defaultConfig())
+
+	plan, err := uc.Plan(context.Background())
+	require.NoError(t, err)
+
+	// 除外が終わったドメインは名前解決され、一時ブロックが終わったドメインのルールは削除される
+	assert.Equal(t, []PlanChange{
+		{Action: PlanActionEndOverride, Domain: "temp.example"},
+		{Action: PlanActionEndOverride, Domain: "example.com"},
+		{Action: PlanActionRefresh, Domain: "example.com", IP: "1.1.1.1"},
+		{Action: PlanActionRestore, Domain: "example.com", IP: "1.1.1.1", BlockAction: db.BlockActionDrop},
+		{Action: PlanActionRemove, IP: "2.2.2.2"},
+	}, plan.Changes)
+
+	// オーバーライドは失効させない
+	assert.Len(t, repo.expiredOverrides, 2)
+	assert.Empty(t, fw.removedRules)
+}
+
+func TestDomainBlockerUseCase_Plan_pendingFirewallOps(t *testing.T) {
+	fresh := time.Now().Add(-time.Hour)
+	reject := db.BlockActionReject
+	drop := db.BlockActionDrop
+	repo := &mockDomainRepo{
+		domains: []db.Domain{{DomainName: "example.com", Action: db.BlockActionReject}},
+		allIPs: []db.DomainIP{
+			{DomainName: "example.com", IPAddress: "1.1.1.1", Action: db.BlockActionReject, UpdatedAt: fresh},
+			{DomainName: "example.com", IPAddress: "3.3.3.3", Action: db.BlockActionReject, UpdatedAt: fresh},
+		},
+	}
+	repo.pendingOps = []db.FirewallOp{
+		{ID: 1, IPAddress: "1.1.1.1", Op: "add", DomainName: "example.com", Action: &drop},
+		{ID: 2, IPAddress: "1.1.1.1", Op: "update", DomainName: "example.com", Action: &reject},
+		{ID: 3, IPAddress: "2.2.2.2", Op: "remove", DomainName: "example.org"},
+		{ID: 4, IPAddress: "3.3.3.3", Op: "add", DomainName: "example.com", Action: &reject},
+		{ID: 5, IPAddress: "4.4.4.4", Op: "remove", DomainName: "example.org"},
+	}
+	fw := &mockFirewallManager{rules: []repository.BlockRule{
+		{IP: "1.1.1.1", Action: db.BlockActionDrop},
+		{IP: "2.2.2.2", Action: db.BlockActionDrop},
+		{IP: "3.3.3.3", Action: db.BlockActionReject},
+	}}
+	dns := &mockDNSResolver{ips: []string{"1.1.1.1", "3.3.3.3"}}
+	uc := newTestUseCase(repo, fw, dns, &mockRebootDetector{}, defaultConfig())
+
+	plan, err := uc.Plan(context.Background())
+	require.NoError(t, err)
+
+	// 同じIPの操作は最後の操作のactionで1回適用され、既にルールが一致するIPは含めない
+	assert.Equal(t, []PlanChange{
+		{Action: PlanActionApplyOp, Domain: "example.com", IP: "1.1.1.1", BlockAction: db.BlockActionReject},
+		{Action: PlanActionApplyOp, Domain: "example.org", IP: "2.2.2.2"},
+		{Action: PlanActionRefresh, Domain: "example.com", IP: "1.1.1.1"},
+		{Action: PlanActionRefresh, Domain: "example.com", IP: "3.3.3.3"},
+	}, plan.Changes)
+
+	// キューの操作は取得しない
+	assert.Len(t, repo.pendingOps, 5)
+	assert.Empty(t, fw.addedRules)
+	assert.Empty(t, fw.removedRules)
+}
+
+func TestDomainBlockerUseCase_Plan_otherResolver(t *testing.T) {
+	fresh := time.Now().Add(-time.Hour)
+	repo := &mockDomainRepo{
+		domains: []db.Domain{{DomainName: "example.com"}},
+		allIPs: []db.DomainIP{
+			{DomainName: "example.com", IPAddress: "1.1.1.1", UpdatedAt: fresh},
+		},
+		expiredOverrides: []db.DomainOverride{{DomainName: "example.com", Kind: db.OverrideKindExempt}},
+	}
+	repo.resolver = "main"
+	fw := &mockFirewallManager{rules: dropRules("9.9.9.9")}
+	dns := &mockDNSResolver{ips: []string{"2.2.2.2"}}
+	uc := newTestUseCase(repo, fw, dns, &mockRebootDetector{}, defaultConfig())
+
+	plan, err := uc.Plan(context.Background())
+	require.NoError(t, err)
+
+	// 名前解決とオーバーライドの失効は担当nodeが行い、このnodeは記録されたIPと照合するのみ
+	assert.Equal(t, "main", plan.Resolver)
+	assert.Equal(t, []PlanChange{
+		{Action: PlanActionRestore, Domain: "example.com", IP: "1.1.1.1", BlockAction: db.BlockActionDrop},
+		{Action: PlanActionRemove, IP: "9.9.9.9"},
+	}, plan.Changes)
+	assert.Empty(t, plan.Failures)
+}
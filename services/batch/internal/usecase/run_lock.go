@@ -0,0 +1,124 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
+	"go.uber.org/zap"
+)
+
+// Run lock modes: what a batch run does when another run holds the lock
+const (
+	RunLockModeExit = "exit" // 実行せずに終了する
+	RunLockModeWait = "wait" // ロックが解放されるまで待つ
+)
+
+// RunLockConfig holds configuration for the run lock
+type RunLockConfig struct {
+	Mode    string        // RunLockModeExit or RunLockModeWait
+	Timeout time.Duration // waitの場合に待つ最大時間(0: 無制限)
+}
+
+// RunLockUseCase keeps batch runs of the timer, the daemon and manual executions from overlapping.
+// It takes the database advisory lock, and falls back to the lock file if the database lock is unavailable.
+type RunLockUseCase struct {
+	locker   repository.RunLocker
+	fallback repository.RunLocker // nil: ロックファイルを使用しない
+	name     string
+	logger   *zap.Logger
+	config   RunLockConfig
+}
+
+// NewRunLockUseCase creates a new instance of RunLockUseCase.
+// name identifies this process (e.g. host and pid) to the runs that find the lock held.
+func NewRunLockUseCase(
+	locker repository.RunLocker,
+	fallback repository.RunLocker,
+	name string,
+	logger *zap.Logger,
+	config RunLockConfig,
+) *RunLockUseCase {
+	return &RunLockUseCase{
+		locker:   locker,
+		fallback: fallback,
+		name:     name,
+		logger:   logger,
+		config:   config,
+	}
+}
+
+// Acquire takes the run lock and returns the function releasing it.
+// When another run holds the lock, it returns an error wrapping db.ErrRunLockHeld that names the holder
+// in exit mode, and waits for the lock in wait mode (the same error is returned if the wait times out).
+func (uc *RunLockUseCase) Acquire(ctx context.Context) (func(), error) {
+	release, err := uc.acquire(ctx, uc.locker)
+	if err == nil || errors.Is(err, db.ErrRunLockHeld) || ctx.Err() != nil || uc.fallback == nil {
+		return release, err
+	}
+	uc.logger.Warn("Failed to take the database run lock, falling back to the lock file", zap.Error(err))
+	return uc.acquire(ctx, uc.fallback)
+}
+
+// Do calls fn while holding the run lock, so that the firewall changes the daemon makes between batch runs
+// (overrides and domain changes) do not overlap with the runs of other processes.
+// fn is not called if the lock cannot be taken, and the error of Acquire is returned.
+func (uc *RunLockUseCase) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	release, err := uc.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return fn(ctx)
+}
+
+func (uc *RunLockUseCase) acquire(ctx context.Context, locker repository.RunLocker) (func(), error) {
+	// application_nameに収まるよう短い形式で取得時刻を付与する
+	holder := fmt.Sprintf("%s since %s", uc.name, time.Now().Format(time.RFC3339))
+	release, err := locker.AcquireRunLock(ctx, holder, false)
+	if errors.Is(err, db.ErrRunLockHeld) {
+		current := uc.holder(ctx, locker)
+		if uc.config.Mode != RunLockModeWait {
+			return nil, fmt.Errorf("%w: %s", err, current)
+		}
+
+		uc.logger.Info("Waiting for another batch run to finish",
+			zap.String("holder", current),
+			zap.Duration("timeout", uc.config.Timeout))
+		waitCtx, cancel := ctx, context.CancelFunc(func() {})
+		if uc.config.Timeout > 0 {
+			waitCtx, cancel = context.WithTimeout(ctx, uc.config.Timeout)
+		}
+		defer cancel()
+		release, err = locker.AcquireRunLock(waitCtx, holder, true)
+		if err != nil && ctx.Err() == nil && waitCtx.Err() != nil {
+			return nil, fmt.Errorf("%w: timed out after %v waiting for %s", db.ErrRunLockHeld, uc.config.Timeout, current)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		// キャンセルされた場合もロックを解放する
+		if err := release(context.WithoutCancel(ctx)); err != nil {
+			uc.logger.Warn("Failed to release run lock", zap.Error(err))
+		}
+	}, nil
+}
+
+// holder describes the run holding the lock for logs and errors
+func (uc *RunLockUseCase) holder(ctx context.Context, locker repository.RunLocker) string {
+	holder, err := locker.RunLockHolder(ctx)
+	if err != nil {
+		uc.logger.Warn("Failed to get run lock holder", zap.Error(err))
+	}
+	if holder == "" {
+		// 確認する間に解放された場合も含む
+		return "unknown holder"
+	}
+	return holder
+}
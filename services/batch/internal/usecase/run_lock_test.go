@@ -0,0 +1,188 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
+	"go.uber.org/zap"
+)
+
+type mockRunLocker struct {
+	holder     string // 他の実行が保持している場合の保持者
+	freedAfter int    // waitの場合、この回数待つと解放される(0: 解放されない)
+	acquireErr error
+	acquired   []string
+	released   int
+}
+
+func (m *mockRunLocker) AcquireRunLock(ctx context.Context, holder string, wait bool) (func(context.Context) error, error) {
+	if m.acquireErr != nil {
+		return nil, m.acquireErr
+	}
+	if m.holder != "" {
+		if !wait {
+			return nil, db.ErrRunLockHeld
+		}
+		if m.freedAfter == 0 {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		m.holder = ""
+	}
+	m.acquired = append(m.acquired, holder)
+	m.holder = holder
+	return func(context.Context) error {
+		m.holder = ""
+		m.released++
+		return nil
+	}, nil
+}
+
+func (m *mockRunLocker) RunLockHolder(context.Context) (string, error) {
+	return m.holder, nil
+}
+
+func TestRunLockUseCase_Acquire(t *testing.T) {
+	tests := []struct {
+		name         string
+		locker       *mockRunLocker
+		fallback     *mockRunLocker
+		config       RunLockConfig
+		wantHeld     bool
+		wantErr      string
+		wantFallback bool
+	}{
+		{
+			name:   "free lock is taken",
+			locker: &mockRunLocker{},
+			config: RunLockConfig{Mode: RunLockModeExit},
+		},
+		{
+			name:     "held lock is reported with the holder in exit mode",
+			locker:   &mockRunLocker{holder: "pi pid=100"},
+			config:   RunLockConfig{Mode: RunLockModeExit},
+			wantHeld: true,
+			wantErr:  "pi pid=100",
+		},
+		{
+			name:   "held lock is waited for in wait mode",
+			locker: &mockRunLocker{holder: "pi pid=100", freedAfter: 1},
+			config: RunLockConfig{Mode: RunLockModeWait},
+		},
+		{
+			name:     "waiting gives up after the timeout",
+			locker:   &mockRunLocker{holder: "pi pid=100"},
+			config:   RunLockConfig{Mode: RunLockModeWait, Timeout: 10 * time.Millisecond},
+			wantHeld: true,
+			wantErr:  "timed out",
+		},
+		{
+			name:         "database failure falls back to the lock file",
+			locker:       &mockRunLocker{acquireErr: errors.New("connection refused")},
+			fallback:     &mockRunLocker{},
+			config:       RunLockConfig{Mode: RunLockModeExit},
+			wantFallback: true,
+		},
+		{
+			name:     "lock file held by another run is reported",
+			locker:   &mockRunLocker{acquireErr: errors.New("connection refused")},
+			fallback: &mockRunLocker{holder: "pi pid=100"},
+			config:   RunLockConfig{Mode: RunLockModeExit},
+			wantHeld: true,
+			wantErr:  "pi pid=100",
+		},
+		{
+			name:    "database failure without a lock file is an error",
+			locker:  &mockRunLocker{acquireErr: errors.New("connection refused")},
+			config:  RunLockConfig{Mode: RunLockModeExit},
+			wantErr: "connection refused",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fallback repository.RunLocker
+			if tt.fallback != nil {
+				fallback = tt.fallback
+			}
+			uc := NewRunLockUseCase(tt.locker, fallback, "pi pid=200", zap.NewNop(), tt.config)
+
+			release, err := uc.Acquire(context.Background())
+
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				assert.Equal(t, tt.wantHeld, errors.Is(err, db.ErrRunLockHeld))
+				assert.Nil(t, release)
+				return
+			}
+			require.NoError(t, err)
+			used := tt.locker
+			if tt.wantFallback {
+				used = tt.fallback
+			}
+			if assert.Len(t, used.acquired, 1) {
+				assert.Contains(t, used.acquired[0], "pi pid=200 since ")
+			}
+			release()
+			assert.Equal(t, 1, used.released)
+		})
+	}
+}
+
+func TestRunLockUseCase_Do(t *testing.T) {
+	locker := &mockRunLocker{}
+	uc := NewRunLockUseCase(locker, nil, "pi pid=200", zap.NewNop(), RunLockConfig{Mode: RunLockModeExit})
+
+	var held string
+	err := uc.Do(context.Background(), func(context.Context) error {
+		held = locker.holder
+		return errors.New("apply failed")
+	})
+	assert.EqualError(t, err, "apply failed")
+	assert.Contains(t, held, "pi pid=200 since ", "fn runs while the lock is held")
+	assert.Equal(t, 1, locker.released)
+}
+
+func TestRunLockUseCase_Do_heldLockBlocksDaemonTasks(t *testing.T) {
+	// 他のプロセスのバッチ実行がロックを保持している間、daemonのオーバーライドとドメイン変更の反映は行わない
+	locker := &mockRunLocker{holder: "pi pid=100"}
+	lock := NewRunLockUseCase(locker, nil, "pi pid=200", zap.NewNop(), RunLockConfig{Mode: RunLockModeExit})
+
+	repo := &mockDomainRepo{
+		domains:          []db.Domain{{DomainName: "example.com"}},
+		expiredOverrides: []db.DomainOverride{{DomainName: "example.com", Kind: db.OverrideKindExempt}},
+	}
+	fw := &mockFirewallManager{}
+	dns := &mockDNSResolver{ips: []string{"1.1.1.1"}}
+	uc := newTestUseCase(repo, fw, dns, &mockRebootDetector{}, defaultConfig())
+
+	err := lock.Do(context.Background(), uc.ApplyOverrides)
+	assert.True(t, errors.Is(err, db.ErrRunLockHeld))
+	err = lock.Do(context.Background(), func(ctx context.Context) error {
+		_, err := uc.ProcessNewDomains(ctx, []string{"example.com"})
+		return err
+	})
+	assert.True(t, errors.Is(err, db.ErrRunLockHeld))
+
+	assert.Len(t, repo.expiredOverrides, 1, "overrides are not expired")
+	assert.Zero(t, fw.prepared)
+	assert.Empty(t, fw.addedRules)
+	assert.Empty(t, repo.pendingOps)
+
+	// ロックが解放された後は反映される
+	locker.holder = ""
+	require.NoError(t, lock.Do(context.Background(), uc.ApplyOverrides))
+	assert.Empty(t, repo.expiredOverrides)
+	require.NoError(t, lock.Do(context.Background(), func(ctx context.Context) error {
+		_, err := uc.ProcessNewDomains(ctx, []string{"example.com"})
+		return err
+	}))
+	assert.Equal(t, []string{"1.1.1.1"}, fw.addedRules)
+}
@@ -0,0 +1,70 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
+	"go.uber.org/zap"
+)
+
+// RunRequestUseCase executes the batch runs requested through the API (web UI)
+type RunRequestUseCase struct {
+	requestRepo  repository.RunRequestRepository
+	logger       *zap.Logger
+	pollInterval time.Duration
+}
+
+// NewRunRequestUseCase creates a new instance of RunRequestUseCase
+func NewRunRequestUseCase(
+	requestRepo repository.RunRequestRepository,
+	logger *zap.Logger,
+	pollInterval time.Duration,
+) *RunRequestUseCase {
+	return &RunRequestUseCase{
+		requestRepo:  requestRepo,
+		logger:       logger,
+		pollInterval: pollInterval,
+	}
+}
+
+// Serve checks for a run request every poll interval and executes it with run until ctx is cancelled.
+// run returns the ID of the recorded batch run, or 0 if it could not be recorded.
+func (uc *RunRequestUseCase) Serve(ctx context.Context, run func(ctx context.Context) int64) error {
+	// 前回のdaemonが実行中に停止した場合、そのリクエストは完了扱いにする
+	if abandoned, err := uc.requestRepo.AbandonRunRequests(ctx); err != nil {
+		uc.logger.Error("Failed to abandon interrupted run requests", zap.Error(err))
+	} else if abandoned > 0 {
+		uc.logger.Warn("Abandoned run requests interrupted by a previous daemon", zap.Int64("requests", abandoned))
+	}
+
+	ticker := time.NewTicker(uc.pollInterval)
+	defer ticker.Stop()
+	for {
+		uc.runRequested(ctx, run)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// runRequested executes the waiting run request, if any
+func (uc *RunRequestUseCase) runRequested(ctx context.Context, run func(ctx context.Context) int64) {
+	requestID, err := uc.requestRepo.ClaimRunRequest(ctx)
+	if err != nil {
+		uc.logger.Error("Failed to check run requests", zap.Error(err))
+		return
+	}
+	if requestID == 0 {
+		return
+	}
+
+	uc.logger.Info("Executing requested batch run", zap.Int64("request_id", requestID))
+	runID := run(ctx)
+	// キャンセルされた場合も完了を記録する
+	if err := uc.requestRepo.FinishRunRequest(context.WithoutCancel(ctx), requestID, runID); err != nil {
+		uc.logger.Error("Failed to record run request completion", zap.Int64("request_id", requestID), zap.Error(err))
+	}
+}
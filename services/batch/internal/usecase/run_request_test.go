@@ -0,0 +1,68 @@
+package usecase
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type mockRunRequestRepo struct {
+	mu        sync.Mutex
+	waiting   []int64
+	finished  map[int64]int64
+	abandoned bool
+}
+
+func (m *mockRunRequestRepo) ClaimRunRequest(_ context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.waiting) == 0 {
+		return 0, nil
+	}
+	id := m.waiting[0]
+	m.waiting = m.waiting[1:]
+	return id, nil
+}
+
+func (m *mockRunRequestRepo) FinishRunRequest(_ context.Context, requestID, batchRunID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.finished[requestID] = batchRunID
+	return nil
+}
+
+func (m *mockRunRequestRepo) AbandonRunRequests(_ context.Context) (int64, error) {
+	m.abandoned = true
+	return 0, nil
+}
+
+func TestRunRequestUseCase_Serve(t *testing.T) {
+	repo := &mockRunRequestRepo{waiting: []int64{1, 2}, finished: map[int64]int64{}}
+	uc := NewRunRequestUseCase(repo, zap.NewNop(), 5*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var runs int64
+	done := make(chan error, 1)
+	go func() {
+		done <- uc.Serve(ctx, func(_ context.Context) int64 {
+			runs++
+			return 100 + runs
+		})
+	}()
+
+	require.Eventually(t, func() bool {
+		repo.mu.Lock()
+		defer repo.mu.Unlock()
+		return len(repo.finished) == 2
+	}, time.Second, 5*time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+
+	assert.True(t, repo.abandoned)
+	assert.Equal(t, map[int64]int64{1: 101, 2: 102}, repo.finished)
+}
@@ -0,0 +1,113 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
+	"go.uber.org/zap"
+)
+
+// RuleSnapshotUseCase saves the managed firewall rules to local disk after a batch run and restores them at boot,
+// so that blocking resumes before the database is available. The next batch run reconciles them with the database.
+type RuleSnapshotUseCase struct {
+	store           repository.RuleSnapshotStore
+	firewallManager repository.FirewallManager
+	logger          *zap.Logger
+}
+
+// NewRuleSnapshotUseCase creates a new instance of RuleSnapshotUseCase
+func NewRuleSnapshotUseCase(
+	store repository.RuleSnapshotStore,
+	firewallManager repository.FirewallManager,
+	logger *zap.Logger,
+) *RuleSnapshotUseCase {
+	return &RuleSnapshotUseCase{
+		store:           store,
+		firewallManager: firewallManager,
+		logger:          logger,
+	}
+}
+
+// Save replaces the snapshot with the given rules, listed at the end of a batch run. Does nothing if disabled.
+func (uc *RuleSnapshotUseCase) Save(rules []repository.BlockRule, now time.Time) error {
+	if !uc.store.Enabled() {
+		return nil
+	}
+
+	snapshot := &repository.RuleSnapshot{SavedAt: now, Rules: make([]repository.SnapshotRule, 0, len(rules))}
+	seen := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		// 同じIPに複数のルールがある場合(actionの変更途中など)は最初のルールのみ保存する
+		if seen[rule.IP] {
+			continue
+		}
+		seen[rule.IP] = true
+		snapshot.Rules = append(snapshot.Rules, repository.SnapshotRule{IP: rule.IP, Action: rule.Action})
+	}
+	if err := uc.store.Save(snapshot); err != nil {
+		return fmt.Errorf("failed to save rule snapshot: %w", err)
+	}
+	uc.logger.Debug("Rule snapshot saved", zap.Int("rules", len(snapshot.Rules)))
+	return nil
+}
+
+// Restore adds the rules of the snapshot that are missing from the firewall and returns how many were added.
+// Rules already present are left untouched, so restoring twice does not duplicate them.
+func (uc *RuleSnapshotUseCase) Restore(ctx context.Context) (int, error) {
+	if !uc.store.Enabled() {
+		return 0, errors.New("rule snapshot is disabled (RULES_SNAPSHOT_FILE is empty)")
+	}
+	// allowlist policyのクライアント制限はスナップショットがない場合も作成する
+	if err := uc.firewallManager.PreparePolicy(ctx); err != nil {
+		return 0, fmt.Errorf("failed to prepare firewall policy: %w", err)
+	}
+	snapshot, err := uc.store.Load()
+	if err != nil {
+		return 0, err
+	}
+	if snapshot == nil {
+		uc.logger.Info("No rule snapshot to restore")
+		return 0, nil
+	}
+
+	rules, err := uc.firewallManager.ListBlockRules(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list firewall rules: %w", err)
+	}
+	present := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		present[rule.IP] = true
+	}
+
+	uc.logger.Info("Restoring firewall rules from snapshot",
+		zap.Time("saved_at", snapshot.SavedAt),
+		zap.Int("rules", len(snapshot.Rules)),
+		zap.Int("present", len(rules)))
+
+	var added int
+	var errs []error
+	for _, rule := range snapshot.Rules {
+		if present[rule.IP] {
+			continue
+		}
+		// 不明なactionはブロックを優先してdropで復元する
+		action := rule.Action
+		if _, err := db.ParseBlockAction(string(action)); err != nil {
+			action = db.BlockActionDrop
+		}
+		if err := uc.firewallManager.AddBlockRule(ctx, rule.IP, action); err != nil {
+			uc.logger.Warn("Failed to restore firewall rule", zap.String("ip", rule.IP), zap.Error(err))
+			errs = append(errs, fmt.Errorf("failed to restore rule for %s: %w", rule.IP, err))
+			continue
+		}
+		present[rule.IP] = true
+		added++
+	}
+
+	uc.logger.Info("Restored firewall rules from snapshot", zap.Int("added", added), zap.Int("failed", len(errs)))
+	return added, errors.Join(errs...)
+}
@@ -0,0 +1,134 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tokane888/router-manager-go/pkg/db"
+	"github.com/tokane888/router-manager-go/services/batch/internal/domain/repository"
+	"go.uber.org/zap"
+)
+
+type mockRuleSnapshotStore struct {
+	disabled bool
+	snapshot *repository.RuleSnapshot
+	loadErr  error
+}
+
+func (m *mockRuleSnapshotStore) Enabled() bool { return !m.disabled }
+
+func (m *mockRuleSnapshotStore) Save(snapshot *repository.RuleSnapshot) error {
+	m.snapshot = snapshot
+	return nil
+}
+
+func (m *mockRuleSnapshotStore) Load() (*repository.RuleSnapshot, error) {
+	return m.snapshot, m.loadErr
+}
+
+func TestRuleSnapshotUseCase_Save(t *testing.T) {
+	now := time.Date(2026, 1, 1, 4, 0, 0, 0, time.UTC)
+	store := &mockRuleSnapshotStore{}
+	uc := NewRuleSnapshotUseCase(store, &mockFirewallManager{}, zap.NewNop())
+
+	rules := []repository.BlockRule{
+		{IP: "192.0.2.1", Action: db.BlockActionDrop, Packets: 10},
+		{IP: "192.0.2.2", Action: db.BlockActionLog},
+		{IP: "192.0.2.2", Action: db.BlockActionDrop},
+	}
+	require.NoError(t, uc.Save(rules, now))
+	assert.Equal(t, &repository.RuleSnapshot{
+		SavedAt: now,
+		Rules: []repository.SnapshotRule{
+			{IP: "192.0.2.1", Action: db.BlockActionDrop},
+			{IP: "192.0.2.2", Action: db.BlockActionLog},
+		},
+	}, store.snapshot)
+
+	// 無効な場合は保存しない
+	disabled := &mockRuleSnapshotStore{disabled: true}
+	require.NoError(t, NewRuleSnapshotUseCase(disabled, &mockFirewallManager{}, zap.NewNop()).Save(rules, now))
+	assert.Nil(t, disabled.snapshot)
+}
+
+func TestRuleSnapshotUseCase_Restore(t *testing.T) {
+	snapshot := &repository.RuleSnapshot{Rules: []repository.SnapshotRule{
+		{IP: "192.0.2.1", Action: db.BlockActionDrop},
+		{IP: "192.0.2.2", Action: db.BlockActionReject},
+		{IP: "192.0.2.3", Action: "unknown"},
+	}}
+	tests := []struct {
+		name        string
+		store       *mockRuleSnapshotStore
+		fw          *mockFirewallManager
+		wantAdded   []string
+		wantActions []db.BlockAction
+		wantErr     bool
+		// wantPrepared is whether the firewall policy is prepared, which happens even without a snapshot
+		wantPrepared bool
+	}{
+		{
+			name:         "missing rules are added",
+			store:        &mockRuleSnapshotStore{snapshot: snapshot},
+			fw:           &mockFirewallManager{rules: dropRules("192.0.2.1")},
+			wantAdded:    []string{"192.0.2.2", "192.0.2.3"},
+			wantActions:  []db.BlockAction{db.BlockActionReject, db.BlockActionDrop},
+			wantPrepared: true,
+		},
+		{
+			name:         "no snapshot yet",
+			store:        &mockRuleSnapshotStore{},
+			fw:           &mockFirewallManager{},
+			wantPrepared: true,
+		},
+		{
+			name:         "policy cannot be prepared",
+			store:        &mockRuleSnapshotStore{snapshot: snapshot},
+			fw:           &mockFirewallManager{prepareErr: errors.New("nft error")},
+			wantErr:      true,
+			wantPrepared: true,
+		},
+		{
+			name:    "disabled",
+			store:   &mockRuleSnapshotStore{disabled: true},
+			fw:      &mockFirewallManager{},
+			wantErr: true,
+		},
+		{
+			name:         "unreadable snapshot",
+			store:        &mockRuleSnapshotStore{loadErr: errors.New("unexpected EOF")},
+			fw:           &mockFirewallManager{},
+			wantErr:      true,
+			wantPrepared: true,
+		},
+		{
+			name:         "add failures are returned",
+			store:        &mockRuleSnapshotStore{snapshot: snapshot},
+			fw:           &mockFirewallManager{addErr: errors.New("nft error")},
+			wantErr:      true,
+			wantPrepared: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := NewRuleSnapshotUseCase(tt.store, tt.fw, zap.NewNop())
+
+			added, err := uc.Restore(context.Background())
+
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, len(tt.wantAdded), added)
+			assert.Equal(t, tt.wantAdded, tt.fw.addedRules)
+			assert.Equal(t, tt.wantActions, tt.fw.addedActions)
+			assert.Equal(t, tt.wantPrepared, tt.fw.prepared > 0)
+		})
+	}
+}